@@ -2,7 +2,9 @@ package main
 
 import (
 	"log"
+	"os"
 
+	"github.com/Weruminger/go-ad-admin/internal/app"
 	"github.com/Weruminger/go-ad-admin/internal/config"
 	"github.com/Weruminger/go-ad-admin/internal/web"
 )
@@ -14,6 +16,15 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		os.Exit(app.AuditCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "gdpr" {
+		os.Exit(app.GDPRCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if app.IsChangeCommand(os.Args[1:]) {
+		os.Exit(app.ChangeCommand(os.Args[1:], os.Stdout, os.Stderr))
+	}
 	cfg := *(new(config.Config))
 	log.Printf("go-ad-admin %s (commit=%s, build=%s) on %s", version, commit, buildDate, cfg.ListenAddr)
 	if err := web.ListenAndServe(cfg); err != nil {
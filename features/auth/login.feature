@@ -11,3 +11,14 @@ Feature: Login
     When I submit an invalid password
     Then I get HTTP 401
     And the failed-attempt counter is incremented
+
+  Scenario: Missing CSRF token
+    Given the system is running
+    When I submit valid credentials without a CSRF token
+    Then I get HTTP 400
+
+  Scenario: Lockout after repeated failures
+    Given the system is running
+    When I submit an invalid password 5 times
+    And I submit valid credentials
+    Then I get HTTP 429
@@ -0,0 +1,35 @@
+Feature: DHCP-Leases
+  As an operator
+  I want to see the leases Kea has handed out
+  So that I can tell which client holds which address
+
+  Scenario: Leases auflisten
+    Given Kea has leases:
+      | ip         | mac               | host |
+      | 192.0.2.10 | aa:bb:cc:dd:ee:01 | pc1  |
+      | 192.0.2.11 | aa:bb:cc:dd:ee:02 | pc2  |
+    When I list the leases
+    Then I see 2 leases
+
+  Scenario: Kea antwortet einmal mit HTTP 500
+    Given Kea has leases:
+      | ip         | mac               | host |
+      | 192.0.2.10 | aa:bb:cc:dd:ee:01 | pc1  |
+    And Kea fails the next 1 "lease4-get-all" calls with HTTP 500
+    When I list the leases
+    Then I see 1 leases
+
+  Scenario: Kea bleibt nicht erreichbar
+    Given Kea fails the next 4 "lease4-get-all" calls with HTTP 500
+    When I list the leases
+    Then I receive an error code "UNAVAILABLE"
+
+  Scenario: Kea antwortet nicht
+    Given Kea fails the next 4 "lease4-get-all" calls with a timeout
+    When I list the leases
+    Then I receive an error code "TIMEOUT"
+
+  Scenario: Kea meldet einen Fehler
+    Given Kea fails the next 1 "lease4-get-all" calls with result 1
+    When I list the leases
+    Then I receive an error code "INVALID_INPUT"
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Weruminger/go-ad-admin/internal/audit"
+	. "github.com/Weruminger/go-ad-admin/internal/config"
+	"github.com/spf13/pflag"
+)
+
+// AuditCommand führt "go-ad-admin audit <sub>" aus und liefert den
+// Exit-Code: 0 = in Ordnung, 1 = Log manipuliert/unlesbar, 2 = Aufruffehler.
+func AuditCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "verify" {
+		_, _ = fmt.Fprintln(stderr, "usage: go-ad-admin audit verify [--config file.yaml] [--file audit.jsonl] [--key kind:base64]")
+		return 2
+	}
+	fs := pflag.NewFlagSet("audit verify", pflag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "", "YAML config file path")
+	file := fs.String("file", "", "audit log (default: auditFile of the config)")
+	key := fs.String("key", "", "verification key (default: auditKey of the config); ed25519-pub:<base64> suffices")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	// Defaults/Env, dann YAML, dann Flags – wie beim Serverstart
+	cfg := NewDefaultConfig()
+	if *configPath != "" {
+		if err := cfg.LoadYAML(*configPath); err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return 2
+		}
+	}
+	if *file == "" {
+		*file = cfg.AuditFile
+	}
+	if *key == "" {
+		*key = cfg.AuditKey
+	}
+	signer, err := audit.ParseKey(*key)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	if _, err := os.Stat(*file); err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 1
+	}
+	rep, err := audit.VerifyHistory(*file, signer)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s: BROKEN after %d entries: %v\n", *file, rep.Entries, err)
+		return 1
+	}
+	signed := "unsigned"
+	if signer != nil {
+		signed = "signatures ok"
+	}
+	_, _ = fmt.Fprintf(stdout, "%s: OK, %d entries (seq %d-%d, %s, %d legacy, %d redacted, %d segments removed by retention), last hash %s\n",
+		*file, rep.Entries, rep.FirstSeq, rep.LastSeq, signed, rep.Legacy, rep.Redacted, rep.Removed, rep.LastHash)
+	return 0
+}
@@ -0,0 +1,42 @@
+package app
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/audit"
+)
+
+func TestAuditCommand_Verify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	w := &audit.Writer{Path: path}
+	for _, op := range []string{"auth.login", "user.create", "auth.logout"} {
+		if err := w.Append(audit.Entry{Op: op, User: "anna"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	var out, errOut bytes.Buffer
+	if code := AuditCommand([]string{"verify", "--file", path}, &out, &errOut); code != 0 || !strings.Contains(out.String(), "OK, 3 entries") {
+		t.Fatalf("intact: %d %q %q", code, out.String(), errOut.String())
+	}
+
+	raw, _ := os.ReadFile(path)
+	lines := strings.SplitAfter(string(raw), "\n")
+	if err := os.WriteFile(path, []byte(lines[0]+lines[2]), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	errOut.Reset()
+	if code := AuditCommand([]string{"verify", "--file", path}, &out, &errOut); code != 1 || !strings.Contains(errOut.String(), "audit.jsonl:2 (seq 3): gap") {
+		t.Fatalf("gap: %d %q", code, errOut.String())
+	}
+
+	if code := AuditCommand([]string{"rotate"}, &out, &errOut); code != 2 {
+		t.Fatalf("unknown subcommand: %d", code)
+	}
+}
@@ -0,0 +1,174 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/Weruminger/go-ad-admin/internal/audit"
+	"github.com/Weruminger/go-ad-admin/internal/change"
+	. "github.com/Weruminger/go-ad-admin/internal/config"
+	"github.com/Weruminger/go-ad-admin/internal/kea"
+	"github.com/Weruminger/go-ad-admin/internal/ldap"
+	"github.com/Weruminger/go-ad-admin/internal/web"
+	"github.com/spf13/pflag"
+)
+
+// IsChangeCommand meldet, ob args (ohne Programmnamen) mit dem ersten Wort
+// einer Schreiboperation beginnen, z.B. "users".
+func IsChangeCommand(args []string) bool {
+	for _, a := range web.Actions() {
+		if len(args) > 0 && strings.Fields(commandName(a))[0] == args[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangeCommand führt eine Schreiboperation der Weboberfläche aus: der Pfad
+// /users/disable wird zu "go-ad-admin users disable", die Formularfelder zu
+// Flags. Mit --dry-run wird nur geprüft und ausgegeben, welche LDAP-
+// Operationen, Kea-Kommandos und Audit-Einträge entstünden.
+// Exit-Code: 0 = ausgeführt, 1 = Operation abgelehnt/fehlgeschlagen,
+// 2 = Aufruffehler.
+func ChangeCommand(args []string, stdout, stderr io.Writer) int {
+	a, ok := findAction(args)
+	if !ok {
+		_, _ = fmt.Fprintln(stderr, "usage: go-ad-admin <command> [--config file.yaml] [--dry-run] [flags]\n\ncommands:")
+		for _, a := range web.Actions() {
+			_, _ = fmt.Fprintf(stderr, "  %-28s %s\n", commandName(a), a.Title)
+		}
+		return 2
+	}
+	name := commandName(a)
+	fs := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "", "YAML config file path")
+	dryRun := fs.Bool("dry-run", false, "nur prüfen und anzeigen, nichts ändern")
+	strs := map[string]*string{}
+	bools := map[string]*bool{}
+	for _, f := range a.Fields {
+		if f.Type == "checkbox" {
+			bools[f.Name] = fs.Bool(f.Name, false, f.Label)
+		} else {
+			strs[f.Name] = fs.String(f.Name, "", f.Label)
+		}
+	}
+	if err := fs.Parse(args[len(strings.Fields(name)):]); err != nil {
+		return 2
+	}
+	form := url.Values{}
+	for k, v := range strs {
+		form.Set(k, *v)
+	}
+	for k, v := range bools {
+		if *v {
+			form.Set(k, "1")
+		}
+	}
+
+	// Defaults/Env, dann YAML – wie beim Serverstart
+	cfg := NewDefaultConfig()
+	if *configPath != "" {
+		if err := cfg.LoadYAML(*configPath); err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return 2
+		}
+	}
+	var dir ldap.Client
+	var dhcp *kea.Client
+	if a.DHCP {
+		c, err := kea.NewClient(*cfg)
+		if err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return 2
+		}
+		dhcp = c
+	} else {
+		c, err := ldap.NewConn(*cfg)
+		if err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return 2
+		}
+		defer c.Close()
+		dir = c
+	}
+
+	ctx := context.Background()
+	operator := cliUser()
+	if *dryRun {
+		pv, err := web.DryRun(ctx, a, form, dir, dhcp)
+		if err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return 1
+		}
+		writePreview(stdout, pv, operator)
+		return 0
+	}
+
+	aw, err := web.OpenAudit(*cfg)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer aw.Close()
+	rec := change.RecorderFunc(func(r change.Record) error {
+		return aw.Append(cliEntry(r, operator))
+	})
+	if err := web.Exec(ctx, a, form, dir, dhcp, rec); err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 1
+	}
+	_, _ = fmt.Fprintf(stdout, "%s: ok\n", name)
+	return 0
+}
+
+// findAction sucht die Aktion, deren Pfad die ersten Argumente bilden.
+func findAction(args []string) (web.Action, bool) {
+	for _, a := range web.Actions() {
+		words := strings.Fields(commandName(a))
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == strings.Join(words, " ") {
+			return a, true
+		}
+	}
+	return web.Action{}, false
+}
+
+// commandName: /dhcp/reservations/add → "dhcp reservations add".
+func commandName(a web.Action) string {
+	return strings.ReplaceAll(strings.Trim(a.Path, "/"), "/", " ")
+}
+
+// cliUser ist der im Audit-Log vermerkte Bediener: der Benutzer des
+// Betriebssystems.
+func cliUser() string {
+	if u, err := user.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
+
+func cliEntry(r change.Record, operator string) audit.Entry {
+	return audit.Entry{TS: time.Now().UTC(), Op: r.Op(), User: operator, Data: r.Fields()}
+}
+
+// writePreview gibt eine Vorschau in drei Abschnitten aus.
+func writePreview(w io.Writer, pv web.Preview, operator string) {
+	_, _ = fmt.Fprintln(w, "# dry run – nothing was changed")
+	if pv.LDIF != "" {
+		_, _ = fmt.Fprintf(w, "\n# LDAP\n%s", pv.LDIF)
+	}
+	if pv.Commands != "" {
+		_, _ = fmt.Fprintf(w, "\n# Kea\n%s\n", pv.Commands)
+	}
+	_, _ = fmt.Fprintln(w, "\n# Audit")
+	for _, r := range pv.Records {
+		b, _ := json.Marshal(cliEntry(r, operator))
+		_, _ = fmt.Fprintln(w, string(b))
+	}
+}
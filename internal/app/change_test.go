@@ -0,0 +1,51 @@
+package app
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/ldap/ldaptest"
+)
+
+func TestChangeCommand(t *testing.T) {
+	srv := ldaptest.NewServer("DC=example,DC=com")
+	defer srv.Close()
+	if err := srv.SeedTable([][]string{{"uid", "displayName"}, {"anna", "Anna"}}); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	cfg := srv.Config()
+	cfg.AuditFile = filepath.Join(dir, "audit.jsonl")
+	conf := filepath.Join(dir, "config.yaml")
+	if err := cfg.SaveYAML(conf); err != nil {
+		t.Fatal(err)
+	}
+	anna := "CN=Anna," + srv.UsersDN()
+
+	var out, errOut bytes.Buffer
+	code := ChangeCommand([]string{"users", "disable", "--config", conf, "--dn", anna, "--dry-run"}, &out, &errOut)
+	if code != 0 || !strings.Contains(out.String(), "changetype: modify") || !strings.Contains(out.String(), `"op":"aduser.disable"`) {
+		t.Fatalf("dry run: %d %q %q", code, out.String(), errOut.String())
+	}
+	if e, _ := srv.Get(anna); e.First("userAccountControl") != "512" {
+		t.Fatalf("dry run wrote: uac %s", e.First("userAccountControl"))
+	}
+
+	out.Reset()
+	if code := ChangeCommand([]string{"users", "disable", "--config", conf, "--dn", anna}, &out, &errOut); code != 0 {
+		t.Fatalf("run: %d %q", code, errOut.String())
+	}
+	if e, _ := srv.Get(anna); e.First("userAccountControl") != "514" {
+		t.Fatalf("not disabled: uac %s", e.First("userAccountControl"))
+	}
+	var verify bytes.Buffer
+	if code := AuditCommand([]string{"verify", "--file", cfg.AuditFile}, &verify, &errOut); code != 0 || !strings.Contains(verify.String(), "OK, 1 entries") {
+		t.Fatalf("audit: %d %q %q", code, verify.String(), errOut.String())
+	}
+
+	if code := ChangeCommand([]string{"users", "rename"}, &out, &errOut); code != 2 || !strings.Contains(errOut.String(), "dhcp reservations add") {
+		t.Fatalf("unknown command: %d %q", code, errOut.String())
+	}
+}
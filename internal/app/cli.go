@@ -44,6 +44,10 @@ type cliFlags struct {
 	LdapURL      string
 	LdapBaseDN   string
 	privacyLevel string
+	ldapBindDN   string
+	ldapCAFile   string
+	ldapStartTLS bool
+	keaURL       string
 }
 
 func parseFlags(args []string) (*cliFlags, error) {
@@ -67,6 +71,10 @@ func parseFlags(args []string) (*cliFlags, error) {
 	fs.StringVar(&f.LdapURL, "ldap-url", "", "url to ldap server")
 	fs.StringVar(&f.LdapBaseDN, "ldap-base-dn", "", "base dn for ldap server")
 	fs.StringVar(&f.privacyLevel, "privacy", "", "privacy low or high")
+	fs.StringVar(&f.ldapBindDN, "ldap-bind-dn", "", "service account DN for LDAP bind")
+	fs.StringVar(&f.ldapCAFile, "ldap-ca-file", "", "PEM CA bundle for LDAPS/StartTLS")
+	fs.BoolVar(&f.ldapStartTLS, "ldap-starttls", false, "upgrade ldap:// connections via StartTLS")
+	fs.StringVar(&f.keaURL, "kea-url", "", "url of the Kea Control Agent")
 
 	// pflag schluckt stdlib flags:
 	fs.AddGoFlagSet(flag.CommandLine)
@@ -98,6 +106,10 @@ Flags:
       --ldap-url string url to ldap server
       --ldap-base-dn    string base dn for ldap server
       --privacy string  privacy low or high
+      --ldap-bind-dn    string service account DN for LDAP bind
+      --ldap-ca-file    string PEM CA bundle for LDAPS/StartTLS
+      --ldap-starttls   upgrade ldap:// connections via StartTLS
+      --kea-url string  url of the Kea Control Agent
 `, VersionBanner())
 }
 
@@ -163,6 +175,18 @@ func (a *App) Initial() (bool, error) {
 	if f.privacyLevel != "" {
 		a.Cfg.PrivacyLevel = f.privacyLevel
 	}
+	if f.ldapBindDN != "" {
+		a.Cfg.LDAPBindDN = f.ldapBindDN
+	}
+	if f.ldapCAFile != "" {
+		a.Cfg.LDAPCAFile = f.ldapCAFile
+	}
+	if f.ldapStartTLS {
+		a.Cfg.LDAPStartTLS = true
+	}
+	if f.keaURL != "" {
+		a.Cfg.KeaURL = f.keaURL
+	}
 	if f.configPath != "" {
 		a.Cfg.ConfigFile = f.configPath
 	}
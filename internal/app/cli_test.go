@@ -34,6 +34,9 @@ func TestParseFlags_AllFlags(t *testing.T) {
 		"--ldap-url", "ldap://localhost",
 		"--ldap-base-dn", "dc=test,dc=lan",
 		"--privacy", "high",
+		"--ldap-bind-dn", "cn=svc,dc=test,dc=lan",
+		"--ldap-ca-file", "ca.pem",
+		"--ldap-starttls",
 	}
 
 	f, err := parseFlags(args)
@@ -77,6 +80,15 @@ func TestParseFlags_AllFlags(t *testing.T) {
 	if f.privacyLevel != "high" {
 		t.Errorf("privacyLevel: got %q, want %q", f.privacyLevel, "high")
 	}
+	if f.ldapBindDN != "cn=svc,dc=test,dc=lan" {
+		t.Errorf("ldapBindDN: got %q, want %q", f.ldapBindDN, "cn=svc,dc=test,dc=lan")
+	}
+	if f.ldapCAFile != "ca.pem" {
+		t.Errorf("ldapCAFile: got %q, want %q", f.ldapCAFile, "ca.pem")
+	}
+	if !f.ldapStartTLS {
+		t.Error("ldapStartTLS: want true")
+	}
 }
 
 func TestParseFlags_InvalidFlag(t *testing.T) {
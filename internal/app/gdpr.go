@@ -0,0 +1,108 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Weruminger/go-ad-admin/internal/audit"
+	. "github.com/Weruminger/go-ad-admin/internal/config"
+	"github.com/Weruminger/go-ad-admin/internal/gdpr"
+	"github.com/Weruminger/go-ad-admin/internal/kea"
+	"github.com/Weruminger/go-ad-admin/internal/ldap"
+	"github.com/Weruminger/go-ad-admin/internal/privacy"
+	"github.com/Weruminger/go-ad-admin/internal/web"
+	"github.com/spf13/pflag"
+)
+
+// GDPRCommand führt "go-ad-admin gdpr report" aus: die Auskunft über ein
+// Konto, eine UPN oder eine MAC als signiertes JSON (oder HTML) auf stdout,
+// mit --erase werden danach die Audit-Einträge der Person pseudonymisiert.
+// Exit-Code: 0 = in Ordnung, 1 = Auskunft/Löschung fehlgeschlagen,
+// 2 = Aufruffehler.
+func GDPRCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "report" {
+		_, _ = fmt.Fprintln(stderr, "usage: go-ad-admin gdpr report --subject <sam|upn|mac> [--config file.yaml] [--html] [--erase]")
+		return 2
+	}
+	fs := pflag.NewFlagSet("gdpr report", pflag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "", "YAML config file path")
+	subject := fs.String("subject", "", "account name, UPN or MAC address")
+	html := fs.Bool("html", false, "HTML instead of JSON")
+	erase := fs.Bool("erase", false, "pseudonymise the subject's entries in the audit log")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *subject == "" {
+		_, _ = fmt.Fprintln(stderr, "--subject is required")
+		return 2
+	}
+
+	// Defaults/Env, dann YAML – wie beim Serverstart
+	cfg := NewDefaultConfig()
+	if *configPath != "" {
+		if err := cfg.LoadYAML(*configPath); err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return 2
+		}
+	}
+	key, err := audit.ParseKey(cfg.AuditKey)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 2
+	}
+	dir, err := ldap.NewConn(*cfg)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 2
+	}
+	defer dir.Close()
+	dhcp, err := kea.NewClient(*cfg)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	rep, err := gdpr.Collect(context.Background(), gdpr.Sources{Dir: dir, DHCP: dhcp, Audit: cfg.AuditFile}, *subject)
+	if err == nil {
+		err = rep.Sign(key)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	// auch die Auskunft selbst gehört ins Audit-Log, die Person nur als Token
+	aw, err := web.OpenAudit(*cfg)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer aw.Close()
+	p := privacy.FromConfig(*cfg)
+	operator := cliUser()
+	if err := aw.Append(audit.Entry{TS: time.Now().UTC(), Op: "privacy.report", User: operator, Data: map[string]any{"subject": p.Token(rep.Subject)}}); err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if *html {
+		err = rep.WriteHTML(stdout)
+	} else {
+		err = rep.WriteJSON(stdout)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if *erase {
+		seqs, err := gdpr.Erase(aw, p, rep, audit.Entry{TS: time.Now().UTC(), User: operator})
+		if err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return 1
+		}
+		_, _ = fmt.Fprintf(stderr, "%d audit entries pseudonymised\n", len(seqs))
+	}
+	return 0
+}
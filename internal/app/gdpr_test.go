@@ -0,0 +1,65 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/audit"
+	"github.com/Weruminger/go-ad-admin/internal/gdpr"
+	"github.com/Weruminger/go-ad-admin/internal/kea/keatest"
+	"github.com/Weruminger/go-ad-admin/internal/ldap/ldaptest"
+)
+
+func TestGDPRCommand(t *testing.T) {
+	srv := ldaptest.NewServer("DC=example,DC=com")
+	defer srv.Close()
+	if err := srv.SeedTable([][]string{{"uid", "displayName"}, {"anna", "Anna"}}); err != nil {
+		t.Fatal(err)
+	}
+	ks := keatest.NewServer()
+	defer ks.Close()
+	dir := t.TempDir()
+	cfg := srv.Config()
+	cfg.KeaURL, cfg.KeaToken = ks.URL, ks.Token
+	cfg.AuditFile = filepath.Join(dir, "audit.jsonl")
+	cfg.PrivacyKey = "test"
+	conf := filepath.Join(dir, "config.yaml")
+	if err := cfg.SaveYAML(conf); err != nil {
+		t.Fatal(err)
+	}
+	w := &audit.Writer{Path: cfg.AuditFile}
+	for _, u := range []string{"anna", "bob"} {
+		if err := w.Append(audit.Entry{Op: "auth.login", User: u}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	var out, errOut bytes.Buffer
+	if code := GDPRCommand([]string{"report", "--config", conf, "--subject", "anna", "--erase"}, &out, &errOut); code != 0 {
+		t.Fatalf("report: %d %q", code, errOut.String())
+	}
+	var rep gdpr.Report
+	if err := json.Unmarshal(out.Bytes(), &rep); err != nil || len(rep.Users) != 1 || len(rep.Audit) != 1 || rep.Audit[0].User != "anna" {
+		t.Fatalf("report: %s %v", out.String(), err)
+	}
+	if !strings.Contains(errOut.String(), "1 audit entries pseudonymised") {
+		t.Fatalf("erase: %q", errOut.String())
+	}
+	var verify bytes.Buffer
+	if code := AuditCommand([]string{"verify", "--file", cfg.AuditFile}, &verify, &errOut); code != 0 || !strings.Contains(verify.String(), "OK, 4 entries") {
+		t.Fatalf("audit: %d %q %q", code, verify.String(), errOut.String())
+	}
+
+	out.Reset()
+	if code := GDPRCommand([]string{"report", "--config", conf, "--subject", "anna", "--html"}, &out, &errOut); code != 0 ||
+		!strings.Contains(out.String(), "<h1>Auskunft über <code>anna</code></h1>") || strings.Contains(out.String(), "auth.login") {
+		t.Fatalf("html after erase: %d %s", code, out.String())
+	}
+	if code := GDPRCommand([]string{"report"}, &out, &errOut); code != 2 {
+		t.Fatalf("no subject: %d", code)
+	}
+}
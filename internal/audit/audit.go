@@ -1,28 +1,318 @@
+// Package audit writes the append-only audit log: one JSON entry per line,
+// chained by sequence number and the SHA-256 of the previous line, and
+// optionally signed, so that edits, deletions and reordering are detected
+// by Verify. The active file is rotated into gzipped segments listed in a
+// manifest; the chain runs on across segments.
 package audit
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"sync"
 	"time"
 )
 
-type Writer struct{ Path string }
+// SyncMode says when appended entries are fsynced.
+type SyncMode string
+
+const (
+	SyncEntry SyncMode = "entry" // after every entry (default)
+	SyncBatch SyncMode = "batch" // every SyncInterval, and on rotate/Close
+	SyncNone  SyncMode = "none"  // left to the OS
+)
+
+// Writer appends entries to the file at Path. It opens the file on first
+// use (or Open) and keeps it open until Close; it must be the only writer
+// of Path. All methods are safe for concurrent use.
+type Writer struct {
+	Path         string
+	Signer       Signer        // signs every entry if set
+	Sync         SyncMode      // "" = SyncEntry
+	SyncInterval time.Duration // SyncBatch, default 1s
+	MaxSize      int64         // rotate before the active file would exceed it, 0 = never
+	MaxAge       time.Duration // rotate once the first entry of the active file is older, 0 = never
+	Retention    time.Duration // remove segments that ended longer ago, 0 = keep
+	MaxSegments  int           // keep at most this many segments, 0 = all
+
+	now func() time.Time // for tests
+
+	mu        sync.Mutex
+	f         *os.File
+	closed    bool
+	size      int64
+	started   time.Time // first entry of the active file
+	firstSeq  uint64
+	firstPrev string
+	seq       uint64 // last written
+	last      string // chain value of the last line
+	dirty     bool   // written but not yet synced (SyncBatch)
+	stop      chan struct{}
+	done      chan struct{}
+}
 
 type Entry struct {
 	TS   time.Time   `json:"ts"`
 	Op   string      `json:"op"`
 	User string      `json:"user"`
 	Data interface{} `json:"data"`
+	Seq  uint64      `json:"seq"`  // 1 for the first chained entry
+	Prev string      `json:"prev"` // hex SHA-256 of the previous line, "" for the first
+	// Redacted is set on a line rewritten by Writer.Redact: the chain
+	// value of the original line, which the next entry links to.
+	Redacted string `json:"redacted,omitempty"`
+	Sig      string `json:"sig,omitempty"` // must stay the last field, see unsigned
+}
+
+// Open opens the active file and picks up the chain from its last line or,
+// if it is empty, from the last segment of the manifest. Append calls it
+// implicitly; call it at startup to fail early.
+func (w *Writer) Open() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.open()
+}
+
+func (w *Writer) open() error {
+	if w.closed {
+		return errors.New("audit: writer closed")
+	}
+	if w.f != nil {
+		return nil
+	}
+	switch w.Sync {
+	case "", SyncEntry, SyncBatch, SyncNone:
+	default:
+		return fmt.Errorf("audit: unknown sync mode %q", w.Sync)
+	}
+	if w.now == nil {
+		w.now = time.Now
+	}
+	f, err := os.OpenFile(w.Path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.size, w.seq, w.last, w.firstSeq, w.firstPrev, w.started = st.Size(), 0, "", 0, "", time.Time{}
+	if w.size > 0 {
+		err = w.resume(f)
+	}
+	if err == nil && w.size == 0 {
+		err = w.resumeManifest()
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.f = f
+	if w.Sync == SyncBatch {
+		interval := w.SyncInterval
+		if interval <= 0 {
+			interval = time.Second
+		}
+		w.stop, w.done = make(chan struct{}), make(chan struct{})
+		go w.syncLoop(interval, w.stop, w.done)
+	}
+	return w.expire()
 }
 
-func (w Writer) Append(e Entry) error {
-	f, err := os.OpenFile(w.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+// resume reads the chain state of a non-empty active file.
+func (w *Writer) resume(f *os.File) error {
+	last, err := lastLine(f)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	b, _ := json.Marshal(e)
-	b = append(b, '\n')
-	_, err = f.Write(b)
+	var e Entry
+	if err := json.Unmarshal(last, &e); err != nil {
+		return fmt.Errorf("audit: last line of %s is not an entry, refusing to extend the chain", w.Path)
+	}
+	w.seq, w.last = e.Seq, chainValue(last, e)
+	first, err := bufio.NewReader(io.NewSectionReader(f, 0, w.size)).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(first), &e); err != nil {
+		return fmt.Errorf("audit: first line of %s is not an entry", w.Path)
+	}
+	w.firstSeq, w.firstPrev, w.started = e.Seq, e.Prev, e.TS
+
+	// a crash between writing the manifest and truncating the active file
+	// leaves entries that are already in the last segment
+	m, err := ReadManifest(w.Path)
+	if err != nil {
+		return err
+	}
+	if n := len(m.Segments); n > 0 && m.Segments[n-1].LastSeq == w.seq && m.Segments[n-1].LastHash == w.last {
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		w.size = 0
+	}
+	return nil
+}
+
+// resumeManifest continues after the last rotated segment, if any.
+func (w *Writer) resumeManifest() error {
+	m, err := ReadManifest(w.Path)
+	if err != nil {
+		return err
+	}
+	if n := len(m.Segments); n > 0 {
+		w.seq, w.last = m.Segments[n-1].LastSeq, m.Segments[n-1].LastHash
+	}
+	return nil
+}
+
+// Append sets Seq and Prev of e, signs it and writes it, rotating first
+// if the active file is full or too old. It returns only after the entry
+// is synced as configured.
+func (w *Writer) Append(e Entry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.open(); err != nil {
+		return err
+	}
+	return w.append(e)
+}
+
+func (w *Writer) append(e Entry) error {
+	e.Seq, e.Prev, e.Sig = w.seq+1, w.last, ""
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	if w.Signer != nil {
+		e.Sig = w.Signer.Sign(b)
+		if b, err = json.Marshal(e); err != nil {
+			return fmt.Errorf("audit: %w", err)
+		}
+	}
+	line := append(b, '\n')
+	if w.due(int64(len(line))) {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	if _, err := w.f.Write(line); err != nil {
+		return err
+	}
+	if w.size == 0 {
+		w.firstSeq, w.firstPrev, w.started = e.Seq, e.Prev, w.now()
+	}
+	w.size += int64(len(line))
+	w.seq, w.last = e.Seq, lineHash(b)
+	switch w.Sync {
+	case "", SyncEntry:
+		return w.f.Sync()
+	case SyncBatch:
+		w.dirty = true
+	}
+	return nil
+}
+
+// due reports whether the active file must be rotated before n more bytes.
+func (w *Writer) due(n int64) bool {
+	if w.size == 0 {
+		return false
+	}
+	return (w.MaxSize > 0 && w.size+n > w.MaxSize) ||
+		(w.MaxAge > 0 && !w.started.IsZero() && w.now().Sub(w.started) >= w.MaxAge)
+}
+
+func (w *Writer) syncLoop(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			w.mu.Lock()
+			if w.dirty && w.f != nil {
+				if w.f.Sync() == nil {
+					w.dirty = false
+				}
+			}
+			w.mu.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Close syncs and closes the active file. Append fails afterwards.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	var err error
+	if w.f != nil {
+		err = w.f.Sync()
+		if cerr := w.f.Close(); err == nil {
+			err = cerr
+		}
+		w.f = nil
+	}
+	w.closed = true
+	stop, done := w.stop, w.done
+	w.stop = nil
+	w.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
 	return err
 }
+
+// lineHash is the chain value of a line (without its newline).
+func lineHash(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// chainValue is the value the successor of line e links to: its hash, or
+// for a redacted line the hash of the original.
+func chainValue(line []byte, e Entry) string {
+	if e.Redacted != "" {
+		return e.Redacted
+	}
+	return lineHash(line)
+}
+
+// lastLine returns the last non-empty line of f, nil for an empty file. It
+// reads backwards in chunks, so opening stays cheap for large logs.
+func lastLine(f *os.File) ([]byte, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	const chunk = 4096
+	var tail []byte
+	for off := st.Size(); off > 0; {
+		n := int64(chunk)
+		if off < n {
+			n = off
+		}
+		off -= n
+		buf := make([]byte, n)
+		if _, err := f.ReadAt(buf, off); err != nil && err != io.EOF {
+			return nil, err
+		}
+		tail = append(buf, tail...)
+		trimmed := bytes.TrimRight(tail, "\n")
+		if i := bytes.LastIndexByte(trimmed, '\n'); i >= 0 {
+			return trimmed[i+1:], nil
+		}
+		if off == 0 && len(trimmed) > 0 {
+			return trimmed, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,143 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeLog(t *testing.T, s Signer, n int) (string, []string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	for i := 0; i < n; i++ {
+		// a new Writer per entry: the chain must survive restarts
+		w := &Writer{Path: path, Signer: s}
+		if err := w.Append(Entry{TS: time.Unix(int64(i), 0).UTC(), Op: "op", User: "anna", Data: map[string]any{"i": i}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, strings.Split(strings.TrimSuffix(string(raw), "\n"), "\n")
+}
+
+func verify(lines []string, s Signer) (Report, *Broken) {
+	rep, err := Verify(strings.NewReader(strings.Join(lines, "\n")+"\n"), s)
+	var b *Broken
+	if err != nil && !errors.As(err, &b) {
+		panic(err)
+	}
+	return rep, b
+}
+
+func TestWriter_Chain(t *testing.T) {
+	_, lines := writeLog(t, nil, 4)
+	rep, b := verify(lines, nil)
+	if b != nil || rep.Entries != 4 || rep.FirstSeq != 1 || rep.LastSeq != 4 || rep.LastHash != lineHash([]byte(lines[3])) {
+		t.Fatalf("intact log: %+v %v", rep, b)
+	}
+
+	edited := append([]string{}, lines...)
+	edited[1] = strings.Replace(edited[1], `"anna"`, `"mallory"`, 1)
+	deleted := append(append([]string{}, lines[:2]...), lines[3:]...)
+	swapped := []string{lines[0], lines[2], lines[1], lines[3]}
+	cases := []struct {
+		name   string
+		lines  []string
+		line   int
+		reason string
+	}{
+		{"edited", edited, 3, "broken link"},
+		{"deleted", deleted, 3, "gap"},
+		{"swapped", swapped, 2, "gap"},
+		{"duplicated", []string{lines[0], lines[1], lines[1]}, 3, "reordered"},
+		{"garbage", []string{lines[0], "{"}, 2, "malformed"},
+	}
+	for _, c := range cases {
+		if _, b := verify(c.lines, nil); b == nil || b.Line != c.line || b.Reason != c.reason {
+			t.Errorf("%s: got %v, want line %d %s", c.name, b, c.line, c.reason)
+		}
+	}
+
+	// without a key the chain cannot see an edit of the last line
+	last := append([]string{}, lines...)
+	last[3] = strings.Replace(last[3], `"anna"`, `"mallory"`, 1)
+	if _, b := verify(last, nil); b != nil {
+		t.Fatalf("unsigned last line: %v", b)
+	}
+}
+
+func TestWriter_ContinuesLegacyLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	legacy := `{"ts":"2024-01-01T00:00:00Z","op":"auth.login","user":"anna","data":null}` + "\n"
+	if err := os.WriteFile(path, []byte(legacy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	w := &Writer{Path: path}
+	if err := w.Append(Entry{Op: "auth.logout"}); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	raw, _ := os.ReadFile(path)
+	rep, err := Verify(bytes.NewReader(raw), nil)
+	if err != nil || rep.Legacy != 1 || rep.Entries != 1 {
+		t.Fatalf("%+v %v", rep, err)
+	}
+}
+
+func TestWriter_Signed(t *testing.T) {
+	secret := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	hm, err := ParseKey("hmac:" + secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, lines := writeLog(t, hm, 3)
+	if _, b := verify(lines, hm); b != nil {
+		t.Fatalf("signed log: %v", b)
+	}
+	last := append([]string{}, lines...)
+	last[2] = strings.Replace(last[2], `"anna"`, `"mallory"`, 1)
+	if _, b := verify(last, hm); b == nil || b.Line != 3 || b.Reason != "bad signature" {
+		t.Fatalf("edited last line: %v", b)
+	}
+	other, _ := ParseKey("hmac:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{8}, 32)))
+	if _, b := verify(lines, other); b == nil || b.Reason != "bad signature" {
+		t.Fatalf("other key: %v", b)
+	}
+	_, plain := writeLog(t, nil, 1)
+	if _, b := verify(plain, hm); b == nil || b.Reason != "unsigned" {
+		t.Fatalf("unsigned entry: %v", b)
+	}
+
+	seed := bytes.Repeat([]byte{1}, ed25519.SeedSize)
+	ed, err := ParseKey("ed25519:" + base64.StdEncoding.EncodeToString(seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, lines = writeLog(t, ed, 2)
+	pub := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+	verifier, err := ParseKey("ed25519-pub:" + base64.StdEncoding.EncodeToString(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, b := verify(lines, verifier); b != nil {
+		t.Fatalf("ed25519: %v", b)
+	}
+
+	for _, bad := range []string{"hmac", "hmac:short", "hmac:" + base64.StdEncoding.EncodeToString([]byte("short")), "rsa:AAAA"} {
+		if _, err := ParseKey(bad); err == nil {
+			t.Errorf("ParseKey(%q) accepted", bad)
+		}
+	}
+}
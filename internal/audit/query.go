@@ -0,0 +1,130 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Query selects audit entries. Zero fields match everything.
+type Query struct {
+	From, To  time.Time // TS in [From, To)
+	Op        string    // exact, or a prefix with a trailing "*" ("auth.*")
+	User      string    // case-insensitive
+	Target    string    // DN or MAC in Data["dn"], Data["target"] or Data["mac"]
+	RequestID string    // Data["requestId"]
+	Before    uint64    // only entries with a smaller seq (paging cursor), 0 = newest
+	Limit     int       // page size, default 50
+
+	// Rewrite is applied to every entry before it is matched, e.g. to
+	// pseudonymise it: a filter then sees only what the reader may see.
+	Rewrite func(Entry) Entry
+}
+
+// Page is one result page, newest entry first.
+type Page struct {
+	Entries []Entry `json:"entries"`
+	Next    uint64  `json:"next,omitempty"` // Before of the next (older) page, 0 if none
+}
+
+// Search streams the whole history of the log at path (segments and
+// active file, see History) and returns the newest Limit matches of q.
+// Memory is bounded by Limit, not by the size of the log.
+func Search(path string, q Query) (Page, error) {
+	if q.Limit <= 0 {
+		q.Limit = 50
+	}
+	// ring of the newest Limit+1 matches; the extra one tells whether an
+	// older page exists
+	ring := make([]Entry, q.Limit+1)
+	n := 0
+	err := Each(path, func(e Entry) error {
+		if q.Rewrite != nil {
+			e = q.Rewrite(e)
+		}
+		if q.match(e) {
+			ring[n%len(ring)] = e
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return Page{}, err
+	}
+
+	var p Page
+	for i := n - 1; i >= 0 && i >= n-q.Limit; i-- {
+		p.Entries = append(p.Entries, ring[i%len(ring)])
+	}
+	if n > q.Limit {
+		p.Next = p.Entries[len(p.Entries)-1].Seq
+	}
+	return p, nil
+}
+
+// Each calls fn for every entry in the history of the log at path, oldest
+// first, and stops at the first error of fn. Lines that are no entries
+// are skipped: Verify reports them, readers do not.
+func Each(path string, fn func(Entry) error) error {
+	h, err := History(path)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+	sc := bufio.NewScanner(h)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var e Entry
+		if json.Unmarshal(sc.Bytes(), &e) != nil {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+func (q Query) match(e Entry) bool {
+	if q.Before > 0 && (e.Seq == 0 || e.Seq >= q.Before) {
+		return false
+	}
+	if (!q.From.IsZero() && e.TS.Before(q.From)) || (!q.To.IsZero() && !e.TS.Before(q.To)) {
+		return false
+	}
+	if q.Op != "" {
+		if prefix, ok := strings.CutSuffix(q.Op, "*"); ok {
+			if !strings.HasPrefix(e.Op, prefix) {
+				return false
+			}
+		} else if e.Op != q.Op {
+			return false
+		}
+	}
+	if q.User != "" && !strings.EqualFold(e.User, q.User) {
+		return false
+	}
+	data, _ := e.Data.(map[string]any)
+	if q.RequestID != "" && data["requestId"] != q.RequestID {
+		return false
+	}
+	if q.Target != "" {
+		want := normTarget(q.Target)
+		for _, k := range []string{"dn", "target", "mac"} {
+			if v, ok := data[k].(string); ok && normTarget(v) == want {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// normTarget makes DNs and MACs comparable: case, blanks after commas and
+// the MAC separator do not matter.
+func normTarget(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.ReplaceAll(s, ", ", ",")
+	return strings.ReplaceAll(s, "-", ":")
+}
@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	w := &Writer{Path: path, MaxSize: 600}
+	t0 := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	add := func(i int, op, user string, data map[string]any) {
+		if err := w.Append(Entry{TS: t0.Add(time.Duration(i) * time.Minute), Op: op, User: user, Data: data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		add(i, "auth.login", "anna", map[string]any{"ip": "10.0.0.1", "requestId": fmt.Sprintf("r%d", i)})
+	}
+	add(10, "user.unlock", "Anna", map[string]any{"dn": "CN=Bob,CN=Users,DC=example,DC=com"})
+	add(11, "dhcp.reservation.add", "carl", map[string]any{"mac": "AA-BB-CC-00-11-22"})
+	w.Close()
+	if m, _ := ReadManifest(path); len(m.Segments) == 0 {
+		t.Fatal("test log was not rotated")
+	}
+
+	seqs := func(p Page) string {
+		var s []string
+		for _, e := range p.Entries {
+			s = append(s, fmt.Sprintf("%s#%d", e.Op, e.Seq))
+		}
+		return strings.Join(s, ",")
+	}
+	cases := []struct {
+		name  string
+		q     Query
+		count int
+	}{
+		{"all", Query{Limit: 100}, 12},
+		{"op prefix", Query{Op: "auth.*", Limit: 100}, 10},
+		{"op exact", Query{Op: "auth", Limit: 100}, 0},
+		{"user", Query{User: "ANNA", Limit: 100}, 11},
+		{"time", Query{From: t0.Add(2 * time.Minute), To: t0.Add(5 * time.Minute), Limit: 100}, 3},
+		{"dn", Query{Target: "cn=bob, cn=users, dc=example, dc=com"}, 1},
+		{"mac", Query{Target: "aa:bb:cc:00:11:22"}, 1},
+		{"request", Query{RequestID: "r3"}, 1},
+	}
+	for _, c := range cases {
+		p, err := Search(path, c.q)
+		if err != nil || len(p.Entries) != c.count {
+			t.Errorf("%s: %d entries (%s), %v", c.name, len(p.Entries), seqs(p), err)
+		}
+	}
+
+	// pages of 5, newest first, continued by seq cursor
+	p, err := Search(path, Query{Limit: 5})
+	if err != nil || len(p.Entries) != 5 || p.Entries[0].Seq != 12 || p.Next != 8 {
+		t.Fatalf("page 1: %+v %v", p, err)
+	}
+	p, _ = Search(path, Query{Limit: 5, Before: p.Next})
+	if len(p.Entries) != 5 || p.Entries[0].Seq != 7 || p.Next != 3 {
+		t.Fatalf("page 2: %+v", p)
+	}
+	p, _ = Search(path, Query{Limit: 5, Before: p.Next})
+	if len(p.Entries) != 2 || p.Next != 0 {
+		t.Fatalf("page 3: %+v", p)
+	}
+}
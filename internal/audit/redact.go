@@ -0,0 +1,222 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// OpRedact is the op of the entry Writer.Redact appends. Its Data lists
+// the rewritten entries under "seqs"; Verify accepts a redacted line only
+// if a later OpRedact entry lists it.
+const OpRedact = "audit.redact"
+
+// Redact rewrites every entry of the readable history (live segments and
+// active file) for which rewrite reports a change, e.g. to pseudonymise
+// one person, and returns their seqs. Before anything is rewritten, note
+// is appended as OpRedact entry with the seqs added to its Data, which
+// must be nil or a map[string]any.
+//
+// A rewritten line keeps Seq and Prev, carries the chain value of the
+// original line in Redacted and is signed again, so the chain, the
+// manifest and a LastHash kept elsewhere stay valid. Without a Signer the
+// content of a listed line is no longer protected by the chain.
+func (w *Writer) Redact(rewrite func(Entry) (Entry, bool), note Entry) ([]uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	seqs, err := w.redactable(rewrite)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]any{}
+	switch d := note.Data.(type) {
+	case nil:
+	case map[string]any:
+		for k, v := range d {
+			data[k] = v
+		}
+	default:
+		return nil, fmt.Errorf("audit: redact note data is %T, want a map", note.Data)
+	}
+	data["seqs"] = seqs
+	note.Op, note.Data = OpRedact, data
+	if err := w.append(note); err != nil {
+		return nil, err
+	}
+	if len(seqs) == 0 {
+		return seqs, nil
+	}
+
+	set := make(map[uint64]bool, len(seqs))
+	for _, s := range seqs {
+		set[s] = true
+	}
+	m, err := ReadManifest(w.Path)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range m.Segments {
+		if s.Removed != nil || !overlaps(set, s.FirstSeq, s.LastSeq) {
+			continue
+		}
+		if err := w.rewriteSegment(filepath.Join(filepath.Dir(w.Path), s.File), set, rewrite); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.rewriteActive(set, rewrite); err != nil {
+		return nil, err
+	}
+	return seqs, nil
+}
+
+// redactable returns the seqs of the chained entries rewrite would change.
+func (w *Writer) redactable(rewrite func(Entry) (Entry, bool)) ([]uint64, error) {
+	seqs := []uint64{}
+	err := Each(w.Path, func(e Entry) error {
+		if _, changed := rewrite(e); changed && e.Seq > 0 {
+			seqs = append(seqs, e.Seq)
+		}
+		return nil
+	})
+	return seqs, err
+}
+
+func overlaps(set map[uint64]bool, first, last uint64) bool {
+	for s := range set {
+		if s >= first && s <= last {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriteLines copies r to out, rewriting the lines whose seq is in set.
+// Lines that are no entries are copied unchanged.
+func (w *Writer) rewriteLines(r io.Reader, out io.Writer, set map[uint64]bool, rewrite func(Entry) (Entry, bool)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := sc.Bytes()
+		var e Entry
+		if json.Unmarshal(line, &e) == nil && set[e.Seq] {
+			if ne, changed := rewrite(e); changed {
+				b, err := w.redactLine(line, e, ne)
+				if err != nil {
+					return err
+				}
+				line = b
+			}
+		}
+		if _, err := out.Write(append(bytes.Clone(line), '\n')); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// redactLine is the line of ne replacing line (entry e) in the chain.
+func (w *Writer) redactLine(line []byte, e, ne Entry) ([]byte, error) {
+	ne.Seq, ne.Prev, ne.Redacted, ne.Sig = e.Seq, e.Prev, chainValue(line, e), ""
+	b, err := json.Marshal(ne)
+	if err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+	if w.Signer != nil {
+		ne.Sig = w.Signer.Sign(b)
+		if b, err = json.Marshal(ne); err != nil {
+			return nil, fmt.Errorf("audit: %w", err)
+		}
+	}
+	return b, nil
+}
+
+// rewriteSegment replaces the gzipped segment at path by its rewritten
+// content, via a temporary file like gzipFile.
+func (w *Writer) rewriteSegment(path string, set map[uint64]bool, rewrite func(Entry) (Entry, bool)) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("audit: segment listed in manifest: %w", err)
+	}
+	defer src.Close()
+	zr, err := gzip.NewReader(src)
+	if err != nil {
+		return fmt.Errorf("audit: %s: %w", filepath.Base(path), err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".segment-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	zw := gzip.NewWriter(tmp)
+	if err := w.rewriteLines(zr, zw, set, rewrite); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o400); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// rewriteActive replaces the active file by its rewritten content and
+// reopens it. The chain state does not change: a redacted last line keeps
+// the chain value of the original.
+func (w *Writer) rewriteActive(set map[uint64]bool, rewrite func(Entry) (Entry, bool)) error {
+	if w.size == 0 {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(w.Path), ".active-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := w.rewriteLines(io.NewSectionReader(w.f, 0, w.size), tmp, set, rewrite); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	st, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), w.Path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.Path, os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	_ = w.f.Close()
+	w.f, w.size, w.dirty = f, st.Size(), false
+	return nil
+}
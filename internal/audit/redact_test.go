@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// renameBob pseudonymises the entries of bob.
+func renameBob(e Entry) (Entry, bool) {
+	if e.User != "bob" {
+		return e, false
+	}
+	e.User = "p-000000000001"
+	return e, true
+}
+
+func TestWriter_RedactKeepsChain(t *testing.T) {
+	key, err := ParseKey("hmac:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	w := &Writer{Path: path, Signer: key, MaxSize: 600}
+	for i := 0; i < 12; i++ {
+		user := "anna"
+		if i%3 == 0 {
+			user = "bob"
+		}
+		if err := w.Append(Entry{Op: "op", User: user, Data: map[string]any{"i": i}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before, err := VerifyHistory(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := ReadManifest(path); len(m.Segments) < 2 {
+		t.Fatalf("want segments, got %+v", m)
+	}
+
+	seqs, err := w.Redact(renameBob, Entry{User: "auditor", Data: map[string]any{"subject": "p-000000000001"}})
+	if err != nil || len(seqs) != 4 || seqs[0] != 1 || seqs[3] != 10 {
+		t.Fatalf("redact: %v %v", seqs, err)
+	}
+	if err := w.Append(Entry{Op: "op", User: "anna"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := VerifyHistory(path, key)
+	if err != nil || rep.Redacted != 4 || rep.Entries != 14 {
+		t.Fatalf("after redact: %+v %v", rep, err)
+	}
+	page, err := Search(path, Query{User: "bob"})
+	if err != nil || len(page.Entries) != 0 {
+		t.Fatalf("bob still in the log: %+v %v", page, err)
+	}
+	page, err = Search(path, Query{Op: OpRedact})
+	if err != nil || len(page.Entries) != 1 || page.Entries[0].Seq != before.LastSeq+1 {
+		t.Fatalf("redact entry: %+v %v", page, err)
+	}
+
+	// nothing left to do, but the request is still recorded
+	w = &Writer{Path: path, Signer: key}
+	if seqs, err := w.Redact(renameBob, Entry{}); err != nil || len(seqs) != 0 {
+		t.Fatalf("second redact: %v %v", seqs, err)
+	}
+	w.Close()
+	if rep, err := VerifyHistory(path, key); err != nil || rep.Entries != 15 {
+		t.Fatalf("second redact: %+v %v", rep, err)
+	}
+}
+
+func TestVerify_UnlistedRedaction(t *testing.T) {
+	path, lines := writeLog(t, nil, 3)
+	w := &Writer{Path: path}
+	if _, err := w.Redact(func(e Entry) (Entry, bool) { return e, false }, Entry{}); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	// a line rewritten by hand, claiming the hash of the original
+	var e Entry
+	forged := append([]string{}, lines...)
+	forged[1] = strings.Replace(forged[1], `"prev"`, `"redacted":"`+lineHash([]byte(lines[1]))+`","prev"`, 1)
+	forged[1] = strings.Replace(forged[1], `"anna"`, `"mallory"`, 1)
+	if !strings.Contains(forged[1], "mallory") || json.Unmarshal([]byte(forged[1]), &e) != nil || e.Redacted == "" {
+		t.Fatalf("bad forgery %s", forged[1])
+	}
+	if _, b := verify(forged, nil); b == nil || b.Line != 2 || b.Reason != "unlisted redaction" {
+		t.Fatalf("unlisted: %v", b)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep, b := verify(strings.Split(strings.TrimSuffix(string(raw), "\n"), "\n"), nil); b != nil || rep.Entries != 4 {
+		t.Fatalf("empty redact: %+v %v", rep, b)
+	}
+}
@@ -0,0 +1,249 @@
+package audit
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Manifest lists the rotated segments of a log, oldest first. It lives
+// next to the active file as <stem>.manifest.json.
+type Manifest struct {
+	Segments []Segment `json:"segments"`
+}
+
+// Segment is one rotated, gzipped part of the log. Segments removed by the
+// retention policy stay listed, so the chain can still be followed across
+// the hole.
+type Segment struct {
+	File     string     `json:"file"` // relative to the directory of the log
+	FirstSeq uint64     `json:"firstSeq"`
+	LastSeq  uint64     `json:"lastSeq"`
+	Prev     string     `json:"prev"`     // Prev of the first entry
+	LastHash string     `json:"lastHash"` // chain value of the last line
+	Start    time.Time  `json:"start"`
+	End      time.Time  `json:"end"`
+	Removed  *time.Time `json:"removed,omitempty"`
+}
+
+func stem(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+func manifestPath(path string) string { return stem(path) + ".manifest.json" }
+
+// ReadManifest returns the manifest of the log at path; empty if there is
+// none yet.
+func ReadManifest(path string) (Manifest, error) {
+	var m Manifest
+	b, err := os.ReadFile(manifestPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, fmt.Errorf("audit: manifest: %w", err)
+	}
+	return m, nil
+}
+
+// writeManifest replaces the manifest atomically.
+func writeManifest(path string, m Manifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeAtomic(manifestPath(path), append(b, '\n'))
+}
+
+// rotate compresses the active file into a segment, records it in the
+// manifest and starts an empty active file. The chain state is kept, so
+// the next entry links to the last line of the segment.
+func (w *Writer) rotate() error {
+	if err := w.f.Sync(); err != nil {
+		return err
+	}
+	w.dirty = false
+	name := fmt.Sprintf("%s-%012d-%012d.jsonl.gz", filepath.Base(stem(w.Path)), w.firstSeq, w.seq)
+	dir := filepath.Dir(w.Path)
+	if err := gzipFile(w.f, filepath.Join(dir, name)); err != nil {
+		return err
+	}
+	m, err := ReadManifest(w.Path)
+	if err != nil {
+		return err
+	}
+	m.Segments = append(m.Segments, Segment{
+		File: name, FirstSeq: w.firstSeq, LastSeq: w.seq, Prev: w.firstPrev, LastHash: w.last,
+		Start: w.started, End: w.now().UTC(),
+	})
+	if err := writeManifest(w.Path, m); err != nil {
+		return err
+	}
+	// only now, with segment and manifest on disk, drop the active file
+	if err := w.f.Truncate(0); err != nil {
+		return err
+	}
+	if err := w.f.Sync(); err != nil {
+		return err
+	}
+	w.size, w.firstSeq, w.firstPrev, w.started = 0, 0, "", time.Time{}
+	return w.expire()
+}
+
+// expire applies Retention and MaxSegments to the manifest.
+func (w *Writer) expire() error {
+	if w.Retention <= 0 && w.MaxSegments <= 0 {
+		return nil
+	}
+	m, err := ReadManifest(w.Path)
+	if err != nil {
+		return err
+	}
+	now := w.now().UTC()
+	live := 0
+	for _, s := range m.Segments {
+		if s.Removed == nil {
+			live++
+		}
+	}
+	changed := false
+	for i := range m.Segments {
+		s := &m.Segments[i]
+		if s.Removed != nil {
+			continue
+		}
+		tooOld := w.Retention > 0 && now.Sub(s.End) > w.Retention
+		tooMany := w.MaxSegments > 0 && live > w.MaxSegments
+		if !tooOld && !tooMany {
+			break // segments are ordered, younger ones follow
+		}
+		if err := os.Remove(filepath.Join(filepath.Dir(w.Path), s.File)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		s.Removed = &now
+		live--
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return writeManifest(w.Path, m)
+}
+
+// History returns the readable log in order: the live segments of the
+// manifest, decompressed, followed by the active file. A listed segment
+// that is missing on disk is an error.
+func History(path string) (io.ReadCloser, error) {
+	m, err := ReadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	h := &history{}
+	for _, s := range m.Segments {
+		if s.Removed != nil {
+			continue
+		}
+		f, err := os.Open(filepath.Join(filepath.Dir(path), s.File))
+		if err != nil {
+			h.Close()
+			return nil, fmt.Errorf("audit: segment listed in manifest: %w", err)
+		}
+		h.closers = append(h.closers, f)
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			h.Close()
+			return nil, fmt.Errorf("audit: %s: %w", s.File, err)
+		}
+		h.parts = append(h.parts, part{s.File, zr})
+	}
+	if f, err := os.Open(path); err == nil {
+		h.closers = append(h.closers, f)
+		h.parts = append(h.parts, part{filepath.Base(path), f})
+	} else if !errors.Is(err, os.ErrNotExist) {
+		h.Close()
+		return nil, err
+	}
+	readers := make([]io.Reader, len(h.parts))
+	for i, p := range h.parts {
+		readers[i] = p.r
+	}
+	h.Reader = io.MultiReader(readers...)
+	return h, nil
+}
+
+type history struct {
+	io.Reader
+	parts   []part
+	closers []io.Closer
+}
+
+type part struct {
+	name string
+	r    io.Reader
+}
+
+func (h *history) Close() error {
+	for _, c := range h.closers {
+		_ = c.Close()
+	}
+	return nil
+}
+
+// gzipFile writes the content of src to dst.gz via a temporary file, so a
+// crash never leaves a truncated segment under the final name.
+func gzipFile(src *os.File, dst string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".segment-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	zw := gzip.NewWriter(tmp)
+	if _, err := io.Copy(zw, io.NewSectionReader(src, 0, 1<<62)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o400); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func writeAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".manifest-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
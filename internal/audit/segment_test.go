@@ -0,0 +1,167 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func appendN(t *testing.T, w *Writer, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := w.Append(Entry{Op: "op", User: "anna", Data: map[string]any{"i": i}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWriter_RotateKeepsChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	w := &Writer{Path: path, MaxSize: 400}
+	appendN(t, w, 10)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadManifest(path)
+	if err != nil || len(m.Segments) < 2 {
+		t.Fatalf("manifest %+v %v", m, err)
+	}
+	if s := m.Segments[1]; s.FirstSeq != m.Segments[0].LastSeq+1 || s.Prev != m.Segments[0].LastHash || !strings.HasSuffix(s.File, ".jsonl.gz") {
+		t.Fatalf("segments %+v", m.Segments)
+	}
+
+	// a restart continues after the active file
+	w = &Writer{Path: path, MaxSize: 400}
+	appendN(t, w, 3)
+	w.Close()
+	rep, err := VerifyHistory(path, nil)
+	if err != nil || rep.Entries != 13 || rep.FirstSeq != 1 || rep.LastSeq != 13 {
+		t.Fatalf("history: %+v %v", rep, err)
+	}
+	h, err := History(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, _ := io.ReadAll(h)
+	h.Close()
+	if n := strings.Count(string(all), "\n"); n != 13 {
+		t.Fatalf("history has %d lines", n)
+	}
+
+	// a listed segment must not vanish
+	if err := os.Remove(filepath.Join(filepath.Dir(path), m.Segments[1].File)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyHistory(path, nil); err == nil {
+		t.Fatal("missing segment not reported")
+	}
+}
+
+func TestWriter_Retention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := &Writer{Path: path, MaxAge: time.Hour, Retention: 3 * time.Hour, now: func() time.Time { return now }}
+	for i := 0; i < 6; i++ {
+		appendN(t, w, 2)
+		now = now.Add(time.Hour)
+	}
+	appendN(t, w, 1)
+	w.Close()
+
+	m, _ := ReadManifest(path)
+	removed := 0
+	for _, s := range m.Segments {
+		_, err := os.Stat(filepath.Join(filepath.Dir(path), s.File))
+		if s.Removed != nil {
+			removed++
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("%s still on disk", s.File)
+			}
+		}
+	}
+	if len(m.Segments) != 6 || removed != 2 {
+		t.Fatalf("%d segments, %d removed", len(m.Segments), removed)
+	}
+	rep, err := VerifyHistory(path, nil)
+	if err != nil || rep.Removed != 2 || rep.FirstSeq != 5 || rep.LastSeq != 13 {
+		t.Fatalf("history: %+v %v", rep, err)
+	}
+
+	w = &Writer{Path: path, MaxSegments: 1}
+	if err := w.Open(); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if rep, err := VerifyHistory(path, nil); err != nil || rep.Removed != 5 || rep.FirstSeq != 11 {
+		t.Fatalf("MaxSegments: %+v %v", rep, err)
+	}
+}
+
+func TestWriter_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	w := &Writer{Path: path, Sync: SyncBatch, SyncInterval: time.Millisecond, MaxSize: 2000}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				if err := w.Append(Entry{Op: fmt.Sprintf("op%d", g)}); err != nil {
+					t.Error(err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Append(Entry{Op: "late"}); err == nil {
+		t.Fatal("append after Close")
+	}
+	if rep, err := VerifyHistory(path, nil); err != nil || rep.Entries != 200 {
+		t.Fatalf("%+v %v", rep, err)
+	}
+}
+
+func TestWriter_RecoversInterruptedRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	w := &Writer{Path: path}
+	appendN(t, w, 3)
+	w.Close()
+	active, _ := os.ReadFile(path)
+
+	// rotate, then put the active file back as if the truncate was lost
+	w = &Writer{Path: path, MaxSize: 1}
+	appendN(t, w, 1)
+	w.Close()
+	m, _ := ReadManifest(path)
+	if len(m.Segments) != 1 {
+		t.Fatalf("manifest %+v", m)
+	}
+	m.Segments = m.Segments[:1]
+	if err := os.WriteFile(path, active, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// the manifest claims seq 1-3, the active file repeats them: Open must
+	// drop the copy instead of extending it
+	w = &Writer{Path: path}
+	appendN(t, w, 1)
+	w.Close()
+	if rep, err := VerifyHistory(path, nil); err != nil || rep.Entries != 4 {
+		t.Fatalf("%+v %v", rep, err)
+	}
+}
+
+func TestWriter_RejectsUnknownSync(t *testing.T) {
+	w := &Writer{Path: filepath.Join(t.TempDir(), "audit.jsonl"), Sync: "sometimes"}
+	if err := w.Open(); err == nil {
+		t.Fatal("unknown sync mode accepted")
+	}
+}
@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Signer signs the JSON of an entry (without "sig") and checks such
+// signatures. Sign panics for a verify-only key.
+type Signer interface {
+	Sign(msg []byte) string
+	Verify(msg []byte, sig string) bool
+}
+
+// ParseKey reads a key in the form of Config.AuditKey:
+//
+//	hmac:<base64 secret>           HMAC-SHA256, at least 32 bytes
+//	ed25519:<base64 seed>          Ed25519 private key (32-byte seed)
+//	ed25519-pub:<base64 public>    Ed25519 public key, verify only
+//
+// An empty string means no signing (nil, nil).
+func ParseKey(s string) (Signer, error) {
+	if s == "" {
+		return nil, nil
+	}
+	kind, enc, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, fmt.Errorf("audit key: want <kind>:<base64>")
+	}
+	raw, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return nil, fmt.Errorf("audit key: %w", err)
+	}
+	switch kind {
+	case "hmac":
+		if len(raw) < 32 {
+			return nil, fmt.Errorf("audit key: hmac secret has %d bytes, want >= 32", len(raw))
+		}
+		return hmacKey(raw), nil
+	case "ed25519":
+		if len(raw) != ed25519.SeedSize {
+			return nil, fmt.Errorf("audit key: ed25519 seed has %d bytes, want %d", len(raw), ed25519.SeedSize)
+		}
+		priv := ed25519.NewKeyFromSeed(raw)
+		return edKey{priv: priv, pub: priv.Public().(ed25519.PublicKey)}, nil
+	case "ed25519-pub":
+		if len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("audit key: ed25519 public key has %d bytes, want %d", len(raw), ed25519.PublicKeySize)
+		}
+		return edKey{pub: ed25519.PublicKey(raw)}, nil
+	}
+	return nil, fmt.Errorf("audit key: unknown kind %q", kind)
+}
+
+type hmacKey []byte
+
+func (k hmacKey) Sign(msg []byte) string {
+	m := hmac.New(sha256.New, k)
+	m.Write(msg)
+	return base64.StdEncoding.EncodeToString(m.Sum(nil))
+}
+
+func (k hmacKey) Verify(msg []byte, sig string) bool {
+	return hmac.Equal([]byte(sig), []byte(k.Sign(msg)))
+}
+
+type edKey struct {
+	priv ed25519.PrivateKey // nil for a verify-only key
+	pub  ed25519.PublicKey
+}
+
+func (k edKey) Sign(msg []byte) string {
+	if k.priv == nil {
+		panic("audit: ed25519 public key cannot sign")
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(k.priv, msg))
+}
+
+func (k edKey) Verify(msg []byte, sig string) bool {
+	raw, err := base64.StdEncoding.DecodeString(sig)
+	return err == nil && ed25519.Verify(k.pub, msg, raw)
+}
@@ -0,0 +1,203 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Broken describes the first place where a log fails verification.
+type Broken struct {
+	File   string // segment or active file, "" for a plain stream
+	Line   int    // 1-based, within File
+	Seq    uint64 // as found on the line, 0 if unreadable
+	Reason string // malformed, gap, reordered, broken link, unsigned, bad signature, manifest, unlisted redaction
+	Detail string
+}
+
+func (b *Broken) Error() string {
+	where := fmt.Sprintf("line %d", b.Line)
+	if b.File != "" {
+		where = b.File + ":" + fmt.Sprint(b.Line)
+	}
+	return fmt.Sprintf("audit: %s (seq %d): %s: %s", where, b.Seq, b.Reason, b.Detail)
+}
+
+// Report is the result of a successful Verify.
+type Report struct {
+	Entries  int    // chained entries read
+	Legacy   int    // leading entries written before the chain existed
+	Removed  int    // segments removed by retention
+	Redacted int    // entries rewritten by Writer.Redact
+	FirstSeq uint64 // 1 unless older entries were removed
+	LastSeq  uint64
+	LastHash string // chain value of the last line, to compare with a copy kept elsewhere
+}
+
+// Verify walks a log and returns a *Broken error for the first line that
+// is not the successor of the one before it. Leading lines without seq
+// (written before chaining) are counted as legacy. With key every chained
+// line must carry a valid signature; without key signatures are ignored.
+//
+// A redacted line (see Writer.Redact) links on with the chain value of
+// the original and must be listed by a later OpRedact entry.
+//
+// The chain alone cannot detect a truncated or edited last line: compare
+// LastSeq/LastHash with an earlier run, or sign the log.
+func Verify(r io.Reader, key Signer) (Report, error) {
+	v := &verifier{key: key}
+	if err := v.feed("", r); err != nil {
+		return v.report(), err
+	}
+	return v.report(), v.finish()
+}
+
+// VerifyHistory verifies the log at path across rotation: the manifest
+// must form an unbroken chain of segments, and the live segments followed
+// by the active file must verify as one log that starts where the removed
+// segments ended.
+func VerifyHistory(path string, key Signer) (Report, error) {
+	m, err := ReadManifest(path)
+	if err != nil {
+		return Report{}, err
+	}
+	v := &verifier{key: key}
+	for i, s := range m.Segments {
+		if i > 0 {
+			p := m.Segments[i-1]
+			if s.FirstSeq != p.LastSeq+1 || s.Prev != p.LastHash {
+				return v.report(), &Broken{File: s.File, Seq: s.FirstSeq, Reason: "manifest",
+					Detail: fmt.Sprintf("segment does not continue %s", p.File)}
+			}
+		}
+		if s.Removed != nil {
+			v.rep.Removed++
+			v.prevSeq, v.prevHash, v.started = s.LastSeq, s.LastHash, true
+		}
+	}
+	h, err := History(path)
+	if err != nil {
+		return v.report(), err
+	}
+	defer h.Close()
+	for _, p := range h.(*history).parts {
+		if err := v.feed(p.name, p.r); err != nil {
+			return v.report(), err
+		}
+	}
+	return v.report(), v.finish()
+}
+
+// verifier carries the chain state from one file to the next.
+type verifier struct {
+	key      Signer
+	rep      Report
+	started  bool      // a chained entry (or removed segment) was seen
+	prevSeq  uint64    // of the last chained entry
+	prevHash string    // chain value of the last line, "" before the first
+	unlisted []*Broken // redacted lines no OpRedact entry listed yet
+}
+
+func (v *verifier) report() Report {
+	r := v.rep
+	r.LastSeq, r.LastHash = v.prevSeq, v.prevHash
+	return r
+}
+
+func (v *verifier) feed(file string, r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		raw := sc.Bytes()
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		broken := func(seq uint64, reason, detail string) error {
+			return &Broken{File: file, Line: line, Seq: seq, Reason: reason, Detail: detail}
+		}
+		var e Entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return broken(0, "malformed", err.Error())
+		}
+		switch {
+		case e.Seq == 0 && !v.started:
+			v.rep.Legacy++
+		case e.Seq == 0:
+			return broken(0, "malformed", "entry without seq inside the chain")
+		case v.started && e.Seq > v.prevSeq+1:
+			return broken(e.Seq, "gap", fmt.Sprintf("expected seq %d, entries missing", v.prevSeq+1))
+		case v.started && e.Seq <= v.prevSeq:
+			return broken(e.Seq, "reordered", fmt.Sprintf("expected seq %d", v.prevSeq+1))
+		case v.prevHash != "" && e.Prev != v.prevHash:
+			return broken(e.Seq, "broken link", "previous entry was modified")
+		case v.prevHash == "" && e.Seq == 1 && e.Prev != "":
+			return broken(e.Seq, "broken link", "first entry points to a predecessor")
+		}
+		if e.Seq > 0 {
+			if v.key != nil {
+				if e.Sig == "" {
+					return broken(e.Seq, "unsigned", "entry carries no signature")
+				}
+				if !v.key.Verify(unsigned(raw), e.Sig) {
+					return broken(e.Seq, "bad signature", "entry was modified or signed with another key")
+				}
+			}
+			if v.rep.Entries == 0 {
+				v.rep.FirstSeq = e.Seq
+			}
+			v.rep.Entries++
+			v.prevSeq, v.started = e.Seq, true
+			if e.Redacted != "" {
+				v.rep.Redacted++
+				v.unlisted = append(v.unlisted, &Broken{File: file, Line: line, Seq: e.Seq, Reason: "unlisted redaction",
+					Detail: "entry was rewritten without an " + OpRedact + " entry listing it"})
+			}
+			if e.Op == OpRedact {
+				v.list(e)
+			}
+		}
+		v.prevHash = chainValue(raw, e)
+	}
+	return sc.Err()
+}
+
+// list drops the redacted lines the OpRedact entry e accounts for.
+func (v *verifier) list(e Entry) {
+	data, _ := e.Data.(map[string]any)
+	seqs, _ := data["seqs"].([]any)
+	listed := make(map[uint64]bool, len(seqs))
+	for _, s := range seqs {
+		if f, ok := s.(float64); ok {
+			listed[uint64(f)] = true
+		}
+	}
+	kept := v.unlisted[:0]
+	for _, b := range v.unlisted {
+		if !listed[b.Seq] {
+			kept = append(kept, b)
+		}
+	}
+	v.unlisted = kept
+}
+
+// finish reports the first redacted line no OpRedact entry listed.
+func (v *verifier) finish() error {
+	if len(v.unlisted) > 0 {
+		return v.unlisted[0]
+	}
+	return nil
+}
+
+// unsigned restores the signed bytes of a line: "sig" is the last field,
+// so the line minus `,"sig":"…"` is what Append passed to Sign.
+func unsigned(line []byte) []byte {
+	i := bytes.LastIndex(line, []byte(`,"sig":"`))
+	if i < 0 {
+		return line
+	}
+	return append(append([]byte{}, line[:i]...), '}')
+}
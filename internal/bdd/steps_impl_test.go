@@ -3,59 +3,119 @@ package bdd
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/cucumber/godog"
+
+	"github.com/Weruminger/go-ad-admin/internal/kea"
+	"github.com/Weruminger/go-ad-admin/internal/kea/keatest"
+	"github.com/Weruminger/go-ad-admin/internal/ldap"
+	"github.com/Weruminger/go-ad-admin/internal/ldap/ldaptest"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+	"github.com/Weruminger/go-ad-admin/internal/web"
 )
 
+const baseDN = "DC=weruminger,DC=eu"
+
 /*** Test-Welt ***/
 
 type world struct {
-	users           map[string]string // uid -> displayName
+	dir             *ldaptest.Server // In-Memory-LDAP, pro Szenario frisch
+	client          *ldap.Conn       // echter Client gegen dir
+	kea             *keatest.Server  // Kea-Fake, pro Szenario frisch
+	keaClient       *kea.Client      // echter Client gegen kea
+	webServer       *web.Server      // Web-Oberfläche gegen client
+	web             http.Handler     // deren Routen
+	lastLeaseCount  int
 	lastSearchCount int
+	lastQuery       string
 	privacyHigh     bool
 	lastHTTP        int
 	sessionCookie   bool
-	failedAttempts  int
+	cookies         []*http.Cookie // Cookies des letzten Logins
 	lastErr         error
 }
 
 func (w *world) reset(ctx context.Context, _ *godog.Scenario) (context.Context, error) {
-	w.users = map[string]string{}
+	if err := w.newDirectory(); err != nil {
+		return ctx, err
+	}
+	if err := w.newKea(); err != nil {
+		return ctx, err
+	}
 	w.privacyHigh = true
+	w.webServer, w.web = nil, nil
 	w.lastHTTP = 0
 	w.sessionCookie = false
-	w.failedAttempts = 0
+	w.cookies = nil
 	w.lastErr = nil
 	w.lastSearchCount = 0
+	w.lastQuery = ""
+	w.lastLeaseCount = 0
+	return ctx, nil
+}
+
+func (w *world) teardown(ctx context.Context, _ *godog.Scenario, _ error) (context.Context, error) {
+	w.closeDirectory()
+	w.closeKea()
 	return ctx, nil
 }
 
+// newDirectory ersetzt das Verzeichnis durch ein leeres und verbindet den Client neu.
+func (w *world) newDirectory() error {
+	w.closeDirectory()
+	w.dir = ldaptest.NewServer(baseDN)
+	c, err := ldap.NewConn(w.dir.Config())
+	if err != nil {
+		return err
+	}
+	w.client = c
+	return nil
+}
+
+func (w *world) closeDirectory() {
+	if w.client != nil {
+		_ = w.client.Close()
+		w.client = nil
+	}
+	if w.dir != nil {
+		w.dir.Close()
+		w.dir = nil
+	}
+}
+
 var _w *world
 
 func testWorld() *world {
 	if _w == nil {
-		_w = &world{users: map[string]string{}}
+		_w = &world{}
 	}
 	return _w
 }
 
-/*** Step-Implementierungen ***/
-
-func anEmptyDirectory() error {
-	// ggf. tmp-dir vorbereiten
-	return nil
+// tableRows wandelt eine Gherkin-Tabelle in Zeilen für ldaptest.SeedTable.
+func tableRows(tbl *godog.Table) [][]string {
+	rows := make([][]string, 0, len(tbl.Rows))
+	for _, r := range tbl.Rows {
+		row := make([]string, 0, len(r.Cells))
+		for _, c := range r.Cells {
+			row = append(row, c.Value)
+		}
+		rows = append(rows, row)
+	}
+	return rows
 }
 
-func anLDAPDirectoryWithUsers(tbl *godog.Table) error {
-	w := testWorld()
-	w.users = map[string]string{}
-
-	// Header: uid | displayName
+// checkUserTable prüft den Header uid | displayName und leere Zellen.
+func checkUserTable(tbl *godog.Table) error {
 	if len(tbl.Rows) < 2 {
 		return fmt.Errorf("table needs header + at least 1 row")
 	}
@@ -67,47 +127,73 @@ func anLDAPDirectoryWithUsers(tbl *godog.Table) error {
 		if len(r.Cells) < 2 {
 			return fmt.Errorf("row needs 2 cells")
 		}
-		uid := strings.TrimSpace(r.Cells[0].Value)
-		dn := strings.TrimSpace(r.Cells[1].Value)
-		if uid == "" || dn == "" {
+		if strings.TrimSpace(r.Cells[0].Value) == "" || strings.TrimSpace(r.Cells[1].Value) == "" {
 			return fmt.Errorf("uid/displayName must not be empty")
 		}
-		w.users[uid] = dn
 	}
 	return nil
 }
 
+/*** Step-Implementierungen ***/
+
+func anEmptyDirectory() error {
+	return testWorld().newDirectory()
+}
+
+func anLDAPDirectoryWithUsers(tbl *godog.Table) error {
+	w := testWorld()
+	if err := checkUserTable(tbl); err != nil {
+		return err
+	}
+	if err := w.newDirectory(); err != nil {
+		return err
+	}
+	return w.dir.SeedTable(tableRows(tbl))
+}
+
 func anLDAPDirectoryWithMatchingUsers(n int) error {
 	w := testWorld()
+	if err := w.newDirectory(); err != nil {
+		return err
+	}
 	// Basismenge mit 2 Matches („anna“ im Namen) + Non-Matches
-	w.users = map[string]string{
-		"anna.smith": "Anna Smith",
-		"joanna.roe": "Joanna Roe",
-		"bob":        "Bob Doe",
-		"charlie":    "Charlie Brown",
+	rows := [][]string{
+		{"uid", "displayName"},
+		{"anna.smith", "Anna Smith"},
+		{"joanna.roe", "Joanna Roe"},
+		{"bob", "Bob Doe"},
+		{"charlie", "Charlie Brown"},
 	}
 	// auf n Matches auffüllen
 	for i := 3; i <= n; i++ {
-		uid := "anna" + strconv.Itoa(i)
-		w.users[uid] = "Anna " + strconv.Itoa(i)
+		rows = append(rows, []string{"anna" + strconv.Itoa(i), "Anna " + strconv.Itoa(i)})
 	}
-	return nil
+	return w.dir.SeedTable(rows)
 }
 
 func iCreateUserWithDisplayName(uid, dn string) error {
 	w := testWorld()
-	if dn == "" {
-		w.lastErr = fmt.Errorf("INVALID_INPUT")
+	// leerer displayName ergibt eine leere CN -> der Client lehnt den DN ab
+	u := ldap.User{
+		DN:   ldapx.MustParseDN(w.dir.UsersDN()).Child("CN", dn),
+		UID:  uid,
+		UPN:  uid + "@weruminger.lan",
+		Name: dn,
+	}
+	if err := w.client.CreateUser(u); err != nil {
+		w.lastErr = err
 		w.lastHTTP = 422
-		return nil
 	}
-	w.users[uid] = dn
 	return nil
 }
 
 func theUserMustExist(uid string) error {
 	w := testWorld()
-	if _, ok := w.users[uid]; !ok {
+	got, err := w.client.SearchUsers(ldapx.Eq("sAMAccountName", uid), 0)
+	if err != nil {
+		return err
+	}
+	if len(got) != 1 {
 		return fmt.Errorf("user %s not found", uid)
 	}
 	return nil
@@ -126,14 +212,16 @@ func iReceiveAnErrorCode(code string) error {
 
 func iSearchFor(q string) error {
 	w := testWorld()
-	ql := strings.ToLower(q)
-	cnt := 0
-	for _, dn := range w.users {
-		if strings.Contains(strings.ToLower(dn), ql) {
-			cnt++
-		}
+	var f ldapx.Filter // leere Suche liefert alle Benutzer
+	if q != "" {
+		f = ldapx.Contains("displayName", q)
 	}
-	w.lastSearchCount = cnt
+	got, err := w.client.SearchUsers(f, 0)
+	if err != nil {
+		return err
+	}
+	w.lastSearchCount = len(got)
+	w.lastQuery = q
 	return nil
 }
 
@@ -145,46 +233,149 @@ func iSeeResults(n int) error {
 	return nil
 }
 
+// noPIIIsShownWhenPrivacyModeIsHigh wiederholt die letzte Suche über die
+// Web-Oberfläche (als Operator ohne audit.reveal) und prüft, dass keiner
+// der gefundenen Namen, Konten oder Mail-Adressen im HTML steht, wohl
+// aber Pseudonyme.
 func noPIIIsShownWhenPrivacyModeIsHigh() error {
 	w := testWorld()
 	if !w.privacyHigh {
 		return fmt.Errorf("privacy not high")
 	}
-	// hier würdest du Inhalte auf PII prüfen
+	if w.web == nil {
+		if err := theSystemIsRunning(); err != nil {
+			return err
+		}
+	}
+	if err := w.login(operatorUID, operatorPassword, true); err != nil {
+		return err
+	}
+	req := httptest.NewRequest(http.MethodGet, "/?q="+url.QueryEscape(w.lastQuery), nil)
+	for _, c := range w.cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	w.web.ServeHTTP(rec, req)
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK {
+		return fmt.Errorf("search page: HTTP %d", rec.Code)
+	}
+	users, err := w.client.SearchUsers(ldapx.Contains("displayName", w.lastQuery), 0)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		for _, v := range []string{u.Name, u.UID, u.Mail} {
+			if v != "" && strings.Contains(body, v) {
+				return fmt.Errorf("PII %q shown", v)
+			}
+		}
+	}
+	if len(users) > 0 && !strings.Contains(body, "<td>p-") {
+		return fmt.Errorf("no pseudonyms shown")
+	}
 	return nil
 }
 
+// Zugangsdaten des Operators, den "the system is running" anlegt.
+const (
+	operatorUID      = "operator"
+	operatorPassword = "Op3rator!"
+)
+
+// theSystemIsRunning legt den Operator samt Rollengruppe im Verzeichnis an
+// und startet die Web-Oberfläche gegen den echten LDAP-Client.
 func theSystemIsRunning() error {
-	// Healthcheck/Mocks hier
+	w := testWorld()
+	if err := w.dir.SeedTable([][]string{{"uid", "displayName"}, {operatorUID, "Operator"}}); err != nil {
+		return err
+	}
+	if err := w.dir.SetPassword("CN=Operator,"+w.dir.UsersDN(), operatorPassword); err != nil {
+		return err
+	}
+	// ohne Rolle kein Login: der Operator ist Mitglied der Admin-Gruppe
+	admins := "CN=Go-AD-Admins," + w.dir.BaseDN
+	if err := w.dir.AddGroup(admins, "CN=Operator,"+w.dir.UsersDN()); err != nil {
+		return err
+	}
+	cfg := w.dir.Config()
+	cfg.Roles = map[string][]string{"superadmin": {admins}}
+	cfg.PrivacyLevel = "low"
+	if w.privacyHigh {
+		cfg.PrivacyLevel = "high"
+	}
+	w.webServer = web.NewServer(cfg, web.WithDirectory(w.client))
+	w.web = w.webServer.Handler()
 	return nil
 }
 
-func iSubmitValidCredentials() error {
-	w := testWorld()
-	w.sessionCookie = true
-	w.lastHTTP = 200
+var reCSRF = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+// login holt wie ein Browser das Formular (Session-Cookie + CSRF-Token),
+// schickt es ab und merkt sich Status und Session-Cookie. Ohne withToken
+// fehlt das Token im Formular.
+func (w *world) login(user, password string, withToken bool) error {
+	rec := httptest.NewRecorder()
+	w.web.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login", nil))
+	m := reCSRF.FindStringSubmatch(rec.Body.String())
+	if m == nil {
+		return fmt.Errorf("login form without CSRF token (HTTP %d)", rec.Code)
+	}
+	form := url.Values{"user": {user}, "password": {password}}
+	if withToken {
+		form.Set("csrf_token", m[1])
+	}
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rec = httptest.NewRecorder()
+	w.web.ServeHTTP(rec, req)
+	w.lastHTTP = rec.Code
+	w.sessionCookie = false
+	w.cookies = rec.Result().Cookies()
+	for _, c := range w.cookies {
+		if c.Name == "go_ad_session" && c.Value != "" && c.HttpOnly && c.SameSite != http.SameSiteDefaultMode {
+			w.sessionCookie = true
+		}
+	}
 	return nil
 }
 
+func iSubmitValidCredentials() error {
+	return testWorld().login(operatorUID, operatorPassword, true)
+}
+
+func iSubmitValidCredentialsWithoutACSRFToken() error {
+	return testWorld().login(operatorUID, operatorPassword, false)
+}
+
 func iReceiveASessionCookie() error {
 	w := testWorld()
 	if !w.sessionCookie {
-		return fmt.Errorf("no session cookie")
+		return fmt.Errorf("no session cookie (HTTP %d)", w.lastHTTP)
 	}
 	return nil
 }
 
 func iSubmitAnInvalidPassword() error {
-	w := testWorld()
-	w.failedAttempts++
-	w.lastHTTP = 401
+	return testWorld().login(operatorUID, "wrong", true)
+}
+
+func iSubmitAnInvalidPasswordTimes(n int) error {
+	for i := 0; i < n; i++ {
+		if err := iSubmitAnInvalidPassword(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func theFailedattemptCounterIsIncremented() error {
 	w := testWorld()
-	if w.failedAttempts < 1 {
-		return fmt.Errorf("failed-attempt counter not incremented")
+	if n := w.webServer.LoginStats().FailsLastHour; n < 1 {
+		return fmt.Errorf("failed-attempt counter is %d", n)
 	}
 	return nil
 }
@@ -202,6 +393,7 @@ func iGetHTTP(code int) error {
 func InitializeScenario(sc *godog.ScenarioContext) {
 	_w = &world{}
 	sc.Before(_w.reset)
+	sc.After(_w.teardown)
 
 	sc.Step(`^an empty directory$`, anEmptyDirectory)
 	sc.Step(`^an LDAP directory with users:$`, anLDAPDirectoryWithUsers)
@@ -217,12 +409,15 @@ func InitializeScenario(sc *godog.ScenarioContext) {
 
 	sc.Step(`^the system is running$`, theSystemIsRunning)
 	sc.Step(`^I submit valid credentials$`, iSubmitValidCredentials)
+	sc.Step(`^I submit valid credentials without a CSRF token$`, iSubmitValidCredentialsWithoutACSRFToken)
 	sc.Step(`^I receive a session cookie$`, iReceiveASessionCookie)
 	sc.Step(`^I submit an invalid password$`, iSubmitAnInvalidPassword)
+	sc.Step(`^I submit an invalid password (\d+) times$`, iSubmitAnInvalidPasswordTimes)
 	sc.Step(`^the failed-attempt counter is incremented$`, theFailedattemptCounterIsIncremented)
 	sc.Step(`^I get HTTP (\d+)$`, iGetHTTP)
 	// <- hier die Zusatzsteps dazuhängen:
 	RegisterSeedSteps(sc)
+	RegisterKeaSteps(sc)
 }
 
 /*** Suite (Strict + robuster Feature-Pfad) ***/
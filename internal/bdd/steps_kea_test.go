@@ -0,0 +1,98 @@
+package bdd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cucumber/godog"
+
+	"github.com/Weruminger/go-ad-admin/internal/kea"
+	"github.com/Weruminger/go-ad-admin/internal/kea/keatest"
+)
+
+// newKea ersetzt den Kea-Fake durch einen leeren und verbindet den Client neu.
+// Kurzer Timeout und Backoff, damit Fehlerszenarien schnell durchlaufen.
+func (w *world) newKea() error {
+	w.closeKea()
+	w.kea = keatest.NewServer()
+	cfg := w.kea.Config()
+	cfg.KeaTimeout = 100 * time.Millisecond
+	c, err := kea.NewClient(cfg)
+	if err != nil {
+		return err
+	}
+	c.Backoff = time.Millisecond
+	w.keaClient = c
+	return nil
+}
+
+func (w *world) closeKea() {
+	if w.kea != nil {
+		w.kea.Close()
+		w.kea = nil
+	}
+	w.keaClient = nil
+}
+
+// Given Kea has leases:
+//
+//	| ip | mac | host |
+func keaHasLeases(tbl *godog.Table) error {
+	w := testWorld()
+	rows := tableRows(tbl)
+	if len(rows) < 2 || len(rows[0]) < 3 || strings.ToLower(rows[0][0]) != "ip" {
+		return fmt.Errorf("expected header: ip | mac | host")
+	}
+	for _, r := range rows[1:] {
+		if err := w.kea.AddLease(keatest.Lease{IPAddress: r[0], HWAddress: r[1], Hostname: r[2]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Given Kea fails the next 2 "lease4-get-all" calls with HTTP 500|a timeout|result 1
+func keaFailsNextCalls(n int, cmd, kind string) error {
+	faults := map[string]keatest.Fault{
+		"HTTP 500":  keatest.FaultHTTP500,
+		"a timeout": keatest.FaultTimeout,
+		"result 1":  keatest.FaultResult,
+	}
+	f, ok := faults[kind]
+	if !ok {
+		return fmt.Errorf("unknown fault %q", kind)
+	}
+	testWorld().kea.Fail(cmd, n, f)
+	return nil
+}
+
+func iListTheLeases() error {
+	w := testWorld()
+	leases, err := w.keaClient.Leases(context.Background())
+	if err != nil {
+		w.lastErr = err
+		return nil
+	}
+	w.lastLeaseCount = len(leases)
+	return nil
+}
+
+func iSeeLeases(n int) error {
+	w := testWorld()
+	if w.lastErr != nil {
+		return fmt.Errorf("unexpected error: %v", w.lastErr)
+	}
+	if w.lastLeaseCount != n {
+		return fmt.Errorf("got %d leases, want %d", w.lastLeaseCount, n)
+	}
+	return nil
+}
+
+func RegisterKeaSteps(sc *godog.ScenarioContext) {
+	sc.Step(`^Kea has leases:$`, keaHasLeases)
+	sc.Step(`^Kea fails the next (\d+) "([^"]*)" calls with (HTTP 500|a timeout|result 1)$`, keaFailsNextCalls)
+	sc.Step(`^I list the leases$`, iListTheLeases)
+	sc.Step(`^I see (\d+) leases$`, iSeeLeases)
+}
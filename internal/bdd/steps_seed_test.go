@@ -9,26 +9,21 @@ import (
 
 /*** Helpers (werden von Steps aufgerufen) ***/
 
-func seedUsers(m map[string]string) {
-	w := testWorld()
-	if w.users == nil {
-		w.users = map[string]string{}
-	}
-	for uid, dn := range m {
-		w.users[uid] = dn
-	}
+func seedUsers(rows [][]string) error {
+	return testWorld().dir.SeedTable(rows)
 }
 
-func seedUsersWithPrefix(n int, prefix, displayBase string) {
-	w := testWorld()
-	if w.users == nil {
-		w.users = map[string]string{}
+func seedUsersWithPrefix(n int, prefix, displayBase string) error {
+	if n == 0 {
+		return nil
 	}
+	rows := [][]string{{"uid", "displayName"}}
 	for i := 1; i <= n; i++ {
 		uid := fmt.Sprintf("%s%d", prefix, i)
 		dn := fmt.Sprintf("%s %d", displayBase, i)
-		w.users[uid] = dn
+		rows = append(rows, []string{uid, dn})
 	}
+	return seedUsers(rows)
 }
 
 func setPrivacyHigh(high bool) {
@@ -63,27 +58,10 @@ func privacyModeIs(mode string) error {
 //
 // (Alias zu anLDAPDirectoryWithUsers, aber „additiv“ statt überschreibend)
 func ldapContainsUsers(tbl *godog.Table) error {
-	if len(tbl.Rows) < 2 {
-		return fmt.Errorf("table needs header + at least 1 row")
+	if err := checkUserTable(tbl); err != nil {
+		return err
 	}
-	h := tbl.Rows[0].Cells
-	if len(h) < 2 || strings.ToLower(h[0].Value) != "uid" || strings.ToLower(h[1].Value) != "displayname" {
-		return fmt.Errorf("expected header: uid | displayName")
-	}
-	m := make(map[string]string, len(tbl.Rows)-1)
-	for _, r := range tbl.Rows[1:] {
-		if len(r.Cells) < 2 {
-			return fmt.Errorf("row needs 2 cells")
-		}
-		uid := strings.TrimSpace(r.Cells[0].Value)
-		dn := strings.TrimSpace(r.Cells[1].Value)
-		if uid == "" || dn == "" {
-			return fmt.Errorf("uid/displayName must not be empty")
-		}
-		m[uid] = dn
-	}
-	seedUsers(m)
-	return nil
+	return seedUsers(tableRows(tbl))
 }
 
 // Given LDAP contains 5 users with prefix "anna" and display base "Anna"
@@ -91,8 +69,7 @@ func ldapContainsNWithPrefixAndBase(n int, prefix, displayBase string) error {
 	if n < 0 {
 		return fmt.Errorf("n must be >= 0")
 	}
-	seedUsersWithPrefix(n, prefix, displayBase)
-	return nil
+	return seedUsersWithPrefix(n, prefix, displayBase)
 }
 
 // Then privacy mode should be "high"|"low"
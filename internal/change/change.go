@@ -0,0 +1,221 @@
+// Package change describes writes to the directory and to Kea for the
+// audit log: which object, its state before and after (serialised with a
+// modelx codec) and the fields that differ. Secrets are redacted before
+// anything is serialised.
+package change
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Weruminger/go-ad-admin/internal/modelx"
+)
+
+// Kinds of changed objects, as in the kind field of the domain types.
+const (
+	ADUser          = "ADUser"
+	ADGroup         = "ADGroup"
+	DHCPLease       = "DHCPLease"
+	DHCPReservation = "DHCPReservation"
+	DHCPSubnet      = "DHCPSubnet"
+)
+
+// Redacted replaces the value of every secret field.
+const Redacted = "[redacted]"
+
+// Codec serialises Before and After.
+var Codec modelx.Codec = modelx.JSON{}
+
+// Record is one successful write.
+type Record struct {
+	Kind   string  `json:"kind"`
+	ID     string  `json:"id"`     // DN, IP address, <subnet>/<ip> or subnet id
+	Action string  `json:"action"` // create, update, delete, move, unlock, ...
+	MAC    string  `json:"mac,omitempty"`
+	Format string  `json:"format"`           // of Before and After
+	Before string  `json:"before,omitempty"` // "" for create
+	After  string  `json:"after,omitempty"`  // "" for delete
+	Diff   []Field `json:"diff,omitempty"`
+}
+
+// Field is one changed value; Path is dotted ("options.routers"). Old is
+// nil for added, New for removed values.
+type Field struct {
+	Path string `json:"path"`
+	Old  any    `json:"old"`
+	New  any    `json:"new"`
+}
+
+// Op is the audit op of r, e.g. "aduser.unlock".
+func (r Record) Op() string { return strings.ToLower(r.Kind) + "." + r.Action }
+
+// New builds the record of a change from before to after; nil stands for
+// "did not exist". Both are serialised with Codec, secret fields (see
+// secret) redacted on the way.
+func New(kind, id, action string, before, after any) (Record, error) {
+	r := Record{Kind: kind, ID: id, Action: action, Format: Codec.Format()}
+	b, err := normalise(before)
+	if err != nil {
+		return r, fmt.Errorf("change %s %s: before: %w", kind, id, err)
+	}
+	a, err := normalise(after)
+	if err != nil {
+		return r, fmt.Errorf("change %s %s: after: %w", kind, id, err)
+	}
+	if r.Before, err = encode(b); err != nil {
+		return r, err
+	}
+	if r.After, err = encode(a); err != nil {
+		return r, err
+	}
+	r.Diff = Diff(b, a)
+	return r, nil
+}
+
+// normalise turns v into its generic codec form (maps, slices, scalars)
+// and redacts secrets.
+func normalise(v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	raw, err := Codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	if err := Codec.Unmarshal(raw, &out); err != nil {
+		return nil, err
+	}
+	return Redact(out), nil
+}
+
+func encode(v any) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	b, err := Codec.Marshal(v)
+	return string(b), err
+}
+
+// Redact replaces the values of secret keys in maps (at any depth) by
+// Redacted and returns v. Flags such as mustChangePassword stay readable.
+func Redact(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, x := range v {
+			if _, flag := x.(bool); secret(k) && !flag {
+				v[k] = Redacted
+			} else {
+				v[k] = Redact(x)
+			}
+		}
+	case []any:
+		for i, x := range v {
+			v[i] = Redact(x)
+		}
+	}
+	return v
+}
+
+// secret reports whether a field name holds a credential.
+func secret(key string) bool {
+	k := strings.ToLower(key)
+	for _, s := range []string{"password", "passwd", "pwd", "secret", "token", "credential"} {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	return strings.HasSuffix(k, "key")
+}
+
+// Diff lists the differing fields of two normalised values, maps compared
+// key by key, everything else as a whole.
+func Diff(before, after any) []Field {
+	var out []Field
+	diff("", before, after, &out)
+	return out
+}
+
+func diff(path string, a, b any, out *[]Field) {
+	am, aok := a.(map[string]any)
+	bm, bok := b.(map[string]any)
+	if (aok && bok) || (a == nil && bok) || (aok && b == nil) {
+		keys := map[string]bool{}
+		for k := range am {
+			keys[k] = true
+		}
+		for k := range bm {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			diff(p, am[k], bm[k], out)
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		*out = append(*out, Field{Path: path, Old: a, New: b})
+	}
+}
+
+// Recorder receives the records of successful writes. An error means the
+// change is done but not audited; callers must not report plain success.
+type Recorder interface {
+	Record(Record) error
+}
+
+// RecorderFunc adapts a function to Recorder.
+type RecorderFunc func(Record) error
+
+func (f RecorderFunc) Record(r Record) error { return f(r) }
+
+type ctxKey struct{}
+
+// NewContext returns ctx carrying rec, for clients whose writes take a
+// context (kea).
+func NewContext(ctx context.Context, rec Recorder) context.Context {
+	return context.WithValue(ctx, ctxKey{}, rec)
+}
+
+// FromContext returns the Recorder of ctx, nil if there is none.
+func FromContext(ctx context.Context) Recorder {
+	rec, _ := ctx.Value(ctxKey{}).(Recorder)
+	return rec
+}
+
+// Fields flattens r into audit entry data; "target" (and "mac") make the
+// entry findable by the audit query.
+func (r Record) Fields() map[string]any {
+	m := map[string]any{
+		"kind": r.Kind, "target": r.ID, "action": r.Action, "format": r.Format,
+	}
+	if r.MAC != "" {
+		m["mac"] = r.MAC
+	}
+	if r.Before != "" {
+		m["before"] = r.Before
+	}
+	if r.After != "" {
+		m["after"] = r.After
+	}
+	if len(r.Diff) > 0 {
+		// round-trip so the data looks the same in memory as read back
+		var diff []any
+		b, _ := json.Marshal(r.Diff)
+		_ = json.Unmarshal(b, &diff)
+		m["diff"] = diff
+	}
+	return m
+}
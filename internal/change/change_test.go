@@ -0,0 +1,43 @@
+package change
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	before := map[string]any{"sam": "anna", "enabled": true, "options": map[string]any{"routers": "192.0.2.1"}}
+	after := map[string]any{"sam": "anna", "enabled": false, "options": map[string]any{"routers": "192.0.2.2", "dns": "192.0.2.53"},
+		"password": "Secr3t!", "apiKey": "k", "mustChangePassword": true}
+	r, err := New(ADUser, "CN=Anna", "update", before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Op() != "aduser.update" || r.Format != "json" || r.Before == "" || strings.Contains(r.After, "Secr3t!") {
+		t.Fatalf("record %+v", r)
+	}
+	want := []Field{
+		{Path: "apiKey", New: Redacted},
+		{Path: "enabled", Old: true, New: false},
+		{Path: "mustChangePassword", New: true},
+		{Path: "options.dns", New: "192.0.2.53"},
+		{Path: "options.routers", Old: "192.0.2.1", New: "192.0.2.2"},
+		{Path: "password", New: Redacted},
+	}
+	if len(r.Diff) != len(want) {
+		t.Fatalf("diff %+v", r.Diff)
+	}
+	for i, f := range r.Diff {
+		if f != want[i] {
+			t.Fatalf("diff[%d] = %+v, want %+v", i, f, want[i])
+		}
+	}
+
+	r, _ = New(DHCPLease, "192.0.2.5", "delete", before, nil)
+	if r.After != "" || len(r.Diff) != 3 || r.Diff[0].Path != "enabled" || r.Diff[0].New != nil {
+		t.Fatalf("delete %+v", r)
+	}
+	if f := r.Fields(); f["target"] != "192.0.2.5" || f["after"] != nil || len(f["diff"].([]any)) != 3 {
+		t.Fatalf("fields %v", f)
+	}
+}
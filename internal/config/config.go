@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -19,9 +21,57 @@ type Config struct {
 	LDAPURL      string `yaml:"ldapURL,omitempty"`
 	LDAPBaseDN   string `yaml:"ldapBaseDN,omitempty"`
 	PrivacyLevel string `yaml:"privacyLevel,omitempty"` // low|high
+	PrivacyKey   string `yaml:"privacyKey,omitempty"`   // HMAC-Schlüssel der Pseudonyme, leer = SessionKey
 	LogFile      string `yaml:"logFile,omitempty"`
 	ConfigFile   string `yaml:"-"` // Pfad, aus dem geladen wurde (keine YAML-Ausgabe)
 
+	// LDAP-Verbindung (Service-Account, TLS)
+	LDAPBindDN       string        `yaml:"ldapBindDN,omitempty"`
+	LDAPBindPassword string        `yaml:"ldapBindPassword,omitempty"`
+	LDAPCAFile       string        `yaml:"ldapCAFile,omitempty"`   // PEM-Bundle, leer = System-Pool
+	LDAPStartTLS     bool          `yaml:"ldapStartTLS,omitempty"` // nur für ldap:// relevant
+	LDAPTimeout      time.Duration `yaml:"ldapTimeout,omitempty"`
+	LDAPMaxPageSize  int           `yaml:"ldapMaxPageSize,omitempty"` // AD-Default: 1000
+
+	// Delegation: je Env die Teilbäume (DNs), in denen gelesen und geschrieben
+	// werden darf. Fehlt der Eintrag für Env, ist nichts erlaubt.
+	LDAPAllowedOUs map[string][]string `yaml:"ldapAllowedOUs,omitempty"`
+
+	// Rollen (viewer, helpdesk, user-admin, dhcp-admin, auditor, superadmin) -> AD-Gruppen-DNs;
+	// verschachtelte Mitgliedschaft zählt. Ohne Rolle ist kein Login möglich.
+	Roles map[string][]string `yaml:"roles,omitempty"`
+
+	// Kea Control Agent (HTTPS, Token oder Basic Auth)
+	KeaURL      string        `yaml:"keaURL,omitempty"`
+	KeaToken    string        `yaml:"keaToken,omitempty"` // Bearer-Token, hat Vorrang vor Basic Auth
+	KeaUser     string        `yaml:"keaUser,omitempty"`
+	KeaPassword string        `yaml:"keaPassword,omitempty"`
+	KeaCAFile   string        `yaml:"keaCAFile,omitempty"`  // PEM-Bundle, leer = System-Pool
+	KeaTimeout  time.Duration `yaml:"keaTimeout,omitempty"` // je Versuch, DHCP-KEA: 2s
+
+	// Web-Sessions (serverseitig, Cookie mit SessionKey signiert)
+	SessionIdleTimeout time.Duration `yaml:"sessionIdleTimeout,omitempty"` // ohne Request, Default 30m
+	SessionMaxAge      time.Duration `yaml:"sessionMaxAge,omitempty"`      // absolut ab Login, Default 8h
+
+	// Login-Schutz, unabhängig vom Lockout des AD
+	LoginRate        int           `yaml:"loginRate,omitempty"`        // Versuche pro Minute je IP und je Benutzer, Default 10
+	LoginBurst       int           `yaml:"loginBurst,omitempty"`       // Versuche ohne Wartezeit, Default 5
+	LockoutThreshold int           `yaml:"lockoutThreshold,omitempty"` // Fehlversuche bis zur Sperre, Default 5
+	LockoutWindow    time.Duration `yaml:"lockoutWindow,omitempty"`    // Zeitraum, in dem die Fehlversuche zählen, Default 15m
+	LockoutDuration  time.Duration `yaml:"lockoutDuration,omitempty"`  // Dauer der Sperre, Default 15m
+
+	// Audit-Log (JSONL, append-only, per Hash-Kette verkettet)
+	AuditFile string `yaml:"auditFile,omitempty"`
+	AuditKey  string `yaml:"auditKey,omitempty"` // optional: hmac:<base64> oder ed25519:<base64-Seed>, signiert jeden Eintrag
+	// fsync: entry (je Eintrag, Default), batch (alle AuditSyncInterval) oder none
+	AuditSync         string        `yaml:"auditSync,omitempty"`
+	AuditSyncInterval time.Duration `yaml:"auditSyncInterval,omitempty"` // Default 1s
+	// Rotation in gzip-Segmente (Manifest neben der Datei), Aufbewahrung
+	AuditMaxSize     int64         `yaml:"auditMaxSize,omitempty"`     // Bytes, Default 100 MiB
+	AuditMaxAge      time.Duration `yaml:"auditMaxAge,omitempty"`      // Default 24h
+	AuditRetention   time.Duration `yaml:"auditRetention,omitempty"`   // 0 = Segmente nie löschen
+	AuditMaxSegments int           `yaml:"auditMaxSegments,omitempty"` // 0 = unbegrenzt
+
 	// Beispiel-AD/DHCP Settings
 	Realm     string `yaml:"realm,omitempty"`
 	DomainLAN string `yaml:"domainLAN,omitempty"`
@@ -50,6 +100,18 @@ func (c *Config) ConfigFileOrDefault() string {
 func (c *Config) SetDefaultOnEmpty() *Config {
 	c.ListenAddr = defaultIfEmpty(c.ListenAddr, getenv("GO_AD_LISTEN", ":8080"))
 	c.LogFile = defaultIfEmpty(c.LogFile, "logs/go-ad-admin.log")
+	c.AuditFile = defaultIfEmpty(c.AuditFile, getenv("GO_AD_AUDIT_FILE", "logs/audit.jsonl"))
+	c.AuditKey = defaultIfEmpty(c.AuditKey, getenv("GO_AD_AUDIT_KEY", ""))
+	c.AuditSync = defaultIfEmpty(c.AuditSync, getenv("GO_AD_AUDIT_SYNC", "entry"))
+	if c.AuditSyncInterval <= 0 {
+		c.AuditSyncInterval = time.Second
+	}
+	if c.AuditMaxSize <= 0 {
+		c.AuditMaxSize = 100 << 20
+	}
+	if c.AuditMaxAge <= 0 {
+		c.AuditMaxAge = 24 * time.Hour
+	}
 	c.Realm = defaultIfEmpty(c.Realm, "WERUMINGER.LAN")
 	c.DomainLAN = defaultIfEmpty(c.DomainLAN, "weruminger.lan")
 	c.DomainDMZ = defaultIfEmpty(c.DomainDMZ, "weruminger.dmz")
@@ -59,9 +121,73 @@ func (c *Config) SetDefaultOnEmpty() *Config {
 	c.LDAPURL = defaultIfEmpty(c.LDAPURL, getenv("GO_AD_LDAP_URL", "ldap://127.0.0.1:389"))
 	c.LDAPBaseDN = defaultIfEmpty(c.LDAPBaseDN, getenv("GO_AD_LDAP_BASEDN", "dc=weruminger, dc=eu"))
 	c.PrivacyLevel = defaultIfEmpty(c.PrivacyLevel, getenv("GO_AD_PRIVACY", "low"))
+	c.PrivacyKey = defaultIfEmpty(c.PrivacyKey, getenv("GO_AD_PRIVACY_KEY", ""))
+	c.LDAPBindDN = defaultIfEmpty(c.LDAPBindDN, getenv("GO_AD_LDAP_BIND_DN", ""))
+	c.LDAPBindPassword = defaultIfEmpty(c.LDAPBindPassword, getenv("GO_AD_LDAP_BIND_PASSWORD", ""))
+	c.LDAPCAFile = defaultIfEmpty(c.LDAPCAFile, getenv("GO_AD_LDAP_CA_FILE", ""))
+	if !c.LDAPStartTLS {
+		c.LDAPStartTLS = getenv("GO_AD_LDAP_STARTTLS", "") == "true"
+	}
+	if v := getenv("GO_AD_LDAP_ALLOWED_OUS", ""); v != "" && len(c.LDAPAllowedOUs[c.Env]) == 0 {
+		if c.LDAPAllowedOUs == nil {
+			c.LDAPAllowedOUs = map[string][]string{}
+		}
+		c.LDAPAllowedOUs[c.Env] = splitList(v, "|")
+	}
+	c.KeaURL = defaultIfEmpty(c.KeaURL, getenv("GO_AD_KEA_URL", "http://127.0.0.1:8000"))
+	c.KeaToken = defaultIfEmpty(c.KeaToken, getenv("GO_AD_KEA_TOKEN", ""))
+	c.KeaUser = defaultIfEmpty(c.KeaUser, getenv("GO_AD_KEA_USER", ""))
+	c.KeaPassword = defaultIfEmpty(c.KeaPassword, getenv("GO_AD_KEA_PASSWORD", ""))
+	c.KeaCAFile = defaultIfEmpty(c.KeaCAFile, getenv("GO_AD_KEA_CA_FILE", ""))
+	if c.KeaTimeout <= 0 {
+		c.KeaTimeout = 2 * time.Second
+	}
+	if c.SessionIdleTimeout <= 0 {
+		c.SessionIdleTimeout = 30 * time.Minute
+	}
+	if c.SessionMaxAge <= 0 {
+		c.SessionMaxAge = 8 * time.Hour
+	}
+	if c.LoginRate <= 0 {
+		c.LoginRate = 10
+	}
+	if c.LoginBurst <= 0 {
+		c.LoginBurst = 5
+	}
+	if c.LockoutThreshold <= 0 {
+		c.LockoutThreshold = 5
+	}
+	if c.LockoutWindow <= 0 {
+		c.LockoutWindow = 15 * time.Minute
+	}
+	if c.LockoutDuration <= 0 {
+		c.LockoutDuration = 15 * time.Minute
+	}
+	if c.LDAPTimeout <= 0 {
+		c.LDAPTimeout = 5 * time.Second
+	}
+	if c.LDAPMaxPageSize <= 0 {
+		c.LDAPMaxPageSize = 1000
+	}
 	return c
 }
 
+// AllowedOUs liefert die Whitelist für die aktuelle Env.
+func (c *Config) AllowedOUs() []string {
+	return c.LDAPAllowedOUs[c.Env]
+}
+
+// splitList trennt an sep und verwirft leere Elemente (DNs enthalten Kommas).
+func splitList(v, sep string) []string {
+	var out []string
+	for _, p := range strings.Split(v, sep) {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
 func getenv(k, def string) string {
 	if v := os.Getenv(k); v != "" {
 		return v
@@ -30,3 +30,25 @@ func TestFromEnvOverrides(t *testing.T) {
 		t.Fatalf("got %s", c.SessionKey)
 	}
 }
+
+func TestAllowedOUs_FromEnv(t *testing.T) {
+	t.Setenv("GO_AD_ENV", "test")
+	t.Setenv("GO_AD_LDAP_ALLOWED_OUS", "OU=Staff,DC=weruminger,DC=eu | OU=Guests,DC=weruminger,DC=eu|")
+
+	c := new(Config).SetDefaultOnEmpty()
+	got := c.AllowedOUs()
+	if len(got) != 2 || got[0] != "OU=Staff,DC=weruminger,DC=eu" || got[1] != "OU=Guests,DC=weruminger,DC=eu" {
+		t.Fatalf("got %q", got)
+	}
+
+	// ein Eintrag aus der YAML-Datei hat Vorrang
+	c = &Config{LDAPAllowedOUs: map[string][]string{"test": {"OU=Yaml,DC=weruminger,DC=eu"}}}
+	c.SetDefaultOnEmpty()
+	if got := c.AllowedOUs(); len(got) != 1 || got[0] != "OU=Yaml,DC=weruminger,DC=eu" {
+		t.Fatalf("got %q", got)
+	}
+	c.Env = "prod"
+	if got := c.AllowedOUs(); len(got) != 0 {
+		t.Fatalf("prod has no whitelist, got %q", got)
+	}
+}
@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/modelx"
+)
+
+var reGroupName = regexp.MustCompile(`^[^"/\\\[\]:;|=,+*?<>]{1,256}$`)
+
+type ADGroup struct {
+	*modelx.Base `json:"-" yaml:"-"`
+	modelx.State `json:"-" yaml:"-"`
+	Kind         string         `json:"kind" yaml:"kind"`       // "ADGroup"
+	Version      string         `json:"version" yaml:"version"` // "v1"
+	Name         string         `json:"name" yaml:"name"`       // sAMAccountName
+	DN           string         `json:"dn,omitempty" yaml:"dn,omitempty"`
+	Description  string         `json:"description,omitempty" yaml:"description,omitempty"`
+	Mail         string         `json:"mail,omitempty" yaml:"mail,omitempty"`
+	Type         string         `json:"type" yaml:"type"`                           // security|distribution
+	Scope        string         `json:"scope" yaml:"scope"`                         // global|domainLocal|universal
+	Members      []string       `json:"members,omitempty" yaml:"members,omitempty"` // direct member DNs
+	Meta         map[string]any `json:"meta,omitempty" yaml:"meta,omitempty"`
+}
+
+func NewADGroup(b *modelx.Base) *ADGroup {
+	return &ADGroup{Base: b, Kind: "ADGroup", Version: "v1", Type: "security", Scope: "global", Meta: map[string]any{}}
+}
+
+func init() {
+	modelx.Register("ADGroup", "v1", NewADGroup, (*ADGroup).validate)
+}
+
+func (g *ADGroup) Validate() *ADGroup { return modelx.Validate(g) }
+
+func (g *ADGroup) Load(ctx context.Context, uri string) *ADGroup {
+	return modelx.Load(ctx, g, uri)
+}
+
+func (g *ADGroup) Save(ctx context.Context, uri, format string) *ADGroup {
+	return modelx.Save(ctx, g, uri, format)
+}
+
+func (g *ADGroup) Serialize(format string) (string, error) { return modelx.Serialize(g, format) }
+
+func (g *ADGroup) Deserialize(format, data string) *ADGroup {
+	return modelx.Deserialize(g, format, data)
+}
+
+// validate adds the field errors of g, see modelx.Register.
+func (g *ADGroup) validate() {
+	op := errs.Op("adgroup.Validate")
+	if strings.TrimSpace(g.Name) == "" || !reGroupName.MatchString(g.Name) {
+		g.SetInvalid(op, "name", `must be 1..256 chars without "/\[]:;|=,+*?<>`)
+	}
+	switch g.Type {
+	case "security", "distribution":
+	default:
+		g.SetInvalid(op, "type", "must be security or distribution")
+	}
+	switch g.Scope {
+	case "global", "domainLocal", "universal":
+	default:
+		g.SetInvalid(op, "scope", "must be global, domainLocal or universal")
+	}
+}
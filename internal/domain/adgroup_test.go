@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/modelx"
+)
+
+func TestADGroup_Validate_Errors(t *testing.T) {
+	g := NewADGroup(baseJSON())
+	g.Name = "bad,name"
+	g.Scope = "forest"
+	if g.Validate().Err() == nil || !errs.IsCode(g.Err(), errs.InvalidInput) {
+		t.Fatalf("want INVALID_INPUT got %v", g.Err())
+	}
+}
+
+func TestADGroup_Save_Load_Roundtrip(t *testing.T) {
+	b := baseJSON()
+	path := t.TempDir() + "/group.json"
+	exp := NewADGroup(b)
+	exp.Name = "GG-Admins"
+	exp.Type = "distribution"
+	exp.Scope = "universal"
+	exp.Members = []string{"CN=Anna,OU=Staff,DC=weruminger,DC=eu"}
+
+	if exp.Save(context.Background(), "file://"+path, "json"); exp.Err() != nil {
+		t.Fatalf("save: %v", exp.Err())
+	}
+	got := NewADGroup(b).Load(context.Background(), "file://"+path)
+	if got.Err() != nil {
+		t.Fatalf("load: %v", got.Err())
+	}
+	if got.Name != exp.Name || got.Scope != "universal" || len(got.Members) != 1 {
+		t.Fatalf("mismatch %+v", got)
+	}
+}
+
+func TestADGroup_Serialize_YAML(t *testing.T) {
+	g := NewADGroup(baseYAML())
+	g.Name = "GG-Staff"
+	out, err := g.Serialize("yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "kind: ADGroup") || !strings.Contains(out, "scope: global") {
+		t.Fatalf("yaml:\n%s", out)
+	}
+	back := NewADGroup(baseYAML()).Deserialize("yaml", out)
+	if back.Err() != nil || back.Name != "GG-Staff" || back.Type != "security" {
+		t.Fatalf("deserialize %+v %v", back, back.Err())
+	}
+}
+
+func TestLoadAny(t *testing.T) {
+	b, ctx := baseJSON(), context.Background()
+	dir := t.TempDir()
+	g := NewADGroup(b)
+	g.Name = "GG-Staff"
+	u := NewADUser(b)
+	u.SAM, u.UPN = "anna", "anna@example.com"
+	if g.Save(ctx, "file://"+dir+"/g.json", "json").Err() != nil || u.Save(ctx, "file://"+dir+"/u.json", "json").Err() != nil {
+		t.Fatal(g.Err(), u.Err())
+	}
+	if o, err := modelx.LoadAny(ctx, b, "file://"+dir+"/g.json"); err != nil || o.(*ADGroup).Name != "GG-Staff" {
+		t.Fatalf("group: %#v %v", o, err)
+	}
+	if o, err := modelx.LoadAny(ctx, b, "file://"+dir+"/u.json"); err != nil || o.(*ADUser).SAM != "anna" {
+		t.Fatalf("user: %#v %v", o, err)
+	}
+	if wrong := NewADUser(b).Load(ctx, "file://"+dir+"/g.json"); !errs.IsCode(wrong.Err(), errs.InvalidInput) {
+		t.Fatalf("group loaded as user: %v", wrong.Err())
+	}
+	want := []string{"ADGroup", "ADUser", "DHCPLease", "DHCPReservation", "DHCPSubnet", "FeatureSpec"}
+	kinds := modelx.Kinds()
+	if len(kinds) != len(want) {
+		t.Fatalf("kinds: %v", kinds)
+	}
+	for i, k := range kinds {
+		if k.Kind != want[i] || k.Version != "v1" {
+			t.Fatalf("kinds: %v", kinds)
+		}
+	}
+}
@@ -2,7 +2,6 @@ package domain
 
 import (
 	"context"
-	"fmt"
 	"regexp"
 	"strings"
 	"time"
@@ -15,13 +14,17 @@ var reSam = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
 
 type ADUser struct {
 	*modelx.Base `json:"-" yaml:"-"`
+	modelx.State `json:"-" yaml:"-"`
 	Kind         string         `json:"kind" yaml:"kind"`       // "ADUser"
 	Version      string         `json:"version" yaml:"version"` // "v1"
 	SAM          string         `json:"sam" yaml:"sam"`         // sAMAccountName
 	UPN          string         `json:"upn" yaml:"upn"`         // user@realm
+	DN           string         `json:"dn,omitempty" yaml:"dn,omitempty"`
 	Display      string         `json:"display,omitempty" yaml:"display,omitempty"`
 	Mail         string         `json:"mail,omitempty" yaml:"mail,omitempty"`
 	Enabled      bool           `json:"enabled" yaml:"enabled"`
+	Locked       bool           `json:"locked,omitempty" yaml:"locked,omitempty"`                         // only true -> false can be saved
+	MustChangePW bool           `json:"mustChangePassword,omitempty" yaml:"mustChangePassword,omitempty"` // pwdLastSet=0
 	ExpiresAt    *time.Time     `json:"expiresAt,omitempty" yaml:"expiresAt,omitempty"`
 	Meta         map[string]any `json:"meta,omitempty" yaml:"meta,omitempty"`
 }
@@ -30,113 +33,33 @@ func NewADUser(b *modelx.Base) *ADUser {
 	return &ADUser{Base: b, Kind: "ADUser", Version: "v1", Enabled: true, Meta: map[string]any{}}
 }
 
-func (u *ADUser) Init() *ADUser { return u }
-
-func (u *ADUser) Validate() *ADUser {
-	if u.Err() != nil {
-		return u
-	}
-	op := errs.Op("aduser.Validate")
-	if strings.TrimSpace(u.SAM) == "" || !reSam.MatchString(u.SAM) {
-		u.SetInvalid(op, "sam", "must be 1..64 chars [A-Za-z0-9._-]")
-	}
-	if !strings.Contains(u.UPN, "@") {
-		u.SetInvalid(op, "upn", "must contain @realm")
-	}
-	return u
+func init() {
+	modelx.Register("ADUser", "v1", NewADUser, (*ADUser).validate)
 }
 
-// helper to set INVALID_INPUT with field info
-func (u *ADUser) SetInvalid(op errs.Op, field, msg string) {
-	u.BaseSetErr(op, errs.InvalidInput, fmt.Errorf("%s: %s", field, msg), map[string]any{"field": field})
-}
-
-func (u *ADUser) BaseSetErr(op errs.Op, code errs.Code, err error, fields map[string]any) {
-	u.Base.SetErr(op, code, err, fields)
-}
+func (u *ADUser) Validate() *ADUser { return modelx.Validate(u) }
 
 func (u *ADUser) Load(ctx context.Context, uri string) *ADUser {
-	if u.Err() != nil {
-		return u
-	}
-	op := errs.Op("aduser.Load")
-	store, _, err := u.Base.PickStore(uri)
-	if err != nil {
-		u.Base.SetErr(op, errs.InvalidInput, err, map[string]any{"uri": uri})
-		return u
-	}
-	raw, err := store.Load(ctx, uri)
-	if err != nil {
-		u.Base.SetErr(op, errs.NotFound, err, map[string]any{"uri": uri})
-		return u
-	}
-	cdc, err := u.Base.PickCodec(modelxFormatFromURI(uri, u.Base))
-	if err != nil {
-		u.Base.SetErr(op, errs.InvalidInput, err, nil)
-		return u
-	}
-	if err := cdc.Unmarshal(raw, u); err != nil {
-		u.Base.SetErr(op, errs.InvalidInput, err, nil)
-		return u
-	}
-	return u.Validate()
+	return modelx.Load(ctx, u, uri)
 }
 
 func (u *ADUser) Save(ctx context.Context, uri, format string) *ADUser {
-	if u.Err() != nil {
-		return u
-	}
-	op := errs.Op("aduser.Save")
-	u = u.Validate()
-	if u.Err() != nil {
-		return u
-	}
-	cdc, err := u.Base.PickCodec(format)
-	if err != nil {
-		u.Base.SetErr(op, errs.InvalidInput, err, map[string]any{"fmt": format})
-		return u
-	}
-	raw, err := cdc.Marshal(u)
-	if err != nil {
-		u.Base.SetErr(op, errs.Internal, err, nil)
-		return u
-	}
-	store, _, err := u.Base.PickStore(uri)
-	if err != nil {
-		u.Base.SetErr(op, errs.InvalidInput, err, map[string]any{"uri": uri})
-		return u
-	}
-	if err := store.Save(ctx, uri, raw); err != nil {
-		u.Base.SetErr(op, errs.Unavailable, err, nil)
-		return u
-	}
-	return u
+	return modelx.Save(ctx, u, uri, format)
 }
 
-func (u *ADUser) Serialize(format string) (string, error) {
-	cdc, err := u.Base.PickCodec(format)
-	if err != nil {
-		return "", errs.Wrap("aduser.Serialize", err, errs.InvalidInput)
-	}
-	b, err := cdc.Marshal(u)
-	if err != nil {
-		return "", errs.Wrap("aduser.Serialize", err, errs.Internal)
-	}
-	return string(b), nil
-}
+func (u *ADUser) Serialize(format string) (string, error) { return modelx.Serialize(u, format) }
 
 func (u *ADUser) Deserialize(format, data string) *ADUser {
-	if u.Err() != nil {
-		return u
-	}
-	cdc, err := u.Base.PickCodec(format)
-	if err != nil {
-		u.Base.SetErr("aduser.Deserialize", errs.InvalidInput, err, nil)
-		return u
+	return modelx.Deserialize(u, format, data)
+}
+
+// validate adds the field errors of u, see modelx.Register.
+func (u *ADUser) validate() {
+	op := errs.Op("aduser.Validate")
+	if strings.TrimSpace(u.SAM) == "" || !reSam.MatchString(u.SAM) {
+		u.SetInvalid(op, "sam", "must be 1..64 chars [A-Za-z0-9._-]")
 	}
-	if err := cdc.Unmarshal([]byte(data), u); err != nil {
-		u.Base.SetErr("aduser.Deserialize", errs.InvalidInput, err, nil)
-		return u
+	if !strings.Contains(u.UPN, "@") {
+		u.SetInvalid(op, "upn", "must contain @realm")
 	}
-	return u.Validate()
 }
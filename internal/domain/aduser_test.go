@@ -2,6 +2,9 @@ package domain
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -24,6 +27,14 @@ func TestADUser_Validate_Errors(t *testing.T) {
 	if !errs.IsCode(u.Err(), errs.InvalidInput) {
 		t.Fatalf("want INVALID_INPUT got %v", u.Err())
 	}
+	fields := errs.FieldErrors(u.Err())
+	if len(fields["sam"]) != 1 || len(fields["upn"]) != 1 {
+		t.Fatalf("want sam and upn errors, got %v", fields)
+	}
+	var e *errs.E
+	if !errors.As(u.Err(), &e) || e.Op != "aduser.Validate" || e.Fields["field"] != "sam" {
+		t.Fatalf("first error: %+v", e)
+	}
 }
 
 func TestADUser_Save_Load_Roundtrip(t *testing.T) {
@@ -48,3 +59,35 @@ func TestADUser_Save_Load_Roundtrip(t *testing.T) {
 		t.Fatalf("mismatch")
 	}
 }
+
+func TestADUser_SharedBase(t *testing.T) {
+	b := baseJSON()
+	ctx := context.Background()
+	if bad := NewADUser(b).Load(ctx, "file://"+t.TempDir()+"/missing.json"); !errs.IsCode(bad.Err(), errs.NotFound) {
+		t.Fatalf("load missing: %v", bad.Err())
+	}
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			u := NewADUser(b)
+			u.SAM, u.UPN = fmt.Sprintf("user%d", i), fmt.Sprintf("user%d@example.com", i)
+			if i%2 == 1 {
+				u.UPN = "broken"
+			}
+			uri := fmt.Sprintf("file://%s/%d.json", dir, i)
+			if u.Save(ctx, uri, "json"); (u.Err() != nil) != (i%2 == 1) {
+				t.Errorf("save %d: %v", i, u.Err())
+				return
+			}
+			if i%2 == 0 {
+				if got := NewADUser(b).Load(ctx, uri); got.Err() != nil || got.SAM != u.SAM {
+					t.Errorf("load %d: %+v %v", i, got, got.Err())
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -2,7 +2,6 @@ package domain
 
 import (
 	"context"
-	"fmt"
 	"net"
 	"regexp"
 	"time"
@@ -15,6 +14,7 @@ var reHost = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
 
 type DHCPLease struct {
 	*modelx.Base `json:"-" yaml:"-"`
+	modelx.State `json:"-" yaml:"-"`
 	Kind         string    `json:"kind" yaml:"kind"`       // "DHCPLease"
 	Version      string    `json:"version" yaml:"version"` // "v1"
 	MAC          string    `json:"mac" yaml:"mac"`
@@ -28,111 +28,40 @@ func NewDHCPLease(b *modelx.Base) *DHCPLease {
 	return &DHCPLease{Base: b, Kind: "DHCPLease", Version: "v1"}
 }
 
-func (d *DHCPLease) Init() *DHCPLease { return d }
-
-func (d *DHCPLease) Validate() *DHCPLease {
-	if d.Err() != nil {
-		return d
-	}
-	op := errs.Op("dhcplease.Validate")
-	if _, err := net.ParseMAC(d.MAC); err != nil {
-		d.Base.SetErr(op, errs.InvalidInput, fmt.Errorf("mac invalid: %w", err), nil)
-	}
-	ip := net.ParseIP(d.IP)
-	if ip == nil || ip.To4() == nil {
-		d.Base.SetErr(op, errs.InvalidInput, fmt.Errorf("ip must be IPv4"), nil)
-	}
-	if !reHost.MatchString(d.Host) {
-		d.Base.SetErr(op, errs.InvalidInput, fmt.Errorf("host RFC-952/1123 invalid"), nil)
-	}
-	if !d.Start.Before(d.End) {
-		d.Base.SetErr(op, errs.InvalidInput, fmt.Errorf("start must be before end"), nil)
-	}
-	return d
+func init() {
+	modelx.Register("DHCPLease", "v1", NewDHCPLease, (*DHCPLease).validate)
 }
 
+func (d *DHCPLease) Validate() *DHCPLease { return modelx.Validate(d) }
+
 func (d *DHCPLease) Load(ctx context.Context, uri string) *DHCPLease {
-	if d.Err() != nil {
-		return d
-	}
-	op := errs.Op("dhcplease.Load")
-	store, _, err := d.Base.PickStore(uri)
-	if err != nil {
-		d.Base.SetErr(op, errs.InvalidInput, err, nil)
-		return d
-	}
-	raw, err := store.Load(ctx, uri)
-	if err != nil {
-		d.Base.SetErr(op, errs.NotFound, err, nil)
-		return d
-	}
-	cdc, err := d.Base.PickCodec(modelxFormatFromURI(uri, d.Base))
-	if err != nil {
-		d.Base.SetErr(op, errs.InvalidInput, err, nil)
-		return d
-	}
-	if err := cdc.Unmarshal(raw, d); err != nil {
-		d.Base.SetErr(op, errs.InvalidInput, err, nil)
-		return d
-	}
-	return d.Validate()
+	return modelx.Load(ctx, d, uri)
 }
 
 func (d *DHCPLease) Save(ctx context.Context, uri, format string) *DHCPLease {
-	if d.Err() != nil {
-		return d
-	}
-	op := errs.Op("dhcplease.Save")
-	d = d.Validate()
-	if d.Err() != nil {
-		return d
-	}
-	cdc, err := d.Base.PickCodec(format)
-	if err != nil {
-		d.Base.SetErr(op, errs.InvalidInput, err, nil)
-		return d
-	}
-	raw, err := cdc.Marshal(d)
-	if err != nil {
-		d.Base.SetErr(op, errs.Internal, err, nil)
-		return d
-	}
-	store, _, err := d.Base.PickStore(uri)
-	if err != nil {
-		d.Base.SetErr(op, errs.InvalidInput, err, nil)
-		return d
-	}
-	if err := store.Save(ctx, uri, raw); err != nil {
-		d.Base.SetErr(op, errs.Unavailable, err, nil)
-		return d
-	}
-	return d
+	return modelx.Save(ctx, d, uri, format)
 }
 
-func (d *DHCPLease) Serialize(format string) (string, error) {
-	cdc, err := d.Base.PickCodec(format)
-	if err != nil {
-		return "", errs.Wrap("dhcplease.Serialize", err, errs.InvalidInput)
-	}
-	b, err := cdc.Marshal(d)
-	if err != nil {
-		return "", errs.Wrap("dhcplease.Serialize", err, errs.Internal)
-	}
-	return string(b), nil
-}
+func (d *DHCPLease) Serialize(format string) (string, error) { return modelx.Serialize(d, format) }
 
 func (d *DHCPLease) Deserialize(format, data string) *DHCPLease {
-	if d.Err() != nil {
-		return d
+	return modelx.Deserialize(d, format, data)
+}
+
+// validate adds the field errors of d, see modelx.Register.
+func (d *DHCPLease) validate() {
+	op := errs.Op("dhcplease.Validate")
+	if _, err := net.ParseMAC(d.MAC); err != nil {
+		d.SetInvalid(op, "mac", err.Error())
 	}
-	cdc, err := d.Base.PickCodec(format)
-	if err != nil {
-		d.Base.SetErr("dhcplease.Deserialize", errs.InvalidInput, err, nil)
-		return d
+	ip := net.ParseIP(d.IP)
+	if ip == nil || ip.To4() == nil {
+		d.SetInvalid(op, "ip", "must be IPv4")
+	}
+	if !reHost.MatchString(d.Host) {
+		d.SetInvalid(op, "host", "RFC-952/1123 invalid")
 	}
-	if err := cdc.Unmarshal([]byte(data), d); err != nil {
-		d.Base.SetErr("dhcplease.Deserialize", errs.InvalidInput, err, nil)
-		return d
+	if !d.Start.Before(d.End) {
+		d.SetInvalid(op, "start", "must be before end")
 	}
-	return d.Validate()
 }
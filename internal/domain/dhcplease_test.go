@@ -24,6 +24,10 @@ func TestDHCPLease_Validate_Error(t *testing.T) {
 	if d.Err() == nil || !errs.IsCode(d.Err(), errs.InvalidInput) {
 		t.Fatalf("expected INVALID_INPUT, got %v", d.Err())
 	}
+	fields := errs.FieldErrors(d.Err())
+	if len(d.Errors()) != 4 || len(fields) != 4 || fields["start"][0] != "must be before end" {
+		t.Fatalf("want all four field errors, got %v", fields)
+	}
 }
 
 func TestDHCPLease_Save_Load(t *testing.T) {
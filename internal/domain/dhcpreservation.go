@@ -0,0 +1,179 @@
+package domain
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/modelx"
+)
+
+var reClientID = regexp.MustCompile(`^[0-9A-Fa-f]{2}(:[0-9A-Fa-f]{2})+$`)
+
+// DHCPOption is one entry of Kea's option-data, identified by name or code.
+type DHCPOption struct {
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	Code int    `json:"code,omitempty" yaml:"code,omitempty"`
+	Data string `json:"data" yaml:"data"`
+}
+
+// DHCPReservation is a Kea host reservation: a fixed address for the client
+// identified by exactly one of HWAddress and ClientID.
+type DHCPReservation struct {
+	*modelx.Base `json:"-" yaml:"-"`
+	modelx.State `json:"-" yaml:"-"`
+	Kind         string       `json:"kind" yaml:"kind"`       // "DHCPReservation"
+	Version      string       `json:"version" yaml:"version"` // "v1"
+	SubnetID     int          `json:"subnetId" yaml:"subnetId"`
+	HWAddress    string       `json:"hwAddress,omitempty" yaml:"hwAddress,omitempty"`
+	ClientID     string       `json:"clientId,omitempty" yaml:"clientId,omitempty"`
+	IP           string       `json:"ip" yaml:"ip"`
+	Host         string       `json:"host,omitempty" yaml:"host,omitempty"`
+	Options      []DHCPOption `json:"options,omitempty" yaml:"options,omitempty"`
+
+	// subnet context for Validate, see InSubnet
+	prefix *net.IPNet
+	pools  []ipRange
+}
+
+func NewDHCPReservation(b *modelx.Base) *DHCPReservation {
+	return &DHCPReservation{Base: b, Kind: "DHCPReservation", Version: "v1"}
+}
+
+func init() {
+	modelx.Register("DHCPReservation", "v1", NewDHCPReservation, (*DHCPReservation).validate)
+}
+
+func (r *DHCPReservation) Validate() *DHCPReservation { return modelx.Validate(r) }
+
+func (r *DHCPReservation) Load(ctx context.Context, uri string) *DHCPReservation {
+	return modelx.Load(ctx, r, uri)
+}
+
+func (r *DHCPReservation) Save(ctx context.Context, uri, format string) *DHCPReservation {
+	return modelx.Save(ctx, r, uri, format)
+}
+
+func (r *DHCPReservation) Serialize(format string) (string, error) {
+	return modelx.Serialize(r, format)
+}
+
+func (r *DHCPReservation) Deserialize(format, data string) *DHCPReservation {
+	return modelx.Deserialize(r, format, data)
+}
+
+// InSubnet makes Validate check that IP lies inside prefix and outside the
+// dynamic pools ("first - last" or CIDR, as Kea writes them).
+func (r *DHCPReservation) InSubnet(prefix string, pools ...string) *DHCPReservation {
+	if r.Err() != nil {
+		return r
+	}
+	op := errs.Op("dhcpreservation.InSubnet")
+	_, ipn, err := net.ParseCIDR(prefix)
+	if err != nil || ipn.IP.To4() == nil {
+		r.SetInvalid(op, "subnet", fmt.Sprintf("%q is not an IPv4 prefix", prefix))
+		return r
+	}
+	r.prefix, r.pools = ipn, nil
+	for _, p := range pools {
+		pr, err := parsePool(p)
+		if err != nil {
+			r.SetInvalid(op, "pools", err.Error())
+			return r
+		}
+		r.pools = append(r.pools, pr)
+	}
+	return r
+}
+
+// validate adds the field errors of r, see modelx.Register.
+func (r *DHCPReservation) validate() {
+	op := errs.Op("dhcpreservation.Validate")
+	if r.SubnetID < 1 {
+		r.SetInvalid(op, "subnetId", "must be >= 1")
+	}
+	switch {
+	case (r.HWAddress == "") == (r.ClientID == ""):
+		r.SetInvalid(op, "hwAddress", "exactly one of hwAddress and clientId is required")
+	case r.HWAddress != "":
+		if _, err := net.ParseMAC(r.HWAddress); err != nil {
+			r.SetInvalid(op, "hwAddress", err.Error())
+		}
+	case !reClientID.MatchString(r.ClientID):
+		r.SetInvalid(op, "clientId", "must be hex octets separated by ':'")
+	}
+	ip := net.ParseIP(r.IP).To4()
+	switch {
+	case ip == nil:
+		r.SetInvalid(op, "ip", "must be IPv4")
+	case r.prefix != nil && !r.prefix.Contains(ip):
+		r.SetInvalid(op, "ip", fmt.Sprintf("%s is outside subnet %s", ip, r.prefix))
+	case r.prefix != nil && (ip.Equal(r.prefix.IP) || ip.Equal(lastAddr(r.prefix))):
+		r.SetInvalid(op, "ip", fmt.Sprintf("%s is the network or broadcast address of %s", ip, r.prefix))
+	default:
+		for _, p := range r.pools {
+			if p.contains(ip) {
+				r.SetInvalid(op, "ip", fmt.Sprintf("%s lies in the dynamic pool %s", ip, p))
+				break
+			}
+		}
+	}
+	if r.Host != "" && !validHostname(r.Host) {
+		r.SetInvalid(op, "host", "RFC-952/1123 invalid")
+	}
+	for i, o := range r.Options {
+		if o.Name == "" && (o.Code < 1 || o.Code > 254) {
+			r.SetInvalid(op, fmt.Sprintf("options[%d]", i), "needs a name or a code in 1..254")
+		}
+	}
+}
+
+// validHostname accepts a host name or FQDN whose labels satisfy reHost.
+func validHostname(s string) bool {
+	if len(s) > 253 {
+		return false
+	}
+	for _, l := range strings.Split(strings.TrimSuffix(s, "."), ".") {
+		if !reHost.MatchString(l) {
+			return false
+		}
+	}
+	return true
+}
+
+// ipRange is an inclusive IPv4 address range such as a dynamic pool.
+type ipRange struct{ first, last net.IP }
+
+func (p ipRange) contains(ip net.IP) bool {
+	ip = ip.To4()
+	return bytes.Compare(ip, p.first) >= 0 && bytes.Compare(ip, p.last) <= 0
+}
+
+func (p ipRange) String() string { return p.first.String() + " - " + p.last.String() }
+
+// parsePool reads a Kea pool, either "first - last" or a CIDR prefix.
+func parsePool(s string) (ipRange, error) {
+	if _, ipn, err := net.ParseCIDR(strings.TrimSpace(s)); err == nil && ipn.IP.To4() != nil {
+		return ipRange{ipn.IP.To4(), lastAddr(ipn)}, nil
+	}
+	a, b, ok := strings.Cut(s, "-")
+	first, last := net.ParseIP(strings.TrimSpace(a)).To4(), net.ParseIP(strings.TrimSpace(b)).To4()
+	if !ok || first == nil || last == nil || bytes.Compare(first, last) > 0 {
+		return ipRange{}, fmt.Errorf("pool %q: want \"first - last\" or an IPv4 prefix", s)
+	}
+	return ipRange{first, last}, nil
+}
+
+// lastAddr is the highest address of n (its broadcast address).
+func lastAddr(n *net.IPNet) net.IP {
+	ip := n.IP.To4()
+	last := make(net.IP, len(ip))
+	for i := range ip {
+		last[i] = ip[i] | ^n.Mask[len(n.Mask)-len(ip)+i]
+	}
+	return last
+}
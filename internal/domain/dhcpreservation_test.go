@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+)
+
+func validReservation() *DHCPReservation {
+	r := NewDHCPReservation(baseYAML())
+	r.SubnetID = 1
+	r.HWAddress = "bc:24:11:9d:ca:fa"
+	r.IP = "10.0.10.6"
+	r.Host = "printer.weruminger.lan"
+	r.Options = []DHCPOption{{Name: "routers", Data: "10.0.10.1"}}
+	return r
+}
+
+func TestDHCPReservation_Validate(t *testing.T) {
+	if r := validReservation().InSubnet("10.0.10.0/24", "10.0.10.100 - 10.0.10.199").Validate(); r.Err() != nil {
+		t.Fatalf("valid reservation rejected: %v", r.Err())
+	}
+	cases := map[string]func(r *DHCPReservation){
+		"no identifier":   func(r *DHCPReservation) { r.HWAddress = "" },
+		"two identifiers": func(r *DHCPReservation) { r.ClientID = "01:bc:24:11:9d:ca:fa" },
+		"bad client-id":   func(r *DHCPReservation) { r.HWAddress, r.ClientID = "", "xyz" },
+		"no subnet":       func(r *DHCPReservation) { r.SubnetID = 0 },
+		"outside subnet":  func(r *DHCPReservation) { r.IP = "10.0.11.6" },
+		"in pool":         func(r *DHCPReservation) { r.IP = "10.0.10.150" },
+		"broadcast":       func(r *DHCPReservation) { r.IP = "10.0.10.255" },
+		"bad host":        func(r *DHCPReservation) { r.Host = "bad host" },
+		"option w/o id":   func(r *DHCPReservation) { r.Options = []DHCPOption{{Data: "x"}} },
+	}
+	for name, mutate := range cases {
+		r := validReservation()
+		mutate(r)
+		if r.InSubnet("10.0.10.0/24", "10.0.10.100 - 10.0.10.199").Validate(); !errs.IsCode(r.Err(), errs.InvalidInput) {
+			t.Errorf("%s: want INVALID_INPUT, got %v", name, r.Err())
+		}
+	}
+	if r := validReservation().InSubnet("10.0.10.0/24", "10.0.10.0/25"); !errs.IsCode(r.Validate().Err(), errs.InvalidInput) {
+		t.Errorf("CIDR pool not applied: %v", r.Err())
+	}
+	if r := validReservation().InSubnet("10.0.10.0/24", "10.0.10.9 - 10.0.10.1"); !errs.IsCode(r.Err(), errs.InvalidInput) {
+		t.Errorf("reversed pool accepted: %v", r.Err())
+	}
+}
+
+func TestDHCPReservation_Save_Load(t *testing.T) {
+	path := t.TempDir() + "/res.yaml"
+	exp := validReservation()
+	if exp.Save(context.Background(), "file://"+path, "yaml"); exp.Err() != nil {
+		t.Fatalf("save: %v", exp.Err())
+	}
+	got := NewDHCPReservation(baseYAML()).Load(context.Background(), "file://"+path)
+	if got.Err() != nil {
+		t.Fatalf("load: %v", got.Err())
+	}
+	if got.IP != exp.IP || got.HWAddress != exp.HWAddress || len(got.Options) != 1 || got.Options[0].Data != "10.0.10.1" {
+		t.Fatalf("mismatch %+v", got)
+	}
+}
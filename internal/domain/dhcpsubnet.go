@@ -0,0 +1,104 @@
+package domain
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/modelx"
+)
+
+var reClientClass = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// DHCPSubnet is a DHCPv4 subnet of the Kea configuration with its dynamic
+// pools. Relay lists the relay agent addresses that select this subnet.
+type DHCPSubnet struct {
+	*modelx.Base  `json:"-" yaml:"-"`
+	modelx.State  `json:"-" yaml:"-"`
+	Kind          string       `json:"kind" yaml:"kind"`       // "DHCPSubnet"
+	Version       string       `json:"version" yaml:"version"` // "v1"
+	ID            int          `json:"id" yaml:"id"`
+	Prefix        string       `json:"prefix" yaml:"prefix"`                       // e.g. 10.0.10.0/24
+	Pools         []string     `json:"pools,omitempty" yaml:"pools,omitempty"`     // "first - last" or CIDR
+	Options       []DHCPOption `json:"options,omitempty" yaml:"options,omitempty"` // option-data
+	ValidLifetime int          `json:"validLifetime,omitempty" yaml:"validLifetime,omitempty"`
+	Relay         []string     `json:"relay,omitempty" yaml:"relay,omitempty"`
+	ClientClass   string       `json:"clientClass,omitempty" yaml:"clientClass,omitempty"`
+}
+
+func NewDHCPSubnet(b *modelx.Base) *DHCPSubnet {
+	return &DHCPSubnet{Base: b, Kind: "DHCPSubnet", Version: "v1"}
+}
+
+func init() {
+	modelx.Register("DHCPSubnet", "v1", NewDHCPSubnet, (*DHCPSubnet).validate)
+}
+
+func (s *DHCPSubnet) Validate() *DHCPSubnet { return modelx.Validate(s) }
+
+func (s *DHCPSubnet) Load(ctx context.Context, uri string) *DHCPSubnet {
+	return modelx.Load(ctx, s, uri)
+}
+
+func (s *DHCPSubnet) Save(ctx context.Context, uri, format string) *DHCPSubnet {
+	return modelx.Save(ctx, s, uri, format)
+}
+
+func (s *DHCPSubnet) Serialize(format string) (string, error) { return modelx.Serialize(s, format) }
+
+func (s *DHCPSubnet) Deserialize(format, data string) *DHCPSubnet {
+	return modelx.Deserialize(s, format, data)
+}
+
+// validate adds the field errors of s, see modelx.Register.
+func (s *DHCPSubnet) validate() {
+	op := errs.Op("dhcpsubnet.Validate")
+	if s.ID < 1 {
+		s.SetInvalid(op, "id", "must be >= 1")
+	}
+	ip, prefix, err := net.ParseCIDR(s.Prefix)
+	switch {
+	case err != nil || ip.To4() == nil:
+		s.SetInvalid(op, "prefix", "must be an IPv4 prefix like 10.0.10.0/24")
+		return
+	case !ip.Equal(prefix.IP):
+		s.SetInvalid(op, "prefix", fmt.Sprintf("host bits set, did you mean %s?", prefix))
+	}
+	var pools []ipRange
+	for i, p := range s.Pools {
+		field := fmt.Sprintf("pools[%d]", i)
+		r, err := parsePool(p)
+		if err != nil {
+			s.SetInvalid(op, field, err.Error())
+			continue
+		}
+		if !prefix.Contains(r.first) || !prefix.Contains(r.last) {
+			s.SetInvalid(op, field, fmt.Sprintf("%s is not inside %s", r, prefix))
+		}
+		for _, o := range pools {
+			if bytes.Compare(r.first, o.last) <= 0 && bytes.Compare(o.first, r.last) <= 0 {
+				s.SetInvalid(op, field, fmt.Sprintf("%s overlaps %s", r, o))
+			}
+		}
+		pools = append(pools, r)
+	}
+	if s.ValidLifetime < 0 {
+		s.SetInvalid(op, "validLifetime", "must be >= 0 seconds")
+	}
+	for i, r := range s.Relay {
+		if net.ParseIP(r).To4() == nil {
+			s.SetInvalid(op, fmt.Sprintf("relay[%d]", i), "must be IPv4")
+		}
+	}
+	if s.ClientClass != "" && !reClientClass.MatchString(s.ClientClass) {
+		s.SetInvalid(op, "clientClass", "1..64 chars of A-Z a-z 0-9 _ . -")
+	}
+	for i, o := range s.Options {
+		if o.Name == "" && (o.Code < 1 || o.Code > 254) {
+			s.SetInvalid(op, fmt.Sprintf("options[%d]", i), "needs a name or a code in 1..254")
+		}
+	}
+}
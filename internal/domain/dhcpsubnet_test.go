@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+)
+
+func validSubnet() *DHCPSubnet {
+	s := NewDHCPSubnet(baseYAML())
+	s.ID = 10
+	s.Prefix = "10.0.10.0/24"
+	s.Pools = []string{"10.0.10.100 - 10.0.10.149", "10.0.10.192/26"}
+	s.ValidLifetime = 3600
+	s.Relay = []string{"10.0.0.1"}
+	s.ClientClass = "lan"
+	return s
+}
+
+func TestDHCPSubnet_Validate(t *testing.T) {
+	if s := validSubnet().Validate(); s.Err() != nil {
+		t.Fatalf("valid subnet rejected: %v", s.Err())
+	}
+	cases := map[string]func(s *DHCPSubnet){
+		"no id":         func(s *DHCPSubnet) { s.ID = 0 },
+		"host bits":     func(s *DHCPSubnet) { s.Prefix = "10.0.10.1/24" },
+		"ipv6":          func(s *DHCPSubnet) { s.Prefix = "2001:db8::/64" },
+		"pool outside":  func(s *DHCPSubnet) { s.Pools = []string{"10.0.11.1 - 10.0.11.9"} },
+		"pools overlap": func(s *DHCPSubnet) { s.Pools = []string{"10.0.10.100 - 10.0.10.150", "10.0.10.150 - 10.0.10.160"} },
+		"bad relay":     func(s *DHCPSubnet) { s.Relay = []string{"relay1"} },
+		"bad class":     func(s *DHCPSubnet) { s.ClientClass = "a b" },
+		"neg lifetime":  func(s *DHCPSubnet) { s.ValidLifetime = -1 },
+		"bad pool":      func(s *DHCPSubnet) { s.Pools = []string{"10.0.10.9"} },
+		"option w/o id": func(s *DHCPSubnet) { s.Options = []DHCPOption{{Data: "x"}} },
+	}
+	for name, mutate := range cases {
+		s := validSubnet()
+		mutate(s)
+		if s.Validate(); !errs.IsCode(s.Err(), errs.InvalidInput) {
+			t.Errorf("%s: want INVALID_INPUT, got %v", name, s.Err())
+		}
+	}
+}
+
+func TestDHCPSubnet_Serialize_Roundtrip(t *testing.T) {
+	out, err := validSubnet().Serialize("yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "kind: DHCPSubnet") || !strings.Contains(out, "validLifetime: 3600") {
+		t.Fatalf("yaml:\n%s", out)
+	}
+	back := NewDHCPSubnet(baseYAML()).Deserialize("yaml", out)
+	if back.Err() != nil || back.Prefix != "10.0.10.0/24" || len(back.Pools) != 2 || back.Relay[0] != "10.0.0.1" {
+		t.Fatalf("deserialize %+v %v", back, back.Err())
+	}
+}
@@ -3,12 +3,14 @@ package errs
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 type Code string
 
 const (
 	InvalidInput Code = "INVALID_INPUT"
+	BadRequest   Code = "BAD_REQUEST" // malformed request, e.g. missing CSRF token
 	NotFound     Code = "NOT_FOUND"
 	Unauthorized Code = "UNAUTHORIZED"
 	Forbidden    Code = "FORBIDDEN"
@@ -16,6 +18,7 @@ const (
 	Internal     Code = "INTERNAL"
 	Unavailable  Code = "UNAVAILABLE"
 	Timeout      Code = "TIMEOUT"
+	RateLimited  Code = "RATE_LIMITED" // Fields["retryAfter"]: seconds until the next try
 )
 
 type Op string
@@ -61,7 +64,76 @@ func Wrap(op Op, err error, code Code) error {
 	return &E{Op: op, Code: code, Err: err}
 }
 
+// Field returns the error of one input field: Fields carries "field" and
+// "message", the message reads "<field>: <msg>".
+func Field(op Op, code Code, field, msg string) *E {
+	return &E{Op: op, Code: code, Err: fmt.Errorf("%s: %s", field, msg), Fields: map[string]any{"field": field, "message": msg}}
+}
+
+// List is a set of errors reported together, e.g. every invalid field of
+// one object. It unwraps to its members, so IsCode and errors.As see each.
+type List []*E
+
+func (l List) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (l List) Unwrap() []error {
+	out := make([]error, len(l))
+	for i, e := range l {
+		out[i] = e
+	}
+	return out
+}
+
+// IsCode reports whether err or, for joined errors, one of its members
+// carries code. The outermost *E of each chain counts.
 func IsCode(err error, code Code) bool {
-	var e *E
-	return errors.As(err, &e) && e.Code == code
+	found := false
+	walk(err, func(e *E) {
+		found = found || e.Code == code
+	})
+	return found
+}
+
+// FieldErrors returns the messages of the field errors in err by field
+// name, in order; nil if there are none.
+func FieldErrors(err error) map[string][]string {
+	var out map[string][]string
+	walk(err, func(e *E) {
+		field, _ := e.Fields["field"].(string)
+		if field == "" {
+			return
+		}
+		msg, _ := e.Fields["message"].(string)
+		if msg == "" {
+			msg = fmt.Sprint(e.Err)
+		}
+		if out == nil {
+			out = map[string][]string{}
+		}
+		out[field] = append(out[field], msg)
+	})
+	return out
+}
+
+// walk calls fn with the outermost *E of every chain in err.
+func walk(err error, fn func(*E)) {
+	switch x := err.(type) {
+	case nil:
+	case *E:
+		if x != nil {
+			fn(x)
+		}
+	case interface{ Unwrap() []error }:
+		for _, m := range x.Unwrap() {
+			walk(m, fn)
+		}
+	case interface{ Unwrap() error }:
+		walk(x.Unwrap(), fn)
+	}
 }
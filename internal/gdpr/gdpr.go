@@ -0,0 +1,244 @@
+// Package gdpr answers data-subject requests (DSGVO Art. 15 and 17): given
+// an account, UPN or MAC address it collects what the tool holds or can
+// see about that person into a signed Report, and pseudonymises the
+// person's entries in the audit log on request.
+package gdpr
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Weruminger/go-ad-admin/internal/audit"
+	"github.com/Weruminger/go-ad-admin/internal/domain"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/kea"
+	"github.com/Weruminger/go-ad-admin/internal/ldap"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+	"github.com/Weruminger/go-ad-admin/internal/privacy"
+)
+
+// Subject kinds, see Kind.
+const (
+	SAM = "sam"
+	UPN = "upn"
+	MAC = "mac"
+)
+
+// Kind classifies a requested subject: a MAC address, a UPN (contains
+// "@") or an account name.
+func Kind(subject string) string {
+	if _, err := net.ParseMAC(subject); err == nil {
+		return MAC
+	}
+	if strings.Contains(subject, "@") {
+		return UPN
+	}
+	return SAM
+}
+
+// Sources are where Collect looks; nil or empty ones are skipped.
+type Sources struct {
+	Dir   ldap.Client
+	DHCP  *kea.Client
+	Audit string // path of the audit log
+}
+
+// Report is everything found about one subject. Sig signs the compact JSON
+// of the report without "sig", like an audit line.
+type Report struct {
+	Subject      string                   `json:"subject"` // as requested
+	Kind         string                   `json:"kind"`
+	Generated    time.Time                `json:"generated"`
+	IDs          []string                 `json:"ids"`    // values searched for: account, UPN, DN, mail or MAC
+	Users        []domain.ADUser          `json:"users"`  // directory entries
+	Groups       []string                 `json:"groups"` // DNs of the (nested) groups of the users
+	Leases       []domain.DHCPLease       `json:"leases"`
+	Reservations []domain.DHCPReservation `json:"reservations"`
+	Audit        []audit.Entry            `json:"audit"` // entries that mention the subject
+	Sig          string                   `json:"sig,omitempty"`
+}
+
+// Collect builds the report about subject. A MAC subject is looked up in
+// the DHCP leases and reservations; an account or UPN in the directory,
+// and its account name also as hostname in DHCP. The audit log is searched
+// for every identifier found.
+func Collect(ctx context.Context, src Sources, subject string) (Report, error) {
+	op := errs.Op("gdpr.Collect")
+	subject = strings.TrimSpace(subject)
+	if subject == "" {
+		return Report{}, errs.New(op, errs.InvalidInput, errors.New("subject is required"), map[string]any{"field": "subject"})
+	}
+	r := Report{Subject: subject, Kind: Kind(subject), Generated: time.Now().UTC(), IDs: []string{subject},
+		Users: []domain.ADUser{}, Groups: []string{}, Leases: []domain.DHCPLease{},
+		Reservations: []domain.DHCPReservation{}, Audit: []audit.Entry{}}
+
+	if r.Kind != MAC && src.Dir != nil {
+		if err := r.collectDirectory(src.Dir); err != nil {
+			return Report{}, err
+		}
+	}
+	s := privacy.NewSubject(r.IDs...)
+	if src.DHCP != nil {
+		if err := r.collectDHCP(ctx, src.DHCP, s); err != nil {
+			return Report{}, err
+		}
+	}
+	if src.Audit != "" {
+		err := audit.Each(src.Audit, func(e audit.Entry) error {
+			if s.Mentions(e) {
+				r.Audit = append(r.Audit, e)
+			}
+			return nil
+		})
+		if err != nil {
+			return Report{}, errs.New(op, errs.Internal, err, map[string]any{"file": src.Audit})
+		}
+	}
+	return r, nil
+}
+
+func (r *Report) collectDirectory(dir ldap.Client) error {
+	attr := "sAMAccountName"
+	if r.Kind == UPN {
+		attr = "userPrincipalName"
+	}
+	users, err := dir.SearchUsers(ldapx.Eq(attr, r.Subject), 0)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		r.Users = append(r.Users, *ldap.DomainUser(u))
+		for _, id := range []string{u.UID, u.UPN, u.DN.String(), u.Mail} {
+			if id != "" && !containsFold(r.IDs, id) {
+				r.IDs = append(r.IDs, id)
+			}
+		}
+		groups, err := dir.EffectiveGroups(u.DN)
+		if err != nil {
+			return err
+		}
+		for _, g := range groups {
+			r.Groups = append(r.Groups, g.DN.String())
+		}
+	}
+	return nil
+}
+
+// collectDHCP adds the leases and reservations whose MAC or hostname
+// identifies s.
+func (r *Report) collectDHCP(ctx context.Context, dhcp *kea.Client, s privacy.Subject) error {
+	leases, err := dhcp.Leases(ctx)
+	if err != nil {
+		return err
+	}
+	for _, l := range leases {
+		if s.Is(l.MAC) || s.Is(l.Host) {
+			r.Leases = append(r.Leases, l)
+		}
+	}
+	subnets, err := dhcp.Subnets(ctx)
+	if err != nil {
+		return err
+	}
+	for _, sn := range subnets {
+		res, err := dhcp.Reservations(ctx, sn.ID)
+		if err != nil {
+			return err
+		}
+		for _, h := range res {
+			if s.Is(h.HWAddress) || s.Is(h.Host) {
+				r.Reservations = append(r.Reservations, h)
+			}
+		}
+	}
+	return nil
+}
+
+func containsFold(list []string, v string) bool {
+	for _, x := range list {
+		if strings.EqualFold(x, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign sets Sig; a nil key leaves the report unsigned.
+func (r *Report) Sign(key audit.Signer) error {
+	r.Sig = ""
+	if key == nil {
+		return nil
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errs.New("gdpr.Sign", errs.Internal, err, nil)
+	}
+	r.Sig = key.Sign(b)
+	return nil
+}
+
+// Verify reports whether r carries a valid signature of key.
+func (r Report) Verify(key audit.Signer) bool {
+	sig := r.Sig
+	r.Sig = ""
+	b, err := json.Marshal(r)
+	return err == nil && sig != "" && key.Verify(b, sig)
+}
+
+// WriteJSON writes r as one line of compact JSON.
+func (r Report) WriteJSON(w io.Writer) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+//go:embed report.html
+var files embed.FS
+
+var reportHTML = template.Must(template.New("report.html").Funcs(template.FuncMap{
+	"json": func(v any) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	},
+}).ParseFS(files, "report.html"))
+
+// WriteHTML writes r as a self-contained HTML document, with the signed
+// JSON embedded for verification.
+func (r Report) WriteHTML(w io.Writer) error {
+	var js bytes.Buffer
+	if err := r.WriteJSON(&js); err != nil {
+		return err
+	}
+	return reportHTML.Execute(w, map[string]any{"R": r, "JSON": js.String()})
+}
+
+// Erase pseudonymises the entries of the subject of r in the audit log
+// (see privacy.Pseudonymizer.Erase and audit.Writer.Redact). note becomes
+// the audit.OpRedact entry; the subject is recorded there as token only.
+// It returns the seqs of the rewritten entries.
+func Erase(w *audit.Writer, p *privacy.Pseudonymizer, r Report, note audit.Entry) ([]uint64, error) {
+	data := map[string]any{}
+	if m, ok := note.Data.(map[string]any); ok {
+		for k, v := range m {
+			data[k] = v
+		}
+	}
+	data["subject"] = p.Token(r.Subject)
+	note.Data = data
+	seqs, err := w.Redact(p.Erase(privacy.NewSubject(r.IDs...)), note)
+	if err != nil {
+		return nil, errs.New("gdpr.Erase", errs.Internal, err, nil)
+	}
+	return seqs, nil
+}
@@ -0,0 +1,186 @@
+package gdpr
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/audit"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/kea"
+	"github.com/Weruminger/go-ad-admin/internal/kea/keatest"
+	"github.com/Weruminger/go-ad-admin/internal/ldap"
+	"github.com/Weruminger/go-ad-admin/internal/ldap/ldaptest"
+	"github.com/Weruminger/go-ad-admin/internal/privacy"
+)
+
+const annaDN = "CN=Anna Smith,CN=Users,DC=example,DC=com"
+
+func newSources(t *testing.T) (Sources, *audit.Writer) {
+	t.Helper()
+	dir := ldaptest.NewServer("DC=example,DC=com")
+	t.Cleanup(dir.Close)
+	if err := dir.SeedTable([][]string{
+		{"uid", "displayName", "userPrincipalName", "mail"},
+		{"anna", "Anna Smith", "anna@example.com", "anna.smith@example.com"},
+		{"bob", "Bob Roe", "bob@example.com", ""},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.AddGroup("CN=Staff,DC=example,DC=com", annaDN); err != nil {
+		t.Fatal(err)
+	}
+	c, err := ldap.NewConn(dir.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+
+	ks := keatest.NewServer()
+	t.Cleanup(ks.Close)
+	if err := ks.AddLease(keatest.Lease{IPAddress: "192.0.2.100", HWAddress: "aa:bb:cc:dd:ee:ff", Hostname: "anna"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.AddLease(keatest.Lease{IPAddress: "192.0.2.101", HWAddress: "11:22:33:44:55:66", Hostname: "printer"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.AddHost(keatest.Host{SubnetID: 1, HWAddress: "aa:bb:cc:dd:ee:ff", IPAddress: "192.0.2.5"}); err != nil {
+		t.Fatal(err)
+	}
+	kc, err := kea.NewClient(ks.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aw := &audit.Writer{Path: filepath.Join(t.TempDir(), "audit.jsonl"), Sync: audit.SyncNone}
+	t.Cleanup(func() { _ = aw.Close() })
+	for _, e := range []audit.Entry{
+		{Op: "auth.login", User: "anna", Data: map[string]any{"ip": "10.0.0.1"}},
+		{Op: "aduser.disable", User: "bob", Data: map[string]any{"ip": "10.0.0.2", "target": annaDN,
+			"before": `{"sam":"anna","enabled":true}`, "after": `{"sam":"anna","enabled":false}`,
+			"diff": []any{map[string]any{"path": "enabled", "old": true, "new": false}}}},
+		{Op: "dhcpreservation.add", User: "bob", Data: map[string]any{"target": "1/192.0.2.5", "mac": "AA-BB-CC-DD-EE-FF"}},
+		{Op: "auth.login", User: "bob", Data: map[string]any{"ip": "10.0.0.2"}},
+	} {
+		if err := aw.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return Sources{Dir: c, DHCP: kc, Audit: aw.Path}, aw
+}
+
+func TestCollect(t *testing.T) {
+	src, _ := newSources(t)
+	ctx := context.Background()
+
+	r, err := Collect(ctx, src, "anna@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Kind != UPN || len(r.Users) != 1 || r.Users[0].SAM != "anna" || len(r.Groups) != 1 || len(r.IDs) != 4 {
+		t.Fatalf("directory: %+v", r)
+	}
+	// the lease carries the account as hostname; the audit log names anna
+	// as operator and as target
+	if len(r.Leases) != 1 || len(r.Reservations) != 0 || len(r.Audit) != 2 {
+		t.Fatalf("dhcp/audit: %+v", r)
+	}
+
+	m, err := Collect(ctx, src, "AA:BB:CC:DD:EE:FF")
+	if err != nil || m.Kind != MAC || len(m.Users) != 0 || len(m.Leases) != 1 || len(m.Reservations) != 1 || len(m.Audit) != 1 {
+		t.Fatalf("mac: %+v %v", m, err)
+	}
+	if _, err := Collect(ctx, src, " "); !errs.IsCode(err, errs.InvalidInput) {
+		t.Fatalf("empty subject: %v", err)
+	}
+	if n, err := Collect(ctx, Sources{}, "nobody"); err != nil || n.Kind != SAM || len(n.Users)+len(n.Audit) != 0 {
+		t.Fatalf("no sources: %+v %v", n, err)
+	}
+}
+
+func TestReport_SignAndHTML(t *testing.T) {
+	src, _ := newSources(t)
+	r, err := Collect(context.Background(), src, "anna")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := audit.ParseKey("hmac:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{3}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Sign(key); err != nil || r.Sig == "" || !r.Verify(key) {
+		t.Fatalf("sign: %q %v", r.Sig, err)
+	}
+	forged := r
+	forged.Users = nil
+	if forged.Verify(key) {
+		t.Fatal("changed report verifies")
+	}
+
+	var b bytes.Buffer
+	if err := r.WriteHTML(&b); err != nil {
+		t.Fatal(err)
+	}
+	html := b.String()
+	if !strings.Contains(html, "Anna Smith") || !strings.Contains(html, "192.0.2.100") || !strings.Contains(html, "aduser.disable") ||
+		!strings.Contains(html, `&#34;sig&#34;:&#34;`) {
+		t.Fatalf("html:\n%s", html)
+	}
+}
+
+func TestErase(t *testing.T) {
+	src, aw := newSources(t)
+	r, err := Collect(context.Background(), src, "anna")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := privacy.New([]byte("key"))
+	note := map[string]any{"reason": "art. 17"}
+	seqs, err := Erase(aw, p, r, audit.Entry{User: "auditor", Data: note})
+	if err != nil || len(seqs) != 2 {
+		t.Fatalf("erase: %v %v", seqs, err)
+	}
+	if len(note) != 1 {
+		t.Fatalf("caller's note data changed: %v", note)
+	}
+	if rep, err := audit.VerifyHistory(aw.Path, nil); err != nil || rep.Redacted != 2 {
+		t.Fatalf("verify: %+v %v", rep, err)
+	}
+	after, err := Collect(context.Background(), src, "anna")
+	if err != nil || len(after.Audit) != 0 {
+		t.Fatalf("anna still in the log: %+v %v", after.Audit, err)
+	}
+	page, err := audit.Search(aw.Path, audit.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range page.Entries {
+		data, _ := e.Data.(map[string]any)
+		switch e.Seq {
+		case 2: // anna's account was changed by bob: bob stays, anna goes
+			if e.User != "bob" || data["ip"] != "10.0.0.2" || data["target"] != p.Token(annaDN) || data["before"] != p.Token(`{"sam":"anna","enabled":true}`) {
+				t.Fatalf("change entry: %+v", e)
+			}
+		case 1:
+			if e.User != p.Token("anna") || data["ip"] != p.Token("10.0.0.1") {
+				t.Fatalf("login entry: %+v", e)
+			}
+		case 5:
+			if e.Op != audit.OpRedact || e.User != "auditor" || data["subject"] != p.Token("anna") || data["reason"] != "art. 17" || strings.Contains(auditJSON(t, e), "anna") {
+				t.Fatalf("redact entry: %+v", e)
+			}
+		}
+	}
+}
+
+func auditJSON(t *testing.T, e audit.Entry) string {
+	t.Helper()
+	var b bytes.Buffer
+	if err := (Report{Audit: []audit.Entry{e}}).WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
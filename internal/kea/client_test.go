@@ -0,0 +1,203 @@
+package kea
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Weruminger/go-ad-admin/internal/config"
+	"github.com/Weruminger/go-ad-admin/internal/domain"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/kea/keatest"
+)
+
+// agent answers every request with handle's result.
+func agent(t *testing.T, handle func(w http.ResponseWriter, req Request)) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad request body: %v", err)
+		}
+		handle(w, req)
+	}))
+	t.Cleanup(srv.Close)
+	return &Client{URL: srv.URL}
+}
+
+func reply(w http.ResponseWriter, res ...Response) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func TestCommand_ResultCodes(t *testing.T) {
+	for result, code := range map[int]errs.Code{
+		ResultError:       errs.InvalidInput,
+		ResultUnsupported: errs.Unavailable,
+		ResultEmpty:       errs.NotFound,
+		42:                errs.Internal,
+	} {
+		c := agent(t, func(w http.ResponseWriter, _ Request) {
+			reply(w, Response{Result: result, Text: "kea says no"})
+		})
+		err := c.Command(context.Background(), DHCP4, "lease4-get", nil, nil)
+		var e *errs.E
+		if !errs.IsCode(err, code) || !errors.As(err, &e) || e.Fields["keaText"] != "kea says no" {
+			t.Errorf("result %d: want %s with keaText, got %v", result, code, err)
+		}
+	}
+}
+
+func TestCommand_AuthAndEnvelope(t *testing.T) {
+	var auth atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth.Store(r.Header.Get("Authorization"))
+		// commands for the agent itself come back as a single object
+		_ = json.NewEncoder(w).Encode(Response{Result: 0, Arguments: json.RawMessage(`{"pid":7}`)})
+	}))
+	defer srv.Close()
+
+	c := &Client{URL: srv.URL, Token: "s3cret", User: "ignored"}
+	var out struct{ PID int }
+	if err := c.Command(context.Background(), "", "status-get", nil, &out); err != nil || out.PID != 7 {
+		t.Fatalf("got %+v %v", out, err)
+	}
+	if auth.Load() != "Bearer s3cret" {
+		t.Fatalf("authorization %q", auth.Load())
+	}
+	c = &Client{URL: srv.URL, User: "kea", Password: "pw"}
+	_ = c.Command(context.Background(), "", "status-get", nil, nil)
+	if auth.Load() != "Basic a2VhOnB3" {
+		t.Fatalf("authorization %q", auth.Load())
+	}
+}
+
+// newFake starts a keatest server and a client for it with a fast backoff.
+func newFake(t *testing.T) (*keatest.Server, *Client) {
+	t.Helper()
+	srv := keatest.NewServer()
+	t.Cleanup(srv.Close)
+	c, err := NewClient(srv.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Backoff = time.Millisecond
+	return srv, c
+}
+
+func TestCommand_RetriesTransientFailures(t *testing.T) {
+	srv, c := newFake(t)
+	ctx := context.Background()
+
+	srv.Fail("status-get", 2, keatest.FaultHTTP500)
+	if _, err := c.Status(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Calls("status-get"); n != 3 {
+		t.Fatalf("want 3 attempts, got %d", n)
+	}
+
+	srv.Fail("lease4-del", 1, keatest.FaultResult)
+	if err := c.DeleteLease(ctx, "192.0.2.10"); !errs.IsCode(err, errs.InvalidInput) {
+		t.Fatalf("want INVALID_INPUT, got %v", err)
+	}
+	if n := srv.Calls("lease4-del"); n != 1 {
+		t.Fatalf("kea errors must not be retried, got %d attempts", n)
+	}
+
+	c.HTTP.Timeout = 20 * time.Millisecond
+	srv.Fail("lease4-get-all", 4, keatest.FaultTimeout)
+	if _, err := c.Leases(ctx); !errs.IsCode(err, errs.Timeout) {
+		t.Fatalf("want TIMEOUT, got %v", err)
+	}
+	if n := srv.Calls("lease4-get-all"); n != 4 {
+		t.Fatalf("want 1+3 attempts, got %d", n)
+	}
+
+	// a write that may have been applied is not sent again
+	c.HTTP.Timeout = 2 * time.Second
+	srv.Fail("lease4-del", 1, keatest.FaultHTTP500)
+	if err := c.DeleteLease(ctx, "192.0.2.10"); !errs.IsCode(err, errs.Unavailable) {
+		t.Fatalf("want UNAVAILABLE, got %v", err)
+	}
+	if n := srv.Calls("lease4-del"); n != 2 {
+		t.Fatalf("writes must not be retried, got %d attempts in total", n)
+	}
+}
+
+func TestCommand_Unauthorized(t *testing.T) {
+	srv, c := newFake(t)
+	c.Token = "wrong"
+	if _, err := c.Status(context.Background()); !errs.IsCode(err, errs.Unauthorized) {
+		t.Fatalf("want UNAUTHORIZED, got %v", err)
+	}
+	if n := srv.Calls("status-get"); n != 0 {
+		t.Fatalf("rejected before dispatch, got %d calls", n)
+	}
+}
+
+func TestLeases_Wrappers(t *testing.T) {
+	srv, c := newFake(t)
+	ctx := context.Background()
+	if err := srv.AddLease(keatest.Lease{IPAddress: "192.0.2.10", HWAddress: "aa:bb:cc:dd:ee:ff", Hostname: "pc1", CLTT: 1700000000, ValidLft: 3600}); err != nil {
+		t.Fatal(err)
+	}
+
+	leases, err := c.Leases(ctx, 1)
+	if err != nil || len(leases) != 1 {
+		t.Fatalf("leases %v %v", leases, err)
+	}
+	l := leases[0]
+	if l.Kind != "DHCPLease" || l.MAC != "aa:bb:cc:dd:ee:ff" || l.Host != "pc1" || l.End.Sub(l.Start) != time.Hour || l.Start.Unix() != 1700000000 {
+		t.Fatalf("lease %+v", l)
+	}
+	if leases, err := c.Leases(ctx, 2); err != nil || len(leases) != 0 {
+		t.Fatalf("other subnet: %v %v", leases, err)
+	}
+
+	if _, err := c.Lease(ctx, "192.0.2.99"); !errs.IsCode(err, errs.NotFound) {
+		t.Fatalf("want NOT_FOUND, got %v", err)
+	}
+	if err := c.DeleteLease(ctx, "not-an-ip"); !errs.IsCode(err, errs.InvalidInput) {
+		t.Fatalf("want INVALID_INPUT, got %v", err)
+	}
+
+	add := *domain.NewDHCPLease(nil)
+	add.IP, add.MAC, add.Host = "192.0.2.20", "aa:bb:cc:dd:ee:01", "pc2"
+	add.Start = time.Unix(1700000000, 0)
+	add.End = add.Start.Add(2 * time.Hour)
+	if err := c.AddLease(ctx, add); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Lease(ctx, "192.0.2.20")
+	if err != nil || !got.Start.Equal(add.Start) || !got.End.Equal(add.End) || got.Host != "pc2" {
+		t.Fatalf("added lease %+v %v", got, err)
+	}
+	if err := c.AddLease(ctx, add); !errs.IsCode(err, errs.InvalidInput) {
+		t.Fatalf("duplicate: want INVALID_INPUT, got %v", err)
+	}
+	if err := c.DeleteLease(ctx, "192.0.2.20"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteLease(ctx, "192.0.2.20"); !errs.IsCode(err, errs.NotFound) {
+		t.Fatalf("second delete: want NOT_FOUND, got %v", err)
+	}
+}
+
+func TestNewClient_RefusesPlaintextInProd(t *testing.T) {
+	cfg := *config.NewDefaultConfig()
+	cfg.Env, cfg.KeaURL = "prod", "http://kea:8000"
+	if _, err := NewClient(cfg); !errs.IsCode(err, errs.Forbidden) {
+		t.Fatalf("want FORBIDDEN, got %v", err)
+	}
+	cfg.KeaURL = "https://kea:8000"
+	c, err := NewClient(cfg)
+	if err != nil || c.HTTP.Timeout != 2*time.Second || c.Retries != 3 {
+		t.Fatalf("client %+v %v", c, err)
+	}
+}
@@ -0,0 +1,144 @@
+package keatest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+)
+
+// Subnets returns a copy of the configured subnets.
+func (s *Server) Subnets() []Subnet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Subnet(nil), s.subnets...)
+}
+
+// rawSubnets returns the subnet4 list. Caller holds s.mu.
+func (s *Server) rawSubnets() []any {
+	out := make([]any, 0, len(s.subnets))
+	for _, sn := range s.subnets {
+		out = append(out, sn.raw)
+	}
+	return out
+}
+
+// dhcp4 assembles the running configuration. Caller holds s.mu.
+func (s *Server) dhcp4() map[string]any {
+	cfg := map[string]any{}
+	for k, v := range s.global {
+		cfg[k] = v
+	}
+	cfg["subnet4"] = s.rawSubnets()
+	return cfg
+}
+
+// parseSubnets checks a subnet4 list the way kea-dhcp4 does on reload:
+// unique positive ids, valid non-overlapping prefixes, pools inside their
+// subnet.
+func parseSubnets(list []any) ([]Subnet, error) {
+	var out []Subnet
+	for i, item := range list {
+		raw, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("subnet4[%d]: not an object", i)
+		}
+		id, ok := toInt(raw["id"])
+		if !ok || id < 1 {
+			return nil, fmt.Errorf("subnet4[%d]: 'id' must be a positive integer", i)
+		}
+		prefix, _ := raw["subnet"].(string)
+		ip, ipn, err := net.ParseCIDR(prefix)
+		if err != nil || ip.To4() == nil {
+			return nil, fmt.Errorf("subnet4[%d]: invalid subnet %q", i, prefix)
+		}
+		sn := Subnet{ID: id, Prefix: ipn, raw: raw}
+		pools, _ := raw["pools"].([]any)
+		for _, p := range pools {
+			pm, _ := p.(map[string]any)
+			ps, _ := pm["pool"].(string)
+			r, err := parsePool(ps)
+			if err != nil {
+				return nil, fmt.Errorf("subnet4[%d]: %v", i, err)
+			}
+			if !ipn.Contains(r[0]) || !ipn.Contains(r[1]) {
+				return nil, fmt.Errorf("a pool of type V4, with the following address range: %s-%s does not match the prefix of a subnet: %s to which it is being added", r[0], r[1], ipn)
+			}
+			sn.Pools = append(sn.Pools, r)
+		}
+		for _, o := range out {
+			if o.ID == id {
+				return nil, fmt.Errorf("subnet with the prefix of '%s' has a duplicated subnet-id of '%d'", ipn, id)
+			}
+			if o.Prefix.Contains(ipn.IP) || ipn.Contains(o.Prefix.IP) {
+				return nil, fmt.Errorf("subnet %s overlaps with existing subnet %s", ipn, o.Prefix)
+			}
+		}
+		out = append(out, sn)
+	}
+	return out, nil
+}
+
+func toInt(v any) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case float64:
+		return int(n), n == float64(int(n))
+	case json.Number:
+		i, err := n.Int64()
+		return int(i), err == nil
+	}
+	return 0, false
+}
+
+func (s *Server) configGet(json.RawMessage) response {
+	cfg := s.dhcp4()
+	b, _ := json.Marshal(cfg)
+	sum := sha256.Sum256(b)
+	return response{Result: resultSuccess, Arguments: map[string]any{"Dhcp4": cfg, "hash": hex.EncodeToString(sum[:])}}
+}
+
+// candidate parses the Dhcp4 object of config-test/config-set.
+func candidate(args json.RawMessage) (map[string]any, []Subnet, *response) {
+	var a struct {
+		Dhcp4 map[string]any `json:"Dhcp4"`
+	}
+	if res := decodeArgs(args, &a); res != nil {
+		return nil, nil, res
+	}
+	if a.Dhcp4 == nil {
+		return nil, nil, &response{Result: resultError, Text: "Missing mandatory 'Dhcp4' parameter."}
+	}
+	list, _ := a.Dhcp4["subnet4"].([]any)
+	subnets, err := parseSubnets(list)
+	if err != nil {
+		return nil, nil, &response{Result: resultError, Text: "subnet configuration failed: " + err.Error()}
+	}
+	return a.Dhcp4, subnets, nil
+}
+
+func (s *Server) configTest(args json.RawMessage) response {
+	if _, _, res := candidate(args); res != nil {
+		return *res
+	}
+	return response{Result: resultSuccess, Text: "Configuration seems sane. Control-socket, hook-libraries, and D2 configuration were sanity checked, but not applied."}
+}
+
+func (s *Server) configSet(args json.RawMessage) response {
+	cfg, subnets, res := candidate(args)
+	if res != nil {
+		return *res
+	}
+	delete(cfg, "subnet4")
+	s.global = cfg
+	s.subnets = subnets
+	return response{Result: resultSuccess, Text: "Configuration successful."}
+}
+
+func (s *Server) configWrite(json.RawMessage) response {
+	b, _ := json.Marshal(map[string]any{"Dhcp4": s.dhcp4()})
+	return response{Result: resultSuccess, Text: "Configuration written to /etc/kea/kea-dhcp4.conf successfully",
+		Arguments: map[string]any{"filename": "/etc/kea/kea-dhcp4.conf", "size": len(b)}}
+}
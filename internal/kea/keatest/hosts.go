@@ -0,0 +1,173 @@
+package keatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Option is one entry of option-data.
+type Option struct {
+	Name  string `json:"name,omitempty"`
+	Code  int    `json:"code,omitempty"`
+	Data  string `json:"data"`
+	Space string `json:"space,omitempty"`
+}
+
+// Host is a host reservation in the host_cmds encoding. Exactly one of
+// HWAddress and ClientID identifies the client.
+type Host struct {
+	SubnetID   int      `json:"subnet-id"`
+	HWAddress  string   `json:"hw-address,omitempty"`
+	ClientID   string   `json:"client-id,omitempty"`
+	IPAddress  string   `json:"ip-address,omitempty"`
+	Hostname   string   `json:"hostname,omitempty"`
+	OptionData []Option `json:"option-data,omitempty"`
+}
+
+// AddHost stores a reservation as reservation-add would.
+func (s *Server) AddHost(h Host) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if res := s.addHost(h); res.Result != resultSuccess {
+		return fmt.Errorf("%s", res.Text)
+	}
+	return nil
+}
+
+// Hosts returns all reservations in insertion order.
+func (s *Server) Hosts() []Host {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Host(nil), s.hosts...)
+}
+
+// addHost validates and stores h. Caller holds s.mu.
+func (s *Server) addHost(h Host) response {
+	if _, ok := s.subnet(h.SubnetID); !ok {
+		return response{Result: resultError, Text: fmt.Sprintf("IPv4 subnet with ID of '%d' is not configured", h.SubnetID)}
+	}
+	idType, id := h.identifier()
+	if (h.HWAddress == "") == (h.ClientID == "") {
+		return response{Result: resultError, Text: "exactly one of hw-address or client-id must be specified"}
+	}
+	if h.IPAddress != "" {
+		ip := net.ParseIP(h.IPAddress).To4()
+		if ip == nil {
+			return response{Result: resultError, Text: fmt.Sprintf("invalid IPv4 address %q", h.IPAddress)}
+		}
+		h.IPAddress = ip.String()
+	}
+	for _, o := range s.hosts {
+		if o.SubnetID != h.SubnetID {
+			continue
+		}
+		oType, oID := o.identifier()
+		if (oType == idType && oID == id) || (h.IPAddress != "" && o.IPAddress == h.IPAddress) {
+			return response{Result: resultError, Text: "Database duplicate entry error"}
+		}
+	}
+	if h.HWAddress != "" {
+		h.HWAddress = strings.ToLower(h.HWAddress)
+	}
+	s.hosts = append(s.hosts, h)
+	return response{Result: resultSuccess, Text: "Host added."}
+}
+
+func (h Host) identifier() (string, string) {
+	if h.HWAddress != "" {
+		return "hw-address", strings.ToLower(h.HWAddress)
+	}
+	return "client-id", strings.ToLower(h.ClientID)
+}
+
+// hostKey selects a reservation by subnet and either address or identifier.
+type hostKey struct {
+	SubnetID       *int   `json:"subnet-id"`
+	IPAddress      string `json:"ip-address"`
+	IdentifierType string `json:"identifier-type"`
+	Identifier     string `json:"identifier"`
+}
+
+// find returns the index of the reservation k selects, or a Kea error.
+// Caller holds s.mu.
+func (s *Server) find(args json.RawMessage) (int, *response) {
+	var k hostKey
+	if res := decodeArgs(args, &k); res != nil {
+		return -1, res
+	}
+	if k.SubnetID == nil {
+		return -1, &response{Result: resultError, Text: "missing parameter 'subnet-id'"}
+	}
+	if k.IPAddress == "" && (k.IdentifierType == "" || k.Identifier == "") {
+		return -1, &response{Result: resultError, Text: "one of ip-address or identifier-type/identifier must be specified"}
+	}
+	for i, h := range s.hosts {
+		if h.SubnetID != *k.SubnetID {
+			continue
+		}
+		if k.IPAddress != "" {
+			if h.IPAddress == normIP(k.IPAddress) {
+				return i, nil
+			}
+			continue
+		}
+		if t, id := h.identifier(); t == k.IdentifierType && id == strings.ToLower(k.Identifier) {
+			return i, nil
+		}
+	}
+	return -1, &response{Result: resultEmpty, Text: "Host not found."}
+}
+
+func (s *Server) reservationAdd(args json.RawMessage) response {
+	var a struct {
+		Reservation *Host `json:"reservation"`
+	}
+	if res := decodeArgs(args, &a); res != nil {
+		return *res
+	}
+	if a.Reservation == nil {
+		return response{Result: resultError, Text: "missing parameter 'reservation'"}
+	}
+	return s.addHost(*a.Reservation)
+}
+
+func (s *Server) reservationGet(args json.RawMessage) response {
+	i, res := s.find(args)
+	if res != nil {
+		return *res
+	}
+	return response{Result: resultSuccess, Text: "Host found.", Arguments: s.hosts[i]}
+}
+
+func (s *Server) reservationGetAll(args json.RawMessage) response {
+	var a struct {
+		SubnetID *int `json:"subnet-id"`
+	}
+	if res := decodeArgs(args, &a); res != nil {
+		return *res
+	}
+	if a.SubnetID == nil {
+		return response{Result: resultError, Text: "missing parameter 'subnet-id'"}
+	}
+	hosts := []Host{}
+	for _, h := range s.hosts {
+		if h.SubnetID == *a.SubnetID {
+			hosts = append(hosts, h)
+		}
+	}
+	if len(hosts) == 0 {
+		return response{Result: resultEmpty, Text: "0 IPv4 host(s) found.", Arguments: map[string]any{"hosts": hosts}}
+	}
+	return response{Result: resultSuccess, Text: fmt.Sprintf("%d IPv4 host(s) found.", len(hosts)), Arguments: map[string]any{"hosts": hosts}}
+}
+
+func (s *Server) reservationDel(args json.RawMessage) response {
+	i, res := s.find(args)
+	if res != nil {
+		return *res
+	}
+	s.hosts = append(s.hosts[:i], s.hosts[i+1:]...)
+	return response{Result: resultSuccess, Text: "Host deleted."}
+}
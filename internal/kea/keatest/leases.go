@@ -0,0 +1,162 @@
+package keatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Lease is a DHCPv4 lease in the lease_cmds encoding.
+type Lease struct {
+	IPAddress string `json:"ip-address"`
+	HWAddress string `json:"hw-address"`
+	Hostname  string `json:"hostname"`
+	SubnetID  int    `json:"subnet-id"`
+	CLTT      int64  `json:"cltt"`
+	ValidLft  int64  `json:"valid-lft"`
+	State     int    `json:"state"`
+}
+
+// AddLease stores l, filling in the subnet from the address and cltt from
+// Now when they are zero.
+func (s *Server) AddLease(l Lease) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if res := s.addLease(l, 0); res.Result != resultSuccess {
+		return fmt.Errorf("%s", res.Text)
+	}
+	return nil
+}
+
+// Leases returns all stored leases ordered by address.
+func (s *Server) Leases() []Lease {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedLeases(nil)
+}
+
+// sortedLeases returns the leases of the given subnets (all when empty).
+// Caller holds s.mu.
+func (s *Server) sortedLeases(subnets []int) []Lease {
+	var out []Lease
+	for _, l := range s.leases {
+		if len(subnets) > 0 && !containsInt(subnets, l.SubnetID) {
+			continue
+		}
+		out = append(out, l)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return bytesCmp(net.ParseIP(out[i].IPAddress).To4(), net.ParseIP(out[j].IPAddress).To4()) < 0
+	})
+	return out
+}
+
+// addLease validates and stores l; expire, when set, fixes cltt as
+// expire - valid-lft. Caller holds s.mu.
+func (s *Server) addLease(l Lease, expire int64) response {
+	ip := net.ParseIP(l.IPAddress).To4()
+	if ip == nil {
+		return response{Result: resultError, Text: fmt.Sprintf("invalid IPv4 address %q", l.IPAddress)}
+	}
+	l.IPAddress = ip.String()
+	if _, err := net.ParseMAC(l.HWAddress); err != nil {
+		return response{Result: resultError, Text: "invalid hw-address: " + err.Error()}
+	}
+	l.HWAddress = strings.ToLower(l.HWAddress)
+	sn, ok := s.subnetFor(ip)
+	switch {
+	case !ok:
+		return response{Result: resultError, Text: fmt.Sprintf("subnet for address %s not found", ip)}
+	case l.SubnetID != 0 && l.SubnetID != sn.ID:
+		return response{Result: resultError, Text: fmt.Sprintf("address %s does not belong to subnet %d", ip, l.SubnetID)}
+	}
+	l.SubnetID = sn.ID
+	if _, dup := s.leases[l.IPAddress]; dup {
+		return response{Result: resultError, Text: "IPv4 lease already exists."}
+	}
+	if l.ValidLft == 0 {
+		l.ValidLft = 4000
+	}
+	switch {
+	case expire != 0:
+		l.CLTT = expire - l.ValidLft
+	case l.CLTT == 0:
+		l.CLTT = s.Now().Unix()
+	}
+	s.leases[l.IPAddress] = l
+	return response{Result: resultSuccess, Text: "Lease for address " + l.IPAddress + ", subnet-id " + fmt.Sprint(l.SubnetID) + " added."}
+}
+
+func (s *Server) lease4GetAll(args json.RawMessage) response {
+	var a struct {
+		Subnets []int `json:"subnets"`
+	}
+	if len(args) > 0 {
+		if res := decodeArgs(args, &a); res != nil {
+			return *res
+		}
+	}
+	leases := s.sortedLeases(a.Subnets)
+	if len(leases) == 0 {
+		return response{Result: resultEmpty, Text: "0 IPv4 lease(s) found.", Arguments: map[string]any{"leases": []Lease{}}}
+	}
+	return response{Result: resultSuccess, Text: fmt.Sprintf("%d IPv4 lease(s) found.", len(leases)), Arguments: map[string]any{"leases": leases}}
+}
+
+type leaseKey struct {
+	IPAddress string `json:"ip-address"`
+}
+
+func (s *Server) lease4Get(args json.RawMessage) response {
+	var a leaseKey
+	if res := decodeArgs(args, &a); res != nil {
+		return *res
+	}
+	l, ok := s.leases[normIP(a.IPAddress)]
+	if !ok {
+		return response{Result: resultEmpty, Text: "Lease not found."}
+	}
+	return response{Result: resultSuccess, Text: "IPv4 lease found.", Arguments: l}
+}
+
+func (s *Server) lease4Add(args json.RawMessage) response {
+	var a struct {
+		Lease
+		Expire int64 `json:"expire"`
+	}
+	if res := decodeArgs(args, &a); res != nil {
+		return *res
+	}
+	return s.addLease(a.Lease, a.Expire)
+}
+
+func (s *Server) lease4Del(args json.RawMessage) response {
+	var a leaseKey
+	if res := decodeArgs(args, &a); res != nil {
+		return *res
+	}
+	ip := normIP(a.IPAddress)
+	if _, ok := s.leases[ip]; !ok {
+		return response{Result: resultEmpty, Text: "IPv4 lease not found."}
+	}
+	delete(s.leases, ip)
+	return response{Result: resultSuccess, Text: "IPv4 lease deleted."}
+}
+
+func normIP(s string) string {
+	if ip := net.ParseIP(s).To4(); ip != nil {
+		return ip.String()
+	}
+	return s
+}
+
+func containsInt(xs []int, x int) bool {
+	for _, v := range xs {
+		if v == x {
+			return true
+		}
+	}
+	return false
+}
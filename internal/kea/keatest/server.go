@@ -0,0 +1,371 @@
+// Package keatest provides a stand-in for the Kea Control Agent in the
+// spirit of net/http/httptest. It speaks the JSON command protocol over a
+// localhost HTTP port and keeps leases and host reservations in memory, so
+// the real kea.Client can be tested without a Kea installation.
+package keatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Weruminger/go-ad-admin/internal/config"
+)
+
+// Token is the bearer token the server accepts unless changed.
+const Token = "keatest-token"
+
+// Kea result codes.
+const (
+	resultSuccess     = 0
+	resultError       = 1
+	resultUnsupported = 2
+	resultEmpty       = 3
+)
+
+// Fault is an error the server injects instead of executing a command.
+type Fault int
+
+const (
+	// FaultResult answers with Kea result 1 ("error").
+	FaultResult Fault = iota + 1
+	// FaultHTTP500 answers with HTTP 500 and no Kea envelope.
+	FaultHTTP500
+	// FaultTimeout never answers; the request hangs until the client gives
+	// up or the server is closed.
+	FaultTimeout
+)
+
+// Subnet is a DHCPv4 subnet of the fake server's configuration.
+type Subnet struct {
+	ID     int
+	Prefix *net.IPNet
+	Pools  [][2]net.IP // inclusive address ranges
+
+	raw map[string]any // subnet4 entry as config-get returns it
+}
+
+// Server is an in-memory Kea Control Agent with a DHCPv4 server behind it.
+type Server struct {
+	URL string
+
+	// Token is the expected bearer token; empty disables the check.
+	Token string
+	// Now is the clock used for lease times.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	latency time.Duration
+	faults  map[string][]Fault // command -> pending faults, "" for any
+	calls   map[string]int
+	subnets []Subnet
+	global  map[string]any   // Dhcp4 settings other than subnet4
+	leases  map[string]Lease // ip -> lease
+	hosts   []Host
+	started time.Time
+
+	srv  *httptest.Server
+	done chan struct{}
+}
+
+// NewServer starts a server with subnet 1 = 192.0.2.0/24 and the dynamic
+// pool 192.0.2.100-192.0.2.199.
+func NewServer() *Server {
+	s := &Server{
+		Token:   Token,
+		Now:     time.Now,
+		faults:  map[string][]Fault{},
+		calls:   map[string]int{},
+		leases:  map[string]Lease{},
+		started: time.Now(),
+		done:    make(chan struct{}),
+		global: map[string]any{
+			"valid-lifetime":    4000,
+			"interfaces-config": map[string]any{"interfaces": []any{"*"}},
+			"lease-database":    map[string]any{"type": "memfile"},
+		},
+	}
+	must(s.AddSubnet(1, "192.0.2.0/24", "192.0.2.100-192.0.2.199"))
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.srv.URL
+	return s
+}
+
+func must(err error) {
+	if err != nil {
+		panic("keatest: " + err.Error())
+	}
+}
+
+// Close releases hanging requests and shuts the server down.
+func (s *Server) Close() {
+	s.mu.Lock()
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+	s.mu.Unlock()
+	s.srv.Close()
+}
+
+// Config returns a dev configuration pointing at this server with its token
+// and a short timeout.
+func (s *Server) Config() config.Config {
+	cfg := *config.NewDefaultConfig()
+	cfg.Env = "dev"
+	cfg.KeaURL = s.URL
+	cfg.KeaToken = s.Token
+	cfg.KeaTimeout = 500 * time.Millisecond
+	return cfg
+}
+
+// AddSubnet adds a subnet with pools given as "first-last" or CIDR.
+func (s *Server) AddSubnet(id int, prefix string, pools ...string) error {
+	raw := map[string]any{"id": id, "subnet": prefix}
+	if len(pools) > 0 {
+		var ps []any
+		for _, p := range pools {
+			ps = append(ps, map[string]any{"pool": p})
+		}
+		raw["pools"] = ps
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subnets, err := parseSubnets(append(s.rawSubnets(), raw))
+	if err != nil {
+		return err
+	}
+	s.subnets = subnets
+	return nil
+}
+
+func parsePool(p string) ([2]net.IP, error) {
+	if _, ipn, err := net.ParseCIDR(p); err == nil {
+		first := ipn.IP.To4()
+		last := make(net.IP, 4)
+		for i := range last {
+			last[i] = first[i] | ^ipn.Mask[i]
+		}
+		return [2]net.IP{first, last}, nil
+	}
+	a, b, ok := strings.Cut(p, "-")
+	first, last := net.ParseIP(strings.TrimSpace(a)).To4(), net.ParseIP(strings.TrimSpace(b)).To4()
+	if !ok || first == nil || last == nil {
+		return [2]net.IP{}, fmt.Errorf("pool %q: want first-last or CIDR", p)
+	}
+	return [2]net.IP{first, last}, nil
+}
+
+// SetLatency delays every answer by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// Fail injects f into the next n calls of cmd ("" for any command).
+func (s *Server) Fail(cmd string, n int, f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.faults[cmd] = append(s.faults[cmd], f)
+	}
+}
+
+// Calls returns how often cmd reached the server, including failed calls.
+func (s *Server) Calls(cmd string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[cmd]
+}
+
+func (s *Server) nextFault(cmd string) Fault {
+	for _, k := range []string{cmd, ""} {
+		if q := s.faults[k]; len(q) > 0 {
+			s.faults[k] = q[1:]
+			return q[0]
+		}
+	}
+	return 0
+}
+
+type request struct {
+	Command   string          `json:"command"`
+	Service   []string        `json:"service"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type response struct {
+	Result    int    `json:"result"`
+	Text      string `json:"text,omitempty"`
+	Arguments any    `json:"arguments,omitempty"`
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		reply(w, nil, response{Result: resultError, Text: "invalid JSON: " + err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	s.calls[req.Command]++
+	fault := s.nextFault(req.Command)
+	latency := s.latency
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+	}
+	switch fault {
+	case FaultResult:
+		reply(w, req.Service, response{Result: resultError, Text: "injected failure"})
+		return
+	case FaultHTTP500:
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	case FaultTimeout:
+		select {
+		case <-r.Context().Done():
+		case <-s.done:
+		}
+		return
+	}
+
+	s.mu.Lock()
+	res := s.exec(req)
+	s.mu.Unlock()
+	reply(w, req.Service, res)
+}
+
+// reply wraps the answer in a list for forwarded commands, as the Control
+// Agent does, and sends it bare for the agent's own.
+func reply(w http.ResponseWriter, service []string, res response) {
+	w.Header().Set("Content-Type", "application/json")
+	if len(service) > 0 {
+		_ = json.NewEncoder(w).Encode([]response{res})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// exec runs one command. Caller holds s.mu.
+func (s *Server) exec(req request) response {
+	if len(req.Service) == 0 {
+		switch req.Command {
+		case "status-get", "list-commands":
+		default:
+			return response{Result: resultUnsupported, Text: fmt.Sprintf("'%s' command not supported.", req.Command)}
+		}
+	} else if len(req.Service) != 1 || req.Service[0] != "dhcp4" {
+		return response{Result: resultError, Text: fmt.Sprintf("forwarding socket is not configured for the server type %v", req.Service)}
+	}
+	h, ok := commands[req.Command]
+	if !ok {
+		return response{Result: resultUnsupported, Text: fmt.Sprintf("'%s' command not supported.", req.Command)}
+	}
+	return h(s, req.Arguments)
+}
+
+type handler func(s *Server, args json.RawMessage) response
+
+var commands map[string]handler
+
+func init() {
+	commands = map[string]handler{
+		"list-commands":       (*Server).listCommands,
+		"status-get":          (*Server).statusGet,
+		"lease4-get-all":      (*Server).lease4GetAll,
+		"lease4-get":          (*Server).lease4Get,
+		"lease4-add":          (*Server).lease4Add,
+		"lease4-del":          (*Server).lease4Del,
+		"reservation-add":     (*Server).reservationAdd,
+		"reservation-get":     (*Server).reservationGet,
+		"reservation-get-all": (*Server).reservationGetAll,
+		"reservation-del":     (*Server).reservationDel,
+		"config-get":          (*Server).configGet,
+		"config-test":         (*Server).configTest,
+		"config-set":          (*Server).configSet,
+		"config-write":        (*Server).configWrite,
+	}
+}
+
+func (s *Server) listCommands(json.RawMessage) response {
+	names := make([]string, 0, len(commands))
+	for n := range commands {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return response{Result: resultSuccess, Arguments: names}
+}
+
+func (s *Server) statusGet(json.RawMessage) response {
+	return response{Result: resultSuccess, Arguments: map[string]any{
+		"pid":    4242,
+		"uptime": int64(s.Now().Sub(s.started) / time.Second),
+		"reload": int64(s.Now().Sub(s.started) / time.Second),
+	}}
+}
+
+// decodeArgs unmarshals args into v, or returns the Kea-style error answer.
+func decodeArgs(args json.RawMessage, v any) *response {
+	if len(args) == 0 {
+		return &response{Result: resultError, Text: "no arguments specified"}
+	}
+	if err := json.Unmarshal(args, v); err != nil {
+		return &response{Result: resultError, Text: err.Error()}
+	}
+	return nil
+}
+
+// subnetFor returns the subnet containing ip. Caller holds s.mu.
+func (s *Server) subnetFor(ip net.IP) (Subnet, bool) {
+	for _, sn := range s.subnets {
+		if sn.Prefix.Contains(ip) {
+			return sn, true
+		}
+	}
+	return Subnet{}, false
+}
+
+func (s *Server) subnet(id int) (Subnet, bool) {
+	for _, sn := range s.subnets {
+		if sn.ID == id {
+			return sn, true
+		}
+	}
+	return Subnet{}, false
+}
+
+func bytesCmp(a, b net.IP) int {
+	for i := range a {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,162 @@
+package keatest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func post(t *testing.T, s *Server, token, body string) (int, []response) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, s.URL, bytes.NewBufferString(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil
+	}
+	var list []response
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return resp.StatusCode, list
+}
+
+func TestServer_TokenAndEnvelope(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	if code, _ := post(t, s, "wrong", `{"command":"status-get","service":["dhcp4"]}`); code != http.StatusUnauthorized {
+		t.Fatalf("wrong token: %d", code)
+	}
+	code, res := post(t, s, Token, `{"command":"status-get","service":["dhcp4"]}`)
+	if code != http.StatusOK || len(res) != 1 || res[0].Result != resultSuccess {
+		t.Fatalf("status-get: %d %+v", code, res)
+	}
+	if _, res := post(t, s, Token, `{"command":"lease4-get-all","service":["dhcp6"]}`); res[0].Result != resultError {
+		t.Fatalf("dhcp6 is not configured: %+v", res)
+	}
+	if _, res := post(t, s, Token, `{"command":"frobnicate","service":["dhcp4"]}`); res[0].Result != resultUnsupported {
+		t.Fatalf("unknown command: %+v", res)
+	}
+}
+
+func TestServer_Leases(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	add := `{"command":"lease4-add","service":["dhcp4"],"arguments":{"ip-address":"192.0.2.10","hw-address":"AA:BB:CC:DD:EE:FF","valid-lft":60,"expire":1000}}`
+	if _, res := post(t, s, Token, add); res[0].Result != resultSuccess {
+		t.Fatalf("add: %+v", res)
+	}
+	if _, res := post(t, s, Token, add); res[0].Result != resultError {
+		t.Fatalf("duplicate: %+v", res)
+	}
+	if _, res := post(t, s, Token, `{"command":"lease4-add","service":["dhcp4"],"arguments":{"ip-address":"10.0.0.1","hw-address":"aa:bb:cc:dd:ee:00"}}`); res[0].Result != resultError {
+		t.Fatalf("outside any subnet: %+v", res)
+	}
+	if l := s.Leases(); len(l) != 1 || l[0].CLTT != 940 || l[0].SubnetID != 1 || l[0].HWAddress != "aa:bb:cc:dd:ee:ff" {
+		t.Fatalf("stored %+v", l)
+	}
+	if _, res := post(t, s, Token, `{"command":"lease4-del","service":["dhcp4"],"arguments":{"ip-address":"192.0.2.10"}}`); res[0].Result != resultSuccess {
+		t.Fatalf("del: %+v", res)
+	}
+	if _, res := post(t, s, Token, `{"command":"lease4-get-all","service":["dhcp4"]}`); res[0].Result != resultEmpty {
+		t.Fatalf("get-all after delete: %+v", res)
+	}
+}
+
+func TestServer_Reservations(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	if err := s.AddHost(Host{SubnetID: 1, HWAddress: "aa:bb:cc:dd:ee:ff", IPAddress: "192.0.2.5", Hostname: "printer"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddHost(Host{SubnetID: 1, ClientID: "01:02", IPAddress: "192.0.2.5"}); err == nil {
+		t.Fatal("duplicate address accepted")
+	}
+	if err := s.AddHost(Host{SubnetID: 9, HWAddress: "aa:bb:cc:dd:ee:00"}); err == nil {
+		t.Fatal("unknown subnet accepted")
+	}
+	_, res := post(t, s, Token, `{"command":"reservation-get","service":["dhcp4"],"arguments":{"subnet-id":1,"identifier-type":"hw-address","identifier":"AA:BB:CC:DD:EE:FF"}}`)
+	if res[0].Result != resultSuccess || res[0].Arguments.(map[string]any)["hostname"] != "printer" {
+		t.Fatalf("get by identifier: %+v", res)
+	}
+	if _, res := post(t, s, Token, `{"command":"reservation-del","service":["dhcp4"],"arguments":{"subnet-id":1,"ip-address":"192.0.2.5"}}`); res[0].Result != resultSuccess {
+		t.Fatalf("del: %+v", res)
+	}
+	if _, res := post(t, s, Token, `{"command":"reservation-get-all","service":["dhcp4"],"arguments":{"subnet-id":1}}`); res[0].Result != resultEmpty {
+		t.Fatalf("get-all after delete: %+v", res)
+	}
+}
+
+func TestServer_Faults(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Fail("status-get", 1, FaultResult)
+	s.Fail("", 1, FaultHTTP500)
+	body := `{"command":"status-get","service":["dhcp4"]}`
+	if _, res := post(t, s, Token, body); res[0].Result != resultError {
+		t.Fatalf("injected result: %+v", res)
+	}
+	if code, _ := post(t, s, Token, body); code != http.StatusInternalServerError {
+		t.Fatalf("injected 500: %d", code)
+	}
+	if _, res := post(t, s, Token, body); res[0].Result != resultSuccess {
+		t.Fatalf("faults must be consumed: %+v", res)
+	}
+	if s.Calls("status-get") != 3 {
+		t.Fatalf("calls %d", s.Calls("status-get"))
+	}
+
+	s.Fail("status-get", 1, FaultTimeout)
+	c := &http.Client{Timeout: 50 * time.Millisecond}
+	req, _ := http.NewRequest(http.MethodPost, s.URL, bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer "+Token)
+	if _, err := c.Do(req); err == nil {
+		t.Fatal("hanging request answered")
+	}
+
+	s.SetLatency(30 * time.Millisecond)
+	start := time.Now()
+	post(t, s, Token, body)
+	if d := time.Since(start); d < 30*time.Millisecond {
+		t.Fatalf("latency not applied: %v", d)
+	}
+}
+
+func TestServer_Config(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	_, res := post(t, s, Token, `{"command":"config-get","service":["dhcp4"]}`)
+	args, _ := res[0].Arguments.(map[string]any)
+	if res[0].Result != resultSuccess || args["Dhcp4"] == nil || args["hash"] == "" {
+		t.Fatalf("config-get: %+v", res)
+	}
+	bad := `{"command":"config-test","service":["dhcp4"],"arguments":{"Dhcp4":{"subnet4":[{"id":1,"subnet":"192.0.2.0/24","pools":[{"pool":"198.51.100.1-198.51.100.9"}]}]}}}`
+	if _, res := post(t, s, Token, bad); res[0].Result != resultError || res[0].Text == "" {
+		t.Fatalf("pool outside subnet: %+v", res)
+	}
+	dup := `{"command":"config-set","service":["dhcp4"],"arguments":{"Dhcp4":{"subnet4":[{"id":1,"subnet":"192.0.2.0/24"},{"id":1,"subnet":"198.51.100.0/24"}]}}}`
+	if _, res := post(t, s, Token, dup); res[0].Result != resultError {
+		t.Fatalf("duplicate id: %+v", res)
+	}
+	if sn := s.Subnets(); len(sn) != 1 || len(sn[0].Pools) != 1 {
+		t.Fatalf("rejected config-set changed the config: %+v", sn)
+	}
+	set := `{"command":"config-set","service":["dhcp4"],"arguments":{"Dhcp4":{"valid-lifetime":600,"subnet4":[{"id":2,"subnet":"198.51.100.0/24","pools":[{"pool":"198.51.100.0/28"}]}]}}}`
+	if _, res := post(t, s, Token, set); res[0].Result != resultSuccess {
+		t.Fatalf("config-set: %+v", res)
+	}
+	if sn := s.Subnets(); len(sn) != 1 || sn[0].ID != 2 || sn[0].Pools[0][1].String() != "198.51.100.15" {
+		t.Fatalf("after config-set: %+v", sn)
+	}
+	if _, res := post(t, s, Token, `{"command":"config-write","service":["dhcp4"]}`); res[0].Result != resultSuccess {
+		t.Fatalf("config-write: %+v", res)
+	}
+}
@@ -0,0 +1,146 @@
+package kea
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/Weruminger/go-ad-admin/internal/change"
+	"github.com/Weruminger/go-ad-admin/internal/domain"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+)
+
+// DHCP4 is the service name of the DHCPv4 server behind the Control Agent.
+const DHCP4 = "dhcp4"
+
+// Lease4 is a lease as the lease_cmds hook library encodes it.
+type Lease4 struct {
+	IPAddress string `json:"ip-address"`
+	HWAddress string `json:"hw-address,omitempty"`
+	Hostname  string `json:"hostname,omitempty"`
+	SubnetID  int    `json:"subnet-id,omitempty"`
+	CLTT      int64  `json:"cltt,omitempty"`      // client last transmission time, unix seconds
+	ValidLft  int64  `json:"valid-lft,omitempty"` // seconds from cltt
+	Expire    int64  `json:"expire,omitempty"`    // unix seconds, only sent by lease4-add
+	State     int    `json:"state,omitempty"`
+}
+
+// toDomain converts l to a domain.DHCPLease without a modelx.Base; attach
+// one before calling Load or Save.
+func (l Lease4) toDomain() domain.DHCPLease {
+	d := *domain.NewDHCPLease(nil)
+	d.IP = l.IPAddress
+	d.MAC = l.HWAddress
+	d.Host = l.Hostname
+	d.Start = time.Unix(l.CLTT, 0).UTC()
+	d.End = d.Start.Add(time.Duration(l.ValidLft) * time.Second)
+	return d
+}
+
+func leaseFromDomain(d domain.DHCPLease) Lease4 {
+	return Lease4{
+		IPAddress: d.IP,
+		HWAddress: d.MAC,
+		Hostname:  d.Host,
+		ValidLft:  int64(d.End.Sub(d.Start) / time.Second),
+		Expire:    d.End.Unix(),
+	}
+}
+
+// Status is the answer of status-get.
+type Status struct {
+	PID    int
+	Uptime time.Duration
+	Reload time.Duration // time since the last config (re)load
+}
+
+// Leases returns all DHCPv4 leases, optionally restricted to subnet IDs.
+func (c *Client) Leases(ctx context.Context, subnets ...int) ([]domain.DHCPLease, error) {
+	var args any
+	if len(subnets) > 0 {
+		args = map[string]any{"subnets": subnets}
+	}
+	var out struct {
+		Leases []Lease4 `json:"leases"`
+	}
+	err := c.Command(ctx, DHCP4, "lease4-get-all", args, &out)
+	if errs.IsCode(err, errs.NotFound) {
+		return nil, nil // result 3: no leases at all
+	}
+	if err != nil {
+		return nil, err
+	}
+	leases := make([]domain.DHCPLease, len(out.Leases))
+	for i, l := range out.Leases {
+		leases[i] = l.toDomain()
+	}
+	return leases, nil
+}
+
+// Lease returns the lease for ip, NOT_FOUND if there is none.
+func (c *Client) Lease(ctx context.Context, ip string) (domain.DHCPLease, error) {
+	if err := checkIP("kea.lease4-get", ip); err != nil {
+		return domain.DHCPLease{}, err
+	}
+	var l Lease4
+	if err := c.Command(ctx, DHCP4, "lease4-get", map[string]any{"ip-address": ip}, &l); err != nil {
+		return domain.DHCPLease{}, err
+	}
+	return l.toDomain(), nil
+}
+
+// AddLease creates a lease from d; Kea picks the subnet from the address.
+func (c *Client) AddLease(ctx context.Context, d domain.DHCPLease) error {
+	if err := checkIP("kea.lease4-add", d.IP); err != nil {
+		return err
+	}
+	if err := c.Command(ctx, DHCP4, "lease4-add", leaseFromDomain(d), nil); err != nil {
+		return err
+	}
+	return record(ctx, pending{kind: change.DHCPLease, id: d.IP, action: "create", after: d}, d.MAC)
+}
+
+// DeleteLease removes the lease for ip, NOT_FOUND if there is none.
+func (c *Client) DeleteLease(ctx context.Context, ip string) error {
+	if err := checkIP("kea.lease4-del", ip); err != nil {
+		return err
+	}
+	p := pending{kind: change.DHCPLease, id: ip, action: "delete"}
+	var mac string
+	if recording(ctx) || planFrom(ctx) != nil {
+		l, err := c.Lease(ctx, ip)
+		switch {
+		case err == nil:
+			p.before, mac = l, l.MAC
+		case planFrom(ctx) != nil:
+			return err // the NOT_FOUND the delete would report
+		case !errs.IsCode(err, errs.NotFound):
+			return err // no before state to record
+		}
+	}
+	if err := c.Command(ctx, DHCP4, "lease4-del", map[string]any{"ip-address": ip}, nil); err != nil {
+		return err
+	}
+	return record(ctx, p, mac)
+}
+
+// Status reports pid and uptime of the DHCPv4 server.
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	var out struct {
+		PID    int   `json:"pid"`
+		Uptime int64 `json:"uptime"`
+		Reload int64 `json:"reload"`
+	}
+	if err := c.Command(ctx, DHCP4, "status-get", nil, &out); err != nil {
+		return Status{}, err
+	}
+	return Status{PID: out.PID, Uptime: time.Duration(out.Uptime) * time.Second, Reload: time.Duration(out.Reload) * time.Second}, nil
+}
+
+func checkIP(op errs.Op, ip string) error {
+	if p := net.ParseIP(ip); p == nil || p.To4() == nil {
+		return errs.New(op, errs.InvalidInput, errors.New("ip must be IPv4"), map[string]any{"ip": ip})
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package kea
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Weruminger/go-ad-admin/internal/change"
+)
+
+// Plan lists the write commands of a dry run in order. Secret arguments
+// are change.Redacted.
+type Plan struct {
+	Commands []Request `json:"commands"`
+}
+
+type planKey struct{}
+
+// DryRun returns ctx for a dry run: the Client still sends reads and
+// config-test, so plans are validated by Kea, but only notes the commands
+// that would change leases, reservations or the configuration in the
+// returned Plan.
+func DryRun(ctx context.Context) (context.Context, *Plan) {
+	p := &Plan{}
+	return context.WithValue(ctx, planKey{}, p), p
+}
+
+func planFrom(ctx context.Context) *Plan {
+	p, _ := ctx.Value(planKey{}).(*Plan)
+	return p
+}
+
+// note adds req to p with its arguments redacted.
+func (p *Plan) note(req Request) error {
+	if req.Arguments != nil {
+		raw, err := json.Marshal(req.Arguments)
+		if err != nil {
+			return err
+		}
+		var args any
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return err
+		}
+		req.Arguments = change.Redact(args)
+	}
+	p.Commands = append(p.Commands, req)
+	return nil
+}
@@ -0,0 +1,54 @@
+package kea
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/domain"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+)
+
+func TestDryRun(t *testing.T) {
+	srv, c := newFake(t)
+	ctx, plan := DryRun(context.Background())
+
+	r := *domain.NewDHCPReservation(nil)
+	r.SubnetID, r.HWAddress, r.IP = 1, "aa:bb:cc:dd:ee:ff", "192.0.2.5"
+	if err := c.AddReservation(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.Hosts()) != 0 {
+		t.Fatal("dry run stored the reservation")
+	}
+	if err := c.DeleteReservation(ctx, 1, "192.0.2.9"); !errs.IsCode(err, errs.NotFound) {
+		t.Fatalf("delete missing: want NOT_FOUND, got %v", err)
+	}
+	if err := c.AddReservation(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddReservation(ctx, r); !errs.IsCode(err, errs.Conflict) {
+		t.Fatalf("duplicate: want CONFLICT, got %v", err)
+	}
+
+	all, _ := c.Subnets(ctx)
+	s := all[0]
+	s.ValidLifetime = 3600
+	p, err := c.PlanSubnet(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Apply(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Calls("config-test") != 1 || srv.Calls("config-set") != 0 || srv.Calls("config-write") != 0 {
+		t.Fatalf("config-test %d, config-set %d, config-write %d", srv.Calls("config-test"), srv.Calls("config-set"), srv.Calls("config-write"))
+	}
+
+	var cmds []string
+	for _, r := range plan.Commands {
+		cmds = append(cmds, r.Command)
+	}
+	if len(cmds) != 3 || cmds[0] != "reservation-add" || cmds[1] != "config-set" || cmds[2] != "config-write" {
+		t.Fatalf("commands %v", cmds)
+	}
+}
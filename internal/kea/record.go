@@ -0,0 +1,33 @@
+package kea
+
+import (
+	"context"
+
+	"github.com/Weruminger/go-ad-admin/internal/change"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+)
+
+// pending is a change waiting for Apply.
+type pending struct {
+	kind, id, action string
+	before, after    any
+}
+
+// recording reports whether writes in ctx are recorded; only then do the
+// write methods spend a lookup on the before state.
+func recording(ctx context.Context) bool { return change.FromContext(ctx) != nil }
+
+// record reports a successful write to the change.Recorder of ctx, if any.
+// nil before or after means the object did not exist.
+func record(ctx context.Context, p pending, mac string) error {
+	rec := change.FromContext(ctx)
+	if rec == nil {
+		return nil
+	}
+	r, err := change.New(p.kind, p.id, p.action, p.before, p.after)
+	if err != nil {
+		return errs.New("kea.record", errs.Internal, err, map[string]any{"id": p.id})
+	}
+	r.MAC = mac
+	return rec.Record(r)
+}
@@ -0,0 +1,90 @@
+package kea
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/change"
+	"github.com/Weruminger/go-ad-admin/internal/domain"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/kea/keatest"
+)
+
+func TestRecording(t *testing.T) {
+	_, c := newFake(t)
+	var got []change.Record
+	ctx := change.NewContext(context.Background(),
+		change.RecorderFunc(func(r change.Record) error { got = append(got, r); return nil }))
+
+	r := *domain.NewDHCPReservation(nil)
+	r.SubnetID, r.HWAddress, r.IP = 1, "aa:bb:cc:dd:ee:ff", "192.0.2.5"
+	if err := c.AddReservation(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteReservation(ctx, 1, "192.0.2.5"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteReservation(ctx, 1, "192.0.2.5"); err == nil {
+		t.Fatal("second delete succeeded")
+	}
+	// Writes without a recorder in ctx are not recorded.
+	if err := c.AddReservation(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+
+	all, _ := c.Subnets(ctx)
+	s := all[0]
+	s.ValidLifetime = 3600
+	p, err := c.PlanSubnet(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("planning recorded: %+v", got)
+	}
+	if err := c.Apply(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("records %+v", got)
+	}
+	if a := got[0]; a.Op() != "dhcpreservation.create" || a.ID != "1/192.0.2.5" || a.MAC != "aa:bb:cc:dd:ee:ff" || a.Before != "" {
+		t.Fatalf("add %+v", a)
+	}
+	if d := got[1]; d.Op() != "dhcpreservation.delete" || d.MAC != "aa:bb:cc:dd:ee:ff" || d.Before == "" || d.After != "" {
+		t.Fatalf("delete %+v", d)
+	}
+	if u := got[2]; u.Op() != "dhcpsubnet.update" || u.ID != "1" || len(u.Diff) != 1 || u.Diff[0].Path != "validLifetime" {
+		t.Fatalf("subnet %+v", u)
+	}
+}
+
+func TestRecording_BeforeStateUnreadable(t *testing.T) {
+	srv, c := newFake(t)
+	var got []change.Record
+	ctx := change.NewContext(context.Background(),
+		change.RecorderFunc(func(r change.Record) error { got = append(got, r); return nil }))
+	if err := srv.AddLease(keatest.Lease{IPAddress: "192.0.2.10", HWAddress: "aa:bb:cc:dd:ee:01"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.AddHost(keatest.Host{SubnetID: 1, HWAddress: "aa:bb:cc:dd:ee:02", IPAddress: "192.0.2.20"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// an unreadable before state is not "did not exist": nothing is deleted
+	srv.Fail("lease4-get", 4, keatest.FaultHTTP500)
+	if err := c.DeleteLease(ctx, "192.0.2.10"); !errs.IsCode(err, errs.Unavailable) {
+		t.Fatalf("delete lease: %v", err)
+	}
+	srv.Fail("reservation-get", 4, keatest.FaultHTTP500)
+	if err := c.DeleteReservation(ctx, 1, "192.0.2.20"); !errs.IsCode(err, errs.Unavailable) {
+		t.Fatalf("delete reservation: %v", err)
+	}
+	if srv.Calls("lease4-del") != 0 || srv.Calls("reservation-del") != 0 || len(got) != 0 {
+		t.Fatalf("deletes sent: %d %d, records %+v", srv.Calls("lease4-del"), srv.Calls("reservation-del"), got)
+	}
+	if len(srv.Leases()) != 1 || len(srv.Hosts()) != 1 {
+		t.Fatalf("leases %+v, hosts %+v", srv.Leases(), srv.Hosts())
+	}
+}
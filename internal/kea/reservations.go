@@ -0,0 +1,152 @@
+package kea
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Weruminger/go-ad-admin/internal/change"
+	"github.com/Weruminger/go-ad-admin/internal/domain"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+)
+
+// Option is one entry of option-data.
+type Option struct {
+	Name  string `json:"name,omitempty"`
+	Code  int    `json:"code,omitempty"`
+	Data  string `json:"data"`
+	Space string `json:"space,omitempty"`
+}
+
+// Host4 is a DHCPv4 host reservation as the host_cmds hook library encodes
+// it.
+type Host4 struct {
+	SubnetID   int      `json:"subnet-id"`
+	HWAddress  string   `json:"hw-address,omitempty"`
+	ClientID   string   `json:"client-id,omitempty"`
+	IPAddress  string   `json:"ip-address,omitempty"`
+	Hostname   string   `json:"hostname,omitempty"`
+	OptionData []Option `json:"option-data,omitempty"`
+}
+
+// toDomain converts h to a domain.DHCPReservation without a modelx.Base.
+func (h Host4) toDomain() domain.DHCPReservation {
+	r := *domain.NewDHCPReservation(nil)
+	r.SubnetID = h.SubnetID
+	r.HWAddress = h.HWAddress
+	r.ClientID = h.ClientID
+	r.IP = h.IPAddress
+	r.Host = h.Hostname
+	for _, o := range h.OptionData {
+		r.Options = append(r.Options, domain.DHCPOption{Name: o.Name, Code: o.Code, Data: o.Data})
+	}
+	return r
+}
+
+func hostFromDomain(r domain.DHCPReservation) Host4 {
+	h := Host4{SubnetID: r.SubnetID, HWAddress: r.HWAddress, ClientID: r.ClientID, IPAddress: r.IP, Hostname: r.Host}
+	for _, o := range r.Options {
+		h.OptionData = append(h.OptionData, Option{Name: o.Name, Code: o.Code, Data: o.Data})
+	}
+	return h
+}
+
+// AddReservation stores r in Kea's host database. Validate r (with
+// InSubnet) first; Kea itself does not check pools. A reservation for the
+// same identifier or address in the subnet is a CONFLICT.
+func (c *Client) AddReservation(ctx context.Context, r domain.DHCPReservation) error {
+	op := errs.Op("kea.reservation-add")
+	if r.SubnetID < 1 || (r.HWAddress == "" && r.ClientID == "") {
+		return errs.New(op, errs.InvalidInput, errors.New("subnet id and hw-address or client-id are required"), map[string]any{"subnetId": r.SubnetID})
+	}
+	if err := checkIP(op, r.IP); err != nil {
+		return err
+	}
+	if planFrom(ctx) != nil {
+		// Kea would reject the duplicate; a dry run has to ask first.
+		if _, err := c.Reservation(ctx, r.SubnetID, r.IP); err == nil {
+			return errs.New(op, errs.Conflict, errors.New("reservation exists"), map[string]any{"subnetId": r.SubnetID, "ip": r.IP})
+		}
+	}
+	err := c.Command(ctx, DHCP4, "reservation-add", map[string]any{"reservation": hostFromDomain(r)}, nil)
+	var e *errs.E
+	if errors.As(err, &e) && e.Code == errs.InvalidInput && strings.Contains(strings.ToLower(e.Err.Error()), "duplicate") {
+		e.Code = errs.Conflict
+	}
+	if err != nil {
+		return err
+	}
+	return record(ctx, pending{kind: change.DHCPReservation, id: reservationID(r.SubnetID, r.IP), action: "create", after: r}, r.HWAddress)
+}
+
+// reservationID identifies a reservation in change records.
+func reservationID(subnetID int, ip string) string { return fmt.Sprintf("%d/%s", subnetID, ip) }
+
+// Reservation returns the reservation of ip in the subnet, NOT_FOUND if
+// there is none.
+func (c *Client) Reservation(ctx context.Context, subnetID int, ip string) (domain.DHCPReservation, error) {
+	if err := checkIP("kea.reservation-get", ip); err != nil {
+		return domain.DHCPReservation{}, err
+	}
+	var h Host4
+	if err := c.Command(ctx, DHCP4, "reservation-get", map[string]any{"subnet-id": subnetID, "ip-address": ip}, &h); err != nil {
+		return domain.DHCPReservation{}, err
+	}
+	return h.toDomain(), nil
+}
+
+// ReservationByHW returns the reservation of the client with the given MAC
+// address in the subnet.
+func (c *Client) ReservationByHW(ctx context.Context, subnetID int, mac string) (domain.DHCPReservation, error) {
+	var h Host4
+	args := map[string]any{"subnet-id": subnetID, "identifier-type": "hw-address", "identifier": mac}
+	if err := c.Command(ctx, DHCP4, "reservation-get", args, &h); err != nil {
+		return domain.DHCPReservation{}, err
+	}
+	return h.toDomain(), nil
+}
+
+// Reservations returns all reservations of a subnet.
+func (c *Client) Reservations(ctx context.Context, subnetID int) ([]domain.DHCPReservation, error) {
+	var out struct {
+		Hosts []Host4 `json:"hosts"`
+	}
+	err := c.Command(ctx, DHCP4, "reservation-get-all", map[string]any{"subnet-id": subnetID}, &out)
+	if errs.IsCode(err, errs.NotFound) {
+		return nil, nil // result 3: no reservations in the subnet
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.DHCPReservation, len(out.Hosts))
+	for i, h := range out.Hosts {
+		res[i] = h.toDomain()
+	}
+	return res, nil
+}
+
+// DeleteReservation removes the reservation of ip in the subnet, NOT_FOUND
+// if there is none.
+func (c *Client) DeleteReservation(ctx context.Context, subnetID int, ip string) error {
+	if err := checkIP("kea.reservation-del", ip); err != nil {
+		return err
+	}
+	p := pending{kind: change.DHCPReservation, id: reservationID(subnetID, ip), action: "delete"}
+	var mac string
+	if recording(ctx) || planFrom(ctx) != nil {
+		r, err := c.Reservation(ctx, subnetID, ip)
+		switch {
+		case err == nil:
+			p.before, mac = r, r.HWAddress
+		case planFrom(ctx) != nil:
+			return err // the NOT_FOUND the delete would report
+		case !errs.IsCode(err, errs.NotFound):
+			return err // no before state to record
+		}
+	}
+	if err := c.Command(ctx, DHCP4, "reservation-del", map[string]any{"subnet-id": subnetID, "ip-address": ip}, nil); err != nil {
+		return err
+	}
+	return record(ctx, p, mac)
+}
@@ -0,0 +1,74 @@
+package kea
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/domain"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/kea/keatest"
+)
+
+func TestReservations_CRUD(t *testing.T) {
+	srv, c := newFake(t)
+	ctx := context.Background()
+
+	r := *domain.NewDHCPReservation(nil)
+	r.SubnetID, r.HWAddress, r.IP, r.Host = 1, "aa:bb:cc:dd:ee:ff", "192.0.2.5", "printer"
+	r.Options = []domain.DHCPOption{{Name: "routers", Data: "192.0.2.1"}}
+	if err := c.AddReservation(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	if h := srv.Hosts(); len(h) != 1 || h[0].OptionData[0].Name != "routers" {
+		t.Fatalf("stored %+v", h)
+	}
+	if err := c.AddReservation(ctx, r); !errs.IsCode(err, errs.Conflict) {
+		t.Fatalf("duplicate: want CONFLICT, got %v", err)
+	}
+
+	got, err := c.Reservation(ctx, 1, "192.0.2.5")
+	if err != nil || got.Kind != "DHCPReservation" || got.Host != "printer" || len(got.Options) != 1 {
+		t.Fatalf("get %+v %v", got, err)
+	}
+	if got, err := c.ReservationByHW(ctx, 1, "AA:BB:CC:DD:EE:FF"); err != nil || got.IP != "192.0.2.5" {
+		t.Fatalf("get by hw %+v %v", got, err)
+	}
+	all, err := c.Reservations(ctx, 1)
+	if err != nil || len(all) != 1 {
+		t.Fatalf("get-all %v %v", all, err)
+	}
+
+	if err := c.DeleteReservation(ctx, 1, "192.0.2.5"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Reservation(ctx, 1, "192.0.2.5"); !errs.IsCode(err, errs.NotFound) {
+		t.Fatalf("after delete: want NOT_FOUND, got %v", err)
+	}
+	if all, err := c.Reservations(ctx, 1); err != nil || len(all) != 0 {
+		t.Fatalf("empty subnet: %v %v", all, err)
+	}
+	if err := c.DeleteReservation(ctx, 1, "192.0.2.5"); !errs.IsCode(err, errs.NotFound) {
+		t.Fatalf("second delete: want NOT_FOUND, got %v", err)
+	}
+}
+
+func TestReservations_Rejected(t *testing.T) {
+	srv, c := newFake(t)
+	ctx := context.Background()
+	r := *domain.NewDHCPReservation(nil)
+	r.SubnetID, r.IP = 1, "192.0.2.5"
+	if err := c.AddReservation(ctx, r); !errs.IsCode(err, errs.InvalidInput) {
+		t.Fatalf("no identifier: want INVALID_INPUT, got %v", err)
+	}
+	r.HWAddress, r.SubnetID = "aa:bb:cc:dd:ee:ff", 7
+	if err := c.AddReservation(ctx, r); !errs.IsCode(err, errs.InvalidInput) {
+		t.Fatalf("unknown subnet: want INVALID_INPUT, got %v", err)
+	}
+	if srv.Calls("reservation-add") != 1 {
+		t.Fatalf("client-side checks must not reach Kea, got %d calls", srv.Calls("reservation-add"))
+	}
+	srv.Fail("reservation-get-all", 4, keatest.FaultHTTP500)
+	if _, err := c.Reservations(ctx, 1); !errs.IsCode(err, errs.Unavailable) {
+		t.Fatalf("want UNAVAILABLE, got %v", err)
+	}
+}
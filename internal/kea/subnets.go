@@ -0,0 +1,384 @@
+package kea
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Weruminger/go-ad-admin/internal/change"
+	"github.com/Weruminger/go-ad-admin/internal/domain"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+)
+
+// Change is one difference between the running and the planned Dhcp4
+// configuration. Old is nil for added, New is nil for removed values.
+type Change struct {
+	Path string `json:"path"` // e.g. Dhcp4.subnet4[id=2].pools
+	Old  any    `json:"old,omitempty"`
+	New  any    `json:"new,omitempty"`
+}
+
+func (c Change) String() string {
+	switch {
+	case c.Old == nil:
+		return fmt.Sprintf("+ %s: %s", c.Path, jsonString(c.New))
+	case c.New == nil:
+		return fmt.Sprintf("- %s: %s", c.Path, jsonString(c.Old))
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Path, jsonString(c.Old), jsonString(c.New))
+}
+
+func jsonString(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// SubnetPlan is a subnet change that passed config-test and waits for
+// Apply. Changes is the diff to show before applying.
+type SubnetPlan struct {
+	Changes []Change
+
+	base   string         // digest of the configuration the plan was made from
+	config map[string]any // planned Dhcp4
+	change pending        // recorded by Apply
+}
+
+// Subnets returns the subnets of the running DHCPv4 configuration.
+func (c *Client) Subnets(ctx context.Context) ([]domain.DHCPSubnet, error) {
+	cfg, _, err := c.running(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list, _ := cfg["subnet4"].([]any)
+	out := make([]domain.DHCPSubnet, 0, len(list))
+	for _, item := range list {
+		if m, ok := item.(map[string]any); ok {
+			out = append(out, subnetFromRaw(m))
+		}
+	}
+	return out, nil
+}
+
+// PlanSubnet fetches the running configuration, creates or updates the
+// subnet with s.ID and has Kea check the result with config-test. Settings
+// the domain type does not model are kept. Validate s first; a
+// configuration Kea rejects is INVALID_INPUT with its text in
+// Fields["keaText"].
+func (c *Client) PlanSubnet(ctx context.Context, s domain.DHCPSubnet) (*SubnetPlan, error) {
+	op := errs.Op("kea.PlanSubnet")
+	if s.ID < 1 {
+		return nil, errs.New(op, errs.InvalidInput, errors.New("subnet id must be >= 1"), map[string]any{"id": s.ID})
+	}
+	cur, base, err := c.running(ctx)
+	if err != nil {
+		return nil, err
+	}
+	next := clone(cur)
+	list, _ := next["subnet4"].([]any)
+	entry, _ := findSubnet(list, s.ID)
+	ch := pending{kind: change.DHCPSubnet, id: strconv.Itoa(s.ID), action: "update"}
+	if entry == nil {
+		entry = map[string]any{}
+		list = append(list, entry)
+		ch.action = "create"
+	} else {
+		ch.before = subnetFromRaw(entry)
+	}
+	applySubnet(entry, s)
+	ch.after = subnetFromRaw(clone(entry)) // JSON numbers, as read from Kea
+	next["subnet4"] = list
+	p, err := c.plan(ctx, cur, base, clone(next))
+	if err != nil {
+		return nil, err
+	}
+	p.change = ch
+	return p, nil
+}
+
+// PlanSubnetDelete plans the removal of subnet id, NOT_FOUND if there is
+// none.
+func (c *Client) PlanSubnetDelete(ctx context.Context, id int) (*SubnetPlan, error) {
+	cur, base, err := c.running(ctx)
+	if err != nil {
+		return nil, err
+	}
+	next := clone(cur)
+	list, _ := next["subnet4"].([]any)
+	_, i := findSubnet(list, id)
+	if i < 0 {
+		return nil, errs.New("kea.PlanSubnetDelete", errs.NotFound, fmt.Errorf("subnet %d not configured", id), map[string]any{"id": id})
+	}
+	before := subnetFromRaw(list[i].(map[string]any))
+	next["subnet4"] = append(list[:i], list[i+1:]...)
+	p, err := c.plan(ctx, cur, base, next)
+	if err != nil {
+		return nil, err
+	}
+	p.change = pending{kind: change.DHCPSubnet, id: strconv.Itoa(id), action: "delete", before: before}
+	return p, nil
+}
+
+// Apply pushes p with config-set and persists it with config-write. If the
+// running configuration changed since the plan was made the plan is stale:
+// CONFLICT, nothing is sent.
+func (c *Client) Apply(ctx context.Context, p *SubnetPlan) error {
+	if len(p.Changes) == 0 {
+		return nil
+	}
+	_, base, err := c.running(ctx)
+	if err != nil {
+		return err
+	}
+	if base != p.base {
+		return errs.New("kea.Apply", errs.Conflict, errors.New("configuration changed since the plan was made"), nil)
+	}
+	if err := c.Command(ctx, DHCP4, "config-set", map[string]any{"Dhcp4": p.config}, nil); err != nil {
+		return err
+	}
+	if err := c.Command(ctx, DHCP4, "config-write", nil, nil); err != nil {
+		return err
+	}
+	return record(ctx, p.change, "")
+}
+
+func (c *Client) plan(ctx context.Context, cur map[string]any, base string, next map[string]any) (*SubnetPlan, error) {
+	if err := c.Command(ctx, DHCP4, "config-test", map[string]any{"Dhcp4": next}, nil); err != nil {
+		return nil, err
+	}
+	p := &SubnetPlan{base: base, config: next}
+	diff("Dhcp4", cur, next, &p.Changes)
+	return p, nil
+}
+
+// running returns the Dhcp4 object of config-get and its digest.
+func (c *Client) running(ctx context.Context) (map[string]any, string, error) {
+	var out struct {
+		Dhcp4 map[string]any `json:"Dhcp4"`
+	}
+	if err := c.Command(ctx, DHCP4, "config-get", nil, &out); err != nil {
+		return nil, "", err
+	}
+	if out.Dhcp4 == nil {
+		return nil, "", errs.New("kea.config-get", errs.Internal, errors.New("answer without Dhcp4"), nil)
+	}
+	b, _ := json.Marshal(out.Dhcp4) // map keys are sorted
+	sum := sha256.Sum256(b)
+	return out.Dhcp4, hex.EncodeToString(sum[:]), nil
+}
+
+// clone deep-copies a decoded JSON object; numbers come back as float64 so
+// the copy compares equal to what config-get returns.
+func clone(m map[string]any) map[string]any {
+	var out map[string]any
+	b, _ := json.Marshal(m)
+	_ = json.Unmarshal(b, &out)
+	return out
+}
+
+func findSubnet(list []any, id int) (map[string]any, int) {
+	for i, item := range list {
+		m, _ := item.(map[string]any)
+		if n, ok := m["id"].(float64); ok && int(n) == id {
+			return m, i
+		}
+	}
+	return nil, -1
+}
+
+func subnetFromRaw(m map[string]any) domain.DHCPSubnet {
+	s := *domain.NewDHCPSubnet(nil)
+	id, _ := m["id"].(float64)
+	lt, _ := m["valid-lifetime"].(float64)
+	s.ID, s.ValidLifetime = int(id), int(lt)
+	s.Prefix, _ = m["subnet"].(string)
+	s.ClientClass, _ = m["client-class"].(string)
+	pools, _ := m["pools"].([]any)
+	for _, p := range pools {
+		pm, _ := p.(map[string]any)
+		if ps, ok := pm["pool"].(string); ok {
+			s.Pools = append(s.Pools, ps)
+		}
+	}
+	opts, _ := m["option-data"].([]any)
+	for _, o := range opts {
+		om, _ := o.(map[string]any)
+		code, _ := om["code"].(float64)
+		name, _ := om["name"].(string)
+		data, _ := om["data"].(string)
+		s.Options = append(s.Options, domain.DHCPOption{Name: name, Code: int(code), Data: data})
+	}
+	relay, _ := m["relay"].(map[string]any)
+	addrs, _ := relay["ip-addresses"].([]any)
+	for _, a := range addrs {
+		if ip, ok := a.(string); ok {
+			s.Relay = append(s.Relay, ip)
+		}
+	}
+	return s
+}
+
+// applySubnet writes s into the subnet4 entry m. Pools and options that
+// already exist keep their other settings (pool options, always-send, ...).
+func applySubnet(m map[string]any, s domain.DHCPSubnet) {
+	m["id"] = s.ID
+	m["subnet"] = s.Prefix
+
+	oldPools, _ := m["pools"].([]any)
+	var pools []any
+	for _, p := range s.Pools {
+		entry := map[string]any{"pool": p}
+		for _, o := range oldPools {
+			if om, _ := o.(map[string]any); om != nil && samePool(om["pool"], p) {
+				entry = om
+				break
+			}
+		}
+		pools = append(pools, entry)
+	}
+	setOrDelete(m, "pools", pools, len(pools) > 0)
+
+	oldOpts, _ := m["option-data"].([]any)
+	var opts []any
+	for _, o := range s.Options {
+		entry := map[string]any{}
+		for _, old := range oldOpts {
+			if om, _ := old.(map[string]any); om != nil && sameOption(om, o) {
+				entry = om
+				break
+			}
+		}
+		if o.Name != "" {
+			entry["name"] = o.Name
+		}
+		if o.Code != 0 {
+			entry["code"] = o.Code
+		}
+		entry["data"] = o.Data
+		opts = append(opts, entry)
+	}
+	setOrDelete(m, "option-data", opts, len(opts) > 0)
+
+	setOrDelete(m, "valid-lifetime", s.ValidLifetime, s.ValidLifetime > 0)
+	setOrDelete(m, "client-class", s.ClientClass, s.ClientClass != "")
+	relay, _ := m["relay"].(map[string]any)
+	if len(s.Relay) > 0 {
+		if relay == nil {
+			relay = map[string]any{}
+		}
+		addrs := make([]any, len(s.Relay))
+		for i, r := range s.Relay {
+			addrs[i] = r
+		}
+		relay["ip-addresses"] = addrs
+		m["relay"] = relay
+	} else if relay != nil {
+		delete(relay, "ip-addresses")
+		setOrDelete(m, "relay", relay, len(relay) > 0)
+	}
+}
+
+func setOrDelete(m map[string]any, key string, v any, set bool) {
+	if set {
+		m[key] = v
+	} else {
+		delete(m, key)
+	}
+}
+
+// samePool compares pools ignoring the spaces around "-".
+func samePool(old any, p string) bool {
+	s, _ := old.(string)
+	return strings.ReplaceAll(s, " ", "") == strings.ReplaceAll(p, " ", "")
+}
+
+func sameOption(m map[string]any, o domain.DHCPOption) bool {
+	if name, _ := m["name"].(string); o.Name != "" && name == o.Name {
+		return true
+	}
+	code, _ := m["code"].(float64)
+	return o.Code != 0 && int(code) == o.Code
+}
+
+// diff appends the differences between a and b below path. Lists of objects
+// with an "id" (subnet4) are matched by id so a change in one subnet is not
+// reported as a change of the whole list.
+func diff(path string, a, b any, out *[]Change) {
+	am, aok := a.(map[string]any)
+	bm, bok := b.(map[string]any)
+	if aok && bok {
+		keys := map[string]bool{}
+		for k := range am {
+			keys[k] = true
+		}
+		for k := range bm {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			diff(path+"."+k, am[k], bm[k], out)
+		}
+		return
+	}
+	al, aok := byID(a)
+	bl, bok := byID(b)
+	if aok && bok {
+		ids := map[int]bool{}
+		for id := range al {
+			ids[id] = true
+		}
+		for id := range bl {
+			ids[id] = true
+		}
+		sorted := make([]int, 0, len(ids))
+		for id := range ids {
+			sorted = append(sorted, id)
+		}
+		sort.Ints(sorted)
+		for _, id := range sorted {
+			var old, cur any
+			if m, ok := al[id]; ok {
+				old = m
+			}
+			if m, ok := bl[id]; ok {
+				cur = m
+			}
+			diff(fmt.Sprintf("%s[id=%d]", path, id), old, cur, out)
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		*out = append(*out, Change{Path: path, Old: a, New: b})
+	}
+}
+
+// byID indexes a list whose elements are all objects with a numeric id.
+func byID(v any) (map[int]map[string]any, bool) {
+	list, ok := v.([]any)
+	if !ok {
+		return nil, false
+	}
+	out := make(map[int]map[string]any, len(list))
+	for _, item := range list {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		id, ok := m["id"].(float64)
+		if !ok {
+			return nil, false
+		}
+		out[int(id)] = m
+	}
+	return out, true
+}
@@ -0,0 +1,123 @@
+package kea
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/domain"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+)
+
+func TestSubnets_PlanAndApply(t *testing.T) {
+	srv, c := newFake(t)
+	ctx := context.Background()
+
+	all, err := c.Subnets(ctx)
+	if err != nil || len(all) != 1 || all[0].Prefix != "192.0.2.0/24" || all[0].Pools[0] != "192.0.2.100-192.0.2.199" {
+		t.Fatalf("subnets %+v %v", all, err)
+	}
+
+	s := all[0]
+	s.Pools = append(s.Pools, "192.0.2.200 - 192.0.2.220")
+	s.ValidLifetime = 3600
+	s.Relay = []string{"192.0.2.254"}
+	p, err := c.PlanSubnet(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{
+		"Dhcp4.subnet4[id=1].pools":          true,
+		"Dhcp4.subnet4[id=1].relay":          true,
+		"Dhcp4.subnet4[id=1].valid-lifetime": true,
+	}
+	if len(p.Changes) != len(want) {
+		t.Fatalf("changes %v", p.Changes)
+	}
+	for _, ch := range p.Changes {
+		if !want[ch.Path] {
+			t.Fatalf("unexpected change %s", ch)
+		}
+	}
+	if srv.Calls("config-set") != 0 {
+		t.Fatal("planning must not change the running config")
+	}
+
+	if err := c.Apply(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Calls("config-set") != 1 || srv.Calls("config-write") != 1 {
+		t.Fatalf("config-set %d, config-write %d", srv.Calls("config-set"), srv.Calls("config-write"))
+	}
+	all, _ = c.Subnets(ctx)
+	if len(all[0].Pools) != 2 || all[0].ValidLifetime != 3600 || all[0].Relay[0] != "192.0.2.254" {
+		t.Fatalf("after apply %+v", all[0])
+	}
+
+	n := *domain.NewDHCPSubnet(nil)
+	n.ID, n.Prefix, n.Pools = 2, "198.51.100.0/24", []string{"198.51.100.10-198.51.100.20"}
+	n.Options = []domain.DHCPOption{{Name: "routers", Data: "198.51.100.1"}}
+	p, err = c.PlanSubnet(ctx, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Changes) != 1 || p.Changes[0].Path != "Dhcp4.subnet4[id=2]" || p.Changes[0].Old != nil {
+		t.Fatalf("new subnet: %v", p.Changes)
+	}
+	if err := c.Apply(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = c.PlanSubnetDelete(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Changes) != 1 || p.Changes[0].New != nil {
+		t.Fatalf("delete: %v", p.Changes)
+	}
+	if err := c.Apply(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if sn := srv.Subnets(); len(sn) != 1 || sn[0].ID != 2 {
+		t.Fatalf("after delete %+v", sn)
+	}
+	if _, err := c.PlanSubnetDelete(ctx, 1); !errs.IsCode(err, errs.NotFound) {
+		t.Fatalf("delete missing: want NOT_FOUND, got %v", err)
+	}
+}
+
+func TestSubnets_ConfigTestRejects(t *testing.T) {
+	srv, c := newFake(t)
+	s := *domain.NewDHCPSubnet(nil)
+	s.ID, s.Prefix, s.Pools = 1, "192.0.2.0/24", []string{"198.51.100.1-198.51.100.9"}
+	_, err := c.PlanSubnet(context.Background(), s)
+	if !errs.IsCode(err, errs.InvalidInput) {
+		t.Fatalf("want INVALID_INPUT, got %v", err)
+	}
+	e := err.(*errs.E)
+	if text, _ := e.Fields["keaText"].(string); text == "" || e.Fields["command"] != "config-test" {
+		t.Fatalf("fields %v", e.Fields)
+	}
+	if srv.Calls("config-set") != 0 {
+		t.Fatal("rejected plan reached config-set")
+	}
+}
+
+func TestSubnets_StalePlan(t *testing.T) {
+	srv, c := newFake(t)
+	ctx := context.Background()
+	s := *domain.NewDHCPSubnet(nil)
+	s.ID, s.Prefix = 2, "198.51.100.0/24"
+	p, err := c.PlanSubnet(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.AddSubnet(3, "203.0.113.0/24"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Apply(ctx, p); !errs.IsCode(err, errs.Conflict) {
+		t.Fatalf("want CONFLICT, got %v", err)
+	}
+	if srv.Calls("config-set") != 0 {
+		t.Fatal("stale plan reached config-set")
+	}
+}
@@ -0,0 +1,105 @@
+package ldap
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+)
+
+// Authenticate checks the password of the user with the given
+// sAMAccountName or userPrincipalName (if login contains "@") by binding as
+// that user on a connection of its own. Operators may live outside the
+// permitted OUs, so the lookup searches the whole base DN. Unknown users,
+// wrong passwords and disabled accounts are all UNAUTHORIZED with the same
+// message.
+func (c *Conn) Authenticate(login, password string) (User, error) {
+	op := errs.Op("ldap.Authenticate")
+	denied := errs.New(op, errs.Unauthorized, errors.New("invalid credentials"), map[string]any{"login": login})
+	// An empty password would turn the bind into an unauthenticated one,
+	// which AD accepts.
+	if login == "" || password == "" {
+		return User{}, denied
+	}
+	attr := "sAMAccountName"
+	if strings.Contains(login, "@") {
+		attr = "userPrincipalName"
+	}
+	f, err := userFilter(ldapx.Eq(attr, login))
+	if err != nil {
+		return User{}, errs.New(op, errs.InvalidInput, err, nil)
+	}
+	var found []*goldap.Entry
+	err = c.do(op, func(lc *goldap.Conn) error {
+		req := goldap.NewSearchRequest(c.base.String(), goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 2, int(c.cfg.LDAPTimeout/time.Second), false,
+			f, userAttrs, nil)
+		res, err := lc.Search(req)
+		if res != nil {
+			found = res.Entries
+		}
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return User{}, err
+	}
+	if len(found) != 1 {
+		return User{}, denied
+	}
+	u, err := userFromEntry(found[0])
+	if err != nil {
+		return User{}, mapErr(op, err)
+	}
+
+	lc, err := c.dial(op)
+	if err != nil {
+		return User{}, err
+	}
+	defer lc.Close()
+	if err := c.bind(op, lc, u.DN.String(), password); err != nil {
+		if errs.IsCode(err, errs.Unauthorized) {
+			return User{}, denied
+		}
+		return User{}, err
+	}
+	return u, nil
+}
+
+// GroupsOf returns the DNs of all groups under the base DN that dn belongs
+// to directly or through nesting. Unlike EffectiveGroups it is not confined
+// to the permitted OUs: it serves role mapping at login, and role groups
+// may lie anywhere below the base DN.
+func (c *Conn) GroupsOf(dn ldapx.DN) ([]ldapx.DN, error) {
+	op := errs.Op("ldap.GroupsOf")
+	f, err := groupFilter(ldapx.InChain("member", dn))
+	if err != nil {
+		return nil, errs.New(op, errs.InvalidInput, err, map[string]any{"dn": dn.String()})
+	}
+	var out []ldapx.DN
+	err = c.do(op, func(lc *goldap.Conn) error {
+		req := goldap.NewSearchRequest(c.base.String(), goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, int(c.cfg.LDAPTimeout/time.Second), false,
+			f, []string{"1.1"}, nil)
+		res, err := lc.Search(req)
+		if err != nil {
+			return err
+		}
+		for _, e := range res.Entries {
+			g, err := ldapx.ParseDN(e.DN)
+			if err != nil {
+				return err
+			}
+			out = append(out, g)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,57 @@
+package ldap
+
+import (
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/ldap/ldaptest"
+)
+
+func TestConn_Authenticate(t *testing.T) {
+	srv := ldaptest.NewServer(testBase)
+	defer srv.Close()
+	dn := seedAnna(t, srv)
+	if err := srv.SetPassword(dn.String(), "s3cret!"); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestConn(t, srv, nil)
+
+	for _, login := range []string{"anna", "anna@example.com"} {
+		u, err := c.Authenticate(login, "s3cret!")
+		if err != nil || !u.DN.Equal(dn) || u.UID != "anna" {
+			t.Fatalf("%s: %+v %v", login, u, err)
+		}
+	}
+	for _, tc := range []struct{ login, password string }{
+		{"anna", "wrong"},
+		{"anna", ""},
+		{"nobody", "s3cret!"},
+		{"", ""},
+	} {
+		if _, err := c.Authenticate(tc.login, tc.password); !errs.IsCode(err, errs.Unauthorized) {
+			t.Errorf("%q/%q: want UNAUTHORIZED, got %v", tc.login, tc.password, err)
+		}
+	}
+
+	if err := srv.AddGroup("CN=Helpdesk,"+testBase, dn.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.AddGroup("CN=Staff,"+srv.UsersDN(), "CN=Helpdesk,"+testBase); err != nil {
+		t.Fatal(err)
+	}
+	groups, err := c.GroupsOf(dn)
+	if err != nil || len(groups) != 2 {
+		t.Fatalf("groups of anna (direct + nested): %v %v", groups, err)
+	}
+
+	// the service connection keeps working after a user bind
+	if err := c.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DisableUser(dn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Authenticate("anna", "s3cret!"); !errs.IsCode(err, errs.Unauthorized) {
+		t.Fatalf("disabled account: want UNAUTHORIZED, got %v", err)
+	}
+}
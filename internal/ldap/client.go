@@ -1,15 +1,55 @@
 package ldap
 
+import (
+	"time"
+
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+)
+
 // Client is the interface to abstract LDAP operations for tests.
 type Client interface {
 	Ping() error
-	SearchUsers(filter string, limit int) ([]User, error)
+	Authenticate(login, password string) (User, error)
+	GroupsOf(dn ldapx.DN) ([]ldapx.DN, error)
+	SearchUsers(filter ldapx.Filter, limit int) ([]User, error)
+	SearchUsersPage(filter ldapx.Filter, pageSize int, cursor string) (UserPage, error)
+	GetUser(dn ldapx.DN) (User, error)
 	CreateUser(u User) error
+	UpdateUser(u User) error
+	DeleteUser(dn ldapx.DN) error
+	MoveUser(dn, newParent ldapx.DN) (ldapx.DN, error)
+	DisableUser(dn ldapx.DN) error
+	EnableUser(dn ldapx.DN) error
+	UnlockUser(dn ldapx.DN) error
+	ResetPassword(dn ldapx.DN, password string, mustChange bool) error
+	RequirePasswordChange(dn ldapx.DN, must bool) error
+	SetExpiry(dn ldapx.DN, at *time.Time) error
+
+	SearchGroups(filter ldapx.Filter, limit int) ([]Group, error)
+	GetGroup(dn ldapx.DN) (Group, error)
+	CreateGroup(g Group) error
+	UpdateGroup(g Group) error
+	AddMembers(group ldapx.DN, members ...ldapx.DN) error
+	RemoveMembers(group ldapx.DN, members ...ldapx.DN) error
+	EffectiveMembers(group ldapx.DN) ([]ldapx.DN, error)
+	EffectiveGroups(dn ldapx.DN) ([]Group, error)
 }
 
 type User struct {
-	DN   string
-	UID  string
-	Name string
+	DN   ldapx.DN
+	UID  string // sAMAccountName
+	UPN  string // userPrincipalName
+	Name string // displayName
 	Mail string
+
+	Enabled            bool       // userAccountControl without ACCOUNTDISABLE
+	Locked             bool       // lockoutTime set
+	MustChangePassword bool       // pwdLastSet == 0
+	ExpiresAt          *time.Time // accountExpires, nil for never
+}
+
+// UserPage is one page of a paged user search.
+type UserPage struct {
+	Users []User
+	Next  string // opaque cursor for the following page, "" on the last one
 }
@@ -0,0 +1,375 @@
+package ldap
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+
+	. "github.com/Weruminger/go-ad-admin/internal/config"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+)
+
+// userAttrs are the attributes fetched for every user search.
+var userAttrs = []string{"sAMAccountName", "userPrincipalName", "displayName", "mail",
+	"userAccountControl", "lockoutTime", "pwdLastSet", "accountExpires"}
+
+// Conn is the LDAPv3 implementation of Client. It keeps one bound
+// connection to the directory and re-dials transparently after network errors.
+type Conn struct {
+	cfg     Config
+	url     *url.URL
+	base    ldapx.DN
+	allowed []ldapx.DN // permitted OUs for cfg.Env
+	tlsCfg  *tls.Config
+	link    *link
+	plan    *Plan // set on dry-run copies, see DryRun
+}
+
+// link is the bound connection, shared by a Conn and its dry-run copies.
+type link struct {
+	mu   sync.Mutex
+	conn *goldap.Conn
+}
+
+var _ Client = (*Conn)(nil)
+
+// NewConn validates the LDAP settings of cfg and prepares a client. The
+// connection itself is established lazily on first use.
+func NewConn(cfg Config) (*Conn, error) {
+	op := errs.Op("ldap.NewConn")
+	u, err := url.Parse(cfg.LDAPURL)
+	if err != nil {
+		return nil, errs.New(op, errs.InvalidInput, err, map[string]any{"url": cfg.LDAPURL})
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "ldap", "ldaps":
+	default:
+		return nil, errs.New(op, errs.InvalidInput, fmt.Errorf("unsupported scheme %q", u.Scheme), map[string]any{"url": cfg.LDAPURL})
+	}
+	base, err := ldapx.ParseDN(cfg.LDAPBaseDN)
+	if err != nil {
+		return nil, errs.New(op, errs.InvalidInput, err, map[string]any{"baseDN": cfg.LDAPBaseDN})
+	}
+	allowed, err := parseAllowed(base, cfg.AllowedOUs())
+	if err != nil {
+		return nil, errs.New(op, errs.InvalidInput, err, map[string]any{"env": cfg.Env, "allowedOUs": cfg.AllowedOUs()})
+	}
+	c := &Conn{cfg: cfg, url: u, base: base, allowed: allowed, link: &link{}}
+	if cfg.Env == "prod" && !c.secure() {
+		return nil, errs.New(op, errs.Forbidden, fmt.Errorf("plaintext LDAP not allowed in prod, use ldaps:// or StartTLS"), map[string]any{"url": cfg.LDAPURL})
+	}
+	if c.tlsCfg, err = tlsConfig(u.Hostname(), cfg.LDAPCAFile); err != nil {
+		return nil, errs.New(op, errs.InvalidInput, err, map[string]any{"caFile": cfg.LDAPCAFile})
+	}
+	return c, nil
+}
+
+func (c *Conn) secure() bool {
+	return strings.EqualFold(c.url.Scheme, "ldaps") || c.cfg.LDAPStartTLS
+}
+
+func tlsConfig(host, caFile string) (*tls.Config, error) {
+	tc := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return tc, nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in %s", caFile)
+	}
+	tc.RootCAs = pool
+	return tc, nil
+}
+
+// Close releases the underlying connection, if any.
+func (c *Conn) Close() error {
+	c.link.mu.Lock()
+	defer c.link.mu.Unlock()
+	if c.link.conn == nil {
+		return nil
+	}
+	err := c.link.conn.Close()
+	c.link.conn = nil
+	return err
+}
+
+// session returns the bound connection, dialing and binding on demand.
+// Callers must hold c.link.mu.
+func (c *Conn) session(op errs.Op) (*goldap.Conn, error) {
+	if c.link.conn != nil && !c.link.conn.IsClosing() {
+		return c.link.conn, nil
+	}
+	lc, err := c.dial(op)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.bind(op, lc, c.cfg.LDAPBindDN, c.cfg.LDAPBindPassword); err != nil {
+		_ = lc.Close()
+		return nil, err
+	}
+	c.link.conn = lc
+	return lc, nil
+}
+
+// dial opens a new, unbound connection and upgrades it with StartTLS if
+// configured.
+func (c *Conn) dial(op errs.Op) (*goldap.Conn, error) {
+	d := &net.Dialer{Timeout: c.cfg.LDAPTimeout}
+	lc, err := goldap.DialURL(c.url.String(), goldap.DialWithDialer(d), goldap.DialWithTLSConfig(c.tlsCfg))
+	if err != nil {
+		return nil, mapErr(op, err)
+	}
+	lc.SetTimeout(c.cfg.LDAPTimeout)
+	if c.cfg.LDAPStartTLS && !strings.EqualFold(c.url.Scheme, "ldaps") {
+		if err := lc.StartTLS(c.tlsCfg); err != nil {
+			_ = lc.Close()
+			return nil, mapErr(op, err)
+		}
+	}
+	return lc, nil
+}
+
+// bind performs a simple bind and refuses to send credentials in the clear
+// when running in prod.
+func (c *Conn) bind(op errs.Op, lc *goldap.Conn, dn, password string) error {
+	if dn == "" {
+		return nil
+	}
+	if _, isTLS := lc.TLSConnectionState(); !isTLS && c.cfg.Env == "prod" {
+		return errs.New(op, errs.Forbidden, fmt.Errorf("refusing plaintext bind in prod"), map[string]any{"dn": dn})
+	}
+	return mapErr(op, lc.Bind(dn, password))
+}
+
+// do runs fn on the shared connection and drops it after network failures so
+// the next call reconnects.
+func (c *Conn) do(op errs.Op, fn func(*goldap.Conn) error) error {
+	c.link.mu.Lock()
+	defer c.link.mu.Unlock()
+	lc, err := c.session(op)
+	if err != nil {
+		return err
+	}
+	err = fn(lc)
+	if goldap.IsErrorWithCode(err, goldap.ErrorNetwork) {
+		_ = lc.Close()
+		c.link.conn = nil
+	}
+	return mapErr(op, err)
+}
+
+// Ping binds (if needed) and reads the root DSE.
+func (c *Conn) Ping() error {
+	return c.do("ldap.Ping", func(lc *goldap.Conn) error {
+		req := goldap.NewSearchRequest("", goldap.ScopeBaseObject, goldap.NeverDerefAliases, 1, int(c.cfg.LDAPTimeout/time.Second), false,
+			"(objectClass=*)", []string{"namingContexts"}, nil)
+		_, err := lc.Search(req)
+		return err
+	})
+}
+
+// SearchUsers returns at most limit user objects that match filter (nil for
+// all users), searching each permitted OU in turn. A size limit hit is not an
+// error, the partial result is returned.
+func (c *Conn) SearchUsers(filter ldapx.Filter, limit int) ([]User, error) {
+	op := errs.Op("ldap.SearchUsers")
+	f, err := userFilter(filter)
+	if err != nil {
+		return nil, errs.New(op, errs.InvalidInput, err, nil)
+	}
+	var out []User
+	err = c.do(op, func(lc *goldap.Conn) error {
+		entries, err := c.searchAllowed(lc, f, userAttrs, limit)
+		for _, e := range entries {
+			u, perr := userFromEntry(e)
+			if perr != nil {
+				return perr
+			}
+			out = append(out, u)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SearchUsersPage returns one page of users using the RFC 2696 paged results
+// control. pageSize is capped at the directory's MaxPageSize; cursor is ""
+// for the first page and UserPage.Next afterwards. The permitted OUs are
+// paged one after another, so a page never spans two of them.
+func (c *Conn) SearchUsersPage(filter ldapx.Filter, pageSize int, cursor string) (UserPage, error) {
+	op := errs.Op("ldap.SearchUsersPage")
+	f, err := userFilter(filter)
+	if err != nil {
+		return UserPage{}, errs.New(op, errs.InvalidInput, err, nil)
+	}
+	if pageSize <= 0 || pageSize > c.cfg.LDAPMaxPageSize {
+		pageSize = c.cfg.LDAPMaxPageSize
+	}
+	idx, cookie, err := decodeCursor(f, cursor)
+	if err == nil && cursor != "" && idx >= len(c.allowed) {
+		err = fmt.Errorf("cursor out of range")
+	}
+	if err != nil {
+		return UserPage{}, errs.New(op, errs.InvalidInput, err, map[string]any{"cursor": cursor})
+	}
+	var page UserPage
+	err = c.do(op, func(lc *goldap.Conn) error {
+		for ; idx < len(c.allowed); idx, cookie = idx+1, nil {
+			paging := goldap.NewControlPaging(uint32(pageSize))
+			paging.SetCookie(cookie)
+			req := goldap.NewSearchRequest(c.allowed[idx].String(), goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, int(c.cfg.LDAPTimeout/time.Second), false,
+				f, userAttrs, []goldap.Control{paging})
+			res, err := lc.Search(req)
+			if goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			for _, e := range res.Entries {
+				u, err := userFromEntry(e)
+				if err != nil {
+					return err
+				}
+				page.Users = append(page.Users, u)
+			}
+			if pc, ok := goldap.FindControl(res.Controls, goldap.ControlTypePaging).(*goldap.ControlPaging); ok && len(pc.Cookie) > 0 {
+				page.Next = encodeCursor(f, idx, pc.Cookie)
+				return nil
+			}
+			if len(page.Users) > 0 {
+				if idx+1 < len(c.allowed) {
+					page.Next = encodeCursor(f, idx+1, nil)
+				}
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return UserPage{}, err
+	}
+	return page, nil
+}
+
+// CreateUser adds a new, disabled user object. AD refuses to enable accounts
+// without a password, so enabling is left to the caller.
+func (c *Conn) CreateUser(u User) error {
+	op := errs.Op("ldap.CreateUser")
+	if u.DN.IsZero() || u.UID == "" {
+		return errs.New(op, errs.InvalidInput, errors.New("dn and uid are required"), map[string]any{"dn": u.DN.String()})
+	}
+	// Round-trip through the parser to reject empty RDN values and the like
+	// before they reach the wire.
+	if _, err := ldapx.ParseDN(u.DN.String()); err != nil {
+		return errs.New(op, errs.InvalidInput, err, map[string]any{"dn": u.DN.String()})
+	}
+	if err := c.checkWrite(op, u.DN); err != nil {
+		return err
+	}
+	req := goldap.NewAddRequest(u.DN.String(), nil)
+	req.Attribute("objectClass", []string{"top", "person", "organizationalPerson", "user"})
+	req.Attribute("sAMAccountName", []string{u.UID})
+	req.Attribute("userAccountControl", []string{"514"}) // NORMAL_ACCOUNT|ACCOUNTDISABLE
+	if u.UPN != "" {
+		req.Attribute("userPrincipalName", []string{u.UPN})
+	}
+	if u.Name != "" {
+		req.Attribute("displayName", []string{u.Name})
+	}
+	if u.Mail != "" {
+		req.Attribute("mail", []string{u.Mail})
+	}
+	return c.do(op, func(lc *goldap.Conn) error { return c.add(lc, req) })
+}
+
+// userFilter restricts filter to user objects and renders it.
+func userFilter(filter ldapx.Filter) (string, error) {
+	f := ldapx.And(ldapx.Eq("objectClass", "user"), ldapx.Not(ldapx.Eq("objectClass", "computer")), filter)
+	if err := ldapx.Validate(f); err != nil {
+		return "", err
+	}
+	return f.String(), nil
+}
+
+// encodeCursor wraps a paging cookie together with a hash of the filter it
+// belongs to, so a cursor cannot be replayed against a different query, and
+// the index of the permitted OU being paged.
+func encodeCursor(filter string, idx int, cookie []byte) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(filter))
+	raw := binary.AppendUvarint(h.Sum(nil), uint64(idx))
+	return base64.RawURLEncoding.EncodeToString(append(raw, cookie...))
+}
+
+func decodeCursor(filter, cursor string) (int, []byte, error) {
+	if cursor == "" {
+		return 0, nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(raw) <= 4 {
+		return 0, nil, fmt.Errorf("malformed cursor")
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(filter))
+	if !bytes.Equal(raw[:4], h.Sum(nil)) {
+		return 0, nil, fmt.Errorf("cursor belongs to a different query")
+	}
+	idx, n := binary.Uvarint(raw[4:])
+	if n <= 0 || idx > math.MaxInt16 {
+		return 0, nil, fmt.Errorf("malformed cursor")
+	}
+	return int(idx), raw[4+n:], nil
+}
+
+func userFromEntry(e *goldap.Entry) (User, error) {
+	dn, err := ldapx.ParseDN(e.DN)
+	if err != nil {
+		return User{}, err
+	}
+	u := User{
+		DN:   dn,
+		UID:  e.GetAttributeValue("sAMAccountName"),
+		UPN:  e.GetAttributeValue("userPrincipalName"),
+		Name: e.GetAttributeValue("displayName"),
+		Mail: e.GetAttributeValue("mail"),
+
+		Enabled:            true,
+		Locked:             e.GetAttributeValue("lockoutTime") != "" && e.GetAttributeValue("lockoutTime") != "0",
+		MustChangePassword: e.GetAttributeValue("pwdLastSet") == "0",
+	}
+	if v := e.GetAttributeValue("userAccountControl"); v != "" {
+		uac, err := strconv.Atoi(v)
+		if err != nil {
+			return User{}, fmt.Errorf("userAccountControl %q: %w", v, err)
+		}
+		u.Enabled = uac&uacAccountDisable == 0
+	}
+	if u.ExpiresAt, err = fromFileTime(e.GetAttributeValue("accountExpires")); err != nil {
+		return User{}, err
+	}
+	return u, nil
+}
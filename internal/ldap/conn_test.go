@@ -0,0 +1,223 @@
+package ldap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/config"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/ldap/ldaptest"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+)
+
+func TestNewConn_ProdRefusesPlaintext(t *testing.T) {
+	cfg := *config.NewDefaultConfig()
+	cfg.Env = "prod"
+	cfg.LDAPURL = "ldap://dc1.example.com:389"
+	cfg.LDAPStartTLS = false
+	if _, err := NewConn(cfg); !errs.IsCode(err, errs.Forbidden) {
+		t.Fatalf("want FORBIDDEN, got %v", err)
+	}
+
+	cfg.LDAPStartTLS = true
+	if _, err := NewConn(cfg); err != nil {
+		t.Fatalf("StartTLS in prod: %v", err)
+	}
+	cfg.LDAPStartTLS = false
+	cfg.LDAPURL = "ldaps://dc1.example.com:636"
+	if _, err := NewConn(cfg); err != nil {
+		t.Fatalf("ldaps in prod: %v", err)
+	}
+}
+
+func TestNewConn_InvalidSettings(t *testing.T) {
+	cfg := *config.NewDefaultConfig()
+	cfg.LDAPURL = "http://dc1.example.com"
+	if _, err := NewConn(cfg); !errs.IsCode(err, errs.InvalidInput) {
+		t.Fatalf("scheme: want INVALID_INPUT, got %v", err)
+	}
+
+	bad := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(bad, []byte("not a cert"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg.LDAPURL = "ldaps://dc1.example.com"
+	cfg.LDAPCAFile = bad
+	if _, err := NewConn(cfg); !errs.IsCode(err, errs.InvalidInput) {
+		t.Fatalf("ca: want INVALID_INPUT, got %v", err)
+	}
+}
+
+func TestConn_PingUnreachable(t *testing.T) {
+	cfg := *config.NewDefaultConfig()
+	cfg.LDAPURL = "ldap://127.0.0.1:1"
+	c, err := NewConn(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Ping(); !errs.IsCode(err, errs.Unavailable) {
+		t.Fatalf("want UNAVAILABLE, got %v", err)
+	}
+}
+
+const testBase = "DC=example,DC=com"
+
+func newTestConn(t *testing.T, srv *ldaptest.Server, mutate func(*config.Config)) *Conn {
+	t.Helper()
+	cfg := srv.Config()
+	if mutate != nil {
+		mutate(&cfg)
+	}
+	c, err := NewConn(cfg)
+	if err != nil {
+		t.Fatalf("NewConn: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestConn_SearchAndCreate(t *testing.T) {
+	srv := ldaptest.NewServer(testBase)
+	defer srv.Close()
+	if err := srv.SeedTable([][]string{
+		{"uid", "displayName"},
+		{"anna.smith", "Anna Smith"},
+		{"joanna.roe", "Joanna Roe"},
+		{"bob", "Bob Doe"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestConn(t, srv, nil)
+
+	if err := c.Ping(); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	got, err := c.SearchUsers(ldapx.Contains("displayName", "anna"), 0)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(got) != 2 || got[0].UID != "anna.smith" || got[0].Name != "Anna Smith" {
+		t.Fatalf("unexpected result %+v", got)
+	}
+	if got, err := c.SearchUsers(nil, 1); err != nil || len(got) != 1 {
+		t.Fatalf("size limit: got %d users, err %v", len(got), err)
+	}
+
+	u := User{DN: ldapx.MustParseDN(testBase).Child("CN", "Users").Child("CN", "Carol"), UID: "carol", UPN: "carol@example.com", Name: "Carol"}
+	if err := c.CreateUser(u); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	e, ok := srv.Get(u.DN.String())
+	if !ok || e.First("userAccountControl") != "514" || e.First("userPrincipalName") != u.UPN {
+		t.Fatalf("created entry wrong: %+v", e)
+	}
+	if err := c.CreateUser(u); !errs.IsCode(err, errs.Conflict) {
+		t.Fatalf("want CONFLICT, got %v", err)
+	}
+	u.DN = ldapx.MustParseDN("CN=Dan,OU=Missing," + testBase)
+	u.UID = "dan"
+	if err := c.CreateUser(u); !errs.IsCode(err, errs.NotFound) {
+		t.Fatalf("want NOT_FOUND, got %v", err)
+	}
+	u.DN = ldapx.MustParseDN(testBase).Child("CN", "")
+	if err := c.CreateUser(u); !errs.IsCode(err, errs.InvalidInput) {
+		t.Fatalf("empty RDN: want INVALID_INPUT, got %v", err)
+	}
+	if _, err := c.SearchUsers(ldapx.Eq("bad attr", "x"), 0); !errs.IsCode(err, errs.InvalidInput) {
+		t.Fatalf("bad attribute: want INVALID_INPUT, got %v", err)
+	}
+}
+
+func TestConn_BadCredentials(t *testing.T) {
+	srv := ldaptest.NewServer(testBase)
+	defer srv.Close()
+	c := newTestConn(t, srv, func(cfg *config.Config) { cfg.LDAPBindPassword = "wrong" })
+	if err := c.Ping(); !errs.IsCode(err, errs.Unauthorized) {
+		t.Fatalf("want UNAUTHORIZED, got %v", err)
+	}
+}
+
+func TestConn_TLS(t *testing.T) {
+	t.Run("StartTLS", func(t *testing.T) {
+		srv := ldaptest.NewServer(testBase)
+		defer srv.Close()
+		c := newTestConn(t, srv, func(cfg *config.Config) {
+			cfg.Env = "prod"
+			cfg.LDAPStartTLS = true
+		})
+		if err := c.Ping(); err != nil {
+			t.Fatalf("ping: %v", err)
+		}
+	})
+	t.Run("LDAPS", func(t *testing.T) {
+		srv := ldaptest.NewTLSServer(testBase)
+		defer srv.Close()
+		c := newTestConn(t, srv, func(cfg *config.Config) { cfg.Env = "prod" })
+		if err := c.Ping(); err != nil {
+			t.Fatalf("ping: %v", err)
+		}
+	})
+	t.Run("UntrustedCA", func(t *testing.T) {
+		srv := ldaptest.NewTLSServer(testBase)
+		defer srv.Close()
+		c := newTestConn(t, srv, func(cfg *config.Config) { cfg.LDAPCAFile = "" })
+		if err := c.Ping(); err == nil {
+			t.Fatal("expected TLS verification failure")
+		}
+	})
+}
+
+func TestConn_SearchUsersPage(t *testing.T) {
+	srv := ldaptest.NewServer(testBase)
+	defer srv.Close()
+	srv.MaxPageSize = 3
+	rows := [][]string{{"uid", "displayName"}}
+	for i := 1; i <= 7; i++ {
+		rows = append(rows, []string{fmt.Sprintf("anna%d", i), fmt.Sprintf("Anna %d", i)})
+	}
+	if err := srv.SeedTable(rows); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestConn(t, srv, nil)
+
+	f := ldapx.HasPrefix("displayName", "anna")
+	var (
+		seen   []string
+		cursor string
+		pages  int
+	)
+	for {
+		p, err := c.SearchUsersPage(f, 10, cursor) // capped to 3 by the server
+		if err != nil {
+			t.Fatalf("page %d: %v", pages+1, err)
+		}
+		pages++
+		if len(p.Users) > 3 {
+			t.Fatalf("page %d has %d users, MaxPageSize not honoured", pages, len(p.Users))
+		}
+		for _, u := range p.Users {
+			seen = append(seen, u.UID)
+		}
+		if p.Next == "" {
+			break
+		}
+		cursor = p.Next
+	}
+	if pages != 3 || len(seen) != 7 || seen[0] != "anna1" || seen[6] != "anna7" {
+		t.Fatalf("pages=%d seen=%v", pages, seen)
+	}
+
+	first, err := c.SearchUsersPage(f, 2, "")
+	if err != nil || first.Next == "" {
+		t.Fatalf("first page: %+v %v", first, err)
+	}
+	if _, err := c.SearchUsersPage(ldapx.HasPrefix("displayName", "bob"), 2, first.Next); !errs.IsCode(err, errs.InvalidInput) {
+		t.Fatalf("cursor of other query: want INVALID_INPUT, got %v", err)
+	}
+	if _, err := c.SearchUsersPage(f, 2, "%%%"); !errs.IsCode(err, errs.InvalidInput) {
+		t.Fatalf("garbage cursor: want INVALID_INPUT, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	goldap "github.com/go-ldap/ldap/v3"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+)
+
+// mapErr translates LDAP result codes and transport failures into errs codes.
+// Errors that already carry an errs code are passed through.
+func mapErr(op errs.Op, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *errs.E
+	if errors.As(err, &e) {
+		return errs.Wrap(op, err, e.Code)
+	}
+	var le *goldap.Error
+	if errors.As(err, &le) {
+		fields := map[string]any{"ldapCode": int(le.ResultCode)}
+		if le.MatchedDN != "" {
+			fields["matchedDN"] = le.MatchedDN
+		}
+		return errs.New(op, codeFor(le), err, fields)
+	}
+	if isTimeout(err) {
+		return errs.New(op, errs.Timeout, err, nil)
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return errs.New(op, errs.Unavailable, err, nil)
+	}
+	return errs.New(op, errs.Internal, err, nil)
+}
+
+func codeFor(le *goldap.Error) errs.Code {
+	switch le.ResultCode {
+	case goldap.LDAPResultNoSuchObject:
+		return errs.NotFound
+	case goldap.LDAPResultEntryAlreadyExists, goldap.LDAPResultAttributeOrValueExists:
+		return errs.Conflict
+	case goldap.LDAPResultInvalidCredentials, goldap.LDAPResultInappropriateAuthentication,
+		goldap.LDAPResultStrongAuthRequired, goldap.LDAPResultConfidentialityRequired, goldap.ErrorEmptyPassword:
+		return errs.Unauthorized
+	case goldap.LDAPResultInsufficientAccessRights:
+		return errs.Forbidden
+	case goldap.LDAPResultTimeLimitExceeded, goldap.LDAPResultTimeout:
+		return errs.Timeout
+	case goldap.LDAPResultBusy, goldap.LDAPResultUnavailable, goldap.LDAPResultServerDown, goldap.LDAPResultConnectError:
+		return errs.Unavailable
+	case goldap.LDAPResultConstraintViolation, goldap.LDAPResultInvalidAttributeSyntax, goldap.LDAPResultInvalidDNSyntax,
+		goldap.LDAPResultObjectClassViolation, goldap.LDAPResultUnwillingToPerform, goldap.LDAPResultNamingViolation,
+		goldap.LDAPResultUndefinedAttributeType, goldap.LDAPResultFilterError, goldap.ErrorFilterCompile:
+		return errs.InvalidInput
+	case goldap.ErrorNetwork:
+		if isTimeout(le.Err) {
+			return errs.Timeout
+		}
+		return errs.Unavailable
+	}
+	return errs.Internal
+}
+
+func isTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	// go-ldap reports message timeouts only as text
+	return strings.Contains(err.Error(), "timed out")
+}
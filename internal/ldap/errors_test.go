@@ -0,0 +1,45 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	goldap "github.com/go-ldap/ldap/v3"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+)
+
+func TestMapErr_ResultCodes(t *testing.T) {
+	cases := []struct {
+		err  error
+		want errs.Code
+	}{
+		{goldap.NewError(goldap.LDAPResultNoSuchObject, fmt.Errorf("no such object")), errs.NotFound},
+		{goldap.NewError(goldap.LDAPResultEntryAlreadyExists, fmt.Errorf("exists")), errs.Conflict},
+		{goldap.NewError(goldap.LDAPResultInvalidCredentials, fmt.Errorf("bad pw")), errs.Unauthorized},
+		{goldap.NewError(goldap.LDAPResultTimeLimitExceeded, fmt.Errorf("slow")), errs.Timeout},
+		{goldap.NewError(goldap.ErrorNetwork, fmt.Errorf("ldap: connection timed out")), errs.Timeout},
+		{goldap.NewError(goldap.LDAPResultBusy, fmt.Errorf("busy")), errs.Unavailable},
+		{goldap.NewError(goldap.ErrorNetwork, fmt.Errorf("connection reset")), errs.Unavailable},
+		{goldap.NewError(goldap.LDAPResultConstraintViolation, fmt.Errorf("pw policy")), errs.InvalidInput},
+		{errors.New("boom"), errs.Internal},
+	}
+	for _, c := range cases {
+		got := mapErr("ldap.Test", c.err)
+		if !errs.IsCode(got, c.want) {
+			t.Errorf("%v: got %v want %s", c.err, got, c.want)
+		}
+	}
+	if mapErr("ldap.Test", nil) != nil {
+		t.Fatal("nil must stay nil")
+	}
+}
+
+func TestMapErr_KeepsExistingCode(t *testing.T) {
+	in := errs.New("", errs.Forbidden, fmt.Errorf("nope"), nil)
+	got := mapErr("ldap.Test", in)
+	if !errs.IsCode(got, errs.Forbidden) {
+		t.Fatalf("want FORBIDDEN got %v", got)
+	}
+}
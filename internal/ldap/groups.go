@@ -0,0 +1,347 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+)
+
+// GroupKind distinguishes security groups (usable in ACLs) from
+// distribution lists.
+type GroupKind string
+
+const (
+	Security     GroupKind = "security"
+	Distribution GroupKind = "distribution"
+)
+
+// GroupScope is the AD group scope.
+type GroupScope string
+
+const (
+	Global      GroupScope = "global"
+	DomainLocal GroupScope = "domainLocal"
+	Universal   GroupScope = "universal"
+)
+
+// groupType flags (MS-ADTS 2.2.12).
+const (
+	gtGlobal      = 0x00000002
+	gtDomainLocal = 0x00000004
+	gtUniversal   = 0x00000008
+	gtSecurity    = -0x80000000
+)
+
+// Group is an AD group with its direct members.
+type Group struct {
+	DN          ldapx.DN
+	Name        string // sAMAccountName
+	Description string
+	Mail        string
+	Kind        GroupKind
+	Scope       GroupScope
+	Members     []ldapx.DN // direct members only
+}
+
+var groupAttrs = []string{"sAMAccountName", "description", "mail", "groupType", "member"}
+
+// groupType encodes kind and scope as the signed 32-bit AD value.
+func groupType(kind GroupKind, scope GroupScope) (int32, error) {
+	var v int32
+	switch scope {
+	case Global:
+		v = gtGlobal
+	case DomainLocal:
+		v = gtDomainLocal
+	case Universal:
+		v = gtUniversal
+	default:
+		return 0, fmt.Errorf("unknown group scope %q", scope)
+	}
+	switch kind {
+	case Security:
+		v |= gtSecurity
+	case Distribution:
+	default:
+		return 0, fmt.Errorf("unknown group kind %q", kind)
+	}
+	return v, nil
+}
+
+func parseGroupType(s string) (GroupKind, GroupScope, error) {
+	n, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return "", "", fmt.Errorf("groupType %q: %w", s, err)
+	}
+	v := int32(n)
+	kind := Distribution
+	if v&gtSecurity != 0 {
+		kind = Security
+	}
+	switch {
+	case v&gtGlobal != 0:
+		return kind, Global, nil
+	case v&gtDomainLocal != 0:
+		return kind, DomainLocal, nil
+	case v&gtUniversal != 0:
+		return kind, Universal, nil
+	}
+	return "", "", fmt.Errorf("groupType %q has no scope", s)
+}
+
+func groupFromEntry(e *goldap.Entry) (Group, error) {
+	dn, err := ldapx.ParseDN(e.DN)
+	if err != nil {
+		return Group{}, err
+	}
+	g := Group{
+		DN:          dn,
+		Name:        e.GetAttributeValue("sAMAccountName"),
+		Description: e.GetAttributeValue("description"),
+		Mail:        e.GetAttributeValue("mail"),
+	}
+	if g.Kind, g.Scope, err = parseGroupType(e.GetAttributeValue("groupType")); err != nil {
+		return Group{}, err
+	}
+	for _, m := range e.GetAttributeValues("member") {
+		md, err := ldapx.ParseDN(m)
+		if err != nil {
+			return Group{}, err
+		}
+		g.Members = append(g.Members, md)
+	}
+	return g, nil
+}
+
+func groupFilter(filter ldapx.Filter) (string, error) {
+	f := ldapx.And(ldapx.Eq("objectClass", "group"), filter)
+	if err := ldapx.Validate(f); err != nil {
+		return "", err
+	}
+	return f.String(), nil
+}
+
+// SearchGroups returns at most limit groups in the permitted OUs that match
+// filter (nil for all groups).
+func (c *Conn) SearchGroups(filter ldapx.Filter, limit int) ([]Group, error) {
+	op := errs.Op("ldap.SearchGroups")
+	f, err := groupFilter(filter)
+	if err != nil {
+		return nil, errs.New(op, errs.InvalidInput, err, nil)
+	}
+	var out []Group
+	err = c.do(op, func(lc *goldap.Conn) error {
+		entries, err := c.searchAllowed(lc, f, groupAttrs, limit)
+		for _, e := range entries {
+			g, perr := groupFromEntry(e)
+			if perr != nil {
+				return perr
+			}
+			out = append(out, g)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetGroup reads a single group with its direct members.
+func (c *Conn) GetGroup(dn ldapx.DN) (Group, error) {
+	op := errs.Op("ldap.GetGroup")
+	var g Group
+	err := c.do(op, func(lc *goldap.Conn) error {
+		e, err := c.readGroup(lc, dn)
+		if err != nil {
+			return err
+		}
+		g, err = groupFromEntry(e)
+		return err
+	})
+	if err != nil {
+		return Group{}, err
+	}
+	return g, nil
+}
+
+// CreateGroup adds a group of the given kind and scope. Members listed in g
+// are added with it and must lie within the delegation.
+func (c *Conn) CreateGroup(g Group) error {
+	op := errs.Op("ldap.CreateGroup")
+	if g.DN.IsZero() || g.Name == "" {
+		return errs.New(op, errs.InvalidInput, errors.New("dn and name are required"), map[string]any{"dn": g.DN.String()})
+	}
+	gt, err := groupType(g.Kind, g.Scope)
+	if err != nil {
+		return errs.New(op, errs.InvalidInput, err, map[string]any{"dn": g.DN.String()})
+	}
+	if err := c.checkWrite(op, g.DN); err != nil {
+		return err
+	}
+	if err := c.checkMembers(op, g.Members); err != nil {
+		return err
+	}
+	req := goldap.NewAddRequest(g.DN.String(), nil)
+	req.Attribute("objectClass", []string{"top", "group"})
+	req.Attribute("sAMAccountName", []string{g.Name})
+	req.Attribute("groupType", []string{strconv.FormatInt(int64(gt), 10)})
+	if g.Description != "" {
+		req.Attribute("description", []string{g.Description})
+	}
+	if g.Mail != "" {
+		req.Attribute("mail", []string{g.Mail})
+	}
+	if len(g.Members) > 0 {
+		req.Attribute("member", dnStrings(g.Members))
+	}
+	return c.do(op, func(lc *goldap.Conn) error { return c.add(lc, req) })
+}
+
+// UpdateGroup replaces name, description, mail and groupType of an existing
+// group; members are changed with AddMembers and RemoveMembers. AD only
+// allows some scope changes (e.g. global to universal) and reports the
+// others as UNWILLING_TO_PERFORM.
+func (c *Conn) UpdateGroup(g Group) error {
+	op := errs.Op("ldap.UpdateGroup")
+	if g.DN.IsZero() || g.Name == "" {
+		return errs.New(op, errs.InvalidInput, errors.New("dn and name are required"), map[string]any{"dn": g.DN.String()})
+	}
+	gt, err := groupType(g.Kind, g.Scope)
+	if err != nil {
+		return errs.New(op, errs.InvalidInput, err, map[string]any{"dn": g.DN.String()})
+	}
+	if err := c.checkWrite(op, g.DN); err != nil {
+		return err
+	}
+	req := goldap.NewModifyRequest(g.DN.String(), nil)
+	req.Replace("sAMAccountName", []string{g.Name})
+	req.Replace("description", values(g.Description))
+	req.Replace("mail", values(g.Mail))
+	req.Replace("groupType", []string{strconv.FormatInt(int64(gt), 10)})
+	return c.do(op, func(lc *goldap.Conn) error {
+		if _, err := c.readGroup(lc, g.DN); err != nil {
+			return err
+		}
+		return c.modify(lc, req)
+	})
+}
+
+// AddMembers adds direct members to a group. Members that already belong to
+// it make AD fail the whole change with CONFLICT.
+func (c *Conn) AddMembers(group ldapx.DN, members ...ldapx.DN) error {
+	return c.changeMembers("ldap.AddMembers", group, members, true)
+}
+
+// RemoveMembers removes direct members from a group.
+func (c *Conn) RemoveMembers(group ldapx.DN, members ...ldapx.DN) error {
+	return c.changeMembers("ldap.RemoveMembers", group, members, false)
+}
+
+func (c *Conn) changeMembers(op errs.Op, group ldapx.DN, members []ldapx.DN, add bool) error {
+	if len(members) == 0 {
+		return nil
+	}
+	if err := c.checkWrite(op, group); err != nil {
+		return err
+	}
+	if err := c.checkMembers(op, members); err != nil {
+		return err
+	}
+	req := goldap.NewModifyRequest(group.String(), nil)
+	if add {
+		req.Add("member", dnStrings(members))
+	} else {
+		req.Delete("member", dnStrings(members))
+	}
+	return c.do(op, func(lc *goldap.Conn) error {
+		if _, err := c.readGroup(lc, group); err != nil {
+			return err
+		}
+		return c.modify(lc, req)
+	})
+}
+
+// EffectiveMembers returns every object in the permitted OUs that belongs to
+// group directly or through nested groups, resolved by the DC with
+// LDAP_MATCHING_RULE_IN_CHAIN. Nested groups themselves are included.
+func (c *Conn) EffectiveMembers(group ldapx.DN) ([]ldapx.DN, error) {
+	op := errs.Op("ldap.EffectiveMembers")
+	f := ldapx.InChain("memberOf", group)
+	var out []ldapx.DN
+	err := c.do(op, func(lc *goldap.Conn) error {
+		if _, err := c.readGroup(lc, group); err != nil {
+			return err
+		}
+		entries, err := c.searchAllowed(lc, f.String(), []string{"1.1"}, 0)
+		for _, e := range entries {
+			dn, perr := ldapx.ParseDN(e.DN)
+			if perr != nil {
+				return perr
+			}
+			out = append(out, dn)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EffectiveGroups returns the groups in the permitted OUs that dn belongs to
+// directly or through nesting.
+func (c *Conn) EffectiveGroups(dn ldapx.DN) ([]Group, error) {
+	op := errs.Op("ldap.EffectiveGroups")
+	if !c.visible(dn) {
+		return nil, errs.New(op, errs.NotFound, fmt.Errorf("%s not found", dn), map[string]any{"dn": dn.String()})
+	}
+	return c.SearchGroups(ldapx.InChain("member", dn), 0)
+}
+
+// checkMembers rejects member DNs outside the delegation so a group cannot
+// be used to pull in objects the caller may not manage.
+func (c *Conn) checkMembers(op errs.Op, members []ldapx.DN) error {
+	for _, m := range members {
+		if !c.visible(m) {
+			return errs.New(op, errs.Forbidden, fmt.Errorf("member %s is outside the permitted OUs", m), map[string]any{"dn": m.String()})
+		}
+	}
+	return nil
+}
+
+// readGroup fetches the group entry at dn. Callers must run inside c.do.
+func (c *Conn) readGroup(lc *goldap.Conn, dn ldapx.DN) (*goldap.Entry, error) {
+	notFound := errs.New("", errs.NotFound, fmt.Errorf("%s is not a group", dn), map[string]any{"dn": dn.String()})
+	if !c.visible(dn) {
+		return nil, notFound
+	}
+	f, err := groupFilter(nil)
+	if err != nil {
+		return nil, err
+	}
+	req := goldap.NewSearchRequest(dn.String(), goldap.ScopeBaseObject, goldap.NeverDerefAliases, 1, int(c.cfg.LDAPTimeout/time.Second), false,
+		f, groupAttrs, nil)
+	res, err := lc.Search(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Entries) == 0 {
+		return nil, notFound
+	}
+	return res.Entries[0], nil
+}
+
+func dnStrings(dns []ldapx.DN) []string {
+	out := make([]string, len(dns))
+	for i, d := range dns {
+		out[i] = d.String()
+	}
+	return out
+}
@@ -0,0 +1,188 @@
+package ldap
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/domain"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+	"github.com/Weruminger/go-ad-admin/internal/modelx"
+)
+
+func TestGroupType_RoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		kind  GroupKind
+		scope GroupScope
+		want  string
+	}{
+		{Security, Global, "-2147483646"},
+		{Security, DomainLocal, "-2147483644"},
+		{Security, Universal, "-2147483640"},
+		{Distribution, Global, "2"},
+		{Distribution, Universal, "8"},
+	} {
+		gt, err := groupType(tc.kind, tc.scope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := strconv.FormatInt(int64(gt), 10)
+		if s != tc.want {
+			t.Errorf("%s/%s: got %s want %s", tc.kind, tc.scope, s, tc.want)
+		}
+		kind, scope, err := parseGroupType(s)
+		if err != nil || kind != tc.kind || scope != tc.scope {
+			t.Errorf("parse %s: %s/%s %v", s, kind, scope, err)
+		}
+	}
+	if _, err := groupType(Security, "forest"); err == nil {
+		t.Fatal("unknown scope accepted")
+	}
+}
+
+func TestConn_CreateGroupAndMembers(t *testing.T) {
+	srv, c := delegatedDir(t)
+	anna := ldapx.MustParseDN("CN=Anna,OU=Staff," + testBase)
+	bert := ldapx.MustParseDN("CN=Bert,OU=Staff," + testBase)
+	dn := ldapx.MustParseDN("OU=Staff,"+testBase).Child("CN", "GG-Staff")
+
+	if err := c.CreateGroup(Group{DN: dn, Name: "GG-Staff", Kind: Distribution, Scope: Universal, Members: []ldapx.DN{anna}}); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := srv.Get(dn.String()); e.First("groupType") != "8" {
+		t.Fatalf("groupType %q", e.First("groupType"))
+	}
+	if err := c.AddMembers(dn, bert); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddMembers(dn, anna); !errs.IsCode(err, errs.Conflict) {
+		t.Fatalf("duplicate member: want CONFLICT, got %v", err)
+	}
+	if err := c.RemoveMembers(dn, anna); err != nil {
+		t.Fatal(err)
+	}
+	g, err := c.GetGroup(dn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Kind != Distribution || g.Scope != Universal || len(g.Members) != 1 || !g.Members[0].Equal(bert) {
+		t.Fatalf("group %+v", g)
+	}
+	if err := c.CreateGroup(Group{DN: dn, Name: "GG-Staff", Kind: Security, Scope: Global}); !errs.IsCode(err, errs.Conflict) {
+		t.Fatalf("existing group: want CONFLICT, got %v", err)
+	}
+	if _, err := c.GetGroup(anna); !errs.IsCode(err, errs.NotFound) {
+		t.Fatalf("user is not a group: got %v", err)
+	}
+}
+
+func TestConn_GroupsStayInDelegation(t *testing.T) {
+	srv, c := delegatedDir(t)
+	root := ldapx.MustParseDN("CN=Root,CN=Users," + testBase)
+	if err := srv.AddGroup("CN=Admins,CN=Users,"+testBase, root.String()); err != nil {
+		t.Fatal(err)
+	}
+	admins := ldapx.MustParseDN("CN=Admins,CN=Users," + testBase)
+	staff := ldapx.MustParseDN("OU=Staff,"+testBase).Child("CN", "GG-Staff")
+
+	if err := c.CreateGroup(Group{DN: admins.Parent().Child("CN", "X"), Name: "X", Kind: Security, Scope: Global}); !errs.IsCode(err, errs.Forbidden) {
+		t.Fatalf("create outside: want FORBIDDEN, got %v", err)
+	}
+	if err := c.CreateGroup(Group{DN: staff, Name: "GG-Staff", Kind: Security, Scope: Global, Members: []ldapx.DN{root}}); !errs.IsCode(err, errs.Forbidden) {
+		t.Fatalf("member outside: want FORBIDDEN, got %v", err)
+	}
+	if err := c.AddMembers(admins, ldapx.MustParseDN("CN=Anna,OU=Staff,"+testBase)); !errs.IsCode(err, errs.Forbidden) {
+		t.Fatalf("modify outside: want FORBIDDEN, got %v", err)
+	}
+	if gs, err := c.SearchGroups(nil, 0); err != nil || len(gs) != 0 {
+		t.Fatalf("hidden group listed: %+v %v", gs, err)
+	}
+	if _, err := c.EffectiveMembers(admins); !errs.IsCode(err, errs.NotFound) {
+		t.Fatalf("hidden group expanded: %v", err)
+	}
+}
+
+func TestConn_EffectiveMembership(t *testing.T) {
+	srv, c := delegatedDir(t)
+	ou := "OU=Staff," + testBase
+	anna, gina := "CN=Anna,"+ou, "CN=Gina,OU=Guests,"+testBase
+	// all -> staff -> anna, all -> guests -> gina, guests -> all (cycle)
+	for _, g := range []struct {
+		dn      string
+		members []string
+	}{
+		{"CN=GG-Staff," + ou, []string{anna}},
+		{"CN=GG-Guests," + ou, []string{gina}},
+		{"CN=GG-All," + ou, []string{"CN=GG-Staff," + ou, "CN=GG-Guests," + ou}},
+	} {
+		if err := srv.AddGroup(g.dn, g.members...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	all := ldapx.MustParseDN("CN=GG-All," + ou)
+	if err := c.AddMembers(ldapx.MustParseDN("CN=GG-Guests,"+ou), all); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.EffectiveMembers(all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{}
+	for _, s := range []string{anna, gina, "CN=GG-Staff," + ou, "CN=GG-Guests," + ou, "CN=GG-All," + ou} {
+		want[ldapx.MustParseDN(s).Norm()] = true
+	}
+	if len(got) != len(want) {
+		t.Fatalf("effective members %v", got)
+	}
+	for _, dn := range got {
+		if !want[dn.Norm()] {
+			t.Fatalf("unexpected member %s", dn)
+		}
+	}
+
+	groups, err := c.EffectiveGroups(ldapx.MustParseDN(anna))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, g := range groups {
+		names = append(names, g.Name)
+	}
+	if len(names) != 3 {
+		t.Fatalf("anna's groups %v", names)
+	}
+}
+
+func TestStore_GroupSaveDiffsMembers(t *testing.T) {
+	_, c := delegatedDir(t)
+	base := modelx.NewBase("json", []modelx.Codec{modelx.JSON{}, modelx.YAML{}}, []modelx.Store{Store{Client: c}})
+	ctx := context.Background()
+	dn := ldapx.MustParseDN("OU=Staff,"+testBase).Child("CN", "GG-Staff")
+	anna, bert := "CN=Anna,OU=Staff,"+testBase, "CN=Bert,OU=Staff,"+testBase
+
+	g := domain.NewADGroup(base)
+	g.Name, g.Members = "GG-Staff", []string{anna}
+	if g.Save(ctx, URI(dn), "yaml"); g.Err() != nil {
+		t.Fatalf("create: %v", g.Err())
+	}
+
+	g = domain.NewADGroup(base).Load(ctx, URI(dn))
+	if g.Err() != nil || g.Type != "security" || g.Scope != "global" || len(g.Members) != 1 {
+		t.Fatalf("load %+v %v", g, g.Err())
+	}
+	g.Scope = "universal"
+	g.Description = "all staff"
+	g.Members = []string{bert}
+	if g.Save(ctx, URI(dn), "json"); g.Err() != nil {
+		t.Fatalf("update: %v", g.Err())
+	}
+	got, err := c.GetGroup(dn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Scope != Universal || got.Description != "all staff" || len(got.Members) != 1 || got.Members[0].String() != bert {
+		t.Fatalf("directory state %+v", got)
+	}
+}
@@ -0,0 +1,123 @@
+package ldaptest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// Entry is a single directory object. Attribute names keep the spelling they
+// were written with; lookups are case-insensitive.
+type Entry struct {
+	DN    string
+	Attrs map[string][]string
+
+	seq int
+}
+
+// Get returns the values of attr (case-insensitive). distinguishedName is
+// synthesised from DN like AD does.
+func (e *Entry) Get(attr string) []string {
+	if strings.EqualFold(attr, "distinguishedName") {
+		return []string{e.DN}
+	}
+	for k, v := range e.Attrs {
+		if strings.EqualFold(k, attr) {
+			return v
+		}
+	}
+	return nil
+}
+
+// First returns the first value of attr or "".
+func (e *Entry) First(attr string) string {
+	if v := e.Get(attr); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (e *Entry) key(attr string) string {
+	for k := range e.Attrs {
+		if strings.EqualFold(k, attr) {
+			return k
+		}
+	}
+	return attr
+}
+
+func (e *Entry) set(attr string, vals []string) {
+	k := e.key(attr)
+	if len(vals) == 0 {
+		delete(e.Attrs, k)
+		return
+	}
+	e.Attrs[k] = vals
+}
+
+func (e *Entry) clone() *Entry {
+	c := &Entry{DN: e.DN, Attrs: make(map[string][]string, len(e.Attrs)), seq: e.seq}
+	for k, v := range e.Attrs {
+		c.Attrs[k] = append([]string(nil), v...)
+	}
+	return c
+}
+
+// normDN canonicalises a DN for map keys and comparisons. Empty RDN values are
+// rejected the same way AD does.
+func normDN(dn string) (string, error) {
+	if strings.TrimSpace(dn) == "" {
+		return "", nil
+	}
+	p, err := goldap.ParseDN(dn)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, 0, len(p.RDNs))
+	for _, rdn := range p.RDNs {
+		avas := make([]string, 0, len(rdn.Attributes))
+		for _, a := range rdn.Attributes {
+			if a.Value == "" {
+				return "", fmt.Errorf("empty value for %s in %q", a.Type, dn)
+			}
+			ava := goldap.AttributeTypeAndValue{Type: strings.ToLower(a.Type), Value: strings.ToLower(a.Value)}
+			avas = append(avas, ava.String())
+		}
+		sort.Strings(avas)
+		parts = append(parts, strings.Join(avas, "+"))
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// parentOf returns the normalised parent of a normalised DN.
+func parentOf(norm string) string {
+	for i := 0; i < len(norm); i++ {
+		switch norm[i] {
+		case '\\':
+			i++
+		case ',':
+			return norm[i+1:]
+		}
+	}
+	return ""
+}
+
+// rdnOf splits the first RDN of dn into attribute and value.
+func rdnOf(dn string) (string, string, error) {
+	p, err := goldap.ParseDN(dn)
+	if err != nil {
+		return "", "", err
+	}
+	if len(p.RDNs) == 0 || len(p.RDNs[0].Attributes) == 0 {
+		return "", "", fmt.Errorf("empty dn")
+	}
+	a := p.RDNs[0].Attributes[0]
+	return a.Type, a.Value, nil
+}
+
+// under reports whether norm equals base or lies below it.
+func under(norm, base string) bool {
+	return base == "" || norm == base || strings.HasSuffix(norm, ","+base)
+}
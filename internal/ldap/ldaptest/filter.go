@@ -0,0 +1,185 @@
+package ldaptest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// AD matching rules understood by extensible match filters.
+const (
+	ruleBitAnd = "1.2.840.113556.1.4.803"
+	ruleBitOr  = "1.2.840.113556.1.4.804"
+	ruleChain  = "1.2.840.113556.1.4.1941" // LDAP_MATCHING_RULE_IN_CHAIN
+)
+
+// match evaluates a BER encoded RFC 4511 filter against e. Values compare
+// case-insensitively, which is what AD does for the attributes we care about.
+func (s *Server) match(e *Entry, f *ber.Packet) (bool, error) {
+	if f.ClassType != ber.ClassContext {
+		return false, fmt.Errorf("invalid filter class %d", f.ClassType)
+	}
+	switch f.Tag {
+	case goldap.FilterAnd:
+		for _, c := range f.Children {
+			ok, err := s.match(e, c)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case goldap.FilterOr:
+		for _, c := range f.Children {
+			ok, err := s.match(e, c)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				return true, nil
+			}
+		}
+		return false, nil
+	case goldap.FilterNot:
+		if len(f.Children) != 1 {
+			return false, fmt.Errorf("not filter needs one child")
+		}
+		ok, err := s.match(e, f.Children[0])
+		return !ok && err == nil, err
+	case goldap.FilterEqualityMatch, goldap.FilterApproxMatch:
+		attr, val, err := ava(f)
+		if err != nil {
+			return false, err
+		}
+		return s.equal(e, attr, val), nil
+	case goldap.FilterGreaterOrEqual, goldap.FilterLessOrEqual:
+		attr, val, err := ava(f)
+		if err != nil {
+			return false, err
+		}
+		for _, v := range e.Get(attr) {
+			c := compare(v, val)
+			if (f.Tag == goldap.FilterGreaterOrEqual && c >= 0) || (f.Tag == goldap.FilterLessOrEqual && c <= 0) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case goldap.FilterPresent:
+		attr := f.Data.String()
+		return strings.EqualFold(attr, "objectClass") || len(e.Get(attr)) > 0, nil
+	case goldap.FilterSubstrings:
+		return substrings(e, f)
+	case goldap.FilterExtensibleMatch:
+		return s.extensible(e, f)
+	}
+	return false, fmt.Errorf("unsupported filter tag %d", f.Tag)
+}
+
+func ava(f *ber.Packet) (string, string, error) {
+	if len(f.Children) != 2 {
+		return "", "", fmt.Errorf("malformed attribute value assertion")
+	}
+	attr, _ := f.Children[0].Value.(string)
+	return attr, string(f.Children[1].ByteValue), nil
+}
+
+func (s *Server) equal(e *Entry, attr, val string) bool {
+	if strings.EqualFold(attr, "distinguishedName") {
+		a, _ := normDN(e.DN)
+		b, err := normDN(val)
+		return err == nil && a == b
+	}
+	return containsFold(e.Get(attr), val)
+}
+
+// compare orders numerically when both sides are integers.
+func compare(a, b string) int {
+	x, errA := strconv.ParseInt(a, 10, 64)
+	y, errB := strconv.ParseInt(b, 10, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+func substrings(e *Entry, f *ber.Packet) (bool, error) {
+	if len(f.Children) != 2 {
+		return false, fmt.Errorf("malformed substring filter")
+	}
+	attr, _ := f.Children[0].Value.(string)
+	for _, v := range e.Get(attr) {
+		if substringMatch(strings.ToLower(v), f.Children[1].Children) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func substringMatch(v string, parts []*ber.Packet) bool {
+	pos := 0
+	for _, p := range parts {
+		sub := strings.ToLower(p.Data.String())
+		switch p.Tag {
+		case goldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(v, sub) {
+				return false
+			}
+			pos = len(sub)
+		case goldap.FilterSubstringsAny:
+			i := strings.Index(v[pos:], sub)
+			if i < 0 {
+				return false
+			}
+			pos += i + len(sub)
+		case goldap.FilterSubstringsFinal:
+			if len(v)-len(sub) < pos || !strings.HasSuffix(v, sub) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s *Server) extensible(e *Entry, f *ber.Packet) (bool, error) {
+	var rule, attr, val string
+	for _, c := range f.Children {
+		switch c.Tag {
+		case 1:
+			rule = c.Data.String()
+		case 2:
+			attr = c.Data.String()
+		case 3:
+			val = c.Data.String()
+		}
+	}
+	switch rule {
+	case ruleBitAnd, ruleBitOr:
+		want, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("bitwise filter needs an integer: %w", err)
+		}
+		for _, v := range e.Get(attr) {
+			have, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				continue
+			}
+			if (rule == ruleBitAnd && have&want == want) || (rule == ruleBitOr && have&want != 0) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case ruleChain:
+		return s.inChain(e, attr, val), nil
+	case "":
+		return s.equal(e, attr, val), nil
+	}
+	return false, fmt.Errorf("unsupported matching rule %s", rule)
+}
@@ -0,0 +1,158 @@
+package ldaptest
+
+import (
+	"sort"
+	"strings"
+
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// groupClasses is the objectClass chain of an AD group object.
+var groupClasses = []string{"top", "group"}
+
+// AddGroup adds a global security group with the given member DNs.
+func (s *Server) AddGroup(dn string, members ...string) error {
+	name := dn
+	if _, v, err := rdnOf(dn); err == nil {
+		name = v
+	}
+	attrs := map[string][]string{
+		"objectClass":    groupClasses,
+		"sAMAccountName": {name},
+		"groupType":      {"-2147483646"}, // GLOBAL|SECURITY
+	}
+	if len(members) > 0 {
+		attrs["member"] = members
+	}
+	return s.Add(dn, attrs)
+}
+
+// memberOf returns the DNs of the groups listing norm as a direct member,
+// the back-link AD maintains as memberOf. Caller holds s.mu.
+func (s *Server) memberOf(norm string) []string {
+	var groups []*Entry
+	for _, g := range s.entries {
+		for _, m := range g.Get("member") {
+			if n, err := normDN(m); err == nil && n == norm {
+				groups = append(groups, g)
+				break
+			}
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].seq < groups[j].seq })
+	out := make([]string, len(groups))
+	for i, g := range groups {
+		out[i] = g.DN
+	}
+	return out
+}
+
+// withMemberOf returns e with the computed memberOf attribute, or e itself
+// when it is in no group. Caller holds s.mu.
+func (s *Server) withMemberOf(e *Entry) *Entry {
+	norm, _ := normDN(e.DN)
+	groups := s.memberOf(norm)
+	if len(groups) == 0 {
+		return e
+	}
+	v := e.clone()
+	v.set("memberOf", groups)
+	return v
+}
+
+// inChain evaluates LDAP_MATCHING_RULE_IN_CHAIN: for memberOf, whether e
+// reaches the group val through nested membership; for member, whether val
+// is a direct or nested member of the group e. Cycles are tolerated.
+func (s *Server) inChain(e *Entry, attr, val string) bool {
+	target, err := normDN(val)
+	if err != nil || target == "" {
+		return false
+	}
+	start, _ := normDN(e.DN)
+	var next func(string) []string
+	switch {
+	case strings.EqualFold(attr, "memberOf"):
+		next = func(n string) []string {
+			var out []string
+			for _, g := range s.memberOf(n) {
+				gn, _ := normDN(g)
+				out = append(out, gn)
+			}
+			return out
+		}
+	case strings.EqualFold(attr, "member"):
+		next = func(n string) []string {
+			g, ok := s.entries[n]
+			if !ok {
+				return nil
+			}
+			var out []string
+			for _, m := range g.Get("member") {
+				if mn, err := normDN(m); err == nil {
+					out = append(out, mn)
+				}
+			}
+			return out
+		}
+	default:
+		return false
+	}
+	seen := map[string]bool{start: true}
+	queue := []string{start}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, m := range next(n) {
+			if m == target {
+				return true
+			}
+			if !seen[m] {
+				seen[m] = true
+				queue = append(queue, m)
+			}
+		}
+	}
+	return false
+}
+
+// checkMembers rejects member values that do not name an existing object.
+// Caller holds s.mu.
+func (s *Server) checkMembers(vals []string) *ldapErr {
+	for _, v := range vals {
+		n, err := normDN(v)
+		if err != nil || n == "" {
+			return &ldapErr{code: goldap.LDAPResultInvalidDNSyntax, msg: v}
+		}
+		if _, ok := s.entries[n]; !ok {
+			return &ldapErr{code: goldap.LDAPResultNoSuchObject, msg: "member " + v}
+		}
+	}
+	return nil
+}
+
+// relink keeps member values consistent after an object was deleted
+// (newDN == "") or renamed, as AD's referential integrity does.
+// Caller holds s.mu.
+func (s *Server) relink(oldNorm, newDN string) {
+	for _, g := range s.entries {
+		members := g.Get("member")
+		if members == nil {
+			continue
+		}
+		var keep []string
+		changed := false
+		for _, m := range members {
+			if n, err := normDN(m); err == nil && n == oldNorm {
+				changed = true
+				if newDN != "" {
+					keep = append(keep, newDN)
+				}
+				continue
+			}
+			keep = append(keep, m)
+		}
+		if changed {
+			g.set("member", keep)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package ldaptest
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// userClasses is the objectClass chain of an AD user object.
+var userClasses = []string{"top", "person", "organizationalPerson", "user"}
+
+// SeedTable adds one user per row. The first row holds attribute names as in
+// a Gherkin table; "uid" is accepted as alias for sAMAccountName. Without a
+// "dn" column users land in CN=Users under the RDN cn, displayName or uid.
+func (s *Server) SeedTable(rows [][]string) error {
+	if len(rows) < 2 {
+		return fmt.Errorf("table needs header + at least 1 row")
+	}
+	header := make([]string, len(rows[0]))
+	for i, h := range rows[0] {
+		h = strings.TrimSpace(h)
+		if strings.EqualFold(h, "uid") {
+			h = "sAMAccountName"
+		}
+		header[i] = h
+	}
+	for n, row := range rows[1:] {
+		if len(row) != len(header) {
+			return fmt.Errorf("row %d: got %d cells, want %d", n+1, len(row), len(header))
+		}
+		dn := ""
+		attrs := map[string][]string{}
+		for i, v := range row {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+			if strings.EqualFold(header[i], "dn") {
+				dn = v
+				continue
+			}
+			attrs[header[i]] = append(attrs[header[i]], v)
+		}
+		if dn == "" {
+			cn := first(attrs, "cn", "displayName", "sAMAccountName")
+			if cn == "" {
+				return fmt.Errorf("row %d: need dn, cn, displayName or uid", n+1)
+			}
+			dn = "CN=" + escapeRDN(cn) + "," + s.UsersDN()
+		}
+		if _, ok := attrs["objectClass"]; !ok {
+			attrs["objectClass"] = userClasses
+		}
+		if _, ok := attrs["userAccountControl"]; !ok && containsFold(attrs["objectClass"], "user") {
+			attrs["userAccountControl"] = []string{"512"}
+		}
+		if err := s.Add(dn, attrs); err != nil {
+			return fmt.Errorf("row %d: %w", n+1, err)
+		}
+	}
+	return nil
+}
+
+// LoadLDIF adds all records of an LDIF content file (RFC 2849, no change
+// records). A userPassword attribute becomes the bind password.
+func (s *Server) LoadLDIF(r io.Reader) error {
+	recs, err := parseLDIF(r)
+	if err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		if err := s.Add(rec.dn, rec.attrs); err != nil {
+			return fmt.Errorf("ldif %s: %w", rec.dn, err)
+		}
+	}
+	return nil
+}
+
+type ldifRecord struct {
+	dn    string
+	attrs map[string][]string
+}
+
+func parseLDIF(r io.Reader) ([]ldifRecord, error) {
+	var (
+		out   []ldifRecord
+		lines []string
+	)
+	flush := func() error {
+		if len(lines) == 0 {
+			return nil
+		}
+		rec := ldifRecord{attrs: map[string][]string{}}
+		for _, l := range lines {
+			name, val, err := ldifLine(l)
+			if err != nil {
+				return err
+			}
+			switch {
+			case strings.EqualFold(name, "version"):
+			case strings.EqualFold(name, "dn"):
+				rec.dn = val
+			default:
+				rec.attrs[name] = append(rec.attrs[name], val)
+			}
+		}
+		lines = lines[:0]
+		if rec.dn == "" {
+			if len(rec.attrs) == 0 {
+				return nil
+			}
+			return fmt.Errorf("ldif record without dn")
+		}
+		out = append(out, rec)
+		return nil
+	}
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		l := strings.TrimRight(sc.Text(), "\r")
+		switch {
+		case strings.HasPrefix(l, "#"):
+		case l == "":
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(l, " ") && len(lines) > 0:
+			lines[len(lines)-1] += l[1:]
+		default:
+			lines = append(lines, l)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func ldifLine(l string) (string, string, error) {
+	i := strings.Index(l, ":")
+	if i <= 0 {
+		return "", "", fmt.Errorf("ldif: malformed line %q", l)
+	}
+	name, rest := l[:i], l[i+1:]
+	if strings.HasPrefix(rest, ":") {
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(rest[1:]))
+		if err != nil {
+			return "", "", fmt.Errorf("ldif: %s: %w", name, err)
+		}
+		return name, string(b), nil
+	}
+	if strings.HasPrefix(rest, "<") {
+		return "", "", fmt.Errorf("ldif: URL values are not supported (%s)", name)
+	}
+	return name, strings.TrimLeft(rest, " "), nil
+}
+
+func first(attrs map[string][]string, names ...string) string {
+	for _, n := range names {
+		for k, v := range attrs {
+			if strings.EqualFold(k, n) && len(v) > 0 {
+				return v[0]
+			}
+		}
+	}
+	return ""
+}
+
+// escapeRDN escapes the RFC 4514 specials of an attribute value.
+func escapeRDN(v string) string {
+	var b strings.Builder
+	for i, r := range v {
+		switch {
+		case strings.ContainsRune(`,+"\<>;=`, r),
+			i == 0 && (r == ' ' || r == '#'),
+			i == len(v)-1 && r == ' ':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,889 @@
+// Package ldaptest provides an in-memory LDAPv3 server for tests, in the
+// spirit of net/http/httptest. It speaks enough of the protocol (and of AD's
+// dialect) to run the real ldap.Conn against it.
+package ldaptest
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+
+	"github.com/Weruminger/go-ad-admin/internal/config"
+)
+
+// Credentials of the built-in service account.
+const (
+	AdminPassword = "Passw0rd!"
+	usersRDN      = "CN=Users"
+	oidStartTLS   = "1.3.6.1.4.1.1466.20037"
+)
+
+// Server is an in-memory directory reachable via LDAP on a localhost port.
+type Server struct {
+	BaseDN string
+	URL    string // ldap:// or ldaps://127.0.0.1:<port>
+
+	// AllowAnonymous permits operations without a prior bind.
+	AllowAnonymous bool
+	// MaxPageSize caps paged searches like AD's LDAP policy of that name.
+	MaxPageSize int
+
+	mu        sync.RWMutex
+	entries   map[string]*Entry // normalised DN -> entry
+	passwords map[string]string // normalised DN -> password
+	seq       int
+
+	ln      net.Listener
+	tlsCfg  *tls.Config
+	ldaps   bool
+	caFile  string
+	wg      sync.WaitGroup
+	connsMu sync.Mutex
+	conns   map[net.Conn]struct{}
+	closed  bool
+}
+
+// NewServer starts a plaintext server with StartTLS support. It panics if no
+// port can be bound, like httptest.NewServer.
+func NewServer(baseDN string) *Server {
+	s := NewUnstartedServer(baseDN)
+	s.Start()
+	return s
+}
+
+// NewTLSServer starts an LDAPS server with a self-signed certificate; use
+// Config (which sets LDAPCAFile) to trust it.
+func NewTLSServer(baseDN string) *Server {
+	s := NewUnstartedServer(baseDN)
+	s.ldaps = true
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer returns a server with the base entry, the CN=Users
+// container and the Administrator service account, but no listener yet.
+func NewUnstartedServer(baseDN string) *Server {
+	s := &Server{
+		BaseDN:      baseDN,
+		entries:     map[string]*Entry{},
+		passwords:   map[string]string{},
+		conns:       map[net.Conn]struct{}{},
+		MaxPageSize: 1000,
+	}
+	dc := "example"
+	if a, v, err := rdnOf(baseDN); err == nil && strings.EqualFold(a, "dc") {
+		dc = v
+	}
+	must(s.Add(baseDN, map[string][]string{"objectClass": {"top", "domain"}, "dc": {dc}}))
+	must(s.Add(s.UsersDN(), map[string][]string{"objectClass": {"top", "container"}, "cn": {"Users"}}))
+	must(s.Add(s.AdminDN(), map[string][]string{
+		"objectClass":        {"top", "person", "organizationalPerson", "user"},
+		"cn":                 {"Administrator"},
+		"sAMAccountName":     {"Administrator"},
+		"userAccountControl": {"512"},
+	}))
+	must(s.SetPassword(s.AdminDN(), AdminPassword))
+	return s
+}
+
+func must(err error) {
+	if err != nil {
+		panic("ldaptest: " + err.Error())
+	}
+}
+
+// UsersDN is the default container for seeded users.
+func (s *Server) UsersDN() string { return usersRDN + "," + s.BaseDN }
+
+// AdminDN is the DN of the built-in service account.
+func (s *Server) AdminDN() string { return "CN=Administrator," + s.UsersDN() }
+
+// Start binds 127.0.0.1 on a random port and serves until Close.
+func (s *Server) Start() {
+	cert, caPEM, err := selfSigned()
+	must(err)
+	s.tlsCfg = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	dir, err := os.MkdirTemp("", "ldaptest")
+	must(err)
+	s.caFile = filepath.Join(dir, "ca.pem")
+	must(os.WriteFile(s.caFile, caPEM, 0o600))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	must(err)
+	scheme := "ldap"
+	if s.ldaps {
+		ln = tls.NewListener(ln, s.tlsCfg)
+		scheme = "ldaps"
+	}
+	s.ln = ln
+	s.URL = scheme + "://" + ln.Addr().String()
+	s.wg.Add(1)
+	go s.serve()
+}
+
+// Close stops the listener, drops all client connections and waits for
+// their goroutines.
+func (s *Server) Close() {
+	s.connsMu.Lock()
+	s.closed = true
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.connsMu.Unlock()
+	if s.ln != nil {
+		_ = s.ln.Close()
+	}
+	s.wg.Wait()
+	if s.caFile != "" {
+		_ = os.RemoveAll(filepath.Dir(s.caFile))
+	}
+}
+
+// CAFile is the path of the PEM file that signs the server certificate.
+func (s *Server) CAFile() string { return s.caFile }
+
+// Config returns a dev configuration pointing at this server and bound as
+// the built-in Administrator, with the whole base DN delegated.
+func (s *Server) Config() config.Config {
+	cfg := *config.NewDefaultConfig()
+	cfg.Env = "dev"
+	cfg.LDAPURL = s.URL
+	cfg.LDAPBaseDN = s.BaseDN
+	cfg.LDAPBindDN = s.AdminDN()
+	cfg.LDAPBindPassword = AdminPassword
+	cfg.LDAPCAFile = s.caFile
+	cfg.LDAPTimeout = 2 * time.Second
+	cfg.LDAPAllowedOUs = map[string][]string{cfg.Env: {s.BaseDN}}
+	return cfg
+}
+
+/*** Directory access for test setup ***/
+
+// Add inserts an entry. The parent must exist unless dn is the base DN.
+func (s *Server) Add(dn string, attrs map[string][]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.add(dn, attrs); e != nil {
+		return e
+	}
+	return nil
+}
+
+func (s *Server) add(dn string, attrs map[string][]string) *ldapErr {
+	norm, err := normDN(dn)
+	if err != nil || norm == "" {
+		return &ldapErr{code: goldap.LDAPResultInvalidDNSyntax, msg: fmt.Sprintf("invalid dn %q", dn)}
+	}
+	if _, ok := s.entries[norm]; ok {
+		return &ldapErr{code: goldap.LDAPResultEntryAlreadyExists, msg: dn}
+	}
+	base, _ := normDN(s.BaseDN)
+	if norm != base {
+		if _, ok := s.entries[parentOf(norm)]; !ok {
+			return &ldapErr{code: goldap.LDAPResultNoSuchObject, msg: "parent of " + dn}
+		}
+	}
+	e := &Entry{DN: dn, Attrs: map[string][]string{}}
+	for k, v := range attrs {
+		e.set(k, append([]string(nil), v...))
+	}
+	if lerr := s.checkMembers(e.Get("member")); lerr != nil {
+		return lerr
+	}
+	if a, v, err := rdnOf(dn); err == nil && e.Get(a) == nil {
+		e.set(a, []string{v})
+	}
+	if pw := e.First("userPassword"); pw != "" {
+		s.passwords[norm] = pw
+		e.set("userPassword", nil)
+	}
+	s.seq++
+	e.seq = s.seq
+	s.entries[norm] = e
+	return nil
+}
+
+// Get returns a copy of the entry at dn.
+func (s *Server) Get(dn string) (*Entry, bool) {
+	norm, err := normDN(dn)
+	if err != nil {
+		return nil, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.entries[norm]
+	if !ok {
+		return nil, false
+	}
+	return e.clone(), true
+}
+
+// Entries returns copies of all entries in insertion order.
+func (s *Server) Entries() []*Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sorted(func(*Entry) bool { return true })
+}
+
+// Len is the number of entries including base, container and admin.
+func (s *Server) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.entries)
+}
+
+// SetPassword sets the simple-bind password of an existing entry.
+func (s *Server) SetPassword(dn, password string) error {
+	norm, err := normDN(dn)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[norm]; !ok {
+		return fmt.Errorf("no such entry %q", dn)
+	}
+	s.passwords[norm] = password
+	return nil
+}
+
+func (s *Server) sorted(keep func(*Entry) bool) []*Entry {
+	out := make([]*Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		if keep(e) {
+			out = append(out, e.clone())
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].seq < out[j].seq })
+	return out
+}
+
+/*** Protocol ***/
+
+type ldapErr struct {
+	code    uint16
+	matched string
+	msg     string
+}
+
+func (e *ldapErr) Error() string { return fmt.Sprintf("ldap %d: %s", e.code, e.msg) }
+
+type session struct {
+	conn  net.Conn
+	bound string // normalised DN, "" = anonymous
+	tls   bool
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.connsMu.Lock()
+		if s.closed {
+			s.connsMu.Unlock()
+			_ = c.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.connsMu.Unlock()
+		s.wg.Add(1)
+		go s.handle(c)
+	}
+}
+
+func (s *Server) handle(c net.Conn) {
+	defer s.wg.Done()
+	sess := &session{conn: c, tls: s.ldaps}
+	defer func() {
+		s.connsMu.Lock()
+		delete(s.conns, c)
+		s.connsMu.Unlock()
+		_ = sess.conn.Close()
+	}()
+	for {
+		p, err := ber.ReadPacket(sess.conn)
+		if err != nil {
+			return
+		}
+		if len(p.Children) < 2 {
+			return
+		}
+		id, _ := p.Children[0].Value.(int64)
+		op := p.Children[1]
+		var controls []*ber.Packet
+		if len(p.Children) > 2 && p.Children[2].ClassType == ber.ClassContext && p.Children[2].Tag == 0 {
+			controls = p.Children[2].Children
+		}
+		switch op.Tag {
+		case goldap.ApplicationBindRequest:
+			s.reply(sess, id, result(goldap.ApplicationBindResponse, s.bind(sess, op)))
+		case goldap.ApplicationUnbindRequest:
+			return
+		case goldap.ApplicationSearchRequest:
+			s.search(sess, id, op, controls)
+		case goldap.ApplicationModifyRequest:
+			s.reply(sess, id, result(goldap.ApplicationModifyResponse, s.guard(sess, func() *ldapErr { return s.modify(sess, op) })))
+		case goldap.ApplicationAddRequest:
+			s.reply(sess, id, result(goldap.ApplicationAddResponse, s.guard(sess, func() *ldapErr { return s.addReq(op) })))
+		case goldap.ApplicationDelRequest:
+			s.reply(sess, id, result(goldap.ApplicationDelResponse, s.guard(sess, func() *ldapErr { return s.del(op.Data.String()) })))
+		case goldap.ApplicationModifyDNRequest:
+			s.reply(sess, id, result(goldap.ApplicationModifyDNResponse, s.guard(sess, func() *ldapErr { return s.modDN(op) })))
+		case goldap.ApplicationAbandonRequest:
+			// nothing is asynchronous, nothing to abandon
+		case goldap.ApplicationExtendedRequest:
+			if !s.extended(sess, id, op) {
+				return
+			}
+		default:
+			s.reply(sess, id, result(goldap.ApplicationExtendedResponse, &ldapErr{code: goldap.LDAPResultProtocolError, msg: "unsupported operation"}))
+		}
+	}
+}
+
+func (s *Server) reply(sess *session, id int64, op *ber.Packet, controls ...*ber.Packet) {
+	env := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	env.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	env.AppendChild(op)
+	if len(controls) > 0 {
+		cs := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Controls")
+		for _, c := range controls {
+			cs.AppendChild(c)
+		}
+		env.AppendChild(cs)
+	}
+	_, _ = sess.conn.Write(env.Bytes())
+}
+
+func result(tag ber.Tag, e *ldapErr) *ber.Packet {
+	code, matched, msg := uint16(goldap.LDAPResultSuccess), "", ""
+	if e != nil {
+		code, matched, msg = e.code, e.matched, e.msg
+	}
+	r := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	r.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	r.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, matched, "matchedDN"))
+	r.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, msg, "diagnosticMessage"))
+	return r
+}
+
+// guard runs a write operation after the bind check under the write lock.
+func (s *Server) guard(sess *session, fn func() *ldapErr) *ldapErr {
+	if e := s.authorised(sess); e != nil {
+		return e
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn()
+}
+
+func (s *Server) authorised(sess *session) *ldapErr {
+	if sess.bound == "" && !s.AllowAnonymous {
+		return &ldapErr{code: goldap.LDAPResultOperationsError, msg: "a successful bind must be completed on the connection"}
+	}
+	return nil
+}
+
+func (s *Server) bind(sess *session, op *ber.Packet) *ldapErr {
+	if len(op.Children) < 3 {
+		return &ldapErr{code: goldap.LDAPResultProtocolError, msg: "malformed bind"}
+	}
+	name, _ := op.Children[1].Value.(string)
+	auth := op.Children[2]
+	if auth.ClassType != ber.ClassContext || auth.Tag != 0 {
+		return &ldapErr{code: goldap.LDAPResultAuthMethodNotSupported, msg: "only simple bind"}
+	}
+	password := auth.Data.String()
+	sess.bound = ""
+	if name == "" && password == "" {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	norm := s.resolveBindName(name)
+	if pw, ok := s.passwords[norm]; !ok || password == "" || pw != password {
+		return &ldapErr{code: goldap.LDAPResultInvalidCredentials, msg: "80090308: LdapErr: DSID-0C09044E, comment: AcceptSecurityContext error, data 52e"}
+	}
+	if e := s.entries[norm]; e != nil && !bindable(e) {
+		return &ldapErr{code: goldap.LDAPResultInvalidCredentials, msg: "80090308: LdapErr: DSID-0C09044E, comment: AcceptSecurityContext error, data 533"}
+	}
+	sess.bound = norm
+	return nil
+}
+
+// resolveBindName accepts a DN or a userPrincipalName, like AD.
+func (s *Server) resolveBindName(name string) string {
+	if strings.Contains(name, "@") && !strings.Contains(name, "=") {
+		for norm, e := range s.entries {
+			for _, upn := range e.Get("userPrincipalName") {
+				if strings.EqualFold(upn, name) {
+					return norm
+				}
+			}
+		}
+		return ""
+	}
+	norm, _ := normDN(name)
+	return norm
+}
+
+// bindable is false for accounts flagged ACCOUNTDISABLE.
+func bindable(e *Entry) bool {
+	var uac int64
+	_, _ = fmt.Sscan(e.First("userAccountControl"), &uac)
+	return uac&0x2 == 0
+}
+
+func (s *Server) extended(sess *session, id int64, op *ber.Packet) bool {
+	name := ""
+	if len(op.Children) > 0 {
+		name = op.Children[0].Data.String()
+	}
+	if name != oidStartTLS {
+		s.reply(sess, id, result(goldap.ApplicationExtendedResponse, &ldapErr{code: goldap.LDAPResultProtocolError, msg: "unsupported extended operation " + name}))
+		return true
+	}
+	if sess.tls {
+		s.reply(sess, id, result(goldap.ApplicationExtendedResponse, &ldapErr{code: goldap.LDAPResultOperationsError, msg: "TLS already established"}))
+		return true
+	}
+	s.reply(sess, id, result(goldap.ApplicationExtendedResponse, nil))
+	tc := tls.Server(sess.conn, s.tlsCfg)
+	if err := tc.Handshake(); err != nil {
+		return false
+	}
+	s.connsMu.Lock()
+	delete(s.conns, sess.conn)
+	s.conns[tc] = struct{}{}
+	s.connsMu.Unlock()
+	sess.conn, sess.tls = tc, true
+	return true
+}
+
+/*** Search ***/
+
+func (s *Server) search(sess *session, id int64, op *ber.Packet, controls []*ber.Packet) {
+	done := func(e *ldapErr, ctrls ...*ber.Packet) {
+		s.reply(sess, id, result(goldap.ApplicationSearchResultDone, e), ctrls...)
+	}
+	if len(op.Children) < 8 {
+		done(&ldapErr{code: goldap.LDAPResultProtocolError, msg: "malformed search"})
+		return
+	}
+	baseDN, _ := op.Children[0].Value.(string)
+	scope, _ := op.Children[1].Value.(int64)
+	sizeLimit, _ := op.Children[3].Value.(int64)
+	filter := op.Children[6]
+	var attrs []string
+	for _, a := range op.Children[7].Children {
+		if v, ok := a.Value.(string); ok {
+			attrs = append(attrs, v)
+		}
+	}
+
+	if baseDN == "" && scope == goldap.ScopeBaseObject {
+		s.reply(sess, id, s.entryPacket(s.rootDSE(), attrs))
+		done(nil)
+		return
+	}
+	if e := s.authorised(sess); e != nil {
+		done(e)
+		return
+	}
+
+	s.mu.RLock()
+	base, err := normDN(baseDN)
+	if err != nil {
+		s.mu.RUnlock()
+		done(&ldapErr{code: goldap.LDAPResultInvalidDNSyntax, msg: baseDN})
+		return
+	}
+	if _, ok := s.entries[base]; !ok {
+		s.mu.RUnlock()
+		done(&ldapErr{code: goldap.LDAPResultNoSuchObject, msg: baseDN})
+		return
+	}
+	var matchErr error
+	hits := s.sorted(func(e *Entry) bool {
+		norm, _ := normDN(e.DN)
+		switch scope {
+		case goldap.ScopeBaseObject:
+			if norm != base {
+				return false
+			}
+		case goldap.ScopeSingleLevel:
+			if parentOf(norm) != base {
+				return false
+			}
+		default:
+			if !under(norm, base) {
+				return false
+			}
+		}
+		ok, err := s.match(s.withMemberOf(e), filter)
+		if err != nil {
+			matchErr = err
+		}
+		return ok
+	})
+	for i, e := range hits {
+		hits[i] = s.withMemberOf(e)
+	}
+	s.mu.RUnlock()
+	if matchErr != nil {
+		done(&ldapErr{code: goldap.LDAPResultFilterError, msg: matchErr.Error()})
+		return
+	}
+
+	page, respCtrls, lerr := s.page(hits, controls)
+	if lerr != nil {
+		done(lerr)
+		return
+	}
+	var limitErr *ldapErr
+	if sizeLimit > 0 && int64(len(page)) > sizeLimit {
+		page = page[:sizeLimit]
+		limitErr = &ldapErr{code: goldap.LDAPResultSizeLimitExceeded, msg: "size limit exceeded"}
+	}
+	for _, e := range page {
+		s.reply(sess, id, s.entryPacket(e, attrs))
+	}
+	done(limitErr, respCtrls...)
+}
+
+// page applies the RFC 2696 paged results control. The cookie is the offset
+// of the next entry, so it survives reconnects (AD's does not).
+func (s *Server) page(hits []*Entry, controls []*ber.Packet) ([]*Entry, []*ber.Packet, *ldapErr) {
+	for _, cp := range controls {
+		ctrl, err := goldap.DecodeControl(cp)
+		if err != nil {
+			return nil, nil, &ldapErr{code: goldap.LDAPResultProtocolError, msg: err.Error()}
+		}
+		pc, ok := ctrl.(*goldap.ControlPaging)
+		if !ok {
+			continue
+		}
+		offset := 0
+		if len(pc.Cookie) > 0 {
+			offset, err = strconv.Atoi(string(pc.Cookie))
+			if err != nil || offset < 0 || offset > len(hits) {
+				return nil, nil, &ldapErr{code: goldap.LDAPResultUnwillingToPerform, msg: "invalid paged results cookie"}
+			}
+		}
+		size := int(pc.PagingSize)
+		if size == 0 { // abandon
+			return nil, []*ber.Packet{(&goldap.ControlPaging{}).Encode()}, nil
+		}
+		if s.MaxPageSize > 0 && size > s.MaxPageSize {
+			size = s.MaxPageSize
+		}
+		end := offset + size
+		if end > len(hits) {
+			end = len(hits)
+		}
+		resp := &goldap.ControlPaging{PagingSize: uint32(len(hits))}
+		if end < len(hits) {
+			resp.Cookie = []byte(strconv.Itoa(end))
+		}
+		return hits[offset:end], []*ber.Packet{resp.Encode()}, nil
+	}
+	return hits, nil, nil
+}
+
+func (s *Server) rootDSE() *Entry {
+	return &Entry{Attrs: map[string][]string{
+		"namingContexts":       {s.BaseDN},
+		"defaultNamingContext": {s.BaseDN},
+		"supportedLDAPVersion": {"3"},
+		"supportedExtension":   {oidStartTLS},
+		"supportedControl":     {goldap.ControlTypePaging},
+		"vendorName":           {"go-ad-admin ldaptest"},
+	}}
+}
+
+func (s *Server) entryPacket(e *Entry, attrs []string) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.DN, "objectName"))
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for _, name := range selectAttrs(e, attrs) {
+		a := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		a.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, v := range e.Get(name) {
+			vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+		}
+		a.AppendChild(vals)
+		list.AppendChild(a)
+	}
+	p.AppendChild(list)
+	return p
+}
+
+// selectAttrs resolves the requested attribute list ("*", "1.1", names)
+// against the entry, keeping the stored spelling.
+func selectAttrs(e *Entry, attrs []string) []string {
+	all := len(attrs) == 0
+	var out []string
+	for _, a := range attrs {
+		switch a {
+		case "*":
+			all = true
+		case "1.1":
+		default:
+			if strings.EqualFold(a, "distinguishedName") {
+				out = append(out, "distinguishedName")
+			} else if e.Get(a) != nil {
+				out = append(out, e.key(a))
+			}
+		}
+	}
+	if all {
+		out = out[:0]
+		for k := range e.Attrs {
+			out = append(out, k)
+		}
+		sort.Strings(out)
+	}
+	return out
+}
+
+/*** Writes (caller holds s.mu) ***/
+
+func (s *Server) addReq(op *ber.Packet) *ldapErr {
+	if len(op.Children) < 2 {
+		return &ldapErr{code: goldap.LDAPResultProtocolError, msg: "malformed add"}
+	}
+	dn, _ := op.Children[0].Value.(string)
+	attrs := map[string][]string{}
+	for _, a := range op.Children[1].Children {
+		if len(a.Children) < 2 {
+			continue
+		}
+		name, _ := a.Children[0].Value.(string)
+		for _, v := range a.Children[1].Children {
+			attrs[name] = append(attrs[name], string(v.ByteValue))
+		}
+	}
+	if len(attrs["objectClass"]) == 0 {
+		return &ldapErr{code: goldap.LDAPResultObjectClassViolation, msg: "objectClass missing"}
+	}
+	return s.add(dn, attrs)
+}
+
+func (s *Server) lookup(dn string) (string, *Entry, *ldapErr) {
+	norm, err := normDN(dn)
+	if err != nil || norm == "" {
+		return "", nil, &ldapErr{code: goldap.LDAPResultInvalidDNSyntax, msg: dn}
+	}
+	e, ok := s.entries[norm]
+	if !ok {
+		return "", nil, &ldapErr{code: goldap.LDAPResultNoSuchObject, msg: dn}
+	}
+	return norm, e, nil
+}
+
+func (s *Server) modify(sess *session, op *ber.Packet) *ldapErr {
+	if len(op.Children) < 2 {
+		return &ldapErr{code: goldap.LDAPResultProtocolError, msg: "malformed modify"}
+	}
+	dn, _ := op.Children[0].Value.(string)
+	norm, e, lerr := s.lookup(dn)
+	if lerr != nil {
+		return lerr
+	}
+	work := e.clone()
+	password := ""
+	for _, ch := range op.Children[1].Children {
+		if len(ch.Children) < 2 || len(ch.Children[1].Children) < 2 {
+			return &ldapErr{code: goldap.LDAPResultProtocolError, msg: "malformed change"}
+		}
+		kind, _ := ch.Children[0].Value.(int64)
+		name, _ := ch.Children[1].Children[0].Value.(string)
+		var vals []string
+		for _, v := range ch.Children[1].Children[1].Children {
+			vals = append(vals, string(v.ByteValue))
+		}
+		if strings.EqualFold(name, "unicodePwd") {
+			pw, lerr := unicodePwd(sess, kind, vals)
+			if lerr != nil {
+				return lerr
+			}
+			password = pw
+			continue
+		}
+		if strings.EqualFold(name, "memberOf") {
+			return &ldapErr{code: goldap.LDAPResultUnwillingToPerform, msg: "memberOf is maintained by the server, modify member on the group"}
+		}
+		if strings.EqualFold(name, "member") && kind != goldap.DeleteAttribute {
+			if lerr := s.checkMembers(vals); lerr != nil {
+				return lerr
+			}
+		}
+		if lerr := s.applyChange(work, kind, name, vals); lerr != nil {
+			return lerr
+		}
+	}
+	s.entries[norm] = work
+	if password != "" {
+		s.passwords[norm] = password
+	}
+	return nil
+}
+
+// unicodePwd decodes an administrative password reset the way AD expects
+// it: a replace over TLS with the quoted password encoded as UTF-16LE.
+// The attribute itself is write-only and never stored on the entry.
+func unicodePwd(sess *session, kind int64, vals []string) (string, *ldapErr) {
+	if !sess.tls {
+		return "", &ldapErr{code: goldap.LDAPResultUnwillingToPerform, msg: "unicodePwd requires a TLS connection"}
+	}
+	if kind != goldap.ReplaceAttribute || len(vals) != 1 || len(vals[0])%2 != 0 {
+		return "", &ldapErr{code: goldap.LDAPResultConstraintViolation, msg: "unicodePwd: expected one replaced value"}
+	}
+	raw := []byte(vals[0])
+	u := make([]uint16, len(raw)/2)
+	for i := range u {
+		u[i] = uint16(raw[2*i]) | uint16(raw[2*i+1])<<8
+	}
+	pw := string(utf16.Decode(u))
+	if len(pw) < 3 || pw[0] != '"' || pw[len(pw)-1] != '"' {
+		return "", &ldapErr{code: goldap.LDAPResultConstraintViolation, msg: "unicodePwd: value must be quoted"}
+	}
+	return pw[1 : len(pw)-1], nil
+}
+
+func (s *Server) applyChange(e *Entry, kind int64, name string, vals []string) *ldapErr {
+	cur := e.Get(name)
+	switch kind {
+	case goldap.AddAttribute:
+		for _, v := range vals {
+			if containsFold(cur, v) {
+				return &ldapErr{code: goldap.LDAPResultAttributeOrValueExists, msg: name}
+			}
+			cur = append(cur, v)
+		}
+		e.set(name, cur)
+	case goldap.DeleteAttribute:
+		if cur == nil {
+			return &ldapErr{code: goldap.LDAPResultNoSuchAttribute, msg: name}
+		}
+		if len(vals) == 0 {
+			e.set(name, nil)
+			return nil
+		}
+		var keep []string
+		for _, c := range cur {
+			if !containsFold(vals, c) {
+				keep = append(keep, c)
+			}
+		}
+		if len(keep) == len(cur) {
+			return &ldapErr{code: goldap.LDAPResultNoSuchAttribute, msg: name}
+		}
+		e.set(name, keep)
+	case goldap.ReplaceAttribute:
+		e.set(name, vals)
+	default:
+		return &ldapErr{code: goldap.LDAPResultUnwillingToPerform, msg: "unsupported modify operation"}
+	}
+	return nil
+}
+
+func (s *Server) del(dn string) *ldapErr {
+	norm, _, lerr := s.lookup(dn)
+	if lerr != nil {
+		return lerr
+	}
+	for k := range s.entries {
+		if parentOf(k) == norm {
+			return &ldapErr{code: goldap.LDAPResultNotAllowedOnNonLeaf, msg: dn}
+		}
+	}
+	delete(s.entries, norm)
+	delete(s.passwords, norm)
+	s.relink(norm, "")
+	return nil
+}
+
+func (s *Server) modDN(op *ber.Packet) *ldapErr {
+	if len(op.Children) < 3 {
+		return &ldapErr{code: goldap.LDAPResultProtocolError, msg: "malformed modrdn"}
+	}
+	dn, _ := op.Children[0].Value.(string)
+	newRDN, _ := op.Children[1].Value.(string)
+	deleteOld, _ := op.Children[2].Value.(bool)
+	norm, e, lerr := s.lookup(dn)
+	if lerr != nil {
+		return lerr
+	}
+	for k := range s.entries {
+		if parentOf(k) == norm {
+			return &ldapErr{code: goldap.LDAPResultNotAllowedOnNonLeaf, msg: dn}
+		}
+	}
+	parent := ""
+	if p, err := goldap.ParseDN(dn); err == nil && len(p.RDNs) > 1 {
+		parent = (&goldap.DN{RDNs: p.RDNs[1:]}).String()
+	}
+	if len(op.Children) > 3 {
+		parent = op.Children[3].Data.String()
+	}
+	newDN := newRDN + "," + parent
+	newNorm, err := normDN(newDN)
+	if err != nil || newNorm == "" {
+		return &ldapErr{code: goldap.LDAPResultInvalidDNSyntax, msg: newDN}
+	}
+	if _, ok := s.entries[newNorm]; ok {
+		return &ldapErr{code: goldap.LDAPResultEntryAlreadyExists, msg: newDN}
+	}
+	if _, ok := s.entries[parentOf(newNorm)]; !ok {
+		return &ldapErr{code: goldap.LDAPResultNoSuchObject, msg: "new superior " + parent}
+	}
+	work := e.clone()
+	work.DN = newDN
+	if deleteOld {
+		if a, v, err := rdnOf(dn); err == nil {
+			var keep []string
+			for _, c := range work.Get(a) {
+				if !strings.EqualFold(c, v) {
+					keep = append(keep, c)
+				}
+			}
+			work.set(a, keep)
+		}
+	}
+	if a, v, err := rdnOf(newDN); err == nil && !containsFold(work.Get(a), v) {
+		work.set(a, append(work.Get(a), v))
+	}
+	delete(s.entries, norm)
+	s.entries[newNorm] = work
+	s.relink(norm, newDN)
+	if pw, ok := s.passwords[norm]; ok {
+		delete(s.passwords, norm)
+		s.passwords[newNorm] = pw
+	}
+	return nil
+}
+
+func containsFold(list []string, v string) bool {
+	for _, c := range list {
+		if strings.EqualFold(c, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,267 @@
+package ldaptest
+
+import (
+	"crypto/tls"
+	"strings"
+	"testing"
+
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+const base = "DC=example,DC=com"
+
+func dial(t *testing.T, s *Server) *goldap.Conn {
+	t.Helper()
+	c, err := goldap.DialURL(s.URL)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	if err := c.Bind(s.AdminDN(), AdminPassword); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	return c
+}
+
+func search(t *testing.T, c *goldap.Conn, filter string) []string {
+	t.Helper()
+	res, err := c.Search(goldap.NewSearchRequest(base, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, 0, false,
+		filter, []string{"sAMAccountName"}, nil))
+	if err != nil {
+		t.Fatalf("search %s: %v", filter, err)
+	}
+	var out []string
+	for _, e := range res.Entries {
+		out = append(out, e.GetAttributeValue("sAMAccountName"))
+	}
+	return out
+}
+
+func TestServer_Bind(t *testing.T) {
+	s := NewServer(base)
+	defer s.Close()
+
+	c, err := goldap.DialURL(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Bind(s.AdminDN(), "wrong"); !goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+		t.Fatalf("want invalid credentials, got %v", err)
+	}
+	if _, err := c.Search(goldap.NewSearchRequest(base, goldap.ScopeWholeSubtree, 0, 0, 0, false, "(objectClass=*)", nil, nil)); err == nil {
+		t.Fatal("anonymous search must fail")
+	}
+	if err := c.Bind(strings.ToLower(s.AdminDN()), AdminPassword); err != nil {
+		t.Fatalf("bind with differently cased DN: %v", err)
+	}
+}
+
+func TestServer_SearchFilters(t *testing.T) {
+	s := NewServer(base)
+	defer s.Close()
+	err := s.SeedTable([][]string{
+		{"uid", "displayName", "mail", "userAccountControl"},
+		{"anna.smith", "Anna Smith", "anna@example.com", "512"},
+		{"joanna.roe", "Joanna Roe", "", "514"},
+		{"bob", "Bob Doe", "bob@example.com", "512"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := dial(t, s)
+
+	cases := map[string]int{
+		"(displayName=*anna*)":                                   2,
+		"(displayName=Anna*)":                                    1,
+		"(displayName=*Roe)":                                     1,
+		"(&(objectClass=user)(mail=*))":                          2,
+		"(|(sAMAccountName=bob)(sAMAccountName=anna.smith))":     2,
+		"(&(objectClass=user)(!(sAMAccountName=Administrator)))": 3,
+		"(userAccountControl:1.2.840.113556.1.4.803:=2)":         1,
+		"(sAMAccountName>=b)":                                    2,
+	}
+	for f, want := range cases {
+		if got := search(t, c, f); len(got) != want {
+			t.Errorf("%s: got %v, want %d hits", f, got, want)
+		}
+	}
+}
+
+func TestServer_SizeLimit(t *testing.T) {
+	s := NewServer(base)
+	defer s.Close()
+	c := dial(t, s)
+	res, err := c.Search(goldap.NewSearchRequest(base, goldap.ScopeWholeSubtree, 0, 1, 0, false, "(objectClass=*)", nil, nil))
+	if !goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) {
+		t.Fatalf("want size limit exceeded, got %v", err)
+	}
+	if len(res.Entries) != 1 {
+		t.Fatalf("got %d entries", len(res.Entries))
+	}
+}
+
+func TestServer_Writes(t *testing.T) {
+	s := NewServer(base)
+	defer s.Close()
+	c := dial(t, s)
+
+	dn := "CN=Carol,CN=Users," + base
+	add := goldap.NewAddRequest(dn, nil)
+	add.Attribute("objectClass", userClasses)
+	add.Attribute("sAMAccountName", []string{"carol"})
+	if err := c.Add(add); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := c.Add(add); !goldap.IsErrorWithCode(err, goldap.LDAPResultEntryAlreadyExists) {
+		t.Fatalf("want exists, got %v", err)
+	}
+	orphan := goldap.NewAddRequest("CN=x,OU=Nope,"+base, nil)
+	orphan.Attribute("objectClass", userClasses)
+	if err := c.Add(orphan); !goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) {
+		t.Fatalf("want no such object, got %v", err)
+	}
+
+	mod := goldap.NewModifyRequest(dn, nil)
+	mod.Replace("mail", []string{"carol@example.com"})
+	mod.Add("description", []string{"temp"})
+	if err := c.Modify(mod); err != nil {
+		t.Fatalf("modify: %v", err)
+	}
+	if e, _ := s.Get(dn); e.First("mail") != "carol@example.com" || e.First("description") != "temp" {
+		t.Fatalf("modify not applied: %v", e.Attrs)
+	}
+
+	if err := c.ModifyDN(goldap.NewModifyDNRequest(dn, "CN=Caroline", true, "")); err != nil {
+		t.Fatalf("modrdn: %v", err)
+	}
+	moved := "CN=Caroline,CN=Users," + base
+	e, ok := s.Get(moved)
+	if !ok || e.First("cn") != "Caroline" {
+		t.Fatalf("rename failed: %v", e)
+	}
+
+	if err := c.Del(goldap.NewDelRequest("CN=Users,"+base, nil)); !goldap.IsErrorWithCode(err, goldap.LDAPResultNotAllowedOnNonLeaf) {
+		t.Fatalf("want non-leaf, got %v", err)
+	}
+	if err := c.Del(goldap.NewDelRequest(moved, nil)); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, ok := s.Get(moved); ok {
+		t.Fatal("entry still present")
+	}
+}
+
+func TestServer_LoadLDIF(t *testing.T) {
+	s := NewServer(base)
+	defer s.Close()
+	ldif := `version: 1
+
+# a staff OU
+dn: OU=Staff,DC=example,DC=com
+objectClass: top
+objectClass: organizationalUnit
+
+dn: CN=Dave,OU=Staff,DC=example,DC=com
+objectClass: top
+objectClass: user
+sAMAccountName: dave
+description:: w4TDlsOc
+userPassword: s3cret
+displayName: Dave
+  Davidson
+`
+	if err := s.LoadLDIF(strings.NewReader(ldif)); err != nil {
+		t.Fatal(err)
+	}
+	e, ok := s.Get("cn=dave,ou=staff,dc=example,dc=com")
+	if !ok {
+		t.Fatal("dave missing")
+	}
+	if e.First("description") != "ÄÖÜ" || e.First("displayName") != "Dave Davidson" {
+		t.Fatalf("decoded attrs wrong: %v", e.Attrs)
+	}
+	c, err := goldap.DialURL(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Bind(e.DN, "s3cret"); err != nil {
+		t.Fatalf("bind with LDIF password: %v", err)
+	}
+}
+
+func TestServer_UnicodePwd(t *testing.T) {
+	s := NewServer(base)
+	defer s.Close()
+	if err := s.SeedTable([][]string{{"uid"}, {"carol"}}); err != nil {
+		t.Fatal(err)
+	}
+	dn := "CN=carol," + s.UsersDN()
+	pw := "\"\x00n\x00e\x00w\x00\"\x00" // "new" as UTF-16LE
+
+	c := dial(t, s)
+	mod := goldap.NewModifyRequest(dn, nil)
+	mod.Replace("unicodePwd", []string{pw})
+	if err := c.Modify(mod); !goldap.IsErrorWithCode(err, goldap.LDAPResultUnwillingToPerform) {
+		t.Fatalf("plaintext: want unwilling to perform, got %v", err)
+	}
+	if err := c.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
+		t.Fatal(err)
+	}
+	bad := goldap.NewModifyRequest(dn, nil)
+	bad.Replace("unicodePwd", []string{"n\x00e\x00w\x00"})
+	if err := c.Modify(bad); !goldap.IsErrorWithCode(err, goldap.LDAPResultConstraintViolation) {
+		t.Fatalf("unquoted: want constraint violation, got %v", err)
+	}
+	if err := c.Modify(mod); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if e, _ := s.Get(dn); len(e.Get("unicodePwd")) != 0 {
+		t.Fatal("unicodePwd stored on the entry")
+	}
+	if err := c.Bind(dn, "new"); err != nil {
+		t.Fatalf("bind with new password: %v", err)
+	}
+}
+
+func TestServer_GroupsInChain(t *testing.T) {
+	s := NewServer(base)
+	defer s.Close()
+	if err := s.SeedTable([][]string{{"uid", "displayName"}, {"anna", "Anna"}}); err != nil {
+		t.Fatal(err)
+	}
+	users := s.UsersDN()
+	anna, inner, outer := "CN=Anna,"+users, "CN=Inner,"+users, "CN=Outer,"+users
+	if err := s.AddGroup(inner, anna); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddGroup(outer, inner); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddGroup("CN=Ghost,"+users, "CN=Nobody,"+users); err == nil {
+		t.Fatal("member must exist")
+	}
+	c := dial(t, s)
+
+	cases := map[string]int{
+		"(memberOf=" + inner + ")":                                  1,
+		"(memberOf=" + outer + ")":                                  1, // Inner only
+		"(memberOf:1.2.840.113556.1.4.1941:=" + outer + ")":         2,
+		"(member:1.2.840.113556.1.4.1941:=" + anna + ")":            2,
+		"(&(objectClass=group)(member:1.2.840.113556.1.4.1941:=x))": 0,
+	}
+	for f, want := range cases {
+		if got := search(t, c, f); len(got) != want {
+			t.Errorf("%s: got %v, want %d", f, got, want)
+		}
+	}
+
+	// deleting a member drops it from every group, as AD does
+	if err := c.Del(goldap.NewDelRequest(anna, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := s.Get(inner); len(e.Get("member")) != 0 {
+		t.Fatalf("stale member %v", e.Get("member"))
+	}
+}
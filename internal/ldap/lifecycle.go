@@ -0,0 +1,286 @@
+package ldap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf16"
+
+	goldap "github.com/go-ldap/ldap/v3"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+)
+
+// userAccountControl flags used here (MS-ADTS 2.2.16).
+const (
+	uacAccountDisable = 0x0002
+	uacNormalAccount  = 0x0200
+)
+
+// accountExpires values AD treats as "never".
+const (
+	neverExpires    = "9223372036854775807"
+	neverExpiresAlt = "0"
+)
+
+// GetUser reads a single user object.
+func (c *Conn) GetUser(dn ldapx.DN) (User, error) {
+	op := errs.Op("ldap.GetUser")
+	var u User
+	err := c.do(op, func(lc *goldap.Conn) error {
+		e, err := c.readUser(lc, dn)
+		if err != nil {
+			return err
+		}
+		u, err = userFromEntry(e)
+		return err
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return u, nil
+}
+
+// UpdateUser replaces the naming and contact attributes of an existing user.
+// Empty fields remove the attribute; account state is left alone.
+func (c *Conn) UpdateUser(u User) error {
+	op := errs.Op("ldap.UpdateUser")
+	if u.DN.IsZero() || u.UID == "" {
+		return errs.New(op, errs.InvalidInput, errors.New("dn and uid are required"), map[string]any{"dn": u.DN.String()})
+	}
+	if err := c.checkWrite(op, u.DN); err != nil {
+		return err
+	}
+	req := goldap.NewModifyRequest(u.DN.String(), nil)
+	req.Replace("sAMAccountName", []string{u.UID})
+	req.Replace("userPrincipalName", values(u.UPN))
+	req.Replace("displayName", values(u.Name))
+	req.Replace("mail", values(u.Mail))
+	return c.modifyUser(op, u.DN, req)
+}
+
+// DisableUser sets ACCOUNTDISABLE in userAccountControl.
+func (c *Conn) DisableUser(dn ldapx.DN) error {
+	return c.setUAC("ldap.DisableUser", dn, uacAccountDisable, true)
+}
+
+// EnableUser clears ACCOUNTDISABLE. AD refuses this for accounts whose
+// password does not satisfy the domain policy.
+func (c *Conn) EnableUser(dn ldapx.DN) error {
+	return c.setUAC("ldap.EnableUser", dn, uacAccountDisable, false)
+}
+
+// setUAC reads userAccountControl and writes it back with flag set or
+// cleared, so unrelated bits survive.
+func (c *Conn) setUAC(op errs.Op, dn ldapx.DN, flag int, on bool) error {
+	if err := c.checkWrite(op, dn); err != nil {
+		return err
+	}
+	return c.do(op, func(lc *goldap.Conn) error {
+		e, err := c.readUser(lc, dn)
+		if err != nil {
+			return err
+		}
+		uac := uacNormalAccount
+		if v := e.GetAttributeValue("userAccountControl"); v != "" {
+			if uac, err = strconv.Atoi(v); err != nil {
+				return fmt.Errorf("userAccountControl %q: %w", v, err)
+			}
+		}
+		if on {
+			uac |= flag
+		} else {
+			uac &^= flag
+		}
+		req := goldap.NewModifyRequest(dn.String(), nil)
+		req.Replace("userAccountControl", []string{strconv.Itoa(uac)})
+		return c.modify(lc, req)
+	})
+}
+
+// UnlockUser clears an intruder lockout by resetting lockoutTime.
+func (c *Conn) UnlockUser(dn ldapx.DN) error {
+	op := errs.Op("ldap.UnlockUser")
+	if err := c.checkWrite(op, dn); err != nil {
+		return err
+	}
+	req := goldap.NewModifyRequest(dn.String(), nil)
+	req.Replace("lockoutTime", []string{"0"})
+	return c.modifyUser(op, dn, req)
+}
+
+// ResetPassword sets a new password administratively. AD only accepts
+// unicodePwd over an encrypted connection, so plaintext sessions are refused
+// before the password leaves the process. mustChange forces a change at the
+// next logon.
+func (c *Conn) ResetPassword(dn ldapx.DN, password string, mustChange bool) error {
+	op := errs.Op("ldap.ResetPassword")
+	if password == "" {
+		return errs.New(op, errs.InvalidInput, errors.New("password must not be empty"), map[string]any{"dn": dn.String()})
+	}
+	if err := c.checkWrite(op, dn); err != nil {
+		return err
+	}
+	req := goldap.NewModifyRequest(dn.String(), nil)
+	req.Replace("unicodePwd", []string{encodePassword(password)})
+	if mustChange {
+		req.Replace("pwdLastSet", []string{"0"})
+	}
+	return c.do(op, func(lc *goldap.Conn) error {
+		if _, isTLS := lc.TLSConnectionState(); !isTLS {
+			return errs.New(op, errs.Forbidden, errors.New("password reset requires LDAPS or StartTLS"), map[string]any{"dn": dn.String()})
+		}
+		if _, err := c.readUser(lc, dn); err != nil {
+			return err
+		}
+		return c.modify(lc, req)
+	})
+}
+
+// RequirePasswordChange sets pwdLastSet to 0 (change at next logon) or -1,
+// which AD turns into the current time and so lifts the requirement.
+func (c *Conn) RequirePasswordChange(dn ldapx.DN, must bool) error {
+	op := errs.Op("ldap.RequirePasswordChange")
+	if err := c.checkWrite(op, dn); err != nil {
+		return err
+	}
+	v := "-1"
+	if must {
+		v = "0"
+	}
+	req := goldap.NewModifyRequest(dn.String(), nil)
+	req.Replace("pwdLastSet", []string{v})
+	return c.modifyUser(op, dn, req)
+}
+
+// SetExpiry sets accountExpires; nil means the account never expires.
+func (c *Conn) SetExpiry(dn ldapx.DN, at *time.Time) error {
+	op := errs.Op("ldap.SetExpiry")
+	if err := c.checkWrite(op, dn); err != nil {
+		return err
+	}
+	v := neverExpires
+	if at != nil {
+		v = strconv.FormatInt(toFileTime(*at), 10)
+	}
+	req := goldap.NewModifyRequest(dn.String(), nil)
+	req.Replace("accountExpires", []string{v})
+	return c.modifyUser(op, dn, req)
+}
+
+// modifyUser applies req if dn is a user, so groups, computers and other
+// objects in the permitted OUs cannot be changed through the user calls.
+func (c *Conn) modifyUser(op errs.Op, dn ldapx.DN, req *goldap.ModifyRequest) error {
+	return c.do(op, func(lc *goldap.Conn) error {
+		if _, err := c.readUser(lc, dn); err != nil {
+			return err
+		}
+		return c.modify(lc, req)
+	})
+}
+
+// DeleteUser removes a user object.
+func (c *Conn) DeleteUser(dn ldapx.DN) error {
+	op := errs.Op("ldap.DeleteUser")
+	if err := c.checkWrite(op, dn); err != nil {
+		return err
+	}
+	return c.do(op, func(lc *goldap.Conn) error {
+		if _, err := c.readUser(lc, dn); err != nil {
+			return err
+		}
+		return c.del(lc, goldap.NewDelRequest(dn.String(), nil))
+	})
+}
+
+// MoveUser moves a user below newParent, keeping its RDN, and returns the
+// new DN. Source and target must both lie within the delegation.
+func (c *Conn) MoveUser(dn, newParent ldapx.DN) (ldapx.DN, error) {
+	op := errs.Op("ldap.MoveUser")
+	if err := c.checkWrite(op, dn); err != nil {
+		return ldapx.DN{}, err
+	}
+	if err := c.checkTarget(op, newParent); err != nil {
+		return ldapx.DN{}, err
+	}
+	rdn := dn.RDN().String()
+	err := c.do(op, func(lc *goldap.Conn) error {
+		if _, err := c.readUser(lc, dn); err != nil {
+			return err
+		}
+		return c.modifyDN(lc, goldap.NewModifyDNRequest(dn.String(), rdn, true, newParent.String()))
+	})
+	if err != nil {
+		return ldapx.DN{}, err
+	}
+	moved, err := ldapx.ParseDN(rdn + "," + newParent.String())
+	if err != nil {
+		return ldapx.DN{}, errs.New(op, errs.Internal, err, nil)
+	}
+	return moved, nil
+}
+
+// readUser fetches the user entry at dn. Objects outside the permitted OUs
+// are reported as not found. Callers must run inside c.do.
+func (c *Conn) readUser(lc *goldap.Conn, dn ldapx.DN) (*goldap.Entry, error) {
+	if !c.visible(dn) {
+		return nil, errs.New("", errs.NotFound, fmt.Errorf("%s is not a user", dn), map[string]any{"dn": dn.String()})
+	}
+	f, err := userFilter(nil)
+	if err != nil {
+		return nil, err
+	}
+	req := goldap.NewSearchRequest(dn.String(), goldap.ScopeBaseObject, goldap.NeverDerefAliases, 1, int(c.cfg.LDAPTimeout/time.Second), false,
+		f, userAttrs, nil)
+	res, err := lc.Search(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Entries) == 0 {
+		return nil, errs.New("", errs.NotFound, fmt.Errorf("%s is not a user", dn), map[string]any{"dn": dn.String()})
+	}
+	return res.Entries[0], nil
+}
+
+func values(v string) []string {
+	if v == "" {
+		return []string{}
+	}
+	return []string{v}
+}
+
+// encodePassword renders the unicodePwd value: the password in double
+// quotes, UTF-16LE encoded.
+func encodePassword(pw string) string {
+	u := utf16.Encode([]rune(`"` + pw + `"`))
+	b := make([]byte, 2*len(u))
+	for i, r := range u {
+		binary.LittleEndian.PutUint16(b[2*i:], r)
+	}
+	return string(b)
+}
+
+// fileTimeOffset is the number of seconds between 1601-01-01, the origin of
+// Windows FILETIME values, and the Unix epoch. time.Duration cannot span the
+// 400 years, so conversions go through seconds.
+const fileTimeOffset = 11644473600
+
+// toFileTime converts t to 100ns intervals since 1601.
+func toFileTime(t time.Time) int64 {
+	return (t.Unix()+fileTimeOffset)*1e7 + int64(t.Nanosecond())/100
+}
+
+func fromFileTime(v string) (*time.Time, error) {
+	if v == "" || v == neverExpires || v == neverExpiresAlt {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("filetime %q: %w", v, err)
+	}
+	t := time.Unix(n/1e7-fileTimeOffset, (n%1e7)*100).UTC()
+	return &t, nil
+}
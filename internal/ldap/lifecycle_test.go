@@ -0,0 +1,176 @@
+package ldap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Weruminger/go-ad-admin/internal/config"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/ldap/ldaptest"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+)
+
+func seedAnna(t *testing.T, srv *ldaptest.Server) ldapx.DN {
+	t.Helper()
+	if err := srv.SeedTable([][]string{
+		{"uid", "displayName", "userPrincipalName", "userAccountControl"},
+		{"anna", "Anna Smith", "anna@example.com", "66048"}, // NORMAL_ACCOUNT|DONT_EXPIRE_PASSWD
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return ldapx.MustParseDN(srv.UsersDN()).Child("CN", "Anna Smith")
+}
+
+func TestConn_DisableEnableKeepsOtherBits(t *testing.T) {
+	srv := ldaptest.NewServer(testBase)
+	defer srv.Close()
+	dn := seedAnna(t, srv)
+	c := newTestConn(t, srv, nil)
+
+	if err := c.DisableUser(dn); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := srv.Get(dn.String()); e.First("userAccountControl") != "66050" {
+		t.Fatalf("uac after disable: %s", e.First("userAccountControl"))
+	}
+	if u, err := c.GetUser(dn); err != nil || u.Enabled {
+		t.Fatalf("want disabled: %+v %v", u, err)
+	}
+	if err := c.EnableUser(dn); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := srv.Get(dn.String()); e.First("userAccountControl") != "66048" {
+		t.Fatalf("uac after enable: %s", e.First("userAccountControl"))
+	}
+	missing := ldapx.MustParseDN(srv.UsersDN()).Child("CN", "Nobody")
+	if err := c.DisableUser(missing); !errs.IsCode(err, errs.NotFound) {
+		t.Fatalf("want NOT_FOUND, got %v", err)
+	}
+	if _, err := c.GetUser(ldapx.MustParseDN(srv.UsersDN())); !errs.IsCode(err, errs.NotFound) {
+		t.Fatalf("container is not a user: want NOT_FOUND, got %v", err)
+	}
+}
+
+func TestConn_UnlockExpiryMustChange(t *testing.T) {
+	srv := ldaptest.NewServer(testBase)
+	defer srv.Close()
+	dn := seedAnna(t, srv)
+	c := newTestConn(t, srv, nil)
+
+	e, _ := srv.Get(dn.String())
+	if err := srv.Add("CN=Locked,"+srv.UsersDN(), map[string][]string{
+		"objectClass": {"top", "person", "organizationalPerson", "user"}, "sAMAccountName": {"locked"}, "lockoutTime": {"133000000000000000"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	locked := ldapx.MustParseDN("CN=Locked," + srv.UsersDN())
+	if u, _ := c.GetUser(locked); !u.Locked {
+		t.Fatal("lockoutTime should read as locked")
+	}
+	if err := c.UnlockUser(locked); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := c.GetUser(locked); u.Locked {
+		t.Fatal("still locked")
+	}
+
+	at := time.Date(2030, 6, 30, 12, 0, 0, 0, time.UTC)
+	if err := c.SetExpiry(dn, &at); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ = srv.Get(dn.String()); e.First("accountExpires") != "135535248000000000" {
+		t.Fatalf("accountExpires = %s", e.First("accountExpires"))
+	}
+	if u, _ := c.GetUser(dn); u.ExpiresAt == nil || !u.ExpiresAt.Equal(at) {
+		t.Fatalf("expiry round trip: %v", u.ExpiresAt)
+	}
+	if err := c.SetExpiry(dn, nil); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := c.GetUser(dn); u.ExpiresAt != nil {
+		t.Fatalf("want never, got %v", u.ExpiresAt)
+	}
+
+	if err := c.RequirePasswordChange(dn, true); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := c.GetUser(dn); !u.MustChangePassword {
+		t.Fatal("pwdLastSet=0 not reported")
+	}
+	if err := c.RequirePasswordChange(dn, false); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := c.GetUser(dn); u.MustChangePassword {
+		t.Fatal("must change still set")
+	}
+}
+
+func TestConn_ResetPassword(t *testing.T) {
+	srv := ldaptest.NewServer(testBase)
+	defer srv.Close()
+	dn := seedAnna(t, srv)
+
+	plain := newTestConn(t, srv, nil)
+	if err := plain.ResetPassword(dn, "Secr3t!", false); !errs.IsCode(err, errs.Forbidden) {
+		t.Fatalf("plaintext: want FORBIDDEN, got %v", err)
+	}
+
+	c := newTestConn(t, srv, func(cfg *config.Config) { cfg.LDAPStartTLS = true })
+	if err := c.ResetPassword(dn, "", false); !errs.IsCode(err, errs.InvalidInput) {
+		t.Fatalf("empty password: want INVALID_INPUT, got %v", err)
+	}
+	if err := c.ResetPassword(dn, "Sëcr3t!€", true); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if u, _ := c.GetUser(dn); !u.MustChangePassword {
+		t.Fatal("mustChange not applied")
+	}
+	if e, _ := srv.Get(dn.String()); len(e.Get("unicodePwd")) != 0 {
+		t.Fatal("unicodePwd must not be readable")
+	}
+
+	asAnna := newTestConn(t, srv, func(cfg *config.Config) {
+		cfg.LDAPStartTLS = true
+		cfg.LDAPBindDN = dn.String()
+		cfg.LDAPBindPassword = "Sëcr3t!€"
+	})
+	if err := asAnna.Ping(); err != nil {
+		t.Fatalf("bind with new password: %v", err)
+	}
+}
+
+func TestEncodePassword(t *testing.T) {
+	if got := encodePassword("ab"); got != "\"\x00a\x00b\x00\"\x00" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestConn_UserWritesRefuseOtherObjects(t *testing.T) {
+	srv := ldaptest.NewServer(testBase)
+	defer srv.Close()
+	seedAnna(t, srv)
+	group := ldapx.MustParseDN("CN=Staff," + srv.UsersDN())
+	if err := srv.Add(group.String(), map[string][]string{"objectClass": {"top", "group"}, "sAMAccountName": {"Staff"}}); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestConn(t, srv, func(cfg *config.Config) { cfg.LDAPStartTLS = true })
+	at := time.Date(2030, 6, 30, 12, 0, 0, 0, time.UTC)
+	writes := map[string]func() error{
+		"update":     func() error { return c.UpdateUser(User{DN: group, UID: "staff"}) },
+		"unlock":     func() error { return c.UnlockUser(group) },
+		"reset":      func() error { return c.ResetPassword(group, "Secr3t!", true) },
+		"mustChange": func() error { return c.RequirePasswordChange(group, true) },
+		"expiry":     func() error { return c.SetExpiry(group, &at) },
+	}
+	for name, write := range writes {
+		if err := write(); !errs.IsCode(err, errs.NotFound) {
+			t.Errorf("%s on a group: want NOT_FOUND, got %v", name, err)
+		}
+	}
+	e, _ := srv.Get(group.String())
+	for _, attr := range []string{"lockoutTime", "pwdLastSet", "accountExpires"} {
+		if v := e.Get(attr); len(v) != 0 {
+			t.Errorf("group changed: %s=%v", attr, v)
+		}
+	}
+}
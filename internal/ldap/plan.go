@@ -0,0 +1,151 @@
+package ldap
+
+import (
+	"fmt"
+	"strings"
+
+	goldap "github.com/go-ldap/ldap/v3"
+
+	"github.com/Weruminger/go-ad-admin/internal/change"
+)
+
+// DryRunner is a Client that can plan writes instead of sending them.
+type DryRunner interface {
+	Client
+	// DryRun returns a client that runs every check and read of a write,
+	// including those the write needs to build its request, but only
+	// notes the write requests in the returned Plan.
+	DryRun() (Client, *Plan)
+}
+
+var _ DryRunner = (*Conn)(nil)
+
+// Plan lists the write requests of a dry run in order.
+type Plan struct {
+	Ops []Operation `json:"ops"`
+}
+
+// Operation is one LDAP write request. Values of secret attributes such
+// as unicodePwd are change.Redacted.
+type Operation struct {
+	Type      string         `json:"type"` // add, modify, delete or modrdn
+	DN        string         `json:"dn"`
+	Changes   []Modification `json:"changes,omitempty"` // attributes of add, changes of modify
+	NewRDN    string         `json:"newRdn,omitempty"`
+	NewParent string         `json:"newParent,omitempty"`
+}
+
+// Modification is one attribute of an add or change of a modify.
+type Modification struct {
+	Op     string   `json:"op,omitempty"` // add, delete or replace; empty for add requests
+	Attr   string   `json:"attr"`
+	Values []string `json:"values"`
+}
+
+// LDIF renders p as LDIF change records (RFC 2849).
+func (p *Plan) LDIF() string {
+	var b strings.Builder
+	for i, o := range p.Ops {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(o.LDIF())
+	}
+	return b.String()
+}
+
+// LDIF renders o as one LDIF change record.
+func (o Operation) LDIF() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "dn: %s\nchangetype: %s\n", o.DN, o.Type)
+	switch o.Type {
+	case "add":
+		for _, m := range o.Changes {
+			for _, v := range m.Values {
+				fmt.Fprintf(&b, "%s: %s\n", m.Attr, v)
+			}
+		}
+	case "modify":
+		for _, m := range o.Changes {
+			fmt.Fprintf(&b, "%s: %s\n", m.Op, m.Attr)
+			for _, v := range m.Values {
+				fmt.Fprintf(&b, "%s: %s\n", m.Attr, v)
+			}
+			b.WriteString("-\n")
+		}
+	case "modrdn":
+		fmt.Fprintf(&b, "newrdn: %s\ndeleteoldrdn: 1\nnewsuperior: %s\n", o.NewRDN, o.NewParent)
+	}
+	return b.String()
+}
+
+// DryRun returns a copy of c that shares its connection but only records
+// writes in the returned Plan.
+func (c *Conn) DryRun() (Client, *Plan) {
+	d := *c
+	d.plan = &Plan{}
+	return &d, d.plan
+}
+
+// add, modify, del and modifyDN send a write request, or note it in c.plan
+// on a dry run. Callers must run inside c.do.
+func (c *Conn) add(lc *goldap.Conn, req *goldap.AddRequest) error {
+	if c.plan == nil {
+		return lc.Add(req)
+	}
+	o := Operation{Type: "add", DN: req.DN}
+	for _, a := range req.Attributes {
+		o.Changes = append(o.Changes, Modification{Attr: a.Type, Values: redact(a.Type, a.Vals)})
+	}
+	c.plan.Ops = append(c.plan.Ops, o)
+	return nil
+}
+
+func (c *Conn) modify(lc *goldap.Conn, req *goldap.ModifyRequest) error {
+	if c.plan == nil {
+		return lc.Modify(req)
+	}
+	o := Operation{Type: "modify", DN: req.DN}
+	for _, ch := range req.Changes {
+		a := ch.Modification
+		o.Changes = append(o.Changes, Modification{Op: modOps[ch.Operation], Attr: a.Type, Values: redact(a.Type, a.Vals)})
+	}
+	c.plan.Ops = append(c.plan.Ops, o)
+	return nil
+}
+
+func (c *Conn) del(lc *goldap.Conn, req *goldap.DelRequest) error {
+	if c.plan == nil {
+		return lc.Del(req)
+	}
+	c.plan.Ops = append(c.plan.Ops, Operation{Type: "delete", DN: req.DN})
+	return nil
+}
+
+func (c *Conn) modifyDN(lc *goldap.Conn, req *goldap.ModifyDNRequest) error {
+	if c.plan == nil {
+		return lc.ModifyDN(req)
+	}
+	c.plan.Ops = append(c.plan.Ops, Operation{Type: "modrdn", DN: req.DN, NewRDN: req.NewRDN, NewParent: req.NewSuperior})
+	return nil
+}
+
+var modOps = map[uint]string{
+	goldap.AddAttribute:     "add",
+	goldap.DeleteAttribute:  "delete",
+	goldap.ReplaceAttribute: "replace",
+}
+
+// secretAttrs hold passwords; compared in lower case.
+var secretAttrs = map[string]bool{"unicodepwd": true, "userpassword": true}
+
+func redact(attr string, vals []string) []string {
+	if !secretAttrs[strings.ToLower(attr)] {
+		return vals
+	}
+	out := make([]string, len(vals))
+	for i := range vals {
+		out[i] = change.Redacted
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package ldap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/change"
+	"github.com/Weruminger/go-ad-admin/internal/config"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/ldap/ldaptest"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+)
+
+func TestConn_DryRun(t *testing.T) {
+	srv := ldaptest.NewServer(testBase)
+	defer srv.Close()
+	dn := seedAnna(t, srv)
+	c := newTestConn(t, srv, func(cfg *config.Config) { cfg.LDAPStartTLS = true })
+	var got []change.Record
+	dry, plan := c.DryRun()
+	dir := Previewing(dry, change.RecorderFunc(func(r change.Record) error { got = append(got, r); return nil }))
+
+	if err := dir.DisableUser(dn); err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.ResetPassword(dn, "Secr3t!", true); err != nil {
+		t.Fatal(err)
+	}
+	carl := ldapx.MustParseDN(srv.UsersDN()).Child("CN", "Carl")
+	if err := dir.CreateUser(User{DN: carl, UID: "carl"}); err != nil {
+		t.Fatal(err)
+	}
+	missing := ldapx.MustParseDN(srv.UsersDN()).Child("CN", "Nobody")
+	if err := dir.DisableUser(missing); !errs.IsCode(err, errs.NotFound) {
+		t.Fatalf("dry run must still check: %v", err)
+	}
+
+	if e, _ := srv.Get(dn.String()); e.First("userAccountControl") != "66048" {
+		t.Fatalf("dry run wrote: uac %s", e.First("userAccountControl"))
+	}
+	if _, ok := srv.Get(carl.String()); ok {
+		t.Fatal("dry run created carl")
+	}
+	ldif := plan.LDIF()
+	for _, want := range []string{
+		"dn: " + dn.String() + "\nchangetype: modify\nreplace: userAccountControl\nuserAccountControl: 66050\n-\n",
+		"replace: unicodePwd\nunicodePwd: " + change.Redacted + "\n-\nreplace: pwdLastSet\npwdLastSet: 0\n",
+		"changetype: add\nobjectClass: top\n",
+	} {
+		if !strings.Contains(ldif, want) {
+			t.Fatalf("ldif lacks %q:\n%s", want, ldif)
+		}
+	}
+	if strings.Contains(ldif, "Secr3t!") || len(plan.Ops) != 3 {
+		t.Fatalf("plan %+v", plan.Ops)
+	}
+
+	if len(got) != 3 || got[0].Op() != "aduser.disable" || len(got[0].Diff) != 1 || got[0].Diff[0].New != false {
+		t.Fatalf("records %+v", got)
+	}
+	if got[2].Op() != "aduser.create" || got[2].Before != "" || !strings.Contains(got[2].After, `"sam": "carl"`) {
+		t.Fatalf("create %+v", got[2])
+	}
+}
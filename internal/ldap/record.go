@@ -0,0 +1,226 @@
+package ldap
+
+import (
+	"time"
+
+	"github.com/Weruminger/go-ad-admin/internal/change"
+	"github.com/Weruminger/go-ad-admin/internal/domain"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+)
+
+// Recording returns c with every successful write reported to rec as a
+// change.Record of the object before and after; reads pass through. The
+// states are read through c, so a write costs up to two extra lookups. If
+// the object cannot be read before, the write is not done and the lookup
+// error is returned; if it cannot be read back or rec fails, the write is
+// done but the error is returned, so callers do not report an unaudited
+// success.
+func Recording(c Client, rec change.Recorder) Client {
+	return recording{Client: c, rec: rec}
+}
+
+// Previewing is Recording for the client of a dry run (see DryRunner).
+// Nothing is written there, so the after state is derived from the before
+// state and the arguments of the write instead of read back.
+func Previewing(c Client, rec change.Recorder) Client {
+	return recording{Client: c, rec: rec, dry: true}
+}
+
+type recording struct {
+	Client
+	rec change.Recorder
+	dry bool
+}
+
+// passwordReset is the after state of ResetPassword: the password field
+// only exists to be redacted, so the record shows that it was set.
+type passwordReset struct {
+	*domain.ADUser
+	Password string `json:"password"`
+}
+
+func (r recording) emit(kind, id, action string, before, after any) error {
+	rec, err := change.New(kind, id, action, before, after)
+	if err != nil {
+		return errs.New("ldap.record", errs.Internal, err, map[string]any{"dn": id})
+	}
+	return r.rec.Record(rec)
+}
+
+// user runs write on the user at dn and records it; apply predicts the
+// after state on a dry run.
+func (r recording) user(dn ldapx.DN, action string, write func() error, apply func(*User)) error {
+	before, err := r.GetUser(dn)
+	if err != nil {
+		return err
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	after, err := r.userAfter(dn, before, apply)
+	if err != nil {
+		return err
+	}
+	return r.emit(change.ADUser, dn.String(), action, DomainUser(before), DomainUser(after))
+}
+
+func (r recording) userAfter(dn ldapx.DN, before User, apply func(*User)) (User, error) {
+	if r.dry {
+		apply(&before)
+		return before, nil
+	}
+	return r.GetUser(dn)
+}
+
+// group runs write on the group at dn and records it; apply predicts the
+// after state on a dry run.
+func (r recording) group(dn ldapx.DN, action string, write func() error, apply func(*Group)) error {
+	before, err := r.GetGroup(dn)
+	if err != nil {
+		return err
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	after := before
+	after.Members = append([]ldapx.DN(nil), before.Members...)
+	if r.dry {
+		apply(&after)
+	} else if after, err = r.GetGroup(dn); err != nil {
+		return err
+	}
+	return r.emit(change.ADGroup, dn.String(), action, domainGroup(before), domainGroup(after))
+}
+
+func (r recording) CreateUser(u User) error {
+	if err := r.Client.CreateUser(u); err != nil {
+		return err
+	}
+	after := u
+	after.Enabled = false // created disabled, see Conn.CreateUser
+	if !r.dry {
+		var err error
+		if after, err = r.GetUser(u.DN); err != nil {
+			return err
+		}
+	}
+	return r.emit(change.ADUser, u.DN.String(), "create", nil, DomainUser(after))
+}
+
+func (r recording) UpdateUser(u User) error {
+	return r.user(u.DN, "update", func() error { return r.Client.UpdateUser(u) }, func(a *User) {
+		a.UID, a.UPN, a.Name, a.Mail = u.UID, u.UPN, u.Name, u.Mail
+	})
+}
+
+func (r recording) DeleteUser(dn ldapx.DN) error {
+	before, err := r.GetUser(dn)
+	if err != nil {
+		return err
+	}
+	if err := r.Client.DeleteUser(dn); err != nil {
+		return err
+	}
+	return r.emit(change.ADUser, dn.String(), "delete", DomainUser(before), nil)
+}
+
+func (r recording) MoveUser(dn, newParent ldapx.DN) (ldapx.DN, error) {
+	before, err := r.GetUser(dn)
+	if err != nil {
+		return ldapx.DN{}, err
+	}
+	moved, err := r.Client.MoveUser(dn, newParent)
+	if err != nil {
+		return moved, err
+	}
+	after, err := r.userAfter(moved, before, func(a *User) { a.DN = moved })
+	if err != nil {
+		return moved, err
+	}
+	return moved, r.emit(change.ADUser, dn.String(), "move", DomainUser(before), DomainUser(after))
+}
+
+func (r recording) DisableUser(dn ldapx.DN) error {
+	return r.user(dn, "disable", func() error { return r.Client.DisableUser(dn) }, func(a *User) { a.Enabled = false })
+}
+
+func (r recording) EnableUser(dn ldapx.DN) error {
+	return r.user(dn, "enable", func() error { return r.Client.EnableUser(dn) }, func(a *User) { a.Enabled = true })
+}
+
+func (r recording) UnlockUser(dn ldapx.DN) error {
+	return r.user(dn, "unlock", func() error { return r.Client.UnlockUser(dn) }, func(a *User) { a.Locked = false })
+}
+
+func (r recording) ResetPassword(dn ldapx.DN, password string, mustChange bool) error {
+	before, err := r.GetUser(dn)
+	if err != nil {
+		return err
+	}
+	if err := r.Client.ResetPassword(dn, password, mustChange); err != nil {
+		return err
+	}
+	after, err := r.userAfter(dn, before, func(a *User) { a.MustChangePassword = mustChange })
+	if err != nil {
+		return err
+	}
+	return r.emit(change.ADUser, dn.String(), "reset-password", DomainUser(before),
+		passwordReset{ADUser: DomainUser(after), Password: password})
+}
+
+func (r recording) RequirePasswordChange(dn ldapx.DN, must bool) error {
+	return r.user(dn, "require-password-change", func() error { return r.Client.RequirePasswordChange(dn, must) },
+		func(a *User) { a.MustChangePassword = must })
+}
+
+func (r recording) SetExpiry(dn ldapx.DN, at *time.Time) error {
+	return r.user(dn, "set-expiry", func() error { return r.Client.SetExpiry(dn, at) }, func(a *User) { a.ExpiresAt = at })
+}
+
+func (r recording) CreateGroup(g Group) error {
+	if err := r.Client.CreateGroup(g); err != nil {
+		return err
+	}
+	after := g
+	if !r.dry {
+		var err error
+		if after, err = r.GetGroup(g.DN); err != nil {
+			return err
+		}
+	}
+	return r.emit(change.ADGroup, g.DN.String(), "create", nil, domainGroup(after))
+}
+
+func (r recording) UpdateGroup(g Group) error {
+	return r.group(g.DN, "update", func() error { return r.Client.UpdateGroup(g) }, func(a *Group) {
+		a.Name, a.Description, a.Mail, a.Kind, a.Scope = g.Name, g.Description, g.Mail, g.Kind, g.Scope
+	})
+}
+
+func (r recording) AddMembers(group ldapx.DN, members ...ldapx.DN) error {
+	return r.group(group, "add-members", func() error { return r.Client.AddMembers(group, members...) }, func(a *Group) {
+		a.Members = append(a.Members, members...)
+	})
+}
+
+func (r recording) RemoveMembers(group ldapx.DN, members ...ldapx.DN) error {
+	return r.group(group, "remove-members", func() error { return r.Client.RemoveMembers(group, members...) }, func(a *Group) {
+		kept := a.Members[:0]
+		for _, m := range a.Members {
+			if !containsDN(members, m) {
+				kept = append(kept, m)
+			}
+		}
+		a.Members = kept
+	})
+}
+
+func containsDN(list []ldapx.DN, dn ldapx.DN) bool {
+	for _, d := range list {
+		if d.Equal(dn) {
+			return true
+		}
+	}
+	return false
+}
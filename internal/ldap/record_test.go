@@ -0,0 +1,118 @@
+package ldap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/change"
+	"github.com/Weruminger/go-ad-admin/internal/config"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/ldap/ldaptest"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+)
+
+func TestRecording(t *testing.T) {
+	srv := ldaptest.NewServer(testBase)
+	defer srv.Close()
+	dn := seedAnna(t, srv)
+	var got []change.Record
+	c := Recording(newTestConn(t, srv, func(cfg *config.Config) { cfg.LDAPStartTLS = true }),
+		change.RecorderFunc(func(r change.Record) error { got = append(got, r); return nil }))
+
+	if err := c.DisableUser(dn); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ResetPassword(dn, "Secr3t!", true); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("records %+v", got)
+	}
+	if r := got[0]; r.Op() != "aduser.disable" || r.ID != dn.String() || len(r.Diff) != 1 ||
+		r.Diff[0].Path != "enabled" || r.Diff[0].Old != true || r.Diff[0].New != false {
+		t.Fatalf("disable %+v", r)
+	}
+	r := got[1]
+	if r.Op() != "aduser.reset-password" || strings.Contains(r.After, "Secr3t!") || !strings.Contains(r.After, change.Redacted) {
+		t.Fatalf("reset %+v", r)
+	}
+	paths := map[string]any{}
+	for _, f := range r.Diff {
+		paths[f.Path] = f.New
+	}
+	if paths["password"] != change.Redacted || paths["mustChangePassword"] != true {
+		t.Fatalf("reset diff %+v", r.Diff)
+	}
+
+	missing := ldapx.MustParseDN(srv.UsersDN()).Child("CN", "Nobody")
+	if err := c.UnlockUser(missing); !errs.IsCode(err, errs.NotFound) || len(got) != 2 {
+		t.Fatalf("failed write: %v, %d records", err, len(got))
+	}
+}
+
+// unreadable fails every user and group lookup and counts the writes that
+// reach the directory.
+type unreadable struct {
+	Client
+	writes int
+}
+
+func (u *unreadable) GetUser(dn ldapx.DN) (User, error) {
+	return User{}, errs.New("ldap.GetUser", errs.Unavailable, errors.New("connection reset"), nil)
+}
+
+func (u *unreadable) GetGroup(dn ldapx.DN) (Group, error) {
+	return Group{}, errs.New("ldap.GetGroup", errs.Unavailable, errors.New("connection reset"), nil)
+}
+
+func (u *unreadable) DisableUser(dn ldapx.DN) error {
+	u.writes++
+	return u.Client.DisableUser(dn)
+}
+
+func (u *unreadable) DeleteUser(dn ldapx.DN) error {
+	u.writes++
+	return u.Client.DeleteUser(dn)
+}
+
+func (u *unreadable) ResetPassword(dn ldapx.DN, password string, mustChange bool) error {
+	u.writes++
+	return u.Client.ResetPassword(dn, password, mustChange)
+}
+
+func (u *unreadable) AddMembers(group ldapx.DN, members ...ldapx.DN) error {
+	u.writes++
+	return u.Client.AddMembers(group, members...)
+}
+
+func TestRecording_BeforeStateUnreadable(t *testing.T) {
+	srv := ldaptest.NewServer(testBase)
+	defer srv.Close()
+	dn := seedAnna(t, srv)
+	group := ldapx.MustParseDN("CN=Staff," + srv.UsersDN())
+	if err := srv.AddGroup(group.String()); err != nil {
+		t.Fatal(err)
+	}
+	dir := &unreadable{Client: newTestConn(t, srv, func(cfg *config.Config) { cfg.LDAPStartTLS = true })}
+	var got []change.Record
+	c := Recording(dir, change.RecorderFunc(func(r change.Record) error { got = append(got, r); return nil }))
+
+	writes := map[string]func() error{
+		"disable": func() error { return c.DisableUser(dn) },
+		"delete":  func() error { return c.DeleteUser(dn) },
+		"reset":   func() error { return c.ResetPassword(dn, "Secr3t!", false) },
+		"members": func() error { return c.AddMembers(group, dn) },
+	}
+	for name, write := range writes {
+		if err := write(); !errs.IsCode(err, errs.Unavailable) {
+			t.Errorf("%s: want the lookup error, got %v", name, err)
+		}
+	}
+	if dir.writes != 0 || len(got) != 0 {
+		t.Fatalf("%d writes sent, %d records", dir.writes, len(got))
+	}
+	if e, ok := srv.Get(dn.String()); !ok || e.First("userAccountControl") != "66048" {
+		t.Fatalf("anna changed: %+v", e)
+	}
+}
@@ -0,0 +1,258 @@
+package ldap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Weruminger/go-ad-admin/internal/domain"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+)
+
+// Store is a modelx.Store for domain.ADUser and domain.ADGroup backed by the
+// directory, so the usual Load/modify/Save flow works against AD:
+//
+//	u := domain.NewADUser(base).Load(ctx, ldap.URI(dn))
+//	u.Enabled = false
+//	u.Save(ctx, ldap.URI(dn), "json")
+//
+// Save creates missing objects and otherwise applies only what differs from
+// the directory. Passwords never travel through the store; use
+// Client.ResetPassword.
+type Store struct {
+	Client Client
+}
+
+// URI is the store address of the object at dn.
+func URI(dn ldapx.DN) string { return "ldap:///" + url.PathEscape(dn.String()) }
+
+func (Store) Scheme() string { return "ldap" }
+
+// Load returns the user or group at uri as JSON with kind ADUser or ADGroup.
+func (s Store) Load(ctx context.Context, uri string) ([]byte, error) {
+	dn, err := dnFromURI(uri)
+	if err != nil {
+		return nil, errs.New("ldap.Store.Load", errs.InvalidInput, err, map[string]any{"uri": uri})
+	}
+	u, err := s.Client.GetUser(dn)
+	if errs.IsCode(err, errs.NotFound) {
+		g, gerr := s.Client.GetGroup(dn)
+		if gerr != nil {
+			return nil, gerr
+		}
+		return json.Marshal(domainGroup(g))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(DomainUser(u))
+}
+
+// DomainUser is the domain form of u, as the Store and the audit log show it.
+func DomainUser(u User) *domain.ADUser {
+	return &domain.ADUser{
+		Kind:         "ADUser",
+		Version:      "v1",
+		SAM:          u.UID,
+		UPN:          u.UPN,
+		DN:           u.DN.String(),
+		Display:      u.Name,
+		Mail:         u.Mail,
+		Enabled:      u.Enabled,
+		Locked:       u.Locked,
+		MustChangePW: u.MustChangePassword,
+		ExpiresAt:    u.ExpiresAt,
+	}
+}
+
+// domainGroup is the domain form of g.
+func domainGroup(g Group) *domain.ADGroup {
+	return &domain.ADGroup{
+		Kind:        "ADGroup",
+		Version:     "v1",
+		Name:        g.Name,
+		DN:          g.DN.String(),
+		Description: g.Description,
+		Mail:        g.Mail,
+		Type:        string(g.Kind),
+		Scope:       string(g.Scope),
+		Members:     dnStrings(g.Members),
+	}
+}
+
+// Save accepts the JSON or YAML encoding of a domain.ADUser or
+// domain.ADGroup, told apart by its kind. The DN comes from uri; a dn field
+// in data is ignored.
+func (s Store) Save(ctx context.Context, uri string, data []byte) error {
+	op := errs.Op("ldap.Store.Save")
+	dn, err := dnFromURI(uri)
+	if err != nil {
+		return errs.New(op, errs.InvalidInput, err, map[string]any{"uri": uri})
+	}
+	var head struct {
+		Kind string `json:"kind" yaml:"kind"`
+	}
+	if err := decode(data, &head); err != nil {
+		return errs.New(op, errs.InvalidInput, err, nil)
+	}
+	switch head.Kind {
+	case "ADUser":
+		var want domain.ADUser
+		if err := decode(data, &want); err != nil {
+			return errs.New(op, errs.InvalidInput, err, nil)
+		}
+		return s.saveUser(op, dn, want)
+	case "ADGroup":
+		var want domain.ADGroup
+		if err := decode(data, &want); err != nil {
+			return errs.New(op, errs.InvalidInput, err, nil)
+		}
+		return s.saveGroup(dn, want)
+	}
+	return errs.New(op, errs.InvalidInput, fmt.Errorf("unsupported kind %q", head.Kind), map[string]any{"field": "kind"})
+}
+
+func (s Store) saveUser(op errs.Op, dn ldapx.DN, want domain.ADUser) error {
+	attrs := User{DN: dn, UID: want.SAM, UPN: want.UPN, Name: want.Display, Mail: want.Mail}
+
+	cur, err := s.Client.GetUser(dn)
+	exists := err == nil
+	if err != nil && !errs.IsCode(err, errs.NotFound) {
+		return err
+	}
+	// Refusals come before the first write, so a failed Save changes nothing.
+	if want.Locked && !cur.Locked {
+		return errs.New(op, errs.InvalidInput, errors.New("locked: accounts can only be unlocked"), map[string]any{"field": "locked"})
+	}
+	switch {
+	case !exists:
+		if err := s.Client.CreateUser(attrs); err != nil {
+			return err
+		}
+		if cur, err = s.Client.GetUser(dn); err != nil {
+			return err
+		}
+	case cur.UID != attrs.UID || cur.UPN != attrs.UPN || cur.Name != attrs.Name || cur.Mail != attrs.Mail:
+		if err := s.Client.UpdateUser(attrs); err != nil {
+			return err
+		}
+	}
+
+	if cur.Locked && !want.Locked {
+		if err := s.Client.UnlockUser(dn); err != nil {
+			return err
+		}
+	}
+	if !sameTime(cur.ExpiresAt, want.ExpiresAt) {
+		if err := s.Client.SetExpiry(dn, want.ExpiresAt); err != nil {
+			return err
+		}
+	}
+	if cur.MustChangePassword != want.MustChangePW {
+		if err := s.Client.RequirePasswordChange(dn, want.MustChangePW); err != nil {
+			return err
+		}
+	}
+	// Enabling last: AD checks the password policy at that point.
+	if cur.Enabled != want.Enabled {
+		if want.Enabled {
+			return s.Client.EnableUser(dn)
+		}
+		return s.Client.DisableUser(dn)
+	}
+	return nil
+}
+
+func (s Store) saveGroup(dn ldapx.DN, want domain.ADGroup) error {
+	g := Group{DN: dn, Name: want.Name, Description: want.Description, Mail: want.Mail,
+		Kind: GroupKind(want.Type), Scope: GroupScope(want.Scope)}
+	for _, m := range want.Members {
+		md, err := ldapx.ParseDN(m)
+		if err != nil {
+			return errs.New("ldap.Store.Save", errs.InvalidInput, err, map[string]any{"field": "members"})
+		}
+		g.Members = append(g.Members, md)
+	}
+
+	cur, err := s.Client.GetGroup(dn)
+	switch {
+	case errs.IsCode(err, errs.NotFound):
+		return s.Client.CreateGroup(g)
+	case err != nil:
+		return err
+	case cur.Name != g.Name || cur.Description != g.Description || cur.Mail != g.Mail || cur.Kind != g.Kind || cur.Scope != g.Scope:
+		if err := s.Client.UpdateGroup(g); err != nil {
+			return err
+		}
+	}
+	add, del := diffDNs(cur.Members, g.Members)
+	if err := s.Client.RemoveMembers(dn, del...); err != nil {
+		return err
+	}
+	return s.Client.AddMembers(dn, add...)
+}
+
+// diffDNs returns the DNs in want but not in have, and those in have but not
+// in want.
+func diffDNs(have, want []ldapx.DN) (add, del []ldapx.DN) {
+	in := func(dn ldapx.DN, set []ldapx.DN) bool {
+		for _, d := range set {
+			if d.Equal(dn) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, d := range want {
+		if !in(d, have) && !in(d, add) {
+			add = append(add, d)
+		}
+	}
+	for _, d := range have {
+		if !in(d, want) {
+			del = append(del, d)
+		}
+	}
+	return add, del
+}
+
+// decode reads JSON or YAML, whichever data looks like.
+func decode(data []byte, v any) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return json.Unmarshal(data, v)
+	}
+	return yaml.Unmarshal(data, v)
+}
+
+func dnFromURI(uri string) (ldapx.DN, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ldapx.DN{}, err
+	}
+	if !strings.EqualFold(u.Scheme, "ldap") || u.Host != "" {
+		return ldapx.DN{}, fmt.Errorf("want ldap:///<dn>, got %q", uri)
+	}
+	dn, err := ldapx.ParseDN(strings.TrimPrefix(u.Path, "/"))
+	if err != nil {
+		return ldapx.DN{}, err
+	}
+	if dn.IsZero() {
+		return ldapx.DN{}, fmt.Errorf("empty dn in %q", uri)
+	}
+	return dn, nil
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
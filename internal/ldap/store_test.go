@@ -0,0 +1,101 @@
+package ldap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Weruminger/go-ad-admin/internal/config"
+	"github.com/Weruminger/go-ad-admin/internal/domain"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/ldap/ldaptest"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+	"github.com/Weruminger/go-ad-admin/internal/modelx"
+)
+
+func TestStore_UserLoadModifySave(t *testing.T) {
+	srv := ldaptest.NewServer(testBase)
+	defer srv.Close()
+	dn := seedAnna(t, srv)
+	c := newTestConn(t, srv, func(cfg *config.Config) { cfg.LDAPStartTLS = true })
+	base := modelx.NewBase("json", []modelx.Codec{modelx.JSON{}, modelx.YAML{}}, []modelx.Store{Store{Client: c}})
+	ctx := context.Background()
+
+	u := domain.NewADUser(base).Load(ctx, URI(dn))
+	if u.Err() != nil {
+		t.Fatalf("load: %v", u.Err())
+	}
+	if u.SAM != "anna" || u.Display != "Anna Smith" || !u.Enabled || u.DN != dn.String() {
+		t.Fatalf("loaded %+v", u)
+	}
+
+	at := time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC)
+	u.Enabled = false
+	u.Mail = "anna@example.com"
+	u.ExpiresAt = &at
+	u.MustChangePW = true
+	if u.Save(ctx, URI(dn), "yaml"); u.Err() != nil {
+		t.Fatalf("save: %v", u.Err())
+	}
+
+	got, err := c.GetUser(dn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Enabled || got.Mail != "anna@example.com" || got.ExpiresAt == nil || !got.ExpiresAt.Equal(at) || !got.MustChangePassword {
+		t.Fatalf("directory state %+v", got)
+	}
+	if got.Name != "Anna Smith" || got.UPN != "anna@example.com" {
+		t.Fatalf("unchanged attributes lost: %+v", got)
+	}
+
+	again := domain.NewADUser(base).Load(ctx, URI(dn))
+	if again.Err() != nil || again.Enabled || again.ExpiresAt == nil {
+		t.Fatalf("reload %+v %v", again, again.Err())
+	}
+}
+
+func TestStore_UserCreateAndLockRules(t *testing.T) {
+	srv := ldaptest.NewServer(testBase)
+	defer srv.Close()
+	c := newTestConn(t, srv, nil)
+	base := modelx.NewBase("json", []modelx.Codec{modelx.JSON{}}, []modelx.Store{Store{Client: c}})
+	ctx := context.Background()
+	dn := ldapx.MustParseDN(srv.UsersDN()).Child("CN", "Smith, Bob")
+
+	// refused before anything is written
+	locked := domain.NewADUser(base)
+	locked.SAM, locked.UPN, locked.Display, locked.Locked = "bob", "bob@example.com", "Bob Smith", true
+	if locked.Save(ctx, URI(dn), "json"); !errs.IsCode(locked.Err(), errs.InvalidInput) {
+		t.Fatalf("creating a locked user must be refused, got %v", locked.Err())
+	}
+	if _, ok := srv.Get(dn.String()); ok {
+		t.Fatal("refused save created the user")
+	}
+
+	u := domain.NewADUser(base)
+	u.SAM, u.UPN, u.Display, u.Enabled = "bob", "bob@example.com", "Bob Smith", false
+	if u.Save(ctx, URI(dn), "json"); u.Err() != nil {
+		t.Fatalf("create: %v", u.Err())
+	}
+	if e, ok := srv.Get(dn.String()); !ok || e.First("userAccountControl") != "514" {
+		t.Fatalf("created entry %+v", e)
+	}
+
+	u.Locked = true
+	if u.Save(ctx, URI(dn), "json"); !errs.IsCode(u.Err(), errs.InvalidInput) {
+		t.Fatalf("locking must be refused, got %v", u.Err())
+	}
+	// the error stays with u; objects built from base later start clean
+	if got := domain.NewADUser(base).Load(ctx, "ldap://dc1/"+dn.String()); !errs.IsCode(got.Err(), errs.InvalidInput) {
+		t.Fatalf("uri with host: got %v", got.Err())
+	}
+}
+
+func TestURI_RoundTrip(t *testing.T) {
+	dn := ldapx.MustParseDN(`CN=a/b\, c?#%,OU=x,DC=example,DC=com`)
+	got, err := dnFromURI(URI(dn))
+	if err != nil || !got.Equal(dn) {
+		t.Fatalf("%s -> %s -> %v %v", dn, URI(dn), got, err)
+	}
+}
@@ -0,0 +1,101 @@
+package ldap
+
+import (
+	"fmt"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+)
+
+// parseAllowed turns the configured OU whitelist into DNs below base. OUs
+// nested in another listed OU are dropped so searches do not return
+// duplicates.
+func parseAllowed(base ldapx.DN, ous []string) ([]ldapx.DN, error) {
+	var dns []ldapx.DN
+	for _, s := range ous {
+		dn, err := ldapx.ParseDN(s)
+		if err != nil {
+			return nil, err
+		}
+		if dn.IsZero() || !dn.Within(base) {
+			return nil, fmt.Errorf("allowed OU %q is not below base DN %q", s, base)
+		}
+		dns = append(dns, dn)
+	}
+	var out []ldapx.DN
+	for i, dn := range dns {
+		nested := false
+		for j, other := range dns {
+			if i != j && dn.Within(other) && (!dn.Equal(other) || j < i) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			out = append(out, dn)
+		}
+	}
+	return out, nil
+}
+
+// visible reports whether dn lies in one of the permitted subtrees.
+func (c *Conn) visible(dn ldapx.DN) bool {
+	for _, ou := range c.allowed {
+		if dn.Within(ou) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWrite rejects writes to objects outside the delegation. The permitted
+// OUs themselves are not writable, only what lies below them.
+func (c *Conn) checkWrite(op errs.Op, dn ldapx.DN) error {
+	for _, ou := range c.allowed {
+		if dn.Within(ou) && !dn.Equal(ou) {
+			return nil
+		}
+	}
+	return errs.New(op, errs.Forbidden, fmt.Errorf("%s is outside the permitted OUs", dn), map[string]any{"dn": dn.String()})
+}
+
+// checkTarget rejects moves into a container outside the delegation; unlike
+// checkWrite the permitted OU itself is a valid parent.
+func (c *Conn) checkTarget(op errs.Op, parent ldapx.DN) error {
+	if c.visible(parent) {
+		return nil
+	}
+	return errs.New(op, errs.Forbidden, fmt.Errorf("%s is outside the permitted OUs", parent), map[string]any{"dn": parent.String()})
+}
+
+// searchAllowed runs a subtree search in every permitted OU and concatenates
+// the results, stopping at limit (0 = unlimited). Callers must run inside c.do.
+func (c *Conn) searchAllowed(lc *goldap.Conn, filter string, attrs []string, limit int) ([]*goldap.Entry, error) {
+	var out []*goldap.Entry
+	for _, base := range c.allowed {
+		left := 0
+		if limit > 0 {
+			if left = limit - len(out); left <= 0 {
+				return out, nil
+			}
+		}
+		req := goldap.NewSearchRequest(base.String(), goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, left, int(c.cfg.LDAPTimeout/time.Second), false,
+			filter, attrs, nil)
+		res, err := lc.Search(req)
+		if res != nil {
+			out = append(out, res.Entries...)
+		}
+		switch {
+		case goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded):
+			return out, nil
+		case goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject):
+			// a permitted OU that does not exist (yet) is simply empty
+		case err != nil:
+			return out, err
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,162 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/config"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/ldap/ldaptest"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+)
+
+// delegatedDir has users in OU=Staff, OU=Guests and CN=Users; only the two
+// OUs are delegated.
+func delegatedDir(t *testing.T) (*ldaptest.Server, *Conn) {
+	t.Helper()
+	srv := ldaptest.NewServer(testBase)
+	t.Cleanup(srv.Close)
+	for _, ou := range []string{"Staff", "Guests"} {
+		if err := srv.Add("OU="+ou+","+testBase, map[string][]string{"objectClass": {"top", "organizationalUnit"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := srv.SeedTable([][]string{
+		{"dn", "uid", "displayName"},
+		{"CN=Anna,OU=Staff," + testBase, "anna", "Anna"},
+		{"CN=Bert,OU=Staff," + testBase, "bert", "Bert"},
+		{"CN=Gina,OU=Guests," + testBase, "gina", "Gina"},
+		{"CN=Root,CN=Users," + testBase, "root", "Root"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestConn(t, srv, func(cfg *config.Config) {
+		cfg.LDAPAllowedOUs = map[string][]string{
+			cfg.Env: {"OU=Staff," + testBase, "ou=guests,dc=example,dc=com", "CN=Anna,OU=Staff," + testBase},
+			"prod":  {"CN=Users," + testBase},
+		}
+	})
+	return srv, c
+}
+
+func TestNewConn_AllowedOUsMustBeBelowBase(t *testing.T) {
+	cfg := *config.NewDefaultConfig()
+	cfg.LDAPBaseDN = testBase
+	for _, ous := range [][]string{{"OU=Staff,DC=other,DC=com"}, {"not a dn"}, {""}} {
+		cfg.LDAPAllowedOUs = map[string][]string{cfg.Env: ous}
+		if _, err := NewConn(cfg); !errs.IsCode(err, errs.InvalidInput) {
+			t.Errorf("%q: want INVALID_INPUT, got %v", ous, err)
+		}
+	}
+}
+
+func TestWhitelist_ScopesReads(t *testing.T) {
+	_, c := delegatedDir(t)
+	got, err := c.SearchUsers(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].UID != "anna" || got[2].UID != "gina" {
+		t.Fatalf("want anna, bert, gina once each, got %+v", got)
+	}
+	if got, _ := c.SearchUsers(nil, 2); len(got) != 2 {
+		t.Fatalf("limit across OUs: got %d", len(got))
+	}
+	root := ldapx.MustParseDN("CN=Root,CN=Users," + testBase)
+	if _, err := c.GetUser(root); !errs.IsCode(err, errs.NotFound) {
+		t.Fatalf("user outside delegation: want NOT_FOUND, got %v", err)
+	}
+
+	var seen []string
+	cursor := ""
+	for i := 0; ; i++ {
+		p, err := c.SearchUsersPage(nil, 2, cursor)
+		if err != nil {
+			t.Fatalf("page %d: %v", i+1, err)
+		}
+		for _, u := range p.Users {
+			seen = append(seen, u.UID)
+		}
+		if p.Next == "" {
+			break
+		}
+		cursor = p.Next
+	}
+	if len(seen) != 3 || seen[2] != "gina" {
+		t.Fatalf("paged across OUs: %v", seen)
+	}
+}
+
+func TestWhitelist_GuardsWrites(t *testing.T) {
+	srv, c := delegatedDir(t)
+	root := ldapx.MustParseDN("CN=Root,CN=Users," + testBase)
+	staff := ldapx.MustParseDN("OU=Staff," + testBase)
+	anna := staff.Child("CN", "Anna")
+
+	forbidden := func(name string, err error, dn ldapx.DN) {
+		t.Helper()
+		var e *errs.E
+		if !errs.IsCode(err, errs.Forbidden) || !errors.As(err, &e) || e.Fields["dn"] != dn.String() {
+			t.Errorf("%s: want FORBIDDEN with dn %s, got %v", name, dn, err)
+		}
+	}
+	forbidden("create outside", c.CreateUser(User{DN: root.Parent().Child("CN", "New"), UID: "new"}), root.Parent().Child("CN", "New"))
+	forbidden("create OU itself", c.CreateUser(User{DN: staff, UID: "ou"}), staff)
+	forbidden("disable", c.DisableUser(root), root)
+	forbidden("enable", c.EnableUser(root), root)
+	forbidden("unlock", c.UnlockUser(root), root)
+	forbidden("update", c.UpdateUser(User{DN: root, UID: "root"}), root)
+	forbidden("expiry", c.SetExpiry(root, nil), root)
+	forbidden("must change", c.RequirePasswordChange(root, true), root)
+	forbidden("reset", c.ResetPassword(root, "x", false), root)
+	forbidden("delete", c.DeleteUser(root), root)
+	_, err := c.MoveUser(root, staff)
+	forbidden("move from outside", err, root)
+	_, err = c.MoveUser(anna, root.Parent())
+	forbidden("move to outside", err, root.Parent())
+	if e, _ := srv.Get(root.String()); e.First("userAccountControl") != "512" {
+		t.Fatal("entry outside delegation was modified")
+	}
+
+	if err := c.CreateUser(User{DN: staff.Child("CN", "Carl"), UID: "carl"}); err != nil {
+		t.Fatalf("create inside: %v", err)
+	}
+	moved, err := c.MoveUser(anna, ldapx.MustParseDN("OU=Guests,"+testBase))
+	if err != nil {
+		t.Fatalf("move inside: %v", err)
+	}
+	if moved.String() != "CN=Anna,OU=Guests,"+testBase {
+		t.Fatalf("moved to %s", moved)
+	}
+	if _, ok := srv.Get(moved.String()); !ok {
+		t.Fatal("moved entry missing")
+	}
+	if err := c.DeleteUser(moved); err != nil {
+		t.Fatalf("delete inside: %v", err)
+	}
+	if _, ok := srv.Get(moved.String()); ok {
+		t.Fatal("entry not deleted")
+	}
+	if err := c.DeleteUser(staff.Child("CN", "Ghost")); !errs.IsCode(err, errs.NotFound) {
+		t.Fatalf("delete missing: want NOT_FOUND, got %v", err)
+	}
+}
+
+func TestWhitelist_EmptyDeniesEverything(t *testing.T) {
+	srv := ldaptest.NewServer(testBase)
+	defer srv.Close()
+	if err := srv.SeedTable([][]string{{"uid"}, {"anna"}}); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestConn(t, srv, func(cfg *config.Config) { cfg.LDAPAllowedOUs = nil })
+	if got, err := c.SearchUsers(nil, 0); err != nil || len(got) != 0 {
+		t.Fatalf("search without delegation: %v %v", got, err)
+	}
+	if p, err := c.SearchUsersPage(nil, 10, ""); err != nil || len(p.Users) != 0 || p.Next != "" {
+		t.Fatalf("page without delegation: %+v %v", p, err)
+	}
+	dn := ldapx.MustParseDN(srv.UsersDN()).Child("CN", "new")
+	if err := c.CreateUser(User{DN: dn, UID: "new"}); !errs.IsCode(err, errs.Forbidden) {
+		t.Fatalf("want FORBIDDEN, got %v", err)
+	}
+}
@@ -0,0 +1,315 @@
+package ldapx
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AVA is one attribute=value pair of an RDN. Value is unescaped.
+type AVA struct {
+	Type  string
+	Value string
+}
+
+// RDN is a relative distinguished name; more than one AVA makes it
+// multi-valued (a+b=c).
+type RDN []AVA
+
+// DN is a parsed distinguished name, most specific RDN first. The zero value
+// is the empty (root) DN.
+type DN struct {
+	rdns []RDN
+}
+
+// ParseDN parses an RFC 4514 string representation.
+func ParseDN(s string) (DN, error) {
+	p := &dnParser{s: s}
+	rdns, err := p.parse()
+	if err != nil {
+		return DN{}, fmt.Errorf("dn %q: %w", s, err)
+	}
+	return DN{rdns: rdns}, nil
+}
+
+// MustParseDN is ParseDN for constants; it panics on error.
+func MustParseDN(s string) DN {
+	d, err := ParseDN(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// NewDN builds a DN from single-valued RDNs given as type, value pairs.
+func NewDN(typeValue ...string) DN {
+	var d DN
+	for i := 0; i+1 < len(typeValue); i += 2 {
+		d.rdns = append(d.rdns, RDN{{Type: typeValue[i], Value: typeValue[i+1]}})
+	}
+	return d
+}
+
+// IsZero reports whether d is the empty DN.
+func (d DN) IsZero() bool { return len(d.rdns) == 0 }
+
+// Len is the number of RDNs.
+func (d DN) Len() int { return len(d.rdns) }
+
+// RDN returns the most specific RDN, nil for the empty DN.
+func (d DN) RDN() RDN {
+	if len(d.rdns) == 0 {
+		return nil
+	}
+	return d.rdns[0]
+}
+
+// RDNs returns a copy of all RDNs.
+func (d DN) RDNs() []RDN { return append([]RDN(nil), d.rdns...) }
+
+// Parent drops the most specific RDN.
+func (d DN) Parent() DN {
+	if len(d.rdns) == 0 {
+		return d
+	}
+	return DN{rdns: d.rdns[1:]}
+}
+
+// Child returns attr=value,d.
+func (d DN) Child(attr, value string) DN {
+	rdns := make([]RDN, 0, len(d.rdns)+1)
+	rdns = append(rdns, RDN{{Type: attr, Value: value}})
+	return DN{rdns: append(rdns, d.rdns...)}
+}
+
+// Equal compares case-insensitively, ignoring AVA order in multi-valued RDNs.
+func (d DN) Equal(o DN) bool { return d.Norm() == o.Norm() }
+
+// Within reports whether d equals base or lies below it.
+func (d DN) Within(base DN) bool {
+	if len(base.rdns) > len(d.rdns) {
+		return false
+	}
+	off := len(d.rdns) - len(base.rdns)
+	for i, r := range base.rdns {
+		if normRDN(r) != normRDN(d.rdns[off+i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Rebase moves d from below from to below to, keeping the relative part.
+func (d DN) Rebase(from, to DN) (DN, error) {
+	if !d.Within(from) {
+		return DN{}, fmt.Errorf("%s is not below %s", d, from)
+	}
+	rel := d.rdns[:len(d.rdns)-len(from.rdns)]
+	rdns := make([]RDN, 0, len(rel)+len(to.rdns))
+	rdns = append(rdns, rel...)
+	return DN{rdns: append(rdns, to.rdns...)}, nil
+}
+
+// String renders d per RFC 4514, keeping the original spelling.
+func (d DN) String() string {
+	parts := make([]string, len(d.rdns))
+	for i, r := range d.rdns {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// Norm is the canonical form used for comparisons and map keys: lower-case
+// types and values, sorted multi-valued RDNs, minimal escaping.
+func (d DN) Norm() string {
+	parts := make([]string, len(d.rdns))
+	for i, r := range d.rdns {
+		parts[i] = normRDN(r)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (r RDN) String() string {
+	parts := make([]string, len(r))
+	for i, a := range r {
+		parts[i] = a.Type + "=" + EscapeDNValue(a.Value)
+	}
+	return strings.Join(parts, "+")
+}
+
+func normRDN(r RDN) string {
+	parts := make([]string, len(r))
+	for i, a := range r {
+		parts[i] = strings.ToLower(strings.TrimSpace(a.Type)) + "=" + EscapeDNValue(strings.ToLower(a.Value))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "+")
+}
+
+// MarshalText lets DNs appear as plain strings in JSON/YAML.
+func (d DN) MarshalText() ([]byte, error) { return []byte(d.String()), nil }
+
+// UnmarshalText parses the string form.
+func (d *DN) UnmarshalText(b []byte) error {
+	p, err := ParseDN(string(b))
+	if err != nil {
+		return err
+	}
+	*d = p
+	return nil
+}
+
+// EscapeDNValue escapes an attribute value for use in a DN string.
+func EscapeDNValue(v string) string {
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		switch {
+		case c == 0:
+			b.WriteString(`\00`)
+			continue
+		case strings.IndexByte(`"+,;<>\`, c) >= 0,
+			i == 0 && (c == ' ' || c == '#'),
+			i == len(v)-1 && c == ' ':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+type dnParser struct {
+	s   string
+	pos int
+}
+
+func (p *dnParser) parse() ([]RDN, error) {
+	if strings.TrimSpace(p.s) == "" {
+		return nil, nil
+	}
+	var (
+		rdns []RDN
+		cur  RDN
+	)
+	for {
+		ava, sep, err := p.ava()
+		if err != nil {
+			return nil, err
+		}
+		cur = append(cur, ava)
+		switch sep {
+		case '+':
+			continue
+		case ',', ';':
+			rdns = append(rdns, cur)
+			cur = nil
+		case 0:
+			return append(rdns, cur), nil
+		}
+	}
+}
+
+func (p *dnParser) ava() (AVA, byte, error) {
+	eq := -1
+	for i := p.pos; i < len(p.s); i++ {
+		if p.s[i] == '=' {
+			eq = i
+			break
+		}
+		if strings.IndexByte(",+;", p.s[i]) >= 0 {
+			break
+		}
+	}
+	if eq < 0 {
+		return AVA{}, 0, fmt.Errorf("missing '=' at offset %d", p.pos)
+	}
+	typ := strings.TrimSpace(p.s[p.pos:eq])
+	if err := checkAttr(typ); err != nil {
+		return AVA{}, 0, err
+	}
+	p.pos = eq + 1
+	val, sep, err := p.value()
+	if err != nil {
+		return AVA{}, 0, err
+	}
+	if val == "" {
+		return AVA{}, 0, fmt.Errorf("empty value for %s", typ)
+	}
+	return AVA{Type: typ, Value: val}, sep, nil
+}
+
+// value reads up to the next unescaped separator, trimming unescaped
+// surrounding spaces. "#hex" values are decoded to their raw bytes.
+func (p *dnParser) value() (string, byte, error) {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+	if p.pos < len(p.s) && p.s[p.pos] == '#' {
+		start := p.pos + 1
+		for p.pos++; p.pos < len(p.s) && strings.IndexByte(",+; ", p.s[p.pos]) < 0; p.pos++ {
+		}
+		raw, err := hex.DecodeString(p.s[start:p.pos])
+		if err != nil {
+			return "", 0, fmt.Errorf("bad hex value: %w", err)
+		}
+		sep, err := p.sep()
+		return string(raw), sep, err
+	}
+	var (
+		b    []byte
+		keep int // length of b up to the last escaped or non-space byte
+	)
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c == '\\':
+			if p.pos+1 >= len(p.s) {
+				return "", 0, fmt.Errorf("dangling escape")
+			}
+			n := p.s[p.pos+1]
+			if strings.IndexByte(`"+,;<>\ #=`, n) >= 0 {
+				b = append(b, n)
+				p.pos += 2
+			} else if p.pos+2 < len(p.s) && isHex(n) && isHex(p.s[p.pos+2]) {
+				x, _ := hex.DecodeString(p.s[p.pos+1 : p.pos+3])
+				b = append(b, x[0])
+				p.pos += 3
+			} else {
+				return "", 0, fmt.Errorf("invalid escape at offset %d", p.pos)
+			}
+			keep = len(b)
+		case strings.IndexByte(",+;", c) >= 0:
+			p.pos++
+			return string(b[:keep]), c, nil
+		case c == '"':
+			return "", 0, fmt.Errorf("quoted values are not supported")
+		default:
+			b = append(b, c)
+			if c != ' ' {
+				keep = len(b)
+			}
+			p.pos++
+		}
+	}
+	return string(b[:keep]), 0, nil
+}
+
+func (p *dnParser) sep() (byte, error) {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+	if p.pos >= len(p.s) {
+		return 0, nil
+	}
+	c := p.s[p.pos]
+	if strings.IndexByte(",+;", c) < 0 {
+		return 0, fmt.Errorf("unexpected %q at offset %d", c, p.pos)
+	}
+	p.pos++
+	return c, nil
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,143 @@
+package ldapx
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseDN_RoundTrip(t *testing.T) {
+	cases := []struct {
+		in, str string
+		rdn0    string // unescaped value of the first AVA
+	}{
+		{"CN=Anna Smith,CN=Users,DC=example,DC=com", "CN=Anna Smith,CN=Users,DC=example,DC=com", "Anna Smith"},
+		{`CN=Smith\, Anna,OU=Staff,DC=example,DC=com`, `CN=Smith\, Anna,OU=Staff,DC=example,DC=com`, "Smith, Anna"},
+		{` cn = x , dc = com `, "cn=x,dc=com", "x"},
+		{`CN=\ lead\ ,DC=com`, `CN=\ lead\ ,DC=com`, " lead "},
+		{`CN=\#hash,DC=com`, `CN=\#hash,DC=com`, "#hash"},
+		{`CN=J\C3\BCrgen,DC=com`, "CN=Jürgen,DC=com", "Jürgen"},
+		{`CN=a\+b\;c\<d\>e\"f\\g,DC=com`, `CN=a\+b\;c\<d\>e\"f\\g,DC=com`, `a+b;c<d>e"f\g`},
+		{"CN=#616263,DC=com", "CN=abc,DC=com", "abc"},
+		{"OU=a;DC=com", "OU=a,DC=com", "a"},
+		{"CN=x=y,DC=com", "CN=x=y,DC=com", "x=y"},
+	}
+	for _, c := range cases {
+		d, err := ParseDN(c.in)
+		if err != nil {
+			t.Errorf("%q: %v", c.in, err)
+			continue
+		}
+		if d.String() != c.str {
+			t.Errorf("%q: String() = %q want %q", c.in, d.String(), c.str)
+		}
+		if v := d.RDN()[0].Value; v != c.rdn0 {
+			t.Errorf("%q: value %q want %q", c.in, v, c.rdn0)
+		}
+		again, err := ParseDN(d.String())
+		if err != nil || !again.Equal(d) {
+			t.Errorf("%q: round trip %v %v", c.in, again, err)
+		}
+	}
+}
+
+func TestParseDN_Errors(t *testing.T) {
+	for _, in := range []string{
+		"CN=,DC=com",
+		"CN",
+		"=x,DC=com",
+		"CN=a,,DC=com",
+		`CN=a\`,
+		`CN=a\zz`,
+		`CN="quoted"`,
+		"C N=a",
+		"CN=#zz",
+		"CN=#6162 x",
+	} {
+		if _, err := ParseDN(in); err == nil {
+			t.Errorf("%q: expected error", in)
+		}
+	}
+	if d, err := ParseDN(""); err != nil || !d.IsZero() {
+		t.Fatalf("empty DN: %v %v", d, err)
+	}
+}
+
+func TestDN_MultiValuedRDN(t *testing.T) {
+	a := MustParseDN("CN=x+UID=1,DC=com")
+	if len(a.RDN()) != 2 || a.String() != "CN=x+UID=1,DC=com" {
+		t.Fatalf("got %v", a.RDNs())
+	}
+	if !a.Equal(MustParseDN("uid=1+cn=X,dc=COM")) {
+		t.Fatal("AVA order and case must not matter")
+	}
+}
+
+func TestDN_EqualWithinRebase(t *testing.T) {
+	base := MustParseDN("DC=example,DC=com")
+	staff := MustParseDN("ou=Staff,dc=Example,dc=COM")
+	u := staff.Child("CN", "Smith, Anna")
+
+	if u.String() != `CN=Smith\, Anna,ou=Staff,dc=Example,dc=COM` {
+		t.Fatalf("child: %s", u)
+	}
+	if u.Norm() != `cn=smith\, anna,ou=staff,dc=example,dc=com` {
+		t.Fatalf("norm: %s", u.Norm())
+	}
+	if !u.Within(base) || !u.Within(staff) || !staff.Within(staff) || base.Within(staff) {
+		t.Fatal("Within is wrong")
+	}
+	if MustParseDN("DC=example,DC=comx").Within(base) {
+		t.Fatal("sibling suffix must not count as within")
+	}
+	if !u.Parent().Equal(staff) || u.Len() != 4 || !base.Parent().Parent().IsZero() {
+		t.Fatal("Parent/Len wrong")
+	}
+
+	moved, err := u.Rebase(staff, MustParseDN("OU=Former,DC=example,DC=com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.String() != `CN=Smith\, Anna,OU=Former,DC=example,DC=com` {
+		t.Fatalf("rebase: %s", moved)
+	}
+	if _, err := base.Rebase(staff, base); err == nil {
+		t.Fatal("rebase outside from must fail")
+	}
+	if u.String() != `CN=Smith\, Anna,ou=Staff,dc=Example,dc=COM` {
+		t.Fatalf("rebase modified the receiver: %s", u)
+	}
+}
+
+func TestDN_JSON(t *testing.T) {
+	var v struct{ DN DN }
+	if err := json.Unmarshal([]byte(`{"DN":"CN=a\\, b,DC=com"}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.DN.RDN()[0].Value != "a, b" {
+		t.Fatalf("got %q", v.DN.RDN()[0].Value)
+	}
+	out, _ := json.Marshal(v)
+	if string(out) != `{"DN":"CN=a\\, b,DC=com"}` {
+		t.Fatalf("marshal: %s", out)
+	}
+	if json.Unmarshal([]byte(`{"DN":"CN="}`), &v) == nil {
+		t.Fatal("invalid DN must not unmarshal")
+	}
+}
+
+func TestEscapeDNValue(t *testing.T) {
+	cases := map[string]string{
+		"plain":     "plain",
+		" lead":     `\ lead`,
+		"trail ":    `trail\ `,
+		"#x":        `\#x`,
+		"a#x":       "a#x",
+		`a,b+c"d\e`: `a\,b\+c\"d\\e`,
+		"nul\x00":   `nul\00`,
+	}
+	for in, want := range cases {
+		if got := EscapeDNValue(in); got != want {
+			t.Errorf("%q: got %q want %q", in, got, want)
+		}
+	}
+}
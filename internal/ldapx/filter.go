@@ -0,0 +1,207 @@
+// Package ldapx builds LDAP search filters (RFC 4515) from typed expressions
+// and parses, normalises and rebases distinguished names (RFC 4514). User
+// input only ever enters a filter or DN as an escaped value.
+package ldapx
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Filter is a search filter expression. Its String form is always a
+// syntactically valid, fully escaped RFC 4515 filter.
+type Filter interface {
+	String() string
+	validate() error
+}
+
+var reAttr = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9-]*|[0-9]+(\.[0-9]+)+)(;[A-Za-z0-9-]+)*$`)
+
+func checkAttr(attr string) error {
+	if !reAttr.MatchString(attr) {
+		return fmt.Errorf("invalid attribute description %q", attr)
+	}
+	return nil
+}
+
+// Validate reports malformed attribute names or empty And/Or sets anywhere in f.
+func Validate(f Filter) error {
+	if f == nil {
+		return fmt.Errorf("nil filter")
+	}
+	return f.validate()
+}
+
+type set struct {
+	op    byte
+	items []Filter
+}
+
+// And matches entries matching every item.
+func And(items ...Filter) Filter { return set{op: '&', items: items} }
+
+// Or matches entries matching at least one item.
+func Or(items ...Filter) Filter { return set{op: '|', items: items} }
+
+func (s set) String() string {
+	var b strings.Builder
+	b.WriteByte('(')
+	b.WriteByte(s.op)
+	for _, f := range s.items {
+		if f != nil {
+			b.WriteString(f.String())
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+func (s set) validate() error {
+	n := 0
+	for _, f := range s.items {
+		if f == nil {
+			continue
+		}
+		if err := f.validate(); err != nil {
+			return err
+		}
+		n++
+	}
+	if n == 0 {
+		return fmt.Errorf("empty (%c) filter", s.op)
+	}
+	return nil
+}
+
+type not struct{ f Filter }
+
+// Not negates f.
+func Not(f Filter) Filter { return not{f: f} }
+
+func (n not) String() string { return "(!" + n.f.String() + ")" }
+func (n not) validate() error {
+	if n.f == nil {
+		return fmt.Errorf("empty (!) filter")
+	}
+	return n.f.validate()
+}
+
+type cmp struct {
+	attr, op, value string
+}
+
+// Eq matches attr equal to value.
+func Eq(attr, value string) Filter { return cmp{attr: attr, op: "=", value: value} }
+
+// GE matches attr ordered at or after value.
+func GE(attr, value string) Filter { return cmp{attr: attr, op: ">=", value: value} }
+
+// LE matches attr ordered at or before value.
+func LE(attr, value string) Filter { return cmp{attr: attr, op: "<=", value: value} }
+
+func (c cmp) String() string  { return "(" + c.attr + c.op + EscapeFilterValue(c.value) + ")" }
+func (c cmp) validate() error { return checkAttr(c.attr) }
+
+type present struct{ attr string }
+
+// Present matches entries that have attr at all.
+func Present(attr string) Filter { return present{attr: attr} }
+
+func (p present) String() string  { return "(" + p.attr + "=*)" }
+func (p present) validate() error { return checkAttr(p.attr) }
+
+// AD matching rules for Extensible.
+const (
+	RuleBitAnd  = "1.2.840.113556.1.4.803"  // all bits of value set
+	RuleBitOr   = "1.2.840.113556.1.4.804"  // any bit of value set
+	RuleInChain = "1.2.840.113556.1.4.1941" // LDAP_MATCHING_RULE_IN_CHAIN
+)
+
+var reOID = regexp.MustCompile(`^[0-9]+(\.[0-9]+)+$`)
+
+type extensible struct {
+	attr, rule, value string
+}
+
+// Extensible matches attr against value using the matching rule OID rule.
+func Extensible(attr, rule, value string) Filter {
+	return extensible{attr: attr, rule: rule, value: value}
+}
+
+// InChain matches entries whose attr (member or memberOf) reaches dn through
+// any number of nested groups.
+func InChain(attr string, dn DN) Filter { return Extensible(attr, RuleInChain, dn.String()) }
+
+// BitAnd matches integer attributes with all bits of mask set.
+func BitAnd(attr string, mask int64) Filter {
+	return Extensible(attr, RuleBitAnd, strconv.FormatInt(mask, 10))
+}
+
+func (x extensible) String() string {
+	return "(" + x.attr + ":" + x.rule + ":=" + EscapeFilterValue(x.value) + ")"
+}
+
+func (x extensible) validate() error {
+	if err := checkAttr(x.attr); err != nil {
+		return err
+	}
+	if !reOID.MatchString(x.rule) {
+		return fmt.Errorf("invalid matching rule %q", x.rule)
+	}
+	return nil
+}
+
+type substring struct {
+	attr, initial, final string
+	any                  []string
+}
+
+// Substring matches attr against initial*any[0]*...*final. Empty initial or
+// final leave that end open.
+func Substring(attr, initial string, any []string, final string) Filter {
+	return substring{attr: attr, initial: initial, any: any, final: final}
+}
+
+// Contains matches attr containing value anywhere.
+func Contains(attr, value string) Filter { return Substring(attr, "", []string{value}, "") }
+
+// HasPrefix matches attr starting with value.
+func HasPrefix(attr, value string) Filter { return Substring(attr, value, nil, "") }
+
+func (s substring) String() string {
+	var b strings.Builder
+	b.WriteString("(" + s.attr + "=" + EscapeFilterValue(s.initial) + "*")
+	for _, a := range s.any {
+		if a != "" {
+			b.WriteString(EscapeFilterValue(a) + "*")
+		}
+	}
+	b.WriteString(EscapeFilterValue(s.final) + ")")
+	return b.String()
+}
+
+func (s substring) validate() error {
+	if err := checkAttr(s.attr); err != nil {
+		return err
+	}
+	if s.initial == "" && s.final == "" && strings.Join(s.any, "") == "" {
+		return fmt.Errorf("substring filter on %s without any value", s.attr)
+	}
+	return nil
+}
+
+// EscapeFilterValue escapes the RFC 4515 special characters * ( ) \ NUL.
+func EscapeFilterValue(v string) string {
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; c {
+		case '*', '(', ')', '\\', 0:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,64 @@
+package ldapx
+
+import "testing"
+
+func TestFilter_String(t *testing.T) {
+	cases := []struct {
+		f    Filter
+		want string
+	}{
+		{Eq("sAMAccountName", "anna"), "(sAMAccountName=anna)"},
+		{Present("mail"), "(mail=*)"},
+		{Contains("displayName", "a*b"), `(displayName=*a\2ab*)`},
+		{HasPrefix("cn", "x)("), `(cn=x\29\28*)`},
+		{Substring("cn", "a", []string{"b", "", "c"}, "d"), "(cn=a*b*c*d)"},
+		{Not(Eq("objectClass", "computer")), "(!(objectClass=computer))"},
+		{And(Eq("a", "1"), nil, Or(Eq("b", `\`), GE("c", "3"), LE("d", "4"))), `(&(a=1)(|(b=\5c)(c>=3)(d<=4)))`},
+		{Eq("cn", "nul\x00byte"), `(cn=nul\00byte)`},
+		{Eq("cn", "Jürgen"), "(cn=Jürgen)"},
+		{BitAnd("userAccountControl", 2), "(userAccountControl:1.2.840.113556.1.4.803:=2)"},
+		{InChain("memberOf", MustParseDN(`CN=Admins\, EU,DC=com`)), `(memberOf:1.2.840.113556.1.4.1941:=CN=Admins\5c, EU,DC=com)`},
+	}
+	for _, c := range cases {
+		if err := Validate(c.f); err != nil {
+			t.Errorf("%s: %v", c.want, err)
+		}
+		if got := c.f.String(); got != c.want {
+			t.Errorf("got %s want %s", got, c.want)
+		}
+	}
+}
+
+func TestFilter_InjectionStaysAValue(t *testing.T) {
+	q := "*)(objectClass=*))(|(cn=*"
+	got := Contains("displayName", q).String()
+	want := `(displayName=*\2a\29\28objectClass=\2a\29\29\28|\28cn=\2a*)`
+	if got != want {
+		t.Fatalf("got %s want %s", got, want)
+	}
+}
+
+func TestValidate_Rejects(t *testing.T) {
+	for _, f := range []Filter{
+		nil,
+		Eq("bad attr", "x"),
+		Eq("cn)(x", "x"),
+		Present(""),
+		And(),
+		Or(nil),
+		Not(nil),
+		Contains("cn", ""),
+		And(Eq("cn", "a"), Not(Eq("=", "b"))),
+		Extensible("member", "inchain", "x"),
+	} {
+		if Validate(f) == nil {
+			t.Errorf("expected error for %v", f)
+		}
+	}
+	if err := Validate(Eq("1.2.840.113556.1.4.8", "x")); err != nil {
+		t.Fatalf("numeric OID: %v", err)
+	}
+	if err := Validate(Eq("userCertificate;binary", "x")); err != nil {
+		t.Fatalf("attribute option: %v", err)
+	}
+}
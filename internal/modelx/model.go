@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
-	"sync"
 
 	"github.com/Weruminger/go-ad-admin/internal/errs"
 )
@@ -22,12 +21,12 @@ type Store interface {
 	Scheme() string
 }
 
+// Base carries the codecs and stores shared by the model objects built
+// from it. It holds no per-object state and is safe for concurrent use.
 type Base struct {
-	mu      sync.RWMutex
-	lastErr error
-	codecs  map[string]Codec
-	stores  map[string]Store
-	format  string
+	codecs map[string]Codec
+	stores map[string]Store
+	format string
 }
 
 func NewBase(defaultFormat string, codecs []Codec, stores []Store) *Base {
@@ -42,20 +41,54 @@ func NewBase(defaultFormat string, codecs []Codec, stores []Store) *Base {
 	return &Base{codecs: cm, stores: sm, format: strings.ToLower(defaultFormat)}
 }
 
-func (b *Base) Err() error {
-	b.mu.RLock()
-	defer b.mu.RUnlock()
-	return b.lastErr
+// State is the error state of one model object; domain types embed it
+// next to the shared *Base. Errors collect: Validate reports every
+// invalid field, not only the last one. A failed Load of one object does
+// not affect others built from the same Base. Like the object, a State
+// belongs to one goroutine at a time; copies do not share new errors.
+type State struct {
+	errList errs.List
 }
 
-func (b *Base) setErr(op errs.Op, code errs.Code, err error, fields map[string]any) {
+// Err returns the errors collected so far as one errs.List, nil if there
+// are none.
+func (s *State) Err() error {
+	if len(s.errList) == 0 {
+		return nil
+	}
+	return s.Errors()
+}
+
+// Errors returns a copy of the errors collected so far.
+func (s *State) Errors() errs.List {
+	if len(s.errList) == 0 {
+		return nil
+	}
+	return append(errs.List(nil), s.errList...)
+}
+
+// SetErr adds err as *errs.E; a nil err is ignored.
+func (s *State) SetErr(op errs.Op, code errs.Code, err error, fields map[string]any) {
 	if err == nil {
 		return
 	}
-	w := errs.New(op, code, err, fields)
-	b.mu.Lock()
-	b.lastErr = w
-	b.mu.Unlock()
+	s.add(errs.New(op, code, err, fields))
+}
+
+// SetFieldErr adds the error of one field, see errs.Field.
+func (s *State) SetFieldErr(op errs.Op, code errs.Code, field, msg string) {
+	s.add(errs.Field(op, code, field, msg))
+}
+
+// SetInvalid adds an INVALID_INPUT error of one field, the common case of
+// a validator.
+func (s *State) SetInvalid(op errs.Op, field, msg string) {
+	s.SetFieldErr(op, errs.InvalidInput, field, msg)
+}
+
+func (s *State) add(e *errs.E) {
+	// clip, so a copy of the object never sees the errors of the original
+	s.errList = append(s.errList[:len(s.errList):len(s.errList)], e)
 }
 
 func (b *Base) pickCodec(format string) (Codec, error) {
@@ -85,12 +118,6 @@ func (b *Base) pickStore(u string) (Store, *url.URL, error) {
 	return s, pu, nil
 }
 
-// package modelx
-
-func (b *Base) SetErr(op errs.Op, code errs.Code, err error, fields map[string]any) {
-	b.setErr(op, code, err, fields)
-}
-
 func (b *Base) PickStore(uri string) (Store, *url.URL, error) {
 	return b.pickStore(uri)
 }
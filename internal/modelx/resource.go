@@ -0,0 +1,362 @@
+package modelx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+)
+
+// Object is a model object: a struct that embeds *Base and State and
+// carries "kind" and "version" fields. Once its type is registered (see
+// Register), Load, Save, Serialize, Deserialize and Validate work for it.
+//
+// Domain types keep one-line methods of the same names that call these
+// functions. They carry no logic; they exist so callers can chain on the
+// concrete type, as in domain.NewADUser(b).Load(ctx, uri).Save(ctx, uri, ""):
+// Go methods cannot take type parameters, and a method promoted from the
+// embedded Base or State cannot return the type that embeds it.
+type Object interface {
+	Err() error
+	SetErr(op errs.Op, code errs.Code, err error, fields map[string]any)
+	SetFieldErr(op errs.Op, code errs.Code, field, msg string)
+	base() *Base
+}
+
+func (b *Base) base() *Base { return b }
+
+// Kind names a registered type, as the "kind" and "version" fields of its
+// documents do.
+type Kind struct {
+	Kind    string `json:"kind" yaml:"kind"`
+	Version string `json:"version" yaml:"version"`
+}
+
+func (k Kind) String() string { return k.Kind + "/" + k.Version }
+
+type resource struct {
+	kind     Kind
+	new      func(*Base) Object
+	validate func(Object)
+}
+
+// op is the errs.Op of name on r, e.g. "aduser.Load".
+func (r *resource) op(name string) errs.Op {
+	return errs.Op(strings.ToLower(r.kind.Kind) + "." + name)
+}
+
+var registry = struct {
+	sync.RWMutex
+	byKind map[Kind]*resource
+	byType map[reflect.Type]*resource
+}{byKind: map[Kind]*resource{}, byType: map[reflect.Type]*resource{}}
+
+// Register makes *T known as kind/version. newFn returns an object with
+// its defaults, Kind and Version set; validate adds the errors of an
+// object (see State.SetFieldErr) and may be nil. Register is meant for
+// init functions and panics on a kind or type registered twice.
+func Register[T any, P interface {
+	*T
+	Object
+}](kind, version string, newFn func(*Base) P, validate func(P)) {
+	r := &resource{kind: Kind{Kind: kind, Version: version}, new: func(b *Base) Object { return newFn(b) }}
+	if validate != nil {
+		r.validate = func(o Object) { validate(o.(P)) }
+	}
+	t := reflect.TypeOf((*T)(nil))
+	registry.Lock()
+	defer registry.Unlock()
+	if _, dup := registry.byKind[r.kind]; dup {
+		panic(fmt.Sprintf("modelx: kind %s registered twice", r.kind))
+	}
+	if _, dup := registry.byType[t]; dup {
+		panic(fmt.Sprintf("modelx: type %s registered twice", t))
+	}
+	registry.byKind[r.kind] = r
+	registry.byType[t] = r
+}
+
+// Kinds returns the registered kinds, sorted.
+func Kinds() []Kind {
+	registry.RLock()
+	defer registry.RUnlock()
+	out := make([]Kind, 0, len(registry.byKind))
+	for k := range registry.byKind {
+		out = append(out, k)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind < out[j].Kind
+		}
+		return out[i].Version < out[j].Version
+	})
+	return out
+}
+
+// lookup returns the registration of k; without a version, the kind has
+// to be registered in one version only.
+func lookup(k Kind) (*resource, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	if r, ok := registry.byKind[k]; ok {
+		return r, true
+	}
+	var found *resource
+	for rk, r := range registry.byKind {
+		if k.Version == "" && rk.Kind == k.Kind {
+			if found != nil {
+				return nil, false
+			}
+			found = r
+		}
+	}
+	return found, found != nil
+}
+
+// resourceOf returns the registration of the type of o.
+func resourceOf(o Object) (*resource, error) {
+	registry.RLock()
+	r, ok := registry.byType[reflect.TypeOf(o)]
+	registry.RUnlock()
+	if !ok {
+		return nil, errs.New("modelx.resource", errs.Internal, fmt.Errorf("type %T is not registered", o), nil)
+	}
+	return r, nil
+}
+
+// begin returns the registration of o and its Base for the operation
+// name, or records why o cannot be handled.
+func begin(o Object, name string) (*resource, *Base, bool) {
+	r, err := resourceOf(o)
+	if err != nil {
+		o.SetErr("modelx."+errs.Op(name), errs.Internal, err, nil)
+		return nil, nil, false
+	}
+	b := o.base()
+	if b == nil {
+		o.SetErr(r.op(name), errs.Internal, errors.New("no modelx.Base attached"), nil)
+		return nil, nil, false
+	}
+	return r, b, true
+}
+
+// New returns a new object of kind k built on b; an unknown kind is
+// NOT_FOUND.
+func New(b *Base, k Kind) (Object, error) {
+	r, ok := lookup(k)
+	if !ok {
+		return nil, errs.New("modelx.New", errs.NotFound, fmt.Errorf("unknown kind %s", k), map[string]any{"kind": k.Kind, "version": k.Version})
+	}
+	return r.new(b), nil
+}
+
+// Validate runs the validator registered for the type of o, unless o
+// already failed.
+func Validate[P Object](o P) P {
+	if o.Err() != nil {
+		return o
+	}
+	r, err := resourceOf(o)
+	if err != nil {
+		o.SetErr("modelx.Validate", errs.Internal, err, nil)
+		return o
+	}
+	if r.validate != nil {
+		r.validate(o)
+	}
+	return o
+}
+
+// Load reads o from uri, in the format the extension of uri names (JSON
+// by default), and validates it. A document of another kind is
+// INVALID_INPUT.
+func Load[P Object](ctx context.Context, o P, uri string) P {
+	if o.Err() != nil {
+		return o
+	}
+	r, b, ok := begin(o, "Load")
+	if !ok {
+		return o
+	}
+	op := r.op("Load")
+	store, _, err := b.pickStore(uri)
+	if err != nil {
+		o.SetErr(op, errs.InvalidInput, err, map[string]any{"uri": uri})
+		return o
+	}
+	raw, err := store.Load(ctx, uri)
+	if err != nil {
+		o.SetErr(op, storeCode(err, errs.NotFound), err, map[string]any{"uri": uri})
+		return o
+	}
+	format := formatFromURI(uri)
+	if err := decode(b, r, format, raw, o); err != nil {
+		o.SetErr(op, errs.InvalidInput, err, map[string]any{"uri": uri, "fmt": format})
+		return o
+	}
+	return Validate(o)
+}
+
+// Save validates o and writes it to uri in format ("" for the default
+// format of its Base).
+func Save[P Object](ctx context.Context, o P, uri, format string) P {
+	if o.Err() != nil {
+		return o
+	}
+	r, b, ok := begin(o, "Save")
+	if !ok {
+		return o
+	}
+	op := r.op("Save")
+	if Validate(o).Err() != nil {
+		return o
+	}
+	cdc, err := b.pickCodec(format)
+	if err != nil {
+		o.SetErr(op, errs.InvalidInput, err, map[string]any{"fmt": format})
+		return o
+	}
+	raw, err := cdc.Marshal(o)
+	if err != nil {
+		o.SetErr(op, errs.Internal, err, map[string]any{"fmt": cdc.Format()})
+		return o
+	}
+	store, _, err := b.pickStore(uri)
+	if err != nil {
+		o.SetErr(op, errs.InvalidInput, err, map[string]any{"uri": uri})
+		return o
+	}
+	if err := store.Save(ctx, uri, raw); err != nil {
+		o.SetErr(op, storeCode(err, errs.Unavailable), err, map[string]any{"uri": uri})
+	}
+	return o
+}
+
+// Serialize returns o as document in format.
+func Serialize[P Object](o P, format string) (string, error) {
+	r, err := resourceOf(o)
+	if err != nil {
+		return "", err
+	}
+	op := r.op("Serialize")
+	b := o.base()
+	if b == nil {
+		return "", errs.New(op, errs.Internal, errors.New("no modelx.Base attached"), nil)
+	}
+	cdc, err := b.pickCodec(format)
+	if err != nil {
+		return "", errs.Wrap(op, err, errs.InvalidInput)
+	}
+	out, err := cdc.Marshal(o)
+	if err != nil {
+		return "", errs.Wrap(op, err, errs.Internal)
+	}
+	return string(out), nil
+}
+
+// Deserialize reads o from data in format and validates it.
+func Deserialize[P Object](o P, format, data string) P {
+	if o.Err() != nil {
+		return o
+	}
+	r, b, ok := begin(o, "Deserialize")
+	if !ok {
+		return o
+	}
+	if err := decode(b, r, format, []byte(data), o); err != nil {
+		o.SetErr(r.op("Deserialize"), errs.InvalidInput, err, map[string]any{"fmt": format})
+		return o
+	}
+	return Validate(o)
+}
+
+// Decode reads data in format into a new object of the kind its "kind"
+// and "version" fields name, built on b, and validates it. The error is
+// that of the object (see State.Err); an unknown kind is INVALID_INPUT.
+func Decode(b *Base, format string, data []byte) (Object, error) {
+	op := errs.Op("modelx.Decode")
+	if b == nil {
+		return nil, errs.New(op, errs.Internal, errors.New("no modelx.Base"), nil)
+	}
+	cdc, err := b.pickCodec(format)
+	if err != nil {
+		return nil, errs.New(op, errs.InvalidInput, err, map[string]any{"fmt": format})
+	}
+	var k Kind
+	if err := cdc.Unmarshal(data, &k); err != nil {
+		return nil, errs.New(op, errs.InvalidInput, err, map[string]any{"fmt": cdc.Format()})
+	}
+	r, ok := lookup(k)
+	if !ok {
+		return nil, errs.New(op, errs.InvalidInput, fmt.Errorf("unknown kind %s", k), map[string]any{"kind": k.Kind, "version": k.Version})
+	}
+	o := r.new(b)
+	if err := cdc.Unmarshal(data, o); err != nil {
+		return nil, errs.New(r.op("Decode"), errs.InvalidInput, err, map[string]any{"fmt": cdc.Format()})
+	}
+	if r.validate != nil {
+		r.validate(o)
+	}
+	return o, o.Err()
+}
+
+// LoadAny reads the document at uri like Load, into an object of the kind
+// it names (see Decode).
+func LoadAny(ctx context.Context, b *Base, uri string) (Object, error) {
+	op := errs.Op("modelx.LoadAny")
+	if b == nil {
+		return nil, errs.New(op, errs.Internal, errors.New("no modelx.Base"), nil)
+	}
+	store, _, err := b.pickStore(uri)
+	if err != nil {
+		return nil, errs.New(op, errs.InvalidInput, err, map[string]any{"uri": uri})
+	}
+	raw, err := store.Load(ctx, uri)
+	if err != nil {
+		return nil, errs.New(op, storeCode(err, errs.NotFound), err, map[string]any{"uri": uri})
+	}
+	return Decode(b, formatFromURI(uri), raw)
+}
+
+// decode unmarshals raw into o after checking that the document is of the
+// kind of r; a document without kind or version is accepted.
+func decode(b *Base, r *resource, format string, raw []byte, o Object) error {
+	cdc, err := b.pickCodec(format)
+	if err != nil {
+		return err
+	}
+	var k Kind
+	if err := cdc.Unmarshal(raw, &k); err != nil {
+		return err
+	}
+	if (k.Kind != "" && k.Kind != r.kind.Kind) || (k.Version != "" && k.Version != r.kind.Version) {
+		return fmt.Errorf("document is %s, want %s", k, r.kind)
+	}
+	return cdc.Unmarshal(raw, o)
+}
+
+// formatFromURI is the format the extension of uri names, JSON by default.
+func formatFromURI(uri string) string {
+	low := strings.ToLower(uri)
+	switch {
+	case strings.HasSuffix(low, ".yaml"), strings.HasSuffix(low, ".yml"):
+		return "yaml"
+	default:
+		return "json"
+	}
+}
+
+// storeCode keeps the code of stores that already report errs errors (e.g.
+// the directory returning FORBIDDEN) and falls back to def otherwise.
+func storeCode(err error, def errs.Code) errs.Code {
+	var e *errs.E
+	if errors.As(err, &e) && e.Code != "" {
+		return e.Code
+	}
+	return def
+}
@@ -0,0 +1,89 @@
+package modelx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+)
+
+type note struct {
+	*Base   `json:"-" yaml:"-"`
+	State   `json:"-" yaml:"-"`
+	Kind    string `json:"kind" yaml:"kind"`
+	Version string `json:"version" yaml:"version"`
+	Text    string `json:"text" yaml:"text"`
+}
+
+func newNote(b *Base) *note { return &note{Base: b, Kind: "Note", Version: "v1"} }
+
+func (n *note) validate() {
+	if n.Text == "" {
+		n.SetFieldErr("note.Validate", errs.InvalidInput, "text", "is required")
+	}
+}
+
+type tag struct {
+	*Base   `json:"-" yaml:"-"`
+	State   `json:"-" yaml:"-"`
+	Kind    string `json:"kind" yaml:"kind"`
+	Version string `json:"version" yaml:"version"`
+}
+
+func init() {
+	Register("Note", "v1", newNote, (*note).validate)
+	Register("Tag", "v1", func(b *Base) *tag { return &tag{Base: b, Kind: "Tag", Version: "v1"} }, nil)
+}
+
+func testBase() *Base {
+	return NewBase("json", []Codec{JSON{}, YAML{}}, []Store{FileStore{}})
+}
+
+func TestResource_SaveLoad(t *testing.T) {
+	b, ctx := testBase(), context.Background()
+	uri := "file://" + t.TempDir() + "/note.yaml"
+	if n := newNote(b); !errs.IsCode(Save(ctx, n, uri, "yaml").Err(), errs.InvalidInput) {
+		t.Fatalf("invalid note saved: %v", n.Err())
+	}
+	n := newNote(b)
+	n.Text = "hello"
+	if Save(ctx, n, uri, "yaml").Err() != nil {
+		t.Fatal(n.Err())
+	}
+	if got := Load(ctx, newNote(b), uri); got.Err() != nil || got.Text != "hello" {
+		t.Fatalf("load: %+v %v", got, got.Err())
+	}
+	// the document names another kind
+	tg := &tag{Base: b}
+	if Load(ctx, tg, uri); !errs.IsCode(tg.Err(), errs.InvalidInput) {
+		t.Fatalf("note loaded as tag: %v", tg.Err())
+	}
+	var unbound note
+	if Validate(&unbound); !errs.IsCode(unbound.Err(), errs.InvalidInput) {
+		t.Fatalf("validate without base: %v", unbound.Err())
+	}
+	if Load(ctx, newNote(nil), uri).Err() == nil {
+		t.Fatal("load without base")
+	}
+}
+
+func TestResource_Decode(t *testing.T) {
+	b := testBase()
+	o, err := Decode(b, "json", []byte(`{"kind":"Note","text":"x"}`))
+	if n, ok := o.(*note); err != nil || !ok || n.Text != "x" || n.Version != "v1" {
+		t.Fatalf("decode: %#v %v", o, err)
+	}
+	if o, err := Decode(b, "yaml", []byte("kind: Note\nversion: v1\n")); !errs.IsCode(err, errs.InvalidInput) || o == nil {
+		t.Fatalf("invalid note: %v %v", o, err)
+	}
+	if _, err := Decode(b, "json", []byte(`{"kind":"Note","version":"v9"}`)); !errs.IsCode(err, errs.InvalidInput) {
+		t.Fatalf("unknown version: %v", err)
+	}
+	if o, err := New(b, Kind{Kind: "Tag"}); err != nil || o.(*tag).Kind != "Tag" {
+		t.Fatalf("new: %v %v", o, err)
+	}
+	kinds := Kinds()
+	if len(kinds) != 2 || kinds[0] != (Kind{"Note", "v1"}) || kinds[1].String() != "Tag/v1" {
+		t.Fatalf("kinds: %v", kinds)
+	}
+}
@@ -0,0 +1,325 @@
+// Package privacy pseudonymises personal data for privacy=high. Names,
+// accounts, mail addresses, DNs, MACs and IPs are replaced by keyed HMAC
+// tokens ("p-" and 12 hex digits): the same value always gets the same
+// token for one key, so a person stays recognisable across pages and in
+// the audit log without being named. Tokens handed out since start can be
+// resolved again with Reveal.
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/Weruminger/go-ad-admin/internal/audit"
+	. "github.com/Weruminger/go-ad-admin/internal/config"
+	"github.com/Weruminger/go-ad-admin/internal/domain"
+	"github.com/Weruminger/go-ad-admin/internal/ldap"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+)
+
+// Prefix starts every token.
+const Prefix = "p-"
+
+// maxRevealable bounds the tokens Reveal remembers; the oldest go first.
+const maxRevealable = 100000
+
+// Pseudonymizer issues tokens for one key. It is safe for concurrent use.
+type Pseudonymizer struct {
+	key []byte
+
+	mu     sync.Mutex
+	values map[string]string // token -> value
+	order  []string          // tokens, oldest first
+}
+
+// New returns a Pseudonymizer keyed with key.
+func New(key []byte) *Pseudonymizer {
+	return &Pseudonymizer{key: key, values: map[string]string{}}
+}
+
+// FromConfig keys the Pseudonymizer with PrivacyKey, falling back to
+// SessionKey, so tokens stay stable for as long as sessions do.
+func FromConfig(cfg Config) *Pseudonymizer {
+	key := cfg.PrivacyKey
+	if key == "" {
+		key = cfg.SessionKey
+	}
+	return New([]byte(key))
+}
+
+// Token returns the token of v, "" for "". Case, blanks after the commas
+// of a DN and the notation of a MAC address do not change the token.
+func (p *Pseudonymizer) Token(v string) string {
+	n := normalise(v)
+	if n == "" {
+		return ""
+	}
+	m := hmac.New(sha256.New, p.key)
+	m.Write([]byte(n))
+	t := Prefix + hex.EncodeToString(m.Sum(nil))[:12]
+	p.remember(t, v)
+	return t
+}
+
+func normalise(v string) string {
+	v = strings.TrimSpace(v)
+	if mac, err := net.ParseMAC(v); err == nil {
+		return mac.String()
+	}
+	return strings.ReplaceAll(strings.ToLower(v), ", ", ",")
+}
+
+func (p *Pseudonymizer) remember(token, v string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.values[token]; ok {
+		return
+	}
+	if len(p.order) >= maxRevealable {
+		delete(p.values, p.order[0])
+		p.order = p.order[1:]
+	}
+	p.values[token] = v
+	p.order = append(p.order, token)
+}
+
+// Reveal returns the value a token was issued for; false if the token is
+// unknown, e.g. issued before a restart or under another key.
+func (p *Pseudonymizer) Reveal(token string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	v, ok := p.values[strings.TrimSpace(token)]
+	return v, ok
+}
+
+// DN replaces d by a one-RDN DN CN=<token of d>, so it still renders and
+// parses as a DN.
+func (p *Pseudonymizer) DN(d ldapx.DN) ldapx.DN {
+	if d.IsZero() {
+		return d
+	}
+	return ldapx.DN{}.Child("CN", p.Token(d.String()))
+}
+
+// User masks UID, UPN, Name, Mail and DN; account state stays readable.
+func (p *Pseudonymizer) User(u ldap.User) ldap.User {
+	u.DN = p.DN(u.DN)
+	u.UID, u.UPN, u.Name, u.Mail = p.Token(u.UID), p.Token(u.UPN), p.Token(u.Name), p.Token(u.Mail)
+	return u
+}
+
+// ADUser masks SAM, UPN, DN, Display and Mail.
+func (p *Pseudonymizer) ADUser(u domain.ADUser) domain.ADUser {
+	u.SAM, u.UPN, u.DN = p.Token(u.SAM), p.Token(u.UPN), p.Token(u.DN)
+	u.Display, u.Mail = p.Token(u.Display), p.Token(u.Mail)
+	return u
+}
+
+// Group masks the member DNs; the group itself is not personal.
+func (p *Pseudonymizer) Group(g ldap.Group) ldap.Group {
+	members := make([]ldapx.DN, len(g.Members))
+	for i, m := range g.Members {
+		members[i] = p.DN(m)
+	}
+	g.Members = members
+	return g
+}
+
+// DHCPLease masks MAC, IP and Host; the lease times stay readable.
+func (p *Pseudonymizer) DHCPLease(l domain.DHCPLease) domain.DHCPLease {
+	l.MAC, l.IP, l.Host = p.Token(l.MAC), p.Token(l.IP), p.Token(l.Host)
+	return l
+}
+
+// personal lists the audit Data fields that identify a person.
+var personal = map[string]bool{
+	"user": true, "login": true, "name": true, "mail": true, "sam": true, "upn": true,
+	"ip": true, "mac": true, "host": true,
+	"dn": true, "target": true, "member": true, "members": true,
+}
+
+// Entry masks User and the personal Data fields of an audit entry. Object
+// states of change records are replaced as a whole, the string values of
+// their diff one by one; flags and numbers in the diff stay readable. Use
+// it as audit.Query.Rewrite.
+func (p *Pseudonymizer) Entry(e audit.Entry) audit.Entry {
+	e.User = p.Token(e.User)
+	data, ok := e.Data.(map[string]any)
+	if !ok {
+		return e
+	}
+	out := make(map[string]any, len(data))
+	for k, v := range data {
+		switch {
+		case personal[k]:
+			v = p.value(v)
+		case k == "before" || k == "after":
+			if s, ok := v.(string); ok {
+				v = p.Token(s)
+			}
+		case k == "diff":
+			v = p.diff(v)
+		}
+		out[k] = v
+	}
+	e.Data = out
+	return e
+}
+
+func (p *Pseudonymizer) value(v any) any {
+	switch v := v.(type) {
+	case string:
+		return p.Token(v)
+	case []any:
+		list := make([]any, len(v))
+		for i, x := range v {
+			list[i] = p.value(x)
+		}
+		return list
+	}
+	return v
+}
+
+// diff masks the old and new values of a change diff.
+func (p *Pseudonymizer) diff(v any) any {
+	fields, ok := v.([]any)
+	if !ok {
+		return v
+	}
+	out := make([]any, len(fields))
+	for i, f := range fields {
+		m, ok := f.(map[string]any)
+		if !ok {
+			out[i] = f
+			continue
+		}
+		c := make(map[string]any, len(m))
+		for k, x := range m {
+			if k == "old" || k == "new" {
+				x = p.value(x)
+			}
+			c[k] = x
+		}
+		out[i] = c
+	}
+	return out
+}
+
+// Subject is one data subject, known by the values that identify it: its
+// account, UPN, DN and mail address, or a MAC address.
+type Subject struct {
+	ids map[string]bool
+}
+
+// NewSubject returns the subject identified by ids; empty ones are ignored.
+func NewSubject(ids ...string) Subject {
+	s := Subject{ids: map[string]bool{}}
+	for _, id := range ids {
+		if n := normalise(id); n != "" {
+			s.ids[n] = true
+		}
+	}
+	return s
+}
+
+// Is reports whether v identifies s; case, DN blanks and MAC notation do
+// not matter.
+func (s Subject) Is(v string) bool { return s.ids[normalise(v)] }
+
+// Mentions reports whether e names s: as User or in a personal Data field.
+func (s Subject) Mentions(e audit.Entry) bool {
+	if s.Is(e.User) {
+		return true
+	}
+	data, _ := e.Data.(map[string]any)
+	for k, v := range data {
+		if personal[k] && s.holds(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Subject) holds(v any) bool {
+	switch v := v.(type) {
+	case string:
+		return s.Is(v)
+	case []any:
+		for _, x := range v {
+			if s.holds(x) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// about reports whether e is a change of the object of s.
+func (s Subject) about(data map[string]any) bool {
+	for _, k := range []string{"target", "dn", "mac"} {
+		if v, ok := data[k].(string); ok && s.Is(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Erase returns a rewrite for audit.Writer.Redact that replaces the values
+// identifying s by tokens in the entries that mention s. In a change of
+// the object of s the states and the diff are masked as in Entry; if s
+// acted itself, its client IP is masked too. Other persons in the same
+// entry, e.g. the operator, stay readable.
+func (p *Pseudonymizer) Erase(s Subject) func(audit.Entry) (audit.Entry, bool) {
+	var value func(v any) any
+	value = func(v any) any {
+		switch v := v.(type) {
+		case string:
+			if s.Is(v) {
+				return p.Token(v)
+			}
+		case []any:
+			list := make([]any, len(v))
+			for i, x := range v {
+				list[i] = value(x)
+			}
+			return list
+		}
+		return v
+	}
+	return func(e audit.Entry) (audit.Entry, bool) {
+		if !s.Mentions(e) {
+			return e, false
+		}
+		actor := s.Is(e.User)
+		if actor {
+			e.User = p.Token(e.User)
+		}
+		data, ok := e.Data.(map[string]any)
+		if !ok {
+			return e, true
+		}
+		about := s.about(data)
+		out := make(map[string]any, len(data))
+		for k, v := range data {
+			switch {
+			case k == "ip" && actor:
+				v = p.value(v)
+			case personal[k]:
+				v = value(v)
+			case about && (k == "before" || k == "after"):
+				if str, ok := v.(string); ok {
+					v = p.Token(str)
+				}
+			case about && k == "diff":
+				v = p.diff(v)
+			}
+			out[k] = v
+		}
+		e.Data = out
+		return e, true
+	}
+}
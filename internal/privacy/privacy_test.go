@@ -0,0 +1,79 @@
+package privacy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/audit"
+	"github.com/Weruminger/go-ad-admin/internal/domain"
+	"github.com/Weruminger/go-ad-admin/internal/ldap"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+)
+
+func TestToken(t *testing.T) {
+	p := New([]byte("key"))
+	tok := p.Token("Anna")
+	if !strings.HasPrefix(tok, Prefix) || len(tok) != len(Prefix)+12 || tok != p.Token(" anna ") {
+		t.Fatalf("token %q", tok)
+	}
+	if p.Token("aa:bb:cc:dd:ee:ff") != p.Token("AA-BB-CC-DD-EE-FF") || p.Token("CN=A, DC=x") != p.Token("cn=a,dc=x") {
+		t.Fatal("notation changes the token")
+	}
+	if p.Token("") != "" || New([]byte("other")).Token("Anna") == tok {
+		t.Fatal("empty value or key ignored")
+	}
+	if v, ok := p.Reveal(tok); !ok || v != "Anna" {
+		t.Fatalf("reveal: %q %v", v, ok)
+	}
+	if _, ok := New([]byte("key")).Reveal(tok); ok {
+		t.Fatal("token revealed by a pseudonymizer that never issued it")
+	}
+}
+
+func TestMasks(t *testing.T) {
+	p := New([]byte("key"))
+	dn := ldapx.MustParseDN("CN=Anna,CN=Users,DC=example,DC=com")
+	u := p.User(ldap.User{DN: dn, UID: "anna", Name: "Anna Smith", Mail: "anna@example.com", Enabled: true})
+	if u.UID != p.Token("anna") || u.Name == "Anna Smith" || u.Mail == "anna@example.com" || !u.Enabled || u.UPN != "" {
+		t.Fatalf("user %+v", u)
+	}
+	if u.DN.String() != "CN="+p.Token(dn.String()) {
+		t.Fatalf("dn %s", u.DN)
+	}
+	g := p.Group(ldap.Group{Name: "staff", Members: []ldapx.DN{dn}})
+	if g.Name != "staff" || !g.Members[0].Equal(u.DN) {
+		t.Fatalf("group %+v", g)
+	}
+	a := p.ADUser(domain.ADUser{SAM: "anna", UPN: "anna@example.com", Display: "Anna Smith", Locked: true})
+	if a.SAM != u.UID || !strings.HasPrefix(a.UPN, Prefix) || a.Display != u.Name || !a.Locked {
+		t.Fatalf("aduser %+v", a)
+	}
+	l := p.DHCPLease(domain.DHCPLease{MAC: "aa:bb:cc:dd:ee:ff", IP: "10.0.0.5", Host: "pc-anna"})
+	if !strings.HasPrefix(l.MAC, Prefix) || !strings.HasPrefix(l.IP, Prefix) || !strings.HasPrefix(l.Host, Prefix) {
+		t.Fatalf("lease %+v", l)
+	}
+}
+
+func TestEntry(t *testing.T) {
+	p := New([]byte("key"))
+	e := p.Entry(audit.Entry{User: "anna", Data: map[string]any{"ip": "10.0.0.1", "roles": []any{"helpdesk"}, "members": []any{"CN=A", "CN=B"}}})
+	data := e.Data.(map[string]any)
+	if !strings.HasPrefix(e.User, Prefix) || e.User != p.Entry(audit.Entry{User: "ANNA"}).User {
+		t.Fatalf("user %q", e.User)
+	}
+	if !strings.HasPrefix(data["ip"].(string), Prefix) || data["roles"].([]any)[0] != "helpdesk" || data["members"].([]any)[1] == "CN=B" {
+		t.Fatalf("data %v", data)
+	}
+	ch := p.Entry(audit.Entry{Data: map[string]any{"before": `{"sam":"anna"}`, "mac": "aa:bb:cc:dd:ee:ff", "diff": []any{
+		map[string]any{"path": "display", "old": "Anna", "new": "Anna S."},
+		map[string]any{"path": "enabled", "old": true, "new": false},
+	}}}).Data.(map[string]any)
+	diff := ch["diff"].([]any)
+	if !strings.HasPrefix(ch["before"].(string), Prefix) || ch["mac"] != p.Token("AA-BB-CC-DD-EE-FF") || diff[0].(map[string]any)["new"] == "Anna S." ||
+		diff[0].(map[string]any)["path"] != "display" || diff[1].(map[string]any)["new"] != false {
+		t.Fatalf("change %v", ch)
+	}
+	if other := New([]byte("other")).Entry(audit.Entry{User: "anna"}); other.User == e.User {
+		t.Fatal("pseudonym independent of key")
+	}
+}
@@ -0,0 +1,146 @@
+// Package rbac maps AD group membership to operator roles and roles to the
+// operations they may perform. The matrix is fixed in code; which groups
+// grant a role is configuration (Config.Roles).
+package rbac
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+)
+
+// Role is an operator role.
+type Role string
+
+const (
+	Viewer     Role = "viewer"
+	Helpdesk   Role = "helpdesk"
+	UserAdmin  Role = "user-admin"
+	DHCPAdmin  Role = "dhcp-admin"
+	Auditor    Role = "auditor"
+	SuperAdmin Role = "superadmin"
+)
+
+// Roles lists all roles, lowest first.
+var Roles = []Role{Viewer, Helpdesk, UserAdmin, DHCPAdmin, Auditor, SuperAdmin}
+
+// Permission is one operation (or class of read operations).
+type Permission string
+
+const (
+	UserRead          Permission = "user.read"
+	UserCreate        Permission = "user.create"
+	UserUpdate        Permission = "user.update"
+	UserDelete        Permission = "user.delete"
+	UserMove          Permission = "user.move"
+	UserEnable        Permission = "user.enable" // enable and disable
+	UserUnlock        Permission = "user.unlock"
+	UserResetPassword Permission = "user.resetPassword" // incl. "must change at next logon"
+	UserExpiry        Permission = "user.expiry"
+	GroupRead         Permission = "group.read"
+	GroupWrite        Permission = "group.write" // create, update, members
+	DHCPRead          Permission = "dhcp.read"
+	DHCPWrite         Permission = "dhcp.write"
+	AuditRead         Permission = "audit.read"
+	AuditReveal       Permission = "audit.reveal"   // clear names in the audit viewer with privacy=high
+	PrivacyReport     Permission = "privacy.report" // data-subject access report
+	PrivacyErase      Permission = "privacy.erase"  // pseudonymise a data subject in the audit log
+)
+
+var reads = []Permission{UserRead, GroupRead, DHCPRead}
+
+// matrix grants each role its permissions. SuperAdmin gets everything but
+// AuditReveal and the data-subject permissions: with privacy=high only
+// auditors see who did what, and only they answer for personal data.
+var matrix = map[Role][]Permission{
+	Viewer:    reads,
+	Helpdesk:  append(append([]Permission{}, reads...), UserUnlock, UserResetPassword),
+	UserAdmin: append(append([]Permission{}, reads...), UserCreate, UserUpdate, UserDelete, UserMove, UserEnable, UserUnlock, UserResetPassword, UserExpiry, GroupWrite),
+	DHCPAdmin: append(append([]Permission{}, reads...), DHCPWrite),
+	Auditor:   append(append([]Permission{}, reads...), AuditRead, AuditReveal, PrivacyReport, PrivacyErase),
+	SuperAdmin: []Permission{UserRead, UserCreate, UserUpdate, UserDelete, UserMove, UserEnable, UserUnlock,
+		UserResetPassword, UserExpiry, GroupRead, GroupWrite, DHCPRead, DHCPWrite, AuditRead},
+}
+
+// Set is the roles of one operator.
+type Set []Role
+
+// Allows reports whether any role of s grants p.
+func (s Set) Allows(p Permission) bool {
+	for _, r := range s {
+		for _, q := range matrix[r] {
+			if q == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Has reports whether s contains r.
+func (s Set) Has(r Role) bool {
+	for _, q := range s {
+		if q == r {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the roles whose configured groups contain one of groups
+// (the operator's direct and nested memberships), in the order of Roles.
+func Resolve(config map[string][]string, groups []ldapx.DN) (Set, error) {
+	var out Set
+	for _, r := range Roles {
+		for _, g := range config[string(r)] {
+			dn, err := ldapx.ParseDN(g)
+			if err != nil {
+				return nil, fmt.Errorf("role %s: %w", r, err)
+			}
+			if containsDN(groups, dn) {
+				out = append(out, r)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// Validate rejects unknown role names and unparsable group DNs.
+func Validate(config map[string][]string) error {
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !known(Role(name)) {
+			return fmt.Errorf("unknown role %q", name)
+		}
+		for _, g := range config[name] {
+			if _, err := ldapx.ParseDN(g); err != nil {
+				return fmt.Errorf("role %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func known(r Role) bool {
+	for _, k := range Roles {
+		if k == r {
+			return true
+		}
+	}
+	return false
+}
+
+func containsDN(list []ldapx.DN, dn ldapx.DN) bool {
+	for _, d := range list {
+		if d.Equal(dn) {
+			return true
+		}
+	}
+	return false
+}
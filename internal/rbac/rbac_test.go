@@ -0,0 +1,67 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+)
+
+func TestSet_Allows(t *testing.T) {
+	cases := []struct {
+		set   Set
+		perm  Permission
+		allow bool
+	}{
+		{Set{Viewer}, UserRead, true},
+		{Set{Viewer}, UserUnlock, false},
+		{Set{Helpdesk}, UserResetPassword, true},
+		{Set{Helpdesk}, UserUnlock, true},
+		{Set{Helpdesk}, UserCreate, false},
+		{Set{Helpdesk}, DHCPWrite, false},
+		{Set{UserAdmin}, UserCreate, true},
+		{Set{UserAdmin}, GroupWrite, true},
+		{Set{UserAdmin}, DHCPWrite, false},
+		{Set{DHCPAdmin}, DHCPWrite, true},
+		{Set{DHCPAdmin}, UserResetPassword, false},
+		{Set{Helpdesk, DHCPAdmin}, DHCPWrite, true},
+		{Set{UserAdmin}, AuditRead, false},
+		{Set{SuperAdmin}, AuditRead, true},
+		{Set{Auditor}, AuditReveal, true},
+		{Set{SuperAdmin}, AuditReveal, false},
+		{Set{Auditor}, PrivacyErase, true},
+		{Set{SuperAdmin}, PrivacyReport, false},
+		{Set{SuperAdmin}, UserCreate, true},
+		{Set{Auditor}, UserUnlock, false},
+		{nil, UserRead, false},
+	}
+	for _, c := range cases {
+		if got := c.set.Allows(c.perm); got != c.allow {
+			t.Errorf("%v %s: got %v", c.set, c.perm, got)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	cfg := map[string][]string{
+		"helpdesk":   {"CN=Helpdesk,OU=Groups,DC=example,DC=com"},
+		"dhcp-admin": {"CN=Net,OU=Groups,DC=example,DC=com", "CN=DHCP,OU=Groups,DC=example,DC=com"},
+		"superadmin": {"CN=Domain Admins,CN=Users,DC=example,DC=com"},
+	}
+	groups := []ldapx.DN{
+		ldapx.MustParseDN("cn=dhcp,ou=groups,dc=example,dc=com"),
+		ldapx.MustParseDN("CN=Helpdesk,OU=Groups,DC=example,DC=com"),
+	}
+	got, err := Resolve(cfg, groups)
+	if err != nil || len(got) != 2 || got[0] != Helpdesk || got[1] != DHCPAdmin {
+		t.Fatalf("got %v %v", got, err)
+	}
+	if err := Validate(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(map[string][]string{"root": {"CN=x,DC=example,DC=com"}}); err == nil {
+		t.Fatal("unknown role accepted")
+	}
+	if err := Validate(map[string][]string{"viewer": {"not a dn"}}); err == nil {
+		t.Fatal("bad DN accepted")
+	}
+}
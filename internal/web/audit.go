@@ -0,0 +1,61 @@
+package web
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Weruminger/go-ad-admin/internal/audit"
+	"github.com/Weruminger/go-ad-admin/internal/change"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+)
+
+// record appends an audit entry for r. Audit is mandatory (AUTH.md): a
+// write failure is INTERNAL and the caller must not report success.
+func (s *Server) record(r *http.Request, op, user string, data map[string]any) error {
+	if s.audit == nil {
+		return nil
+	}
+	if err := s.audit.Append(entry(r, op, user, data)); err != nil {
+		return errs.New("web.audit", errs.Internal, err, map[string]any{"op": op})
+	}
+	return nil
+}
+
+// entry is the audit entry for r, with client IP and request ID added to
+// data.
+func entry(r *http.Request, op, user string, data map[string]any) audit.Entry {
+	if data == nil {
+		data = map[string]any{}
+	}
+	data["ip"] = clientIP(r)
+	if id := reqIDFrom(r); id != "" {
+		data["requestId"] = id
+	}
+	return audit.Entry{TS: time.Now().UTC(), Op: op, User: user, Data: data}
+}
+
+// recorder writes the change records of writes made for r to the audit
+// log, attributed to the session user. Pass it to ldap.Recording or carry
+// it to the Kea client with change.NewContext.
+func (s *Server) recorder(r *http.Request) change.Recorder {
+	return change.RecorderFunc(func(rec change.Record) error {
+		return s.record(r, rec.Op(), sessionUser(r), rec.Fields())
+	})
+}
+
+func sessionUser(r *http.Request) string {
+	if sess, ok := sessionFrom(r); ok {
+		return sess.User
+	}
+	return ""
+}
+
+// clientIP is the peer address of r. Forwarded headers are not trusted:
+// behind a reverse proxy all clients share the proxy's budget.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
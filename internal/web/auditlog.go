@@ -0,0 +1,137 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Weruminger/go-ad-admin/internal/audit"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+)
+
+// auditMaxLimit caps the page size of the audit query.
+const auditMaxLimit = 500
+
+// auditFilters are the query parameters of /audit and /api/audit.
+var auditFilters = []string{"from", "to", "op", "user", "target", "reqid"}
+
+// handleAudit shows the audit log, newest first, filtered by the query
+// parameters; "ältere" pages on with ?before=<seq>.
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	page, pseud, err := s.searchAudit(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	q := map[string]string{}
+	keep := url.Values{}
+	for _, k := range auditFilters {
+		if v := r.URL.Query().Get(k); v != "" {
+			q[k] = v
+			keep.Set(k, v)
+		}
+	}
+	data := map[string]any{"Q": q, "Entries": page.Entries, "Pseudonymised": pseud}
+	if r.URL.Query().Get("before") != "" {
+		data["Newest"] = "/audit?" + keep.Encode()
+	}
+	if page.Next > 0 {
+		keep.Set("before", strconv.FormatUint(page.Next, 10))
+		data["Older"] = "/audit?" + keep.Encode()
+	}
+	s.render(w, r, "audit", data)
+}
+
+// handleAuditJSON answers the same query as JSON.
+func (s *Server) handleAuditJSON(w http.ResponseWriter, r *http.Request) {
+	page, _, err := s.searchAudit(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if page.Entries == nil {
+		page.Entries = []audit.Entry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(page)
+}
+
+// searchAudit runs the query of r against the audit log. With
+// privacy=high, users without AuditReveal see and filter pseudonyms only.
+func (s *Server) searchAudit(r *http.Request) (audit.Page, bool, error) {
+	op := errs.Op("web.Audit")
+	if s.audit == nil {
+		return audit.Page{}, false, errs.New(op, errs.Unavailable, fmt.Errorf("no audit log configured"), nil)
+	}
+	q, err := auditQuery(r)
+	if err != nil {
+		return audit.Page{}, false, errs.New(op, errs.InvalidInput, err, nil)
+	}
+	pseud := s.masked(r)
+	if pseud {
+		q.Rewrite = s.priv.Entry
+	}
+	page, err := audit.Search(s.audit.Path, q)
+	if err != nil {
+		return audit.Page{}, false, errs.New(op, errs.Internal, err, nil)
+	}
+	return page, pseud, nil
+}
+
+func auditQuery(r *http.Request) (audit.Query, error) {
+	v := r.URL.Query()
+	q := audit.Query{Op: v.Get("op"), User: v.Get("user"), Target: v.Get("target"), RequestID: v.Get("reqid"), Limit: 50}
+	for _, f := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		if s := v.Get(f.name); s != "" {
+			t, err := parseAuditTime(s)
+			if err != nil {
+				return q, fmt.Errorf("%s: %w", f.name, err)
+			}
+			*f.dst = t
+		}
+	}
+	if s := v.Get("before"); s != "" {
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return q, fmt.Errorf("before must be a sequence number")
+		}
+		q.Before = n
+	}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > auditMaxLimit {
+			return q, fmt.Errorf("limit must be 1..%d", auditMaxLimit)
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+// parseAuditTime accepts RFC 3339, the value of a datetime-local input and
+// a plain date; the latter two are UTC.
+func parseAuditTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// auditData renders the Data of an entry compactly for the table.
+func auditData(v any) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,107 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Weruminger/go-ad-admin/internal/audit"
+	"github.com/Weruminger/go-ad-admin/internal/rbac"
+	"github.com/Weruminger/go-ad-admin/internal/testx"
+)
+
+func newAuditServer(t *testing.T, privacy string) *Server {
+	t.Helper()
+	aw := &audit.Writer{Path: filepath.Join(t.TempDir(), "audit.jsonl"), Sync: audit.SyncNone}
+	t.Cleanup(func() { _ = aw.Close() })
+	t0 := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	for i, e := range []audit.Entry{
+		{Op: "auth.login", User: "anna", Data: map[string]any{"ip": "10.0.0.1", "requestId": "req-1"}},
+		{Op: "rbac.denied", User: "anna", Data: map[string]any{"permission": "user.create"}},
+		{Op: "auth.login", User: "bob", Data: map[string]any{"ip": "10.0.0.2"}},
+	} {
+		e.TS = t0.Add(time.Duration(i) * time.Minute)
+		if err := aw.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := newDirServer(t, 1).cfg
+	cfg.PrivacyLevel = privacy
+	return NewServer(cfg, WithAudit(aw))
+}
+
+func getAs(s *Server, path string, roles ...rbac.Role) *testx.Response {
+	_, value := s.sessions.create("tester", "", "Tester", rbac.Set(roles))
+	req := testx.NewRequest("GET", path, nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: value})
+	rec := testx.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAudit_Viewer(t *testing.T) {
+	s := newAuditServer(t, "low")
+
+	rec := getAs(s, "/audit?op=auth.*", rbac.SuperAdmin)
+	body := rec.BodyString()
+	if rec.Code != http.StatusOK || strings.Count(body, "<td>auth.login</td>") != 2 || strings.Contains(body, "rbac.denied") || !strings.Contains(body, "<td>bob</td>") {
+		t.Fatalf("%d\n%s", rec.Code, body)
+	}
+	if rec := getAs(s, "/audit", rbac.Helpdesk); rec.Code != http.StatusForbidden {
+		t.Fatalf("helpdesk: %d", rec.Code)
+	}
+	if rec := getAs(s, "/audit?from=yesterday", rbac.Auditor); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("bad from: %d", rec.Code)
+	}
+
+	// one entry per page, the older link carries the filter on
+	rec = getAs(s, "/api/audit?user=anna&limit=1", rbac.Auditor)
+	var page audit.Page
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil || len(page.Entries) != 1 || page.Entries[0].Op != "rbac.denied" || page.Next != 2 {
+		t.Fatalf("json: %s %v", rec.BodyString(), err)
+	}
+	rec = getAs(s, "/audit?user=anna&limit=1", rbac.Auditor)
+	if !strings.Contains(rec.BodyString(), `href="/audit?before=2&amp;user=anna"`) {
+		t.Fatalf("no older link:\n%s", rec.BodyString())
+	}
+	rec = getAs(s, "/api/audit?reqid=req-1", rbac.Auditor)
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil || len(page.Entries) != 1 || page.Entries[0].Seq != 1 {
+		t.Fatalf("reqid: %s", rec.BodyString())
+	}
+}
+
+func TestAudit_PrivacyHigh(t *testing.T) {
+	s := newAuditServer(t, "high")
+
+	// superadmin reads the log, but without names
+	rec := getAs(s, "/api/audit", rbac.SuperAdmin)
+	var page audit.Page
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil || len(page.Entries) != 3 {
+		t.Fatalf("%s %v", rec.BodyString(), err)
+	}
+	for _, e := range page.Entries {
+		ip, _ := e.Data.(map[string]any)["ip"].(string)
+		if !strings.HasPrefix(e.User, "p-") || (ip != "" && !strings.HasPrefix(ip, "p-")) {
+			t.Fatalf("not pseudonymised: %+v", e)
+		}
+	}
+	if strings.Contains(rec.BodyString(), "anna") || strings.Contains(rec.BodyString(), "10.0.0.1") {
+		t.Fatalf("clear data leaked: %s", rec.BodyString())
+	}
+	// filtering by the clear name must not reveal anything either
+	rec = getAs(s, "/api/audit?user=anna", rbac.SuperAdmin)
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil || len(page.Entries) != 0 {
+		t.Fatalf("clear-name filter: %s", rec.BodyString())
+	}
+	if rec := getAs(s, "/audit", rbac.SuperAdmin); !strings.Contains(rec.BodyString(), "pseudonymisiert") {
+		t.Fatal("no privacy notice")
+	}
+
+	rec = getAs(s, "/api/audit?user=anna", rbac.Auditor)
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil || len(page.Entries) != 2 {
+		t.Fatalf("auditor: %s", rec.BodyString())
+	}
+}
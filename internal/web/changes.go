@@ -0,0 +1,349 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Weruminger/go-ad-admin/internal/audit"
+	"github.com/Weruminger/go-ad-admin/internal/change"
+	"github.com/Weruminger/go-ad-admin/internal/domain"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/kea"
+	"github.com/Weruminger/go-ad-admin/internal/ldap"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+	"github.com/Weruminger/go-ad-admin/internal/rbac"
+)
+
+// Action is one write operation, offered as web form at Path and as CLI
+// command. Its inputs are the Fields, by name.
+type Action struct {
+	Path   string
+	Title  string
+	Perm   rbac.Permission
+	Fields []Field
+	DHCP   bool              // runs on Kea, not on the directory
+	names  map[string]string // model field -> input, where the names differ
+	run    func(ctx context.Context, dir ldap.Client, dhcp *kea.Client, f url.Values) error
+}
+
+// Field is one input of an Action; Type is an HTML input type.
+type Field struct {
+	Name, Label, Type string
+}
+
+// formField is a field with the value shown in the form and the
+// validation messages shown next to it.
+type formField struct {
+	Field
+	Value  string
+	Errors []string
+}
+
+// Actions returns the write operations.
+func Actions() []Action { return append([]Action(nil), actions...) }
+
+// actions are the write forms, each served at its Path.
+var actions = []Action{
+	{Path: "/users/create", Title: "Benutzer anlegen", Perm: rbac.UserCreate,
+		Fields: []Field{{"dn", "DN", "text"}, {"uid", "Konto (sAMAccountName)", "text"}, {"upn", "UPN", "text"}, {"name", "Anzeigename", "text"}, {"mail", "E-Mail", "email"}},
+		run: func(_ context.Context, dir ldap.Client, _ *kea.Client, f url.Values) error {
+			dn, err := formDN(f)
+			if err != nil {
+				return err
+			}
+			return dir.CreateUser(ldap.User{DN: dn, UID: f.Get("uid"), UPN: f.Get("upn"), Name: f.Get("name"), Mail: f.Get("mail")})
+		}},
+	{Path: "/users/disable", Title: "Benutzer deaktivieren", Perm: rbac.UserEnable,
+		Fields: []Field{{"dn", "DN", "text"}},
+		run: func(_ context.Context, dir ldap.Client, _ *kea.Client, f url.Values) error {
+			dn, err := formDN(f)
+			if err != nil {
+				return err
+			}
+			return dir.DisableUser(dn)
+		}},
+	{Path: "/users/reset-password", Title: "Passwort zurücksetzen", Perm: rbac.UserResetPassword,
+		Fields: []Field{{"dn", "DN", "text"}, {"password", "Neues Passwort", "password"}, {"mustChange", "Bei nächster Anmeldung ändern", "checkbox"}},
+		run: func(_ context.Context, dir ldap.Client, _ *kea.Client, f url.Values) error {
+			dn, err := formDN(f)
+			if err != nil {
+				return err
+			}
+			return dir.ResetPassword(dn, f.Get("password"), f.Get("mustChange") != "")
+		}},
+	{Path: "/dhcp/reservations/add", Title: "Reservierung anlegen", Perm: rbac.DHCPWrite, DHCP: true,
+		Fields: []Field{{"subnet", "Subnet-ID", "number"}, {"mac", "MAC", "text"}, {"ip", "IP", "text"}, {"host", "Hostname", "text"}},
+		names:  map[string]string{"subnetId": "subnet", "hwAddress": "mac"},
+		run:    addReservation},
+	{Path: "/dhcp/reservations/delete", Title: "Reservierung löschen", Perm: rbac.DHCPWrite, DHCP: true,
+		Fields: []Field{{"subnet", "Subnet-ID", "number"}, {"ip", "IP", "text"}},
+		run: func(ctx context.Context, _ ldap.Client, dhcp *kea.Client, f url.Values) error {
+			id, err := formInt(f, "subnet")
+			if err != nil {
+				return err
+			}
+			return dhcp.DeleteReservation(ctx, id, f.Get("ip"))
+		}},
+	{Path: "/dhcp/subnets/update", Title: "Subnetz ändern", Perm: rbac.DHCPWrite, DHCP: true,
+		Fields: []Field{{"id", "Subnet-ID", "number"}, {"prefix", "Präfix", "text"}, {"pools", "Pools (kommagetrennt)", "text"}, {"validLifetime", "Lease-Dauer (s)", "number"}},
+		run:    updateSubnet},
+}
+
+// addReservation validates the reservation in f against its subnet and
+// adds it.
+func addReservation(ctx context.Context, _ ldap.Client, dhcp *kea.Client, f url.Values) error {
+	id, err := formInt(f, "subnet")
+	if err != nil {
+		return err
+	}
+	res := domain.NewDHCPReservation(nil)
+	res.SubnetID, res.HWAddress, res.IP, res.Host = id, f.Get("mac"), f.Get("ip"), f.Get("host")
+	all, err := dhcp.Subnets(ctx)
+	if err != nil {
+		return err
+	}
+	known := false
+	for _, sn := range all {
+		if sn.ID == id {
+			res.InSubnet(sn.Prefix, sn.Pools...)
+			known = true
+		}
+	}
+	if !known {
+		return errs.Field("web.form", errs.InvalidInput, "subnet", "no such subnet")
+	}
+	if err := res.Validate().Err(); err != nil {
+		return err
+	}
+	return dhcp.AddReservation(ctx, *res)
+}
+
+// updateSubnet changes the fields given in f of subnet id (or creates it)
+// and applies the plan.
+func updateSubnet(ctx context.Context, _ ldap.Client, dhcp *kea.Client, f url.Values) error {
+	id, err := formInt(f, "id")
+	if err != nil {
+		return err
+	}
+	all, err := dhcp.Subnets(ctx)
+	if err != nil {
+		return err
+	}
+	s := *domain.NewDHCPSubnet(nil)
+	s.ID = id
+	for _, x := range all {
+		if x.ID == id {
+			s = x
+		}
+	}
+	if v := f.Get("prefix"); v != "" {
+		s.Prefix = v
+	}
+	if v := f.Get("pools"); v != "" {
+		s.Pools = nil
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				s.Pools = append(s.Pools, p)
+			}
+		}
+	}
+	if f.Get("validLifetime") != "" {
+		if s.ValidLifetime, err = formInt(f, "validLifetime"); err != nil {
+			return err
+		}
+	}
+	if err := s.Validate().Err(); err != nil {
+		return err
+	}
+	p, err := dhcp.PlanSubnet(ctx, s)
+	if err != nil {
+		return err
+	}
+	return dhcp.Apply(ctx, p)
+}
+
+func formDN(f url.Values) (ldapx.DN, error) {
+	dn, err := ldapx.ParseDN(f.Get("dn"))
+	if err != nil || dn.IsZero() {
+		return ldapx.DN{}, errs.Field("web.form", errs.InvalidInput, "dn", "is required")
+	}
+	return dn, nil
+}
+
+func formInt(f url.Values, name string) (int, error) {
+	n, err := strconv.Atoi(f.Get(name))
+	if err != nil || n < 1 {
+		return 0, errs.Field("web.form", errs.InvalidInput, name, "must be a positive number")
+	}
+	return n, nil
+}
+
+// handleAction serves the form of a (GET, prefilled from the query) and
+// runs it on POST. With the "preview" button the operation runs as a dry
+// run: it is validated and the LDAP operations, Kea commands and audit
+// entries it would produce are shown, nothing is sent or logged.
+func (s *Server) handleAction(a Action) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		op := errs.Op("web.Action")
+		form := r.URL.Query()
+		if r.Method == http.MethodPost {
+			if err := r.ParseForm(); err != nil {
+				writeError(w, r, errs.New(op, errs.BadRequest, err, nil))
+				return
+			}
+			form = r.PostForm
+		}
+		data := map[string]any{"Action": a}
+		data["Fields"], data["Errors"] = formFields(a, form, nil)
+		if r.Method != http.MethodPost {
+			s.render(w, r, "change", data)
+			return
+		}
+		switch {
+		case a.DHCP && s.dhcp == nil:
+			writeError(w, r, errs.New(op, errs.Unavailable, errors.New("no Kea control agent configured"), nil))
+			return
+		case !a.DHCP && s.dir == nil:
+			writeError(w, r, errs.New(op, errs.Unavailable, errors.New("no directory configured"), nil))
+			return
+		}
+		if form.Get("preview") != "" {
+			pv, err := s.preview(r, a, form)
+			if err != nil {
+				s.formError(w, r, a, form, data, err)
+				return
+			}
+			data["Preview"] = pv
+			s.render(w, r, "change", data)
+			return
+		}
+		ctx := change.NewContext(r.Context(), s.recorder(r))
+		if err := a.run(ctx, s.directory(r), s.dhcp, form); err != nil {
+			s.formError(w, r, a, form, data, err)
+			return
+		}
+		data["Done"] = true
+		s.render(w, r, "change", data)
+	}
+}
+
+// formError shows the form of a again with the field errors of err next
+// to the inputs (422); errors without fields go to writeError.
+func (s *Server) formError(w http.ResponseWriter, r *http.Request, a Action, form url.Values, data map[string]any, err error) {
+	fields := errs.FieldErrors(err)
+	if fields == nil || !errs.IsCode(err, errs.InvalidInput) {
+		writeError(w, r, err)
+		return
+	}
+	data["Fields"], data["Errors"] = formFields(a, form, fields)
+	s.renderStatus(w, r, http.StatusUnprocessableEntity, "change", data)
+}
+
+// formFields fills the fields of a from form and attaches the messages of
+// fieldErrs (see errs.FieldErrors); an index like "pools[1]" counts for
+// its input. Messages for fields without input are returned as "field:
+// message". Passwords are never sent back to the browser.
+func formFields(a Action, form url.Values, fieldErrs map[string][]string) ([]formField, []string) {
+	out := make([]formField, len(a.Fields))
+	at := map[string]int{}
+	for i, f := range a.Fields {
+		out[i] = formField{Field: f}
+		if f.Type != "password" {
+			out[i].Value = form.Get(f.Name)
+		}
+		at[f.Name] = i
+	}
+	keys := make([]string, 0, len(fieldErrs))
+	for k := range fieldErrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var rest []string
+	for _, field := range keys {
+		name, _, _ := strings.Cut(field, "[")
+		if n, ok := a.names[name]; ok {
+			name = n
+		}
+		if i, ok := at[name]; ok {
+			out[i].Errors = append(out[i].Errors, fieldErrs[field]...)
+			continue
+		}
+		for _, msg := range fieldErrs[field] {
+			rest = append(rest, field+": "+msg)
+		}
+	}
+	return out, rest
+}
+
+// Exec runs a with the inputs form on dir and dhcp; rec receives the
+// change records (see ldap.Recording).
+func Exec(ctx context.Context, a Action, form url.Values, dir ldap.Client, dhcp *kea.Client, rec change.Recorder) error {
+	if dir != nil {
+		dir = ldap.Recording(dir, rec)
+	}
+	return a.run(change.NewContext(ctx, rec), dir, dhcp, form)
+}
+
+// Preview is the outcome of a dry run.
+type Preview struct {
+	LDIF     string          // LDAP write requests
+	Commands string          // Kea commands, JSON
+	Records  []change.Record // changes the audit log would record
+}
+
+// DryRun runs a with the inputs form on dry-run clients made from dir
+// (a ldap.DryRunner, unused for DHCP actions) and dhcp: everything is validated and read as for the
+// real operation, nothing is written.
+func DryRun(ctx context.Context, a Action, form url.Values, dir ldap.Client, dhcp *kea.Client) (Preview, error) {
+	op := errs.Op("web.DryRun")
+	var pv Preview
+	rec := change.RecorderFunc(func(r change.Record) error {
+		pv.Records = append(pv.Records, r)
+		return nil
+	})
+	ctx, kp := kea.DryRun(ctx)
+	ctx = change.NewContext(ctx, rec)
+	var lp *ldap.Plan
+	if dir != nil && !a.DHCP {
+		dr, ok := dir.(ldap.DryRunner)
+		if !ok {
+			return pv, errs.New(op, errs.Unavailable, errors.New("directory does not support dry runs"), nil)
+		}
+		dir, lp = dr.DryRun()
+		dir = ldap.Previewing(dir, rec)
+	}
+	if err := a.run(ctx, dir, dhcp, form); err != nil {
+		return pv, err
+	}
+	if lp != nil {
+		pv.LDIF = lp.LDIF()
+	}
+	if len(kp.Commands) > 0 {
+		b, err := json.MarshalIndent(kp.Commands, "", "  ")
+		if err != nil {
+			return pv, errs.New(op, errs.Internal, err, nil)
+		}
+		pv.Commands = string(b)
+	}
+	return pv, nil
+}
+
+// preview runs a as DryRun for r; Entries are the audit entries the
+// records would become.
+func (s *Server) preview(r *http.Request, a Action, form url.Values) (map[string]any, error) {
+	pv, err := DryRun(r.Context(), a, form, s.dir, s.dhcp)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]audit.Entry, len(pv.Records))
+	for i, rec := range pv.Records {
+		entries[i] = entry(r, rec.Op(), sessionUser(r), rec.Fields())
+	}
+	return map[string]any{"LDIF": pv.LDIF, "Commands": pv.Commands, "Entries": entries}, nil
+}
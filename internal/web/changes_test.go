@@ -0,0 +1,84 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/audit"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+	"github.com/Weruminger/go-ad-admin/internal/rbac"
+	"github.com/Weruminger/go-ad-admin/internal/testx"
+)
+
+func postAs(s *Server, path string, form url.Values, roles ...rbac.Role) *testx.Response {
+	sess, value := s.sessions.create("tester", "", "Tester", rbac.Set(roles))
+	form.Set(csrfFieldName, sess.CSRF)
+	return postForm(s, path, form, &http.Cookie{Name: sessionCookie, Value: value})
+}
+
+func TestAction_PreviewThenRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	s := newAuthServer(t, WithAudit(&audit.Writer{Path: path}))
+	anna := ldapx.MustParseDN("CN=Anna,CN=Users,DC=example,DC=com")
+
+	if rec := getAs(s, "/users/disable?dn="+url.QueryEscape(anna.String()), rbac.UserAdmin); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `value="CN=Anna,CN=Users,DC=example,DC=com"`) {
+		t.Fatalf("form: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec := postAs(s, "/users/disable", url.Values{"dn": {anna.String()}, "preview": {"1"}}, rbac.UserAdmin)
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, "changetype: modify") || !strings.Contains(body, "replace: userAccountControl") ||
+		!strings.Contains(body, "aduser.disable") || !strings.Contains(body, "Vorschau") {
+		t.Fatalf("preview: %d %s", rec.Code, body)
+	}
+	if u, err := s.dir.GetUser(anna); err != nil || !u.Enabled {
+		t.Fatalf("preview changed the user: %+v %v", u, err)
+	}
+	if raw, _ := os.ReadFile(path); strings.Contains(string(raw), "aduser.disable") {
+		t.Fatal("preview was audited")
+	}
+
+	rec = postAs(s, "/users/reset-password", url.Values{"dn": {anna.String()}, "password": {"N3w-pass!"}, "preview": {"1"}}, rbac.UserAdmin)
+	if body := rec.Body.String(); strings.Contains(body, "N3w-pass!") {
+		t.Fatalf("password echoed: %s", body)
+	}
+
+	if rec := postAs(s, "/users/disable", url.Values{"dn": {anna.String()}}, rbac.UserAdmin); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Ausgeführt") {
+		t.Fatalf("run: %d %s", rec.Code, rec.Body.String())
+	}
+	if u, _ := s.dir.GetUser(anna); u.Enabled {
+		t.Fatal("user still enabled")
+	}
+	entries := auditOps(t, path)
+	if last := entries[len(entries)-1]; last.Op != "aduser.disable" || last.User != "tester" {
+		t.Fatalf("audit %+v", last)
+	}
+
+	if rec := postAs(s, "/users/disable", url.Values{"dn": {anna.String()}, "preview": {"1"}}, rbac.Helpdesk); rec.Code != http.StatusForbidden {
+		t.Fatalf("helpdesk preview: %d", rec.Code)
+	}
+}
+
+func TestAction_FieldErrors(t *testing.T) {
+	fake, s := newDHCPServer(t) // subnet 1 = 192.0.2.0/24
+	form := url.Values{"subnet": {"1"}, "mac": {"zz"}, "ip": {"198.51.100.7"}, "host": {"bad host"}}
+	rec := postAs(s, "/dhcp/reservations/add", form, rbac.DHCPAdmin)
+	body := rec.Body.String()
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(body, `id="mac-error"`) ||
+		!strings.Contains(body, "198.51.100.7 is outside subnet 192.0.2.0/24") || !strings.Contains(body, `id="host-error"`) ||
+		!strings.Contains(body, `value="198.51.100.7"`) {
+		t.Fatalf("field errors: %d %s", rec.Code, body)
+	}
+	if got := fake.Hosts(); len(got) != 0 {
+		t.Fatalf("invalid reservation stored: %+v", got)
+	}
+
+	form.Set("subnet", "9")
+	if rec := postAs(s, "/dhcp/reservations/add", form, rbac.DHCPAdmin); rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), `id="subnet-error"`) {
+		t.Fatalf("unknown subnet: %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -1,9 +1,6 @@
 package web
 
-import "embed"
+import tplfs "github.com/Weruminger/go-ad-admin/web/templates"
 
-/*
-	go:embed ../../web/templates/*
-*/
-
-var templates embed.FS
+// templates are compiled into the binary, no working-directory lookup needed.
+var templates = tplfs.FS
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/Weruminger/go-ad-admin/internal/errs"
 )
@@ -26,6 +27,25 @@ func writeError(w http.ResponseWriter, r *http.Request, err error) {
 			status = http.StatusUnprocessableEntity
 			code = e.Code
 			msg = "Eingabe ungültig."
+		case errs.BadRequest:
+			status = http.StatusBadRequest
+			code = e.Code
+			msg = "Ungültige Anfrage."
+		case errs.Unauthorized:
+			status = http.StatusUnauthorized
+			code = e.Code
+			msg = "Anmeldung erforderlich."
+		case errs.Forbidden:
+			status = http.StatusForbidden
+			code = e.Code
+			msg = "Keine Berechtigung."
+		case errs.RateLimited:
+			status = http.StatusTooManyRequests
+			code = e.Code
+			msg = "Zu viele Anfragen. Bitte später erneut versuchen."
+			if secs, ok := e.Fields["retryAfter"].(int); ok {
+				w.Header().Set("Retry-After", strconv.Itoa(secs))
+			}
 		case errs.NotFound:
 			status = http.StatusNotFound
 			code = e.Code
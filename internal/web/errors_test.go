@@ -22,6 +22,11 @@ func TestWriteError_Mapping(t *testing.T) {
 		{errs.New("web.Search", errs.InvalidInput, fmt.Errorf("bad q"), nil), http.StatusUnprocessableEntity, `"code":"INVALID_INPUT"`},
 		{errs.New("ldap.Search", errs.Timeout, fmt.Errorf("ctx"), nil), http.StatusServiceUnavailable, `"code":"TIMEOUT"`},
 		{errs.New("ldap.Get", errs.NotFound, fmt.Errorf("dn"), nil), http.StatusNotFound, `"code":"NOT_FOUND"`},
+		{errs.New("web.checkCSRF", errs.BadRequest, fmt.Errorf("missing token"), nil), http.StatusBadRequest, `"code":"BAD_REQUEST"`},
+		{errs.New("web.requireSession", errs.Unauthorized, fmt.Errorf("no session"), nil), http.StatusUnauthorized, `"code":"UNAUTHORIZED"`},
+		{errs.New("ldap.Modify", errs.Forbidden, fmt.Errorf("outside OU"), nil), http.StatusForbidden, `"code":"FORBIDDEN"`},
+		{errs.New("web.Login", errs.RateLimited, fmt.Errorf("slow down"), map[string]any{"retryAfter": 7}), http.StatusTooManyRequests, `"code":"RATE_LIMITED"`},
+		{errs.List{errs.Field("aduser.Validate", errs.InvalidInput, "sam", "bad"), errs.Field("aduser.Validate", errs.InvalidInput, "upn", "bad")}, http.StatusUnprocessableEntity, `"code":"INVALID_INPUT"`},
 		{fmt.Errorf("raw"), http.StatusInternalServerError, `"code":"INTERNAL"`},
 	}
 	_ = NewServer(*(config.NewDefaultConfig())) // just ensure it builds
@@ -0,0 +1,94 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Weruminger/go-ad-admin/internal/audit"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/gdpr"
+	"github.com/Weruminger/go-ad-admin/internal/privacy"
+	"github.com/Weruminger/go-ad-admin/internal/rbac"
+)
+
+// handleGDPR shows the data-subject form and, with ?subject=, the report
+// about the subject; &format=json or &format=html download it, signed with
+// the audit key. Every report is audited as privacy.report, naming the
+// subject by token only, which is not kept for /privacy/reveal; if that
+// fails, nothing is shown.
+func (s *Server) handleGDPR(w http.ResponseWriter, r *http.Request) {
+	subject := r.URL.Query().Get("subject")
+	if subject == "" {
+		s.render(w, r, "gdpr", map[string]any{})
+		return
+	}
+	rep, err := s.gdprReport(r, subject)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := s.record(r, "privacy.report", sessionUser(r), map[string]any{"subject": privacy.FromConfig(s.cfg).Token(rep.Subject)}); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	switch r.URL.Query().Get("format") {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="gdpr-report.json"`)
+		_ = rep.WriteJSON(w)
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="gdpr-report.html"`)
+		_ = rep.WriteHTML(w)
+	default:
+		s.render(w, r, "gdpr", map[string]any{"Report": rep})
+	}
+}
+
+// handleGDPRErase pseudonymises the entries of a subject in the audit log
+// (POST), see gdpr.Erase. The tokens are not kept for /privacy/reveal.
+func (s *Server) handleGDPRErase(w http.ResponseWriter, r *http.Request) {
+	op := errs.Op("web.GDPRErase")
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.audit == nil {
+		writeError(w, r, errs.New(op, errs.Unavailable, errors.New("no audit log configured"), nil))
+		return
+	}
+	rep, err := s.gdprReport(r, r.PostFormValue("subject"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	seqs, err := gdpr.Erase(s.audit, privacy.FromConfig(s.cfg), rep, entry(r, audit.OpRedact, sessionUser(r), nil))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.render(w, r, "gdpr", map[string]any{"Erased": len(seqs), "Subject": rep.Subject})
+}
+
+// gdprReport collects the signed report about subject from the sources of
+// s, read with the permissions of the session like every other page: the
+// directory through s.directory, DHCP only with DHCPRead.
+func (s *Server) gdprReport(r *http.Request, subject string) (gdpr.Report, error) {
+	src := gdpr.Sources{Dir: s.directory(r)}
+	if s.dhcp != nil {
+		if err := s.authorize(r, rbac.DHCPRead); err != nil {
+			return gdpr.Report{}, err
+		}
+		src.DHCP = s.dhcp
+	}
+	var key audit.Signer
+	if s.audit != nil {
+		src.Audit, key = s.audit.Path, s.audit.Signer
+	}
+	rep, err := gdpr.Collect(r.Context(), src, subject)
+	if err != nil {
+		return rep, err
+	}
+	return rep, rep.Sign(key)
+}
@@ -0,0 +1,58 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/audit"
+	"github.com/Weruminger/go-ad-admin/internal/gdpr"
+	"github.com/Weruminger/go-ad-admin/internal/privacy"
+	"github.com/Weruminger/go-ad-admin/internal/rbac"
+)
+
+func TestGDPR_ReportAndErase(t *testing.T) {
+	s := newAuditServer(t, "low")
+
+	if rec := getAs(s, "/gdpr?subject=anna", rbac.SuperAdmin); rec.Code != http.StatusForbidden {
+		t.Fatalf("superadmin: %d", rec.Code)
+	}
+	rec := getAs(s, "/gdpr?subject=anna", rbac.Auditor)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.BodyString(), "Audit-Einträge: 2") {
+		t.Fatalf("report page: %d %s", rec.Code, rec.BodyString())
+	}
+	// the subject token of the privacy.report entry cannot be revealed
+	if v, ok := s.priv.Reveal(privacy.FromConfig(s.cfg).Token("anna")); ok {
+		t.Fatalf("report subject revealable as %q", v)
+	}
+	rec = getAs(s, "/gdpr?subject=anna&format=json", rbac.Auditor)
+	var rep gdpr.Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &rep); err != nil || rep.Subject != "anna" || len(rep.Audit) != 2 ||
+		!strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment") {
+		t.Fatalf("json: %s %v", rec.BodyString(), err)
+	}
+
+	if rec := getAs(s, "/gdpr/erase", rbac.Auditor); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET erase: %d", rec.Code)
+	}
+	rec = postAs(s, "/gdpr/erase", url.Values{"subject": {"anna"}}, rbac.Auditor)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.BodyString(), "2 Audit-Einträge") {
+		t.Fatalf("erase: %d %s", rec.Code, rec.BodyString())
+	}
+	if rep, err := audit.VerifyHistory(s.audit.Path, nil); err != nil || rep.Redacted != 2 {
+		t.Fatalf("verify: %+v %v", rep, err)
+	}
+	// the log now holds two report entries and the redaction, none naming anna
+	page, err := audit.Search(s.audit.Path, audit.Query{Op: "privacy.*"})
+	if err != nil || len(page.Entries) != 2 {
+		t.Fatalf("report entries: %+v %v", page, err)
+	}
+	if page, err = audit.Search(s.audit.Path, audit.Query{User: "anna"}); err != nil || len(page.Entries) != 0 {
+		t.Fatalf("anna left: %+v %v", page, err)
+	}
+	if page, err = audit.Search(s.audit.Path, audit.Query{Op: audit.OpRedact}); err != nil || len(page.Entries) != 1 || page.Entries[0].User != "tester" {
+		t.Fatalf("redact entry: %+v %v", page, err)
+	}
+}
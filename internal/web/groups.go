@@ -0,0 +1,85 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+)
+
+// groupListLimit caps the group list; narrow it down with ?q=.
+const groupListLimit = 200
+
+func (s *Server) handleGroups(w http.ResponseWriter, r *http.Request) {
+	op := errs.Op("web.Groups")
+	q := r.URL.Query().Get("q")
+	if len(q) > 256 {
+		writeError(w, r, errs.New(op, errs.InvalidInput, fmt.Errorf("q>256"), map[string]any{"len": len(q)}))
+		return
+	}
+	dir := s.directory(r)
+	if dir == nil {
+		writeError(w, r, errs.New(op, errs.Unavailable, fmt.Errorf("no directory configured"), nil))
+		return
+	}
+	var filter ldapx.Filter
+	if q != "" {
+		filter = ldapx.Or(ldapx.Contains("sAMAccountName", q), ldapx.Contains("description", q))
+	}
+	groups, err := dir.SearchGroups(filter, groupListLimit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.render(w, r, "groups", map[string]any{"Q": q, "Groups": groups, "Truncated": len(groups) == groupListLimit})
+}
+
+// handleGroup shows a group with its direct members and those it only has
+// through nested groups.
+func (s *Server) handleGroup(w http.ResponseWriter, r *http.Request) {
+	op := errs.Op("web.Group")
+	dn, err := ldapx.ParseDN(r.URL.Query().Get("dn"))
+	if err != nil || dn.IsZero() {
+		writeError(w, r, errs.New(op, errs.InvalidInput, fmt.Errorf("dn: %v", err), map[string]any{"field": "dn"}))
+		return
+	}
+	dir := s.directory(r)
+	if dir == nil {
+		writeError(w, r, errs.New(op, errs.Unavailable, fmt.Errorf("no directory configured"), nil))
+		return
+	}
+	g, err := dir.GetGroup(dn)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	all, err := dir.EffectiveMembers(dn)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var nested []ldapx.DN
+	for _, m := range all {
+		if !m.Equal(dn) && !containsDN(g.Members, m) {
+			nested = append(nested, m)
+		}
+	}
+	masked := s.masked(r)
+	if masked {
+		g = s.priv.Group(g)
+		for i, m := range nested {
+			nested[i] = s.priv.DN(m)
+		}
+	}
+	s.render(w, r, "group", map[string]any{"Group": g, "Nested": nested, "Pseudonymised": masked})
+}
+
+func containsDN(set []ldapx.DN, dn ldapx.DN) bool {
+	for _, d := range set {
+		if d.Equal(dn) {
+			return true
+		}
+	}
+	return false
+}
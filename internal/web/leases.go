@@ -0,0 +1,39 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+)
+
+// handleLeases lists the DHCPv4 leases, optionally of one subnet (?subnet=).
+func (s *Server) handleLeases(w http.ResponseWriter, r *http.Request) {
+	op := errs.Op("web.Leases")
+	var subnets []int
+	if v := r.URL.Query().Get("subnet"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 {
+			writeError(w, r, errs.New(op, errs.InvalidInput, fmt.Errorf("subnet must be a positive id"), map[string]any{"subnet": v}))
+			return
+		}
+		subnets = append(subnets, id)
+	}
+	if s.dhcp == nil {
+		writeError(w, r, errs.New(op, errs.Unavailable, fmt.Errorf("no Kea control agent configured"), nil))
+		return
+	}
+	leases, err := s.dhcp.Leases(r.Context(), subnets...)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	masked := s.masked(r)
+	if masked {
+		for i, l := range leases {
+			leases[i] = s.priv.DHCPLease(l)
+		}
+	}
+	s.render(w, r, "leases", map[string]any{"Subnet": r.URL.Query().Get("subnet"), "Leases": leases, "Pseudonymised": masked})
+}
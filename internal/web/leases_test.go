@@ -0,0 +1,58 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/kea"
+	"github.com/Weruminger/go-ad-admin/internal/kea/keatest"
+)
+
+func newDHCPServer(t *testing.T) (*keatest.Server, *Server) {
+	t.Helper()
+	fake := keatest.NewServer()
+	t.Cleanup(fake.Close)
+	cfg := fake.Config()
+	c, err := kea.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Retries = 0
+	return fake, NewServer(cfg, WithDHCP(c))
+}
+
+func TestLeases_List(t *testing.T) {
+	fake, s := newDHCPServer(t)
+	if err := fake.AddSubnet(2, "198.51.100.0/24"); err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []keatest.Lease{
+		{IPAddress: "192.0.2.10", HWAddress: "aa:bb:cc:dd:ee:01", Hostname: "pc1"},
+		{IPAddress: "198.51.100.7", HWAddress: "aa:bb:cc:dd:ee:02", Hostname: "<srv>"},
+	} {
+		if err := fake.AddLease(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	body := get(s, "/leases").BodyString()
+	if !strings.Contains(body, "192.0.2.10") || !strings.Contains(body, "&lt;srv&gt;") {
+		t.Fatalf("all leases expected:\n%s", body)
+	}
+	body = get(s, "/leases?subnet=2").BodyString()
+	if strings.Contains(body, "192.0.2.10") || !strings.Contains(body, "198.51.100.7") {
+		t.Fatalf("subnet filter:\n%s", body)
+	}
+	if rec := get(s, "/leases?subnet=x"); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("bad subnet: %d", rec.Code)
+	}
+}
+
+func TestLeases_KeaDown(t *testing.T) {
+	fake, s := newDHCPServer(t)
+	fake.Fail("lease4-get-all", 1, keatest.FaultHTTP500)
+	if rec := get(s, "/leases"); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.BodyString(), "UNAVAILABLE") {
+		t.Fatalf("got %d %s", rec.Code, rec.BodyString())
+	}
+}
@@ -0,0 +1,140 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/rbac"
+)
+
+// handleLogin shows the login form and binds the submitted credentials
+// against the directory. A successful login always starts a new session,
+// an existing one is discarded (no session fixation).
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	op := errs.Op("web.Login")
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.render(w, r, "login", map[string]any{})
+		return
+	case http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.dir == nil {
+		writeError(w, r, errs.New(op, errs.Unavailable, fmt.Errorf("no directory configured"), nil))
+		return
+	}
+	login := r.PostFormValue("user")
+	if len(login) > 256 {
+		writeError(w, r, errs.New(op, errs.InvalidInput, fmt.Errorf("user>256"), map[string]any{"len": len(login)}))
+		return
+	}
+	if err := s.guard.check(clientIP(r), login); err != nil {
+		s.loginRejected(w, r, login, err)
+		return
+	}
+	u, err := s.dir.Authenticate(login, r.PostFormValue("password"))
+	if errs.IsCode(err, errs.Unauthorized) {
+		s.loginFailed(w, r, login)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.guard.succeeded(login)
+	groups, err := s.dir.GroupsOf(u.DN)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	roles, err := rbac.Resolve(s.cfg.Roles, groups)
+	if err != nil {
+		writeError(w, r, errs.New(op, errs.Internal, err, map[string]any{"field": "roles"}))
+		return
+	}
+	if len(roles) == 0 {
+		if err := s.record(r, "auth.login.denied", u.UID, map[string]any{"reason": "no role"}); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeError(w, r, errs.New(op, errs.Forbidden, fmt.Errorf("%s has no operator role", u.UID), nil))
+		return
+	}
+	if err := s.record(r, "auth.login", u.UID, map[string]any{"roles": roles}); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		s.sessions.destroy(c.Value)
+	}
+	_, value := s.sessions.create(u.UID, u.DN.String(), u.Name, roles)
+	s.setSessionCookie(w, value)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// loginFailed counts a wrong password, locks the user name once the policy
+// says so and answers 401 with the form again.
+func (s *Server) loginFailed(w http.ResponseWriter, r *http.Request, login string) {
+	locked, until := s.guard.failed(login)
+	if err := s.record(r, "auth.login.failed", login, nil); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if locked {
+		if err := s.record(r, "auth.lockout", login, map[string]any{"until": until.UTC()}); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	s.renderStatus(w, r, http.StatusUnauthorized, "login", map[string]any{"Login": login, "Failed": true})
+}
+
+// loginRejected audits an attempt the login guard refused, rate limit or
+// lockout, and answers with its error (429).
+func (s *Server) loginRejected(w http.ResponseWriter, r *http.Request, login string, err error) {
+	data := map[string]any{}
+	var e *errs.E
+	if errors.As(err, &e) {
+		data["reason"], data["retryAfter"] = e.Fields["reason"], e.Fields["retryAfter"]
+	}
+	if rerr := s.record(r, "auth.login.rejected", login, data); rerr != nil {
+		writeError(w, r, rerr)
+		return
+	}
+	writeError(w, r, err)
+}
+
+// handleStats reports the login KPIs as JSON.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.LoginStats())
+}
+
+// LoginStats returns failures and lockouts of the last hour, the currently
+// locked user names and the active sessions.
+func (s *Server) LoginStats() LoginStats {
+	st := s.guard.stats()
+	st.ActiveSessions = s.sessions.active()
+	return st
+}
+
+// handleLogout ends the session. POST only, so a link or image elsewhere
+// cannot log the user out.
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		s.sessions.destroy(c.Value)
+	}
+	s.clearSessionCookie(w)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
@@ -0,0 +1,273 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/audit"
+	"github.com/Weruminger/go-ad-admin/internal/ldap"
+	"github.com/Weruminger/go-ad-admin/internal/ldap/ldaptest"
+	"github.com/Weruminger/go-ad-admin/internal/rbac"
+	"github.com/Weruminger/go-ad-admin/internal/testx"
+)
+
+func newAuthServer(t *testing.T, opts ...Option) *Server {
+	t.Helper()
+	dir := ldaptest.NewServer("DC=example,DC=com")
+	t.Cleanup(dir.Close)
+	if err := dir.SeedTable([][]string{{"uid", "displayName"}, {"anna", "Anna"}, {"ben", "Ben"}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, dn := range []string{"CN=Anna," + dir.UsersDN(), "CN=Ben," + dir.UsersDN()} {
+		if err := dir.SetPassword(dn, "s3cret!"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// anna is helpdesk, ben has no role
+	if err := dir.AddGroup("CN=Helpdesk,DC=example,DC=com", "CN=Anna,"+dir.UsersDN()); err != nil {
+		t.Fatal(err)
+	}
+	cfg := dir.Config()
+	cfg.Roles = map[string][]string{"helpdesk": {"CN=Helpdesk,DC=example,DC=com"}}
+	c, err := ldap.NewConn(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return NewServer(cfg, append([]Option{WithDirectory(c)}, opts...)...)
+}
+
+func postForm(s *Server, path string, form url.Values, cookies ...*http.Cookie) *testx.Response {
+	req := testx.NewRequest("POST", path, []byte(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := testx.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func sessionCookieOf(t *testing.T, rec *testx.Response) *http.Cookie {
+	t.Helper()
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == sessionCookie {
+			return c
+		}
+	}
+	t.Fatalf("no session cookie in %v", rec.Header())
+	return nil
+}
+
+func TestAuth_ProtectsRoutes(t *testing.T) {
+	s := newDirServer(t, 1)
+	for _, path := range []string{"/", "/groups", "/leases", "/group?dn=x"} {
+		rec := testx.NewRecorder()
+		s.routes().ServeHTTP(rec, testx.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" {
+			t.Errorf("GET %s: %d %q", path, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+	if rec := postForm(s, "/logout", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("POST without session: %d", rec.Code)
+	}
+	for _, path := range []string{"/login", "/healthz"} {
+		rec := testx.NewRecorder()
+		s.routes().ServeHTTP(rec, testx.NewRequest("GET", path, nil))
+		if rec.Code/100 != 2 {
+			t.Errorf("GET %s must be public: %d", path, rec.Code)
+		}
+	}
+}
+
+var reToken = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+// open GETs path like a browser holding cookie c (may be nil) and returns
+// the session cookie to use afterwards and the CSRF token of the page.
+func open(t *testing.T, s *Server, path string, c *http.Cookie) (*http.Cookie, string) {
+	t.Helper()
+	req := testx.NewRequest("GET", path, nil)
+	if c != nil {
+		req.AddCookie(c)
+	}
+	rec := testx.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	m := reToken.FindStringSubmatch(rec.BodyString())
+	if rec.Code != http.StatusOK || m == nil {
+		t.Fatalf("GET %s: %d without token\n%s", path, rec.Code, rec.BodyString())
+	}
+	for _, nc := range rec.Result().Cookies() {
+		if nc.Name == sessionCookie && nc.Value != "" {
+			c = nc
+		}
+	}
+	return c, m[1]
+}
+
+func TestAuth_LoginRotateLogout(t *testing.T) {
+	s := newAuthServer(t)
+
+	anon, token := open(t, s, "/login", nil)
+	rec := postForm(s, "/login", url.Values{"user": {"anna"}, "password": {"wrong"}, "csrf_token": {token}}, anon)
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.BodyString(), "Anmeldung fehlgeschlagen") {
+		t.Fatalf("wrong password: %d\n%s", rec.Code, rec.BodyString())
+	}
+	if len(rec.Result().Cookies()) != 0 {
+		t.Fatal("failed login must not set a cookie")
+	}
+
+	rec = postForm(s, "/login", url.Values{"user": {"anna"}, "password": {"s3cret!"}, "csrf_token": {token}}, anon)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+		t.Fatalf("login: %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	first := sessionCookieOf(t, rec)
+	if !first.HttpOnly || first.SameSite != http.SameSiteStrictMode || first.Path != "/" {
+		t.Fatalf("cookie flags: %+v", first)
+	}
+	if first.Value == anon.Value {
+		t.Fatal("session ID not rotated on login")
+	}
+	if _, ok := s.sessions.lookup(anon.Value); ok {
+		t.Fatal("pre-login session still valid")
+	}
+
+	req := testx.NewRequest("GET", "/", nil)
+	req.AddCookie(first)
+	rec = testx.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.BodyString(), "Angemeldet als <code>anna</code>") {
+		t.Fatalf("index with session: %d\n%s", rec.Code, rec.BodyString())
+	}
+
+	// logging in again with the old cookie issues a new ID and ends the old one
+	_, token = open(t, s, "/", first)
+	rec = postForm(s, "/login", url.Values{"user": {"anna"}, "password": {"s3cret!"}, "csrf_token": {token}}, first)
+	second := sessionCookieOf(t, rec)
+	if second.Value == first.Value {
+		t.Fatal("session ID not rotated")
+	}
+	if _, ok := s.sessions.lookup(first.Value); ok {
+		t.Fatal("old session still valid after login")
+	}
+
+	_, token = open(t, s, "/", second)
+	rec = postForm(s, "/logout", url.Values{"csrf_token": {token}}, second)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" || sessionCookieOf(t, rec).MaxAge >= 0 {
+		t.Fatalf("logout: %d %v", rec.Code, rec.Header())
+	}
+	if _, ok := s.sessions.lookup(second.Value); ok {
+		t.Fatal("session valid after logout")
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	s := newAuthServer(t)
+	_, value := s.sessions.create("anna", "", "Anna", rbac.Set{rbac.Helpdesk})
+	c := &http.Cookie{Name: sessionCookie, Value: value}
+	c, token := open(t, s, "/", c)
+
+	logout := func(form url.Values, header map[string]string) int {
+		req := testx.NewRequest("POST", "/logout", []byte(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		req.AddCookie(c)
+		rec := testx.NewRecorder()
+		s.routes().ServeHTTP(rec, req)
+		return rec.Code
+	}
+	cases := []struct {
+		name   string
+		form   url.Values
+		header map[string]string
+		want   int
+	}{
+		{"missing", nil, nil, http.StatusBadRequest},
+		{"wrong", url.Values{"csrf_token": {"x" + token}}, nil, http.StatusBadRequest},
+		{"foreign origin", url.Values{"csrf_token": {token}}, map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"foreign referer", url.Values{"csrf_token": {token}}, map[string]string{"Referer": "https://evil.example/x"}, http.StatusForbidden},
+		{"null origin", url.Values{"csrf_token": {token}}, map[string]string{"Origin": "null"}, http.StatusForbidden},
+		{"header", nil, map[string]string{"X-CSRF-Token": token, "Origin": "http://example.com"}, http.StatusSeeOther},
+	}
+	for _, tc := range cases {
+		if got := logout(tc.form, tc.header); got != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	// the login form needs a token as well (UC-AUTH-01: 400 without)
+	if rec := postForm(s, "/login", url.Values{"user": {"anna"}, "password": {"s3cret!"}}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("login without token: %d", rec.Code)
+	}
+}
+
+func TestLogin_LockoutAndAudit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	s := newAuthServer(t, WithAudit(&audit.Writer{Path: path}))
+	s.guard.threshold = 2
+
+	try := func(password string) *testx.Response {
+		c, token := open(t, s, "/login", nil)
+		return postForm(s, "/login", url.Values{"user": {"anna"}, "password": {password}, "csrf_token": {token}}, c)
+	}
+	if rec := try("wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("1st failure: %d", rec.Code)
+	}
+	if rec := try("wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("2nd failure: %d", rec.Code)
+	}
+	rec := try("s3cret!")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "900" || !strings.Contains(rec.BodyString(), "RATE_LIMITED") {
+		t.Fatalf("locked: %d %v %s", rec.Code, rec.Header(), rec.BodyString())
+	}
+	if st := s.LoginStats(); st.FailsLastHour != 2 || st.LockoutsLastHour != 1 || st.LockedAccounts != 1 {
+		t.Fatalf("stats %+v", st)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []string
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		var e audit.Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.User != "anna" || e.Data.(map[string]any)["ip"] == "" {
+			t.Fatalf("entry %+v", e)
+		}
+		ops = append(ops, e.Op)
+		if e.Op == "auth.login.rejected" && e.Data.(map[string]any)["reason"] != "lockout" {
+			t.Fatalf("rejected entry %+v", e)
+		}
+	}
+	if got := strings.Join(ops, ","); got != "auth.login.failed,auth.login.failed,auth.lockout,auth.login.rejected" {
+		t.Fatalf("audit ops: %s", got)
+	}
+}
+
+func TestLogin_RateLimitPerIP(t *testing.T) {
+	s := newAuthServer(t)
+	s.guard.byIP = newTokenBucket(1, 2)
+	for i, want := range []int{http.StatusSeeOther, http.StatusSeeOther, http.StatusTooManyRequests} {
+		c, token := open(t, s, "/login", nil)
+		rec := postForm(s, "/login", url.Values{"user": {"anna"}, "password": {"s3cret!"}, "csrf_token": {token}}, c)
+		if rec.Code != want {
+			t.Fatalf("attempt %d: got %d, want %d", i+1, rec.Code, want)
+		}
+		if want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Fatal("429 without Retry-After")
+		}
+	}
+	if st := s.LoginStats(); st.ActiveSessions != 2 {
+		t.Fatalf("active sessions %d", st.ActiveSessions)
+	}
+}
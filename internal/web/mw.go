@@ -2,14 +2,24 @@ package web
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/google/uuid"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
 )
 
 type ctxKey string
 
-const ctxReqID ctxKey = "reqid"
+const (
+	ctxReqID   ctxKey = "reqid"
+	ctxSession ctxKey = "session"
+)
 
 func withReqID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -31,3 +41,97 @@ func reqIDFrom(r *http.Request) string {
 	}
 	return ""
 }
+
+// withSession puts the live session of the request's cookie, logged in or
+// not, into the context. A stale cookie is cleared.
+func (s *Server) withSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie(sessionCookie); err == nil {
+			if sess, ok := s.sessions.lookup(c.Value); ok {
+				r = r.WithContext(context.WithValue(r.Context(), ctxSession, sess))
+			} else {
+				s.clearSessionCookie(w)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireSession lets requests for the public paths through and all others
+// only with a logged-in session. Page requests without one are sent to
+// /login, anything else gets a 401.
+func (s *Server) requireSession(next http.Handler, public ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, p := range public {
+			if r.URL.Path == p {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if sess, ok := sessionFrom(r); ok && sess.User != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		writeError(w, r, errs.New("web.requireSession", errs.Unauthorized, errors.New("no valid session"), nil))
+	})
+}
+
+// checkCSRF guards state-changing methods. The request must come from our
+// own origin (Origin, else Referer, if the browser sends either) and carry
+// the session's token in the csrf_token form field or the X-CSRF-Token
+// header.
+func (s *Server) checkCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+		op := errs.Op("web.checkCSRF")
+		if err := sameOrigin(r); err != nil {
+			writeError(w, r, errs.New(op, errs.Forbidden, err, nil))
+			return
+		}
+		token := r.Header.Get("X-CSRF-Token")
+		if token == "" {
+			token = r.PostFormValue(csrfFieldName)
+		}
+		if token == "" {
+			writeError(w, r, errs.New(op, errs.BadRequest, errors.New("missing CSRF token"), nil))
+			return
+		}
+		sess, ok := sessionFrom(r)
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(sess.CSRF)) != 1 {
+			writeError(w, r, errs.New(op, errs.BadRequest, errors.New("invalid CSRF token"), nil))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sameOrigin rejects requests whose Origin or Referer names another host.
+// Without either header the token alone decides.
+func sameOrigin(r *http.Request) error {
+	src := r.Header.Get("Origin")
+	if src == "" {
+		src = r.Header.Get("Referer")
+	}
+	if src == "" {
+		return nil
+	}
+	u, err := url.Parse(src)
+	if err != nil || u.Host == "" || !strings.EqualFold(u.Host, r.Host) {
+		return fmt.Errorf("cross-origin request from %q", src)
+	}
+	return nil
+}
+
+func sessionFrom(r *http.Request) (session, bool) {
+	sess, ok := r.Context().Value(ctxSession).(session)
+	return sess, ok
+}
@@ -0,0 +1,46 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/privacy"
+	"github.com/Weruminger/go-ad-admin/internal/rbac"
+)
+
+// masked reports whether r sees pseudonyms instead of personal data: with
+// privacy=high, unless the session may reveal them.
+func (s *Server) masked(r *http.Request) bool {
+	if s.cfg.PrivacyLevel != "high" {
+		return false
+	}
+	sess, _ := sessionFrom(r)
+	return !sess.Roles.Allows(rbac.AuditReveal)
+}
+
+// handleReveal resolves one pseudonym (GET: form, POST: reveal). Every
+// reveal is audited first; if that fails, nothing is revealed.
+func (s *Server) handleReveal(w http.ResponseWriter, r *http.Request) {
+	op := errs.Op("web.Reveal")
+	if r.Method != http.MethodPost {
+		s.render(w, r, "reveal", map[string]any{"Token": r.URL.Query().Get("token")})
+		return
+	}
+	token := strings.TrimSpace(r.PostFormValue("token"))
+	if !strings.HasPrefix(token, privacy.Prefix) {
+		writeError(w, r, errs.New(op, errs.InvalidInput, errors.New("not a pseudonym"), map[string]any{"field": "token"}))
+		return
+	}
+	value, ok := s.priv.Reveal(token)
+	if !ok {
+		writeError(w, r, errs.New(op, errs.NotFound, errors.New("unknown pseudonym"), map[string]any{"token": token}))
+		return
+	}
+	if err := s.record(r, "privacy.reveal", sessionUser(r), map[string]any{"token": token}); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.render(w, r, "reveal", map[string]any{"Token": token, "Value": value})
+}
@@ -0,0 +1,57 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/audit"
+	"github.com/Weruminger/go-ad-admin/internal/rbac"
+)
+
+func TestPrivacyHigh_UserSearch(t *testing.T) {
+	s := newDirServer(t, 2)
+	s.cfg.PrivacyLevel = "high"
+
+	body := getAs(s, "/?q=anna", rbac.Helpdesk).BodyString()
+	if strings.Contains(body, "Anna 001") || strings.Contains(body, "anna002") || strings.Count(body, "<td>p-") != 4 || !strings.Contains(body, "pseudonymisiert") {
+		t.Fatalf("helpdesk sees clear data:\n%s", body)
+	}
+	if body := getAs(s, "/?q=anna", rbac.Auditor).BodyString(); !strings.Contains(body, "Anna 001") || strings.Contains(body, "pseudonymisiert") {
+		t.Fatalf("auditor:\n%s", body)
+	}
+	s.cfg.PrivacyLevel = "low"
+	if body := getAs(s, "/?q=anna", rbac.Helpdesk).BodyString(); !strings.Contains(body, "Anna 001") {
+		t.Fatalf("privacy=low:\n%s", body)
+	}
+}
+
+func TestPrivacy_Reveal(t *testing.T) {
+	s := newAuditServer(t, "high")
+	var page audit.Page
+	if err := json.Unmarshal(getAs(s, "/api/audit?op=rbac.denied", rbac.SuperAdmin).Body.Bytes(), &page); err != nil || len(page.Entries) != 1 {
+		t.Fatalf("%+v %v", page, err)
+	}
+	token := page.Entries[0].User
+
+	if rec := postAs(s, "/privacy/reveal", url.Values{"token": {token}}, rbac.SuperAdmin); rec.Code != http.StatusForbidden {
+		t.Fatalf("superadmin: %d", rec.Code)
+	}
+	rec := postAs(s, "/privacy/reveal", url.Values{"token": {token}}, rbac.Auditor)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.BodyString(), "<code>anna</code>") {
+		t.Fatalf("reveal: %d %s", rec.Code, rec.BodyString())
+	}
+	if rec := postAs(s, "/privacy/reveal", url.Values{"token": {"p-000000000000"}}, rbac.Auditor); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown token: %d", rec.Code)
+	}
+	if rec := postAs(s, "/privacy/reveal", url.Values{"token": {"anna"}}, rbac.Auditor); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("no token: %d", rec.Code)
+	}
+
+	got, err := audit.Search(s.audit.Path, audit.Query{Op: "privacy.reveal"})
+	if err != nil || len(got.Entries) != 1 || got.Entries[0].User != "tester" || got.Entries[0].Data.(map[string]any)["token"] != token {
+		t.Fatalf("audit: %+v %v", got, err)
+	}
+}
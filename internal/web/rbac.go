@@ -0,0 +1,266 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/ldap"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+	"github.com/Weruminger/go-ad-admin/internal/rbac"
+)
+
+// authorize returns FORBIDDEN, and audits the denial, unless the session of
+// r has a role granting p.
+func (s *Server) authorize(r *http.Request, p rbac.Permission) error {
+	sess, _ := sessionFrom(r)
+	if sess.Roles.Allows(p) {
+		return nil
+	}
+	if err := s.record(r, "rbac.denied", sess.User, map[string]any{"permission": string(p), "method": r.Method, "path": r.URL.Path}); err != nil {
+		return err
+	}
+	return errs.New("web.authorize", errs.Forbidden, fmt.Errorf("%s not permitted", p),
+		map[string]any{"permission": string(p), "roles": sess.Roles})
+}
+
+// allow guards a route with p.
+func (s *Server) allow(p rbac.Permission, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.authorize(r, p); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// directory returns the LDAP client for r: every operation is checked
+// against the roles of the session first, so a handler cannot do more than
+// its caller may. nil if no directory is configured.
+func (s *Server) directory(r *http.Request) ldap.Client {
+	if s.dir == nil {
+		return nil
+	}
+	next := s.dir
+	if s.audit != nil {
+		next = ldap.Recording(next, s.recorder(r))
+	}
+	return guardedDirectory{
+		next:      next,
+		check:     func(p rbac.Permission) error { return s.authorize(r, p) },
+		roleGroup: func(group ldapx.DN) error { return s.authorizeRoleGroup(r, next, group) },
+	}
+}
+
+// authorizeRoleGroup returns FORBIDDEN, and audits the denial, if group is
+// a role group of Config.Roles or nested in one and the session of r does
+// not hold that role already: GroupWrite on it would let an operator grant
+// roles they do not hold, to their own account too. A superadmin may
+// change every role group.
+func (s *Server) authorizeRoleGroup(r *http.Request, dir ldap.Client, group ldapx.DN) error {
+	sess, _ := sessionFrom(r)
+	if len(s.cfg.Roles) == 0 || sess.Roles.Has(rbac.SuperAdmin) {
+		return nil
+	}
+	parents, err := dir.GroupsOf(group)
+	if err != nil && !errs.IsCode(err, errs.NotFound) {
+		return err
+	}
+	granted, err := rbac.Resolve(s.cfg.Roles, append(parents, group))
+	if err != nil {
+		return errs.New("web.authorize", errs.Internal, err, map[string]any{"field": "roles"})
+	}
+	for _, role := range granted {
+		if sess.Roles.Has(role) {
+			continue
+		}
+		if err := s.record(r, "rbac.denied", sess.User, map[string]any{"permission": string(rbac.GroupWrite), "role": string(role),
+			"group": group.String(), "method": r.Method, "path": r.URL.Path}); err != nil {
+			return err
+		}
+		return errs.New("web.authorize", errs.Forbidden, fmt.Errorf("%s grants role %s", group, role),
+			map[string]any{"permission": string(rbac.GroupWrite), "role": string(role), "roles": sess.Roles})
+	}
+	return nil
+}
+
+// guardedDirectory maps each ldap.Client operation to its permission.
+// Group writes are also refused on role groups the caller may not grant
+// (see Server.authorizeRoleGroup).
+type guardedDirectory struct {
+	next      ldap.Client
+	check     func(rbac.Permission) error
+	roleGroup func(ldapx.DN) error
+}
+
+// checkGroupWrite checks GroupWrite and the role groups behind group.
+func (g guardedDirectory) checkGroupWrite(group ldapx.DN) error {
+	if err := g.check(rbac.GroupWrite); err != nil {
+		return err
+	}
+	return g.roleGroup(group)
+}
+
+var _ ldap.Client = guardedDirectory{}
+
+func (g guardedDirectory) Ping() error { return g.next.Ping() }
+
+func (g guardedDirectory) Authenticate(login, password string) (ldap.User, error) {
+	return g.next.Authenticate(login, password)
+}
+
+func (g guardedDirectory) GroupsOf(dn ldapx.DN) ([]ldapx.DN, error) {
+	if err := g.check(rbac.GroupRead); err != nil {
+		return nil, err
+	}
+	return g.next.GroupsOf(dn)
+}
+
+func (g guardedDirectory) SearchUsers(filter ldapx.Filter, limit int) ([]ldap.User, error) {
+	if err := g.check(rbac.UserRead); err != nil {
+		return nil, err
+	}
+	return g.next.SearchUsers(filter, limit)
+}
+
+func (g guardedDirectory) SearchUsersPage(filter ldapx.Filter, pageSize int, cursor string) (ldap.UserPage, error) {
+	if err := g.check(rbac.UserRead); err != nil {
+		return ldap.UserPage{}, err
+	}
+	return g.next.SearchUsersPage(filter, pageSize, cursor)
+}
+
+func (g guardedDirectory) GetUser(dn ldapx.DN) (ldap.User, error) {
+	if err := g.check(rbac.UserRead); err != nil {
+		return ldap.User{}, err
+	}
+	return g.next.GetUser(dn)
+}
+
+func (g guardedDirectory) CreateUser(u ldap.User) error {
+	if err := g.check(rbac.UserCreate); err != nil {
+		return err
+	}
+	return g.next.CreateUser(u)
+}
+
+func (g guardedDirectory) UpdateUser(u ldap.User) error {
+	if err := g.check(rbac.UserUpdate); err != nil {
+		return err
+	}
+	return g.next.UpdateUser(u)
+}
+
+func (g guardedDirectory) DeleteUser(dn ldapx.DN) error {
+	if err := g.check(rbac.UserDelete); err != nil {
+		return err
+	}
+	return g.next.DeleteUser(dn)
+}
+
+func (g guardedDirectory) MoveUser(dn, newParent ldapx.DN) (ldapx.DN, error) {
+	if err := g.check(rbac.UserMove); err != nil {
+		return ldapx.DN{}, err
+	}
+	return g.next.MoveUser(dn, newParent)
+}
+
+func (g guardedDirectory) DisableUser(dn ldapx.DN) error {
+	if err := g.check(rbac.UserEnable); err != nil {
+		return err
+	}
+	return g.next.DisableUser(dn)
+}
+
+func (g guardedDirectory) EnableUser(dn ldapx.DN) error {
+	if err := g.check(rbac.UserEnable); err != nil {
+		return err
+	}
+	return g.next.EnableUser(dn)
+}
+
+func (g guardedDirectory) UnlockUser(dn ldapx.DN) error {
+	if err := g.check(rbac.UserUnlock); err != nil {
+		return err
+	}
+	return g.next.UnlockUser(dn)
+}
+
+func (g guardedDirectory) ResetPassword(dn ldapx.DN, password string, mustChange bool) error {
+	if err := g.check(rbac.UserResetPassword); err != nil {
+		return err
+	}
+	return g.next.ResetPassword(dn, password, mustChange)
+}
+
+func (g guardedDirectory) RequirePasswordChange(dn ldapx.DN, must bool) error {
+	if err := g.check(rbac.UserResetPassword); err != nil {
+		return err
+	}
+	return g.next.RequirePasswordChange(dn, must)
+}
+
+func (g guardedDirectory) SetExpiry(dn ldapx.DN, at *time.Time) error {
+	if err := g.check(rbac.UserExpiry); err != nil {
+		return err
+	}
+	return g.next.SetExpiry(dn, at)
+}
+
+func (g guardedDirectory) SearchGroups(filter ldapx.Filter, limit int) ([]ldap.Group, error) {
+	if err := g.check(rbac.GroupRead); err != nil {
+		return nil, err
+	}
+	return g.next.SearchGroups(filter, limit)
+}
+
+func (g guardedDirectory) GetGroup(dn ldapx.DN) (ldap.Group, error) {
+	if err := g.check(rbac.GroupRead); err != nil {
+		return ldap.Group{}, err
+	}
+	return g.next.GetGroup(dn)
+}
+
+func (g guardedDirectory) CreateGroup(gr ldap.Group) error {
+	if err := g.checkGroupWrite(gr.DN); err != nil {
+		return err
+	}
+	return g.next.CreateGroup(gr)
+}
+
+func (g guardedDirectory) UpdateGroup(gr ldap.Group) error {
+	if err := g.checkGroupWrite(gr.DN); err != nil {
+		return err
+	}
+	return g.next.UpdateGroup(gr)
+}
+
+func (g guardedDirectory) AddMembers(group ldapx.DN, members ...ldapx.DN) error {
+	if err := g.checkGroupWrite(group); err != nil {
+		return err
+	}
+	return g.next.AddMembers(group, members...)
+}
+
+func (g guardedDirectory) RemoveMembers(group ldapx.DN, members ...ldapx.DN) error {
+	if err := g.checkGroupWrite(group); err != nil {
+		return err
+	}
+	return g.next.RemoveMembers(group, members...)
+}
+
+func (g guardedDirectory) EffectiveMembers(group ldapx.DN) ([]ldapx.DN, error) {
+	if err := g.check(rbac.GroupRead); err != nil {
+		return nil, err
+	}
+	return g.next.EffectiveMembers(group)
+}
+
+func (g guardedDirectory) EffectiveGroups(dn ldapx.DN) ([]ldap.Group, error) {
+	if err := g.check(rbac.GroupRead); err != nil {
+		return nil, err
+	}
+	return g.next.EffectiveGroups(dn)
+}
@@ -0,0 +1,177 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/audit"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/ldap"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+	"github.com/Weruminger/go-ad-admin/internal/rbac"
+	"github.com/Weruminger/go-ad-admin/internal/testx"
+)
+
+func auditOps(t *testing.T, path string) []audit.Entry {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []audit.Entry
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		var e audit.Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func TestRBAC_LoginResolvesRoles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	s := newAuthServer(t, WithAudit(&audit.Writer{Path: path}))
+
+	login := func(user string) *testx.Response {
+		c, token := open(t, s, "/login", nil)
+		return postForm(s, "/login", url.Values{"user": {user}, "password": {"s3cret!"}, "csrf_token": {token}}, c)
+	}
+	rec := login("anna")
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("anna: %d", rec.Code)
+	}
+	c := sessionCookieOf(t, rec)
+	sess, ok := s.sessions.lookup(c.Value)
+	if !ok || len(sess.Roles) != 1 || sess.Roles[0] != "helpdesk" {
+		t.Fatalf("session %+v", sess)
+	}
+
+	// helpdesk may search users but not read the audit KPIs
+	for path, want := range map[string]int{"/": http.StatusOK, "/stats": http.StatusForbidden} {
+		req := testx.NewRequest("GET", path, nil)
+		req.AddCookie(c)
+		rec := testx.NewRecorder()
+		s.routes().ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("GET %s as helpdesk: %d", path, rec.Code)
+		}
+	}
+
+	// ben authenticates but holds no role
+	if rec := login("ben"); rec.Code != http.StatusForbidden {
+		t.Fatalf("ben: %d", rec.Code)
+	}
+
+	var ops []string
+	for _, e := range auditOps(t, path) {
+		ops = append(ops, e.Op)
+		if e.Op == "rbac.denied" && e.Data.(map[string]any)["permission"] != "audit.read" {
+			t.Fatalf("denied entry %+v", e)
+		}
+	}
+	if got := strings.Join(ops, ","); got != "auth.login,rbac.denied,auth.login.denied" {
+		t.Fatalf("audit ops: %s", got)
+	}
+}
+
+func TestRBAC_GuardedDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	s := newAuthServer(t, WithAudit(&audit.Writer{Path: path}))
+	sess, _ := s.sessions.create("anna", "", "Anna", rbac.Set{rbac.Helpdesk})
+	req := testx.NewRequest("POST", "/", nil)
+	dir := s.directory(req.WithContext(context.WithValue(req.Context(), ctxSession, *sess)))
+
+	anna := ldapx.MustParseDN("CN=Anna,CN=Users,DC=example,DC=com")
+	if err := dir.UnlockUser(anna); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if err := dir.RequirePasswordChange(anna, true); err != nil {
+		t.Fatalf("must change: %v", err)
+	}
+	u, err := dir.GetUser(anna)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.DN, u.UID, u.Name = ldapx.MustParseDN("CN=Carl,CN=Users,DC=example,DC=com"), "carl", "Carl"
+	if err := dir.CreateUser(u); !errs.IsCode(err, errs.Forbidden) {
+		t.Fatalf("create as helpdesk: %v", err)
+	}
+	entries := auditOps(t, path)
+	last := entries[len(entries)-1]
+	if last.Op != "rbac.denied" || last.User != "anna" || last.Data.(map[string]any)["permission"] != "user.create" {
+		t.Fatalf("audit %+v", last)
+	}
+	var must map[string]any
+	for _, e := range entries {
+		if e.Op == "aduser.require-password-change" && e.User == "anna" {
+			must = e.Data.(map[string]any)
+		}
+	}
+	if must == nil || must["target"] != anna.String() || fmt.Sprint(must["diff"]) != "[map[new:true old:<nil> path:mustChangePassword]]" {
+		t.Fatalf("change record %v in %+v", must, entries)
+	}
+}
+
+func TestRBAC_RoleGroupsNeedTheRole(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	s := newAuthServer(t, WithAudit(&audit.Writer{Path: path}))
+	admins := ldapx.MustParseDN("CN=Admins,CN=Users,DC=example,DC=com")
+	tier0 := ldapx.MustParseDN("CN=Tier0,CN=Users,DC=example,DC=com")
+	userAdmins := ldapx.MustParseDN("CN=UserAdmins,CN=Users,DC=example,DC=com")
+	staff := ldapx.MustParseDN("CN=Staff,CN=Users,DC=example,DC=com")
+	for _, g := range []ldap.Group{
+		{DN: tier0, Name: "Tier0"},
+		{DN: admins, Name: "Admins", Members: []ldapx.DN{tier0}},
+		{DN: userAdmins, Name: "UserAdmins"},
+		{DN: staff, Name: "Staff"},
+	} {
+		g.Kind, g.Scope = ldap.Security, ldap.Global
+		if err := s.dir.CreateGroup(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.cfg.Roles = map[string][]string{"superadmin": {admins.String()}, "user-admin": {userAdmins.String()}}
+
+	as := func(roles ...rbac.Role) ldap.Client {
+		sess, _ := s.sessions.create("anna", "", "Anna", rbac.Set(roles))
+		req := testx.NewRequest("POST", "/groups", nil)
+		return s.directory(req.WithContext(context.WithValue(req.Context(), ctxSession, *sess)))
+	}
+	anna := ldapx.MustParseDN("CN=Anna,CN=Users,DC=example,DC=com")
+	dir := as(rbac.UserAdmin)
+	// the role group itself and a group nested in it
+	for _, g := range []ldapx.DN{admins, tier0} {
+		if err := dir.AddMembers(g, anna); !errs.IsCode(err, errs.Forbidden) {
+			t.Fatalf("add to %s as user-admin: %v", g, err)
+		}
+		if err := dir.UpdateGroup(ldap.Group{DN: g, Name: "x", Kind: ldap.Security, Scope: ldap.Global}); !errs.IsCode(err, errs.Forbidden) {
+			t.Fatalf("update %s as user-admin: %v", g, err)
+		}
+	}
+	if grp, err := s.dir.GetGroup(admins); err != nil || len(grp.Members) != 1 {
+		t.Fatalf("admins changed: %+v %v", grp, err)
+	}
+	entries := auditOps(t, path)
+	last := entries[len(entries)-1].Data.(map[string]any)
+	if entries[len(entries)-1].Op != "rbac.denied" || last["role"] != "superadmin" || last["group"] != tier0.String() {
+		t.Fatalf("audit %+v", entries[len(entries)-1])
+	}
+
+	// a role the caller holds, and groups that grant nothing
+	for _, g := range []ldapx.DN{userAdmins, staff} {
+		if err := dir.AddMembers(g, anna); err != nil {
+			t.Fatalf("add to %s as user-admin: %v", g, err)
+		}
+	}
+	if err := as(rbac.SuperAdmin).AddMembers(admins, anna); err != nil {
+		t.Fatalf("add to admins as superadmin: %v", err)
+	}
+}
@@ -3,54 +3,257 @@ package web
 import (
 	"fmt"
 	"html/template"
+	"io/fs"
 	"net/http"
+	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
+	"github.com/Weruminger/go-ad-admin/internal/audit"
 	. "github.com/Weruminger/go-ad-admin/internal/config"
 	"github.com/Weruminger/go-ad-admin/internal/errs"
+	"github.com/Weruminger/go-ad-admin/internal/kea"
+	"github.com/Weruminger/go-ad-admin/internal/ldap"
+	"github.com/Weruminger/go-ad-admin/internal/ldapx"
+	"github.com/Weruminger/go-ad-admin/internal/privacy"
+	"github.com/Weruminger/go-ad-admin/internal/rbac"
 )
 
+// searchPageSize is the number of users shown per result page.
+const searchPageSize = 50
+
 type Server struct {
-	cfg Config
-	tpl *template.Template
-}
-
-func NewServer(cfg Config) *Server {
-	const glob = "web/templates/*.html"
-	t, err := template.ParseGlob(glob)
-	if err != nil || t == nil {
-		t = template.Must(template.New("layout").Parse(`{{define "layout"}}<!doctype html><html><head><meta charset="utf-8"><title>go-ad-admin</title></head><body>
-<main><h1>go-ad-admin</h1><p>Env: {{.Env}}</p></main>
-</body></html>{{end}}`))
-	} else {
-		matches, _ := filepath.Glob(glob)
-		if len(matches) == 0 {
-			t = template.Must(template.New("layout").Parse(`{{define "layout"}}<!doctype html><html><head><meta charset="utf-8"><title>go-ad-admin</title></head><body>
-<main><h1>go-ad-admin</h1><p>Env: {{.Env}}</p></main>
-</body></html>{{end}}`))
+	cfg      Config
+	pages    map[string]*template.Template
+	dir      ldap.Client
+	dhcp     *kea.Client
+	sessions *sessionStore
+	guard    *loginGuard
+	audit    *audit.Writer
+	priv     *privacy.Pseudonymizer
+}
+
+// Option configures optional dependencies of a Server.
+type Option func(*Server)
+
+// WithDirectory sets the LDAP client used by the user and group pages.
+func WithDirectory(c ldap.Client) Option {
+	return func(s *Server) { s.dir = c }
+}
+
+// WithAudit sets the audit log for logins and changes.
+func WithAudit(w *audit.Writer) Option {
+	return func(s *Server) { s.audit = w }
+}
+
+// WithDHCP sets the Kea client used by the lease pages.
+func WithDHCP(c *kea.Client) Option {
+	return func(s *Server) { s.dhcp = c }
+}
+
+func NewServer(cfg Config, opts ...Option) *Server {
+	s := &Server{
+		cfg:      cfg,
+		pages:    parsePages(),
+		sessions: newSessionStore(cfg.SessionKey, cfg.SessionIdleTimeout, cfg.SessionMaxAge),
+		guard:    newLoginGuard(cfg),
+		priv:     privacy.FromConfig(cfg),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// csrfFieldName is the form field checkCSRF reads the token from.
+const csrfFieldName = "csrf_token"
+
+// funcs are available in all templates. {{csrfField .CSRF}} renders the
+// hidden token input every POST form needs.
+var funcs = template.FuncMap{
+	"csrfField": func(token string) template.HTML {
+		return template.HTML(`<input type="hidden" name="` + csrfFieldName + `" value="` + template.HTMLEscapeString(token) + `">`)
+	},
+	"auditData": auditData,
+}
+
+// parsePages builds one template set per page: layout.html plus the page
+// file, so every page can define its own "content" block.
+func parsePages() map[string]*template.Template {
+	files, err := fs.Glob(templates, "*.html")
+	if err != nil {
+		panic(err)
+	}
+	pages := map[string]*template.Template{}
+	for _, f := range files {
+		if f == "layout.html" {
+			continue
 		}
+		name := strings.TrimSuffix(f, ".html")
+		pages[name] = template.Must(template.New(name).Funcs(funcs).ParseFS(templates, "layout.html", f))
+	}
+	return pages
+}
+
+func (s *Server) render(w http.ResponseWriter, r *http.Request, page string, data map[string]any) {
+	s.renderStatus(w, r, http.StatusOK, page, data)
+}
+
+func (s *Server) renderStatus(w http.ResponseWriter, r *http.Request, status int, page string, data map[string]any) {
+	t, ok := s.pages[page]
+	if !ok {
+		writeError(w, r, errs.New("web.render", errs.Internal, fmt.Errorf("unknown page %q", page), nil))
+		return
+	}
+	sess := s.ensureSession(w, r)
+	data["Env"] = s.cfg.Env
+	data["CSRF"] = sess.CSRF
+	if sess.User != "" {
+		data["Session"] = sess
 	}
-	return &Server{cfg: cfg, tpl: t}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_ = t.ExecuteTemplate(w, "layout", data)
 }
 
+// Handler returns the routes of s behind the request-ID and session
+// middleware.
+func (s *Server) Handler() http.Handler { return s.routes() }
+
 func (s *Server) routes() http.Handler {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/", s.allow(rbac.UserRead, s.handleIndex))
+	mux.HandleFunc("/groups", s.allow(rbac.GroupRead, s.handleGroups))
+	mux.HandleFunc("/group", s.allow(rbac.GroupRead, s.handleGroup))
+	mux.HandleFunc("/leases", s.allow(rbac.DHCPRead, s.handleLeases))
+	mux.HandleFunc("/login", s.handleLogin)
+	mux.HandleFunc("/logout", s.handleLogout)
+	mux.HandleFunc("/stats", s.allow(rbac.AuditRead, s.handleStats))
+	mux.HandleFunc("/audit", s.allow(rbac.AuditRead, s.handleAudit))
+	mux.HandleFunc("/api/audit", s.allow(rbac.AuditRead, s.handleAuditJSON))
+	mux.HandleFunc("/privacy/reveal", s.allow(rbac.AuditReveal, s.handleReveal))
+	mux.HandleFunc("/gdpr", s.allow(rbac.PrivacyReport, s.handleGDPR))
+	mux.HandleFunc("/gdpr/erase", s.allow(rbac.PrivacyErase, s.handleGDPRErase))
+	for _, a := range actions {
+		mux.HandleFunc(a.Path, s.allow(a.Perm, s.handleAction(a)))
+	}
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(204)
 	})
-	return withReqID(mux)
+	return withReqID(s.withSession(s.requireSession(s.checkCSRF(mux), "/login", "/healthz")))
 }
 
 func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	op := errs.Op("web.Index")
 	q := r.URL.Query().Get("q")
 	if len(q) > 256 {
-		writeError(w, r, errs.New("web.Index", errs.InvalidInput, fmt.Errorf("q>256"), map[string]any{"len": len(q)}))
+		writeError(w, r, errs.New(op, errs.InvalidInput, fmt.Errorf("q>256"), map[string]any{"len": len(q)}))
 		return
 	}
-	_ = s.tpl.ExecuteTemplate(w, "layout", map[string]any{"Env": s.cfg.Env})
+	page := 1
+	if p := r.URL.Query().Get("page"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 {
+			writeError(w, r, errs.New(op, errs.InvalidInput, fmt.Errorf("page must be >= 1"), map[string]any{"page": p}))
+			return
+		}
+		page = n
+	}
+	data := map[string]any{"Q": q, "Page": page, "PrevPage": page - 1, "NextPage": page + 1}
+	if q != "" {
+		dir := s.directory(r)
+		if dir == nil {
+			writeError(w, r, errs.New(op, errs.Unavailable, fmt.Errorf("no directory configured"), nil))
+			return
+		}
+		res, err := searchPage(dir, userQuery(q), page)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if s.masked(r) {
+			for i, u := range res.Users {
+				res.Users[i] = s.priv.User(u)
+			}
+			data["Pseudonymised"] = true
+		}
+		data["Users"] = res.Users
+		data["HasNext"] = res.Next != ""
+	}
+	s.render(w, r, "index", data)
+}
+
+// searchPage walks the paged search up to the requested page number. The
+// LDAP cursor is only valid forward, so page N costs N round trips.
+func searchPage(dir ldap.Client, filter ldapx.Filter, page int) (ldap.UserPage, error) {
+	var res ldap.UserPage
+	cursor := ""
+	for i := 1; i <= page; i++ {
+		var err error
+		res, err = dir.SearchUsersPage(filter, searchPageSize, cursor)
+		if err != nil {
+			return ldap.UserPage{}, err
+		}
+		if i < page && res.Next == "" {
+			return ldap.UserPage{}, nil
+		}
+		cursor = res.Next
+	}
+	return res, nil
 }
 
+// userQuery matches q as substring of display name, account or mail.
+func userQuery(q string) ldapx.Filter {
+	return ldapx.Or(ldapx.Contains("displayName", q), ldapx.Contains("sAMAccountName", q), ldapx.Contains("mail", q))
+}
+
+// ListenAndServe connects the LDAP and Kea clients described by cfg and
+// serves HTTP.
 func ListenAndServe(cfg Config) error {
-	return http.ListenAndServe(cfg.ListenAddr, NewServer(cfg).routes())
+	if err := rbac.Validate(cfg.Roles); err != nil {
+		return errs.New("web.ListenAndServe", errs.InvalidInput, err, map[string]any{"field": "roles"})
+	}
+	dir, err := ldap.NewConn(cfg)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	dhcp, err := kea.NewClient(cfg)
+	if err != nil {
+		return err
+	}
+	aw, err := OpenAudit(cfg)
+	if err != nil {
+		return err
+	}
+	defer aw.Close()
+	srv := NewServer(cfg, WithDirectory(dir), WithDHCP(dhcp), WithAudit(aw))
+	return http.ListenAndServe(cfg.ListenAddr, srv.Handler())
+}
+
+// OpenAudit opens the audit log described by cfg for writing.
+func OpenAudit(cfg Config) (*audit.Writer, error) {
+	op := errs.Op("web.OpenAudit")
+	signer, err := audit.ParseKey(cfg.AuditKey)
+	if err != nil {
+		return nil, errs.New(op, errs.InvalidInput, err, map[string]any{"field": "auditKey"})
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.AuditFile), 0o750); err != nil {
+		return nil, errs.New(op, errs.Internal, err, map[string]any{"file": cfg.AuditFile})
+	}
+	aw := &audit.Writer{
+		Path:         cfg.AuditFile,
+		Signer:       signer,
+		Sync:         audit.SyncMode(cfg.AuditSync),
+		SyncInterval: cfg.AuditSyncInterval,
+		MaxSize:      cfg.AuditMaxSize,
+		MaxAge:       cfg.AuditMaxAge,
+		Retention:    cfg.AuditRetention,
+		MaxSegments:  cfg.AuditMaxSegments,
+	}
+	if err := aw.Open(); err != nil {
+		return nil, errs.New(op, errs.Internal, err, map[string]any{"file": cfg.AuditFile})
+	}
+	return aw, nil
 }
@@ -0,0 +1,136 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Weruminger/go-ad-admin/internal/ldap"
+	"github.com/Weruminger/go-ad-admin/internal/ldap/ldaptest"
+	"github.com/Weruminger/go-ad-admin/internal/rbac"
+	"github.com/Weruminger/go-ad-admin/internal/testx"
+)
+
+func newDirServer(t *testing.T, users int) *Server {
+	t.Helper()
+	dir := ldaptest.NewServer("DC=example,DC=com")
+	t.Cleanup(dir.Close)
+	rows := [][]string{{"uid", "displayName"}}
+	for i := 1; i <= users; i++ {
+		rows = append(rows, []string{fmt.Sprintf("anna%03d", i), fmt.Sprintf("Anna %03d", i)})
+	}
+	rows = append(rows, []string{"bob", "Bob <Doe>"})
+	if err := dir.SeedTable(rows); err != nil {
+		t.Fatal(err)
+	}
+	cfg := dir.Config()
+	c, err := ldap.NewConn(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return NewServer(cfg, WithDirectory(c))
+}
+
+// get requests path with a fresh session, as a logged-in operator.
+func get(s *Server, path string) *testx.Response {
+	_, value := s.sessions.create("tester", "", "Tester", rbac.Set{rbac.SuperAdmin})
+	req := testx.NewRequest("GET", path, nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: value})
+	rec := testx.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIndex_PagedSearch(t *testing.T) {
+	s := newDirServer(t, searchPageSize+10)
+
+	rec := get(s, "/?q=anna")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.BodyString())
+	}
+	body := rec.BodyString()
+	if strings.Count(body, "<tr><td>Anna") != searchPageSize || !strings.Contains(body, `rel="next"`) {
+		t.Fatalf("page 1 should be full with a next link:\n%s", body)
+	}
+
+	body = get(s, "/?q=anna&page=2").BodyString()
+	if n := strings.Count(body, "<tr><td>Anna"); n != 10 || strings.Contains(body, `rel="next"`) || !strings.Contains(body, `rel="prev"`) {
+		t.Fatalf("page 2: %d rows\n%s", n, body)
+	}
+
+	body = get(s, "/?q=anna&page=3").BodyString()
+	if !strings.Contains(body, "Keine Treffer.") {
+		t.Fatalf("page beyond the end should be empty:\n%s", body)
+	}
+}
+
+func TestIndex_EscapesQueryAndOutput(t *testing.T) {
+	s := newDirServer(t, 0)
+	body := get(s, "/?q=%3CDoe%3E").BodyString()
+	if !strings.Contains(body, "Bob &lt;Doe&gt;") {
+		t.Fatalf("result missing or not escaped:\n%s", body)
+	}
+	if rec := get(s, "/?q=*)(objectClass=*"); rec.Code != http.StatusOK || !strings.Contains(rec.BodyString(), "Keine Treffer.") {
+		t.Fatalf("filter injection must not match anything: %d\n%s", rec.Code, rec.BodyString())
+	}
+}
+
+func TestIndex_InvalidPage(t *testing.T) {
+	s := newDirServer(t, 1)
+	for _, p := range []string{"0", "-1", "x"} {
+		if rec := get(s, "/?q=anna&page="+p); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("page=%s: got %d", p, rec.Code)
+		}
+	}
+}
+
+func TestGroupPage_DirectAndNested(t *testing.T) {
+	dir := ldaptest.NewServer("DC=example,DC=com")
+	t.Cleanup(dir.Close)
+	if err := dir.SeedTable([][]string{{"uid", "displayName"}, {"anna", "Anna"}, {"bob", "Bob"}}); err != nil {
+		t.Fatal(err)
+	}
+	users := dir.UsersDN()
+	if err := dir.AddGroup("CN=Inner,"+users, "CN=Anna,"+users); err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.AddGroup("CN=Outer,"+users, "CN=Inner,"+users, "CN=Bob,"+users); err != nil {
+		t.Fatal(err)
+	}
+	cfg := dir.Config()
+	c, err := ldap.NewConn(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	s := NewServer(cfg, WithDirectory(c))
+
+	rec := get(s, "/groups")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.BodyString(), `href="/group?dn=CN%3dOuter%2cCN%3dUsers`) {
+		t.Fatalf("group list %d:\n%s", rec.Code, rec.BodyString())
+	}
+
+	rec = get(s, "/group?dn="+url.QueryEscape("CN=Outer,"+users))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.BodyString())
+	}
+	body := rec.BodyString()
+	direct := body[strings.Index(body, `id="direct"`):strings.Index(body, `id="nested"`)]
+	nested := body[strings.Index(body, `id="nested"`):]
+	if !strings.Contains(direct, "CN=Inner") || !strings.Contains(direct, "CN=Bob") || strings.Contains(direct, "CN=Anna") {
+		t.Fatalf("direct members:\n%s", direct)
+	}
+	if !strings.Contains(nested, "CN=Anna") || strings.Contains(nested, "CN=Bob") {
+		t.Fatalf("nested members:\n%s", nested)
+	}
+
+	if rec := get(s, "/group?dn="+url.QueryEscape("CN=Anna,"+users)); rec.Code != http.StatusNotFound {
+		t.Fatalf("user as group: got %d", rec.Code)
+	}
+	if rec := get(s, "/group?dn=nonsense"); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("bad dn: got %d", rec.Code)
+	}
+}
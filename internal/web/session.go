@@ -0,0 +1,176 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Weruminger/go-ad-admin/internal/rbac"
+)
+
+// sessionCookie is the name of the cookie carrying the signed session ID.
+const sessionCookie = "go_ad_session"
+
+// session is the server-side state of one browser. Before login User is
+// empty; the session then only carries the CSRF token of the login form.
+type session struct {
+	ID       string
+	CSRF     string // synchronizer token for state-changing requests
+	User     string // sAMAccountName, "" before login
+	DN       string
+	Name     string   // displayName
+	Roles    rbac.Set // resolved from group membership at login
+	Created  time.Time
+	LastSeen time.Time
+}
+
+// sessionStore keeps sessions in memory. Cookie values are the session ID
+// plus an HMAC-SHA256 over it keyed with Config.SessionKey, so forged or
+// guessed IDs are rejected before the lookup.
+type sessionStore struct {
+	key      []byte
+	idle     time.Duration // expires without requests
+	absolute time.Duration // expires after login regardless of activity
+	now      func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func newSessionStore(key string, idle, absolute time.Duration) *sessionStore {
+	return &sessionStore{
+		key:      []byte(key),
+		idle:     idle,
+		absolute: absolute,
+		now:      time.Now,
+		sessions: map[string]*session{},
+	}
+}
+
+// create starts a session for the user ("" for an anonymous one) and
+// returns it with its cookie value. Expired sessions are swept on the way.
+func (st *sessionStore) create(user, dn, name string, roles rbac.Set) (*session, string) {
+	now := st.now()
+	s := &session{ID: randToken(), CSRF: randToken(), User: user, DN: dn, Name: name, Roles: roles, Created: now, LastSeen: now}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for id, old := range st.sessions {
+		if st.expired(old, now) {
+			delete(st.sessions, id)
+		}
+	}
+	st.sessions[s.ID] = s
+	return s, s.ID + "." + st.sign(s.ID)
+}
+
+// lookup returns a copy of the live session of a cookie value and marks
+// it as used. Expired sessions are dropped.
+func (st *sessionStore) lookup(value string) (session, bool) {
+	id, ok := st.verify(value)
+	if !ok {
+		return session{}, false
+	}
+	now := st.now()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	s, ok := st.sessions[id]
+	if !ok {
+		return session{}, false
+	}
+	if st.expired(s, now) {
+		delete(st.sessions, id)
+		return session{}, false
+	}
+	s.LastSeen = now
+	return *s, true
+}
+
+// destroy ends the session of a cookie value, if any.
+func (st *sessionStore) destroy(value string) {
+	if id, ok := st.verify(value); ok {
+		st.mu.Lock()
+		delete(st.sessions, id)
+		st.mu.Unlock()
+	}
+}
+
+// active counts the live logged-in sessions.
+func (st *sessionStore) active() int {
+	now := st.now()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	n := 0
+	for _, s := range st.sessions {
+		if s.User != "" && !st.expired(s, now) {
+			n++
+		}
+	}
+	return n
+}
+
+func randToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (st *sessionStore) expired(s *session, now time.Time) bool {
+	return now.Sub(s.LastSeen) > st.idle || now.Sub(s.Created) > st.absolute
+}
+
+func (st *sessionStore) sign(id string) string {
+	m := hmac.New(sha256.New, st.key)
+	m.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+func (st *sessionStore) verify(value string) (string, bool) {
+	id, sig, ok := strings.Cut(value, ".")
+	if !ok || id == "" {
+		return "", false
+	}
+	return id, hmac.Equal([]byte(sig), []byte(st.sign(id)))
+}
+
+// setSessionCookie sends value as HttpOnly, SameSite=Strict cookie; Secure
+// in prod. The cookie has no Max-Age: the server decides when it expires.
+func (s *Server) setSessionCookie(w http.ResponseWriter, value string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   s.cfg.Env == "prod",
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func (s *Server) clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   s.cfg.Env == "prod",
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// ensureSession returns the session of r, starting an anonymous one if
+// there is none so that forms rendered for r can carry a CSRF token. Must
+// be called before the response header is written.
+func (s *Server) ensureSession(w http.ResponseWriter, r *http.Request) session {
+	if sess, ok := sessionFrom(r); ok {
+		return sess
+	}
+	sess, value := s.sessions.create("", "", "", nil)
+	s.setSessionCookie(w, value)
+	return *sess
+}
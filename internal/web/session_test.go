@@ -0,0 +1,59 @@
+package web
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionStore_Timeouts(t *testing.T) {
+	now := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	st := newSessionStore("k", 30*time.Minute, 8*time.Hour)
+	st.now = func() time.Time { return now }
+
+	_, value := st.create("anna", "CN=Anna", "Anna", nil)
+	for i := 0; i < 20; i++ { // active for 7h40m
+		now = now.Add(23 * time.Minute)
+		if _, ok := st.lookup(value); !ok {
+			t.Fatalf("session lost after %s of activity", now.Sub(time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)))
+		}
+	}
+	now = now.Add(21 * time.Minute)
+	if _, ok := st.lookup(value); ok {
+		t.Fatal("absolute timeout not enforced")
+	}
+
+	_, value = st.create("anna", "CN=Anna", "Anna", nil)
+	now = now.Add(31 * time.Minute)
+	if _, ok := st.lookup(value); ok {
+		t.Fatal("idle timeout not enforced")
+	}
+
+	st.create("bob", "CN=Bob", "Bob", nil)
+	now = now.Add(time.Hour)
+	st.create("anna", "CN=Anna", "Anna", nil)
+	if len(st.sessions) != 1 {
+		t.Fatalf("expired sessions kept: %d", len(st.sessions))
+	}
+}
+
+func TestSessionStore_RejectsForgedCookies(t *testing.T) {
+	st := newSessionStore("k", time.Hour, time.Hour)
+	s, value := st.create("anna", "CN=Anna", "Anna", nil)
+	if got, ok := st.lookup(value); !ok || got.User != "anna" {
+		t.Fatalf("lookup %+v %v", got, ok)
+	}
+	other := newSessionStore("other key", time.Hour, time.Hour)
+	other.sessions[s.ID] = s
+	for _, v := range []string{s.ID, s.ID + ".", s.ID + ".AAAA", value[:len(value)-1] + "x"} {
+		if _, ok := st.lookup(v); ok {
+			t.Errorf("%q accepted", v)
+		}
+	}
+	if _, ok := other.lookup(value); ok {
+		t.Error("cookie signed with another key accepted")
+	}
+	st.destroy(value)
+	if _, ok := st.lookup(value); ok {
+		t.Fatal("destroyed session still valid")
+	}
+}
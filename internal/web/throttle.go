@@ -0,0 +1,201 @@
+package web
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/Weruminger/go-ad-admin/internal/config"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+)
+
+// tokenBucket limits events per key: a key holds up to burst tokens and
+// regains rate tokens per second. Callers hold the lock of the owner.
+type tokenBucket struct {
+	rate    float64 // tokens per second
+	burst   float64
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(perMinute, burst int) *tokenBucket {
+	return &tokenBucket{rate: float64(perMinute) / 60, burst: float64(burst), buckets: map[string]*bucket{}}
+}
+
+// take uses one token of key. It returns 0 if there was one, otherwise how
+// long until the next one is available.
+func (tb *tokenBucket) take(key string, now time.Time) time.Duration {
+	tb.sweep(now)
+	b, ok := tb.buckets[key]
+	if !ok {
+		b = &bucket{tokens: tb.burst, last: now}
+		tb.buckets[key] = b
+	}
+	b.tokens = math.Min(tb.burst, b.tokens+now.Sub(b.last).Seconds()*tb.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / tb.rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// sweep drops buckets that are full again, at most once a minute, so keys
+// of past clients do not pile up.
+func (tb *tokenBucket) sweep(now time.Time) {
+	if now.Sub(tb.swept) < time.Minute {
+		return
+	}
+	tb.swept = now
+	for k, b := range tb.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*tb.rate >= tb.burst {
+			delete(tb.buckets, k)
+		}
+	}
+}
+
+// LoginStats are the login KPIs of AUTH.md.
+type LoginStats struct {
+	FailsLastHour    int `json:"failsLastHour"`
+	LockoutsLastHour int `json:"lockoutsLastHour"`
+	LockedAccounts   int `json:"lockedAccounts"`
+	ActiveSessions   int `json:"activeSessions"`
+}
+
+// loginGuard rate-limits login attempts per client IP and per user name and
+// locks a user name after LockoutThreshold failures within LockoutWindow
+// for LockoutDuration. The lockout is our own and does not touch AD's
+// lockoutTime, so a guessing attack cannot lock the account directory-wide.
+type loginGuard struct {
+	now       func() time.Time
+	threshold int
+	window    time.Duration
+	duration  time.Duration
+
+	mu       sync.Mutex
+	byIP     *tokenBucket
+	byUser   *tokenBucket
+	failures map[string][]time.Time // user -> failures within window
+	locked   map[string]time.Time   // user -> locked until
+	fails    []time.Time            // last hour, for LoginStats
+	lockouts []time.Time
+}
+
+func newLoginGuard(cfg Config) *loginGuard {
+	return &loginGuard{
+		now:       time.Now,
+		threshold: cfg.LockoutThreshold,
+		window:    cfg.LockoutWindow,
+		duration:  cfg.LockoutDuration,
+		byIP:      newTokenBucket(cfg.LoginRate, cfg.LoginBurst),
+		byUser:    newTokenBucket(cfg.LoginRate, cfg.LoginBurst),
+		failures:  map[string][]time.Time{},
+		locked:    map[string]time.Time{},
+	}
+}
+
+// check admits an attempt by ip for user, or returns RATE_LIMITED with
+// Fields["retryAfter"] in whole seconds. A locked user is reported the same
+// way with Fields["reason"] = "lockout".
+func (g *loginGuard) check(ip, user string) error {
+	op := errs.Op("web.loginGuard")
+	user = loginKey(user)
+	now := g.now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if until, ok := g.locked[user]; ok {
+		if now.Before(until) {
+			return errs.New(op, errs.RateLimited, errors.New("account temporarily locked"),
+				map[string]any{"reason": "lockout", "retryAfter": seconds(until.Sub(now))})
+		}
+		delete(g.locked, user)
+	}
+	if wait := g.byIP.take(ip, now); wait > 0 {
+		return errs.New(op, errs.RateLimited, errors.New("too many login attempts from this address"),
+			map[string]any{"reason": "ip", "retryAfter": seconds(wait)})
+	}
+	if wait := g.byUser.take(user, now); wait > 0 {
+		return errs.New(op, errs.RateLimited, errors.New("too many login attempts for this user"),
+			map[string]any{"reason": "user", "retryAfter": seconds(wait)})
+	}
+	return nil
+}
+
+// failed records a failed attempt and reports whether it locked the user.
+func (g *loginGuard) failed(user string) (bool, time.Time) {
+	user = loginKey(user)
+	now := g.now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.fails = append(lastHour(g.fails, now), now)
+	recent := g.failures[user][:0]
+	for _, t := range g.failures[user] {
+		if now.Sub(t) < g.window {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	if len(recent) < g.threshold {
+		g.failures[user] = recent
+		return false, time.Time{}
+	}
+	delete(g.failures, user)
+	until := now.Add(g.duration)
+	g.locked[user] = until
+	g.lockouts = append(lastHour(g.lockouts, now), now)
+	return true, until
+}
+
+// succeeded clears the failures of user.
+func (g *loginGuard) succeeded(user string) {
+	g.mu.Lock()
+	delete(g.failures, loginKey(user))
+	g.mu.Unlock()
+}
+
+// loginKey is the account a login names, as the key of the per-user
+// counters. Authenticate takes the sAMAccountName or the userPrincipalName,
+// and AD matches both ignoring case and surrounding blanks, so "anna",
+// " Anna " and "anna@example.com" count against the same account.
+func loginKey(login string) string {
+	login = strings.ToLower(strings.TrimSpace(login))
+	if i := strings.LastIndexByte(login, '@'); i >= 0 {
+		login = strings.TrimSpace(login[:i])
+	}
+	return login
+}
+
+func (g *loginGuard) stats() LoginStats {
+	now := g.now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.fails, g.lockouts = lastHour(g.fails, now), lastHour(g.lockouts, now)
+	st := LoginStats{FailsLastHour: len(g.fails), LockoutsLastHour: len(g.lockouts)}
+	for _, until := range g.locked {
+		if now.Before(until) {
+			st.LockedAccounts++
+		}
+	}
+	return st
+}
+
+// lastHour drops the leading times older than an hour (ts is ascending).
+func lastHour(ts []time.Time, now time.Time) []time.Time {
+	i := 0
+	for i < len(ts) && now.Sub(ts[i]) >= time.Hour {
+		i++
+	}
+	return ts[i:]
+}
+
+// seconds rounds d up to whole seconds for Retry-After.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
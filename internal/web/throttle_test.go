@@ -0,0 +1,127 @@
+package web
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Weruminger/go-ad-admin/internal/config"
+	"github.com/Weruminger/go-ad-admin/internal/errs"
+)
+
+func TestTokenBucket_Refill(t *testing.T) {
+	now := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	tb := newTokenBucket(6, 3) // one token every 10s
+	for i := 0; i < 3; i++ {
+		if wait := tb.take("ip", now); wait != 0 {
+			t.Fatalf("burst %d: wait %s", i, wait)
+		}
+	}
+	if wait := tb.take("ip", now); wait != 10*time.Second {
+		t.Fatalf("empty bucket: wait %s", wait)
+	}
+	if wait := tb.take("other", now); wait != 0 {
+		t.Fatal("keys must not share a bucket")
+	}
+	now = now.Add(10 * time.Second)
+	if wait := tb.take("ip", now); wait != 0 {
+		t.Fatalf("after refill: wait %s", wait)
+	}
+	now = now.Add(time.Hour)
+	tb.take("x", now)
+	if _, ok := tb.buckets["ip"]; ok {
+		t.Fatal("full bucket not swept")
+	}
+}
+
+func TestLoginGuard_Lockout(t *testing.T) {
+	now := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	cfg := *config.NewDefaultConfig()
+	cfg.LoginRate, cfg.LoginBurst = 600, 100
+	cfg.LockoutThreshold, cfg.LockoutWindow, cfg.LockoutDuration = 3, 10*time.Minute, 15*time.Minute
+	g := newLoginGuard(cfg)
+	g.now = func() time.Time { return now }
+
+	// failures outside the window do not add up
+	g.failed("anna")
+	now = now.Add(11 * time.Minute)
+	g.failed("Anna")
+	if locked, _ := g.failed("anna"); locked {
+		t.Fatal("locked with only 2 failures in the window")
+	}
+	locked, until := g.failed("ANNA")
+	if !locked || !until.Equal(now.Add(15*time.Minute)) {
+		t.Fatalf("want lockout until %s, got %v %s", now.Add(15*time.Minute), locked, until)
+	}
+	err := g.check("192.0.2.1", "anna")
+	if !errs.IsCode(err, errs.RateLimited) || err.(*errs.E).Fields["retryAfter"] != 900 || err.(*errs.E).Fields["reason"] != "lockout" {
+		t.Fatalf("locked user: %v", err)
+	}
+	if err := g.check("192.0.2.1", "bob"); err != nil {
+		t.Fatalf("other users are not affected: %v", err)
+	}
+	if st := g.stats(); st.FailsLastHour != 4 || st.LockoutsLastHour != 1 || st.LockedAccounts != 1 {
+		t.Fatalf("stats %+v", st)
+	}
+
+	now = now.Add(15 * time.Minute)
+	if err := g.check("192.0.2.1", "anna"); err != nil {
+		t.Fatalf("lock expired: %v", err)
+	}
+	now = now.Add(time.Hour)
+	if st := g.stats(); st != (LoginStats{}) {
+		t.Fatalf("stats after an hour %+v", st)
+	}
+}
+
+func TestLoginGuard_SpellingsOfOneAccount(t *testing.T) {
+	now := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	cfg := *config.NewDefaultConfig()
+	cfg.LoginRate, cfg.LoginBurst = 600, 100
+	cfg.LockoutThreshold, cfg.LockoutWindow, cfg.LockoutDuration = 3, 10*time.Minute, 15*time.Minute
+	g := newLoginGuard(cfg)
+	g.now = func() time.Time { return now }
+
+	g.failed("anna")
+	g.failed("anna@example.com")
+	if locked, _ := g.failed(" Anna "); !locked {
+		t.Fatal("three spellings of anna did not lock the account")
+	}
+	for _, login := range []string{"anna", "ANNA@EXAMPLE.COM", "anna\t", " anna @example.com"} {
+		if err := g.check("192.0.2.1", login); !errs.IsCode(err, errs.RateLimited) || err.(*errs.E).Fields["reason"] != "lockout" {
+			t.Fatalf("%q: %v", login, err)
+		}
+	}
+
+	// the per-user bucket is shared the same way
+	cfg.LoginRate, cfg.LoginBurst = 60, 2
+	g = newLoginGuard(cfg)
+	g.now = func() time.Time { return now }
+	g.check("192.0.2.1", "dora")
+	g.check("192.0.2.2", "dora@example.com")
+	if err := g.check("192.0.2.3", "Dora "); !errs.IsCode(err, errs.RateLimited) || err.(*errs.E).Fields["reason"] != "user" {
+		t.Fatalf("per user: %v", err)
+	}
+}
+
+func TestLoginGuard_RateLimits(t *testing.T) {
+	now := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	cfg := *config.NewDefaultConfig()
+	cfg.LoginRate, cfg.LoginBurst = 60, 2
+	g := newLoginGuard(cfg)
+	g.now = func() time.Time { return now }
+
+	g.check("192.0.2.1", "anna")
+	g.check("192.0.2.1", "bob")
+	if err := g.check("192.0.2.1", "carl"); !errs.IsCode(err, errs.RateLimited) || err.(*errs.E).Fields["reason"] != "ip" {
+		t.Fatalf("per IP: %v", err)
+	}
+	g.check("192.0.2.2", "dora")
+	g.check("192.0.2.3", "dora")
+	if err := g.check("192.0.2.4", "dora"); !errs.IsCode(err, errs.RateLimited) || err.(*errs.E).Fields["reason"] != "user" {
+		t.Fatalf("per user: %v", err)
+	}
+	now = now.Add(time.Second)
+	if err := g.check("192.0.2.1", "carl"); err != nil {
+		t.Fatalf("after refill: %v", err)
+	}
+}
@@ -0,0 +1,9 @@
+// Package templates embeds the SSR page templates into the binary.
+package templates
+
+import "embed"
+
+// FS holds layout.html and one file per page.
+//
+//go:embed *.html
+var FS embed.FS